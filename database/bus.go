@@ -0,0 +1,99 @@
+package database
+
+import (
+	"mygram/entity"
+	"sync"
+)
+
+// DefaultSubscriptionBuffer is how many events a subscriber may fall behind
+// by before it is dropped.
+const DefaultSubscriptionBuffer = 64
+
+// Events is the bus the write paths publish every stored notification to.
+var Events = NewBus()
+
+// Bus hands notifications, once stored, to the subscriptions of their user.
+// Publishing never waits for a subscriber: one that falls too far behind is
+// dropped, and has to catch up from GET /notifications.
+type Bus struct {
+	mu   sync.Mutex
+	subs map[int64]map[*Subscription]bool
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[int64]map[*Subscription]bool{}}
+}
+
+// Subscription receives the notifications of one user on C, until it is
+// closed or dropped, which closes C.
+type Subscription struct {
+	C <-chan entity.Notification
+
+	c      chan entity.Notification
+	bus    *Bus
+	userid int64
+	// lagged is set when the bus dropped the subscription. Guarded by bus.mu.
+	lagged bool
+}
+
+// Subscribe starts receiving the notifications of userid, buffering up to
+// buffer of them.
+func (b *Bus) Subscribe(userid int64, buffer int) *Subscription {
+	c := make(chan entity.Notification, buffer)
+	s := &Subscription{C: c, c: c, bus: b, userid: userid}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs[userid] == nil {
+		b.subs[userid] = map[*Subscription]bool{}
+	}
+	b.subs[userid][s] = true
+	return s
+}
+
+// Publish hands n to the subscriptions of n.UserID. A subscription whose
+// buffer is full is dropped rather than waited for.
+func (b *Bus) Publish(n entity.Notification) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs[n.UserID] {
+		select {
+		case s.c <- n:
+		default:
+			s.lagged = true
+			b.remove(s)
+		}
+	}
+}
+
+// Subscribers counts the subscriptions of userid.
+func (b *Bus) Subscribers(userid int64) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs[userid])
+}
+
+// remove closes s. Callers hold b.mu.
+func (b *Bus) remove(s *Subscription) {
+	if !b.subs[s.userid][s] {
+		return
+	}
+	delete(b.subs[s.userid], s)
+	if len(b.subs[s.userid]) == 0 {
+		delete(b.subs, s.userid)
+	}
+	close(s.c)
+}
+
+// Close stops the subscription. It may be called more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
+
+// Lagged tells whether the subscription was dropped for falling behind.
+func (s *Subscription) Lagged() bool {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.lagged
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"mygram/entity"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	mine := bus.Subscribe(1, 2)
+	other := bus.Subscribe(2, 2)
+	defer other.Close()
+	assert.Equal(t, 1, bus.Subscribers(1))
+
+	bus.Publish(entity.Notification{ID: 1, UserID: 1})
+	assert.Equal(t, int64(1), (<-mine.C).ID)
+	assert.Empty(t, other.C)
+
+	// a subscriber that falls behind is dropped, not waited for
+	for id := int64(2); id <= 4; id++ {
+		bus.Publish(entity.Notification{ID: id, UserID: 1})
+	}
+	var got []int64
+	for n := range mine.C {
+		got = append(got, n.ID)
+	}
+	assert.Equal(t, []int64{2, 3}, got)
+	assert.True(t, mine.Lagged())
+	assert.Equal(t, 0, bus.Subscribers(1))
+	mine.Close()
+
+	other.Close()
+	other.Close()
+	_, ok := <-other.C
+	assert.False(t, ok)
+	assert.False(t, other.Lagged())
+}
+
+func TestDatabase_PublishAfterCommit(t *testing.T) {
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	sub := Events.Subscribe(2, 1)
+	defer sub.Close()
+	comment := mock.NewRows([]string{"id", "message", "photoid", "userid", "parentid", "createdat"}).
+		AddRow(5, "@ann", 1, 1, nil, time.Now())
+
+	mock.ExpectQuery(regexp.QuoteMeta("select id from photos where id = @ID")).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("insert into comments")).
+		WillReturnRows(comment)
+	mock.ExpectQuery(regexp.QuoteMeta("select userid from photos where id = @id")).
+		WillReturnRows(mock.NewRows([]string{"userid"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta("insert into notifications")).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectQuery(regexp.QuoteMeta("select id, username from users")).
+		WillReturnError(errors.New("db down"))
+	mock.ExpectRollback()
+	_, err := dbtes.PostComment(ctx, 1, entity.CommentPost{Message: "@ann", PhotoID: 1})
+	assert.EqualError(t, err, "db down")
+	assert.Empty(t, sub.C)
+	assert.Empty(t, dbtes.committed)
+
+	comment = mock.NewRows([]string{"id", "message", "photoid", "userid", "parentid", "createdat"}).
+		AddRow(6, "nice", 1, 1, nil, time.Now())
+	mock.ExpectQuery(regexp.QuoteMeta("select id from photos where id = @ID")).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("insert into comments")).
+		WillReturnRows(comment)
+	mock.ExpectQuery(regexp.QuoteMeta("select userid from photos where id = @id")).
+		WillReturnRows(mock.NewRows([]string{"userid"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta("insert into notifications")).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(8))
+	expectOutbox(mock, entity.EventCommentCreated)
+	mock.ExpectCommit()
+	_, err = dbtes.PostComment(ctx, 1, entity.CommentPost{Message: "nice", PhotoID: 1})
+	require.NoError(t, err)
+	require.Len(t, sub.C, 1)
+	n := <-sub.C
+	assert.Equal(t, int64(8), n.ID)
+	assert.Equal(t, entity.NotificationComment, n.Type)
+	assert.False(t, n.CreatedAt.IsZero())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"mygram/entity"
 	"strings"
 	"time"
@@ -10,134 +11,308 @@ import (
 
 func (s *Database) PostComment(ctx context.Context, userid int64, i entity.CommentPost) (*entity.Comment, error) {
 	result := &entity.Comment{}
-	qry := "insert into comments (message, photoid, userid, createdat, updatedat) values (@message, @photoid, @userid, @createdat, @updatedat); select id, message, photoid, userid, createdat from comments where id = SCOPE_IDENTITY()"
+	if err := s.checkPhotoExists(ctx, int64(i.PhotoID)); err != nil {
+		return nil, err
+	}
+	var rootid *int64
+	if i.ParentCommentID != nil {
+		id, err := s.commentRoot(ctx, *i.ParentCommentID, int64(i.PhotoID))
+		if err != nil {
+			return nil, err
+		}
+		rootid = &id
+	}
+	qry := "insert into comments (message, photoid, userid, parentid, rootid, createdat, updatedat) values (@message, @photoid, @userid, @parentid, @rootid, @createdat, @updatedat)" +
+		s.sqlDialect().insertReturning("comments", "id, message, photoid, userid, parentid, createdat")
 	now := time.Now()
-	rows, err := s.SqlDb.QueryContext(ctx, qry,
-		sql.Named("message", i.Message),
-		sql.Named("photoid", i.PhotoID),
-		sql.Named("userid", userid),
-		sql.Named("createdat", now),
-		sql.Named("updatedat", now))
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := s.txQueryContext(ctx, tx, qry,
+			sql.Named("message", i.Message),
+			sql.Named("photoid", i.PhotoID),
+			sql.Named("userid", userid),
+			sql.Named("parentid", i.ParentCommentID),
+			sql.Named("rootid", rootid),
+			sql.Named("createdat", now),
+			sql.Named("updatedat", now))
+		if err != nil {
+			return err
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			err := rows.Scan(
+				&result.ID,
+				&result.Message,
+				&result.PhotoID,
+				&result.UserID,
+				&result.ParentCommentID,
+				&result.CreatedAt,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return s.translateError(err)
+		}
+		rows.Close()
+		owner, err := s.photoOwner(ctx, tx, result.PhotoID)
+		if err != nil {
+			return err
+		}
+		if err := s.notify(ctx, tx, entity.NewCommentNotification(owner, userid, result.PhotoID, result.ID), now); err != nil {
+			return err
+		}
+		result.Mentions, err = s.setMentions(ctx, tx, mentionSource{actorID: userid, photoID: result.PhotoID, commentID: &result.ID}, i.Message, true, now)
+		if err != nil {
+			return err
+		}
+		return s.addToOutbox(ctx, tx, entity.EventCommentCreated, result, now)
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	return result, nil
+}
+
+// commentRoot is the top-level comment of the thread a reply to parentid
+// joins. It returns ErrForeignKey unless the parent is a live comment on
+// photoid.
+func (s *Database) commentRoot(ctx context.Context, parentid int64, photoid int64) (int64, error) {
+	var rootid int64
+	rows, err := s.queryContext(ctx, "select coalesce(rootid, id) from comments where id = @ID and photoid = @photoid and deletedat is null",
+		sql.Named("ID", parentid),
+		sql.Named("photoid", photoid))
+	if err != nil {
+		return 0, err
+	}
 	defer rows.Close()
 	for rows.Next() {
-		err := rows.Scan(
-			&result.ID,
-			&result.Message,
-			&result.PhotoID,
-			&result.UserID,
-			&result.CreatedAt,
-		)
-		if err != nil {
-			return nil, err
+		if err := rows.Scan(&rootid); err != nil {
+			return 0, err
 		}
 	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if rootid == 0 {
+		return 0, fmt.Errorf("%w: comment %d is not a comment on photo %d", ErrForeignKey, parentid, photoid)
+	}
+	return rootid, nil
+}
 
-	return result, nil
+// commentGetOutputQuery reads entity.CommentGetOutput rows for scanCommentGetOutput.
+// Tombstones have no user, so users is outer joined.
+const commentGetOutputQuery = "select c.id, c.message, c.photoid, coalesce(c.userid, 0), c.parentid, c.createdat, c.updatedat, c.deletedat," +
+	" p.title, p.caption, p.photourl," +
+	" coalesce(u.email, ''), coalesce(u.username, '') from comments c" +
+	" join photos p on c.photoid=p.id" +
+	" left join users u on c.userid=u.id"
+
+func scanCommentGetOutput(rows *sql.Rows) (entity.CommentGetOutput, error) {
+	var row entity.CommentGetOutput
+	err := rows.Scan(
+		&row.ID,
+		&row.Message,
+		&row.PhotoID,
+		&row.UserID,
+		&row.ParentCommentID,
+		&row.CreatedAt,
+		&row.UpdatedAt,
+		&row.DeletedAt,
+		&row.Photo.Title,
+		&row.Photo.Caption,
+		&row.Photo.PhotoUrl,
+		&row.User.Email,
+		&row.User.Username,
+	)
+	row.User.ID = row.UserID
+	row.Photo.UserID = row.UserID
+	row.Photo.ID = row.PhotoID
+	return row, err
 }
 
-func (s *Database) GetComments(ctx context.Context) ([]entity.CommentGetOutput, error) {
+// commentSorts are the columns GET /comments may be sorted by.
+var commentSorts = map[string]sortColumn[entity.CommentGetOutput]{
+	entity.SortCreatedAt: {"c.createdat", func(c entity.CommentGetOutput) interface{} { return c.CreatedAt }},
+	entity.SortUpdatedAt: {"c.updatedat", func(c entity.CommentGetOutput) interface{} { return c.UpdatedAt }},
+}
+
+func (s *Database) GetComments(ctx context.Context, filter entity.CommentFilter, page entity.PageRequest) (*entity.Page[entity.CommentGetOutput], error) {
 	var result []entity.CommentGetOutput
+	q, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
+	value, err := sortBy(&q, filter.Sort, commentSorts)
+	if err != nil {
+		return nil, err
+	}
+	var where conditions
+	if filter.PhotoID != 0 {
+		where.add("c.photoid = @photoid", sql.Named("photoid", filter.PhotoID))
+	}
+	if filter.UserID != 0 {
+		where.add("c.userid = @userid", sql.Named("userid", filter.UserID))
+	}
+	if filter.ParentID != 0 {
+		where.add("c.parentid = @parentid", sql.Named("parentid", filter.ParentID))
+	}
+	if filter.TopLevel {
+		where.add("c.parentid is null")
+	}
+	if keyset := q.where("c.id"); keyset != "" {
+		where.add(keyset, sql.Named("cursor", q.cursor.ID), sql.Named("cursorvalue", q.cursor.value()))
+	}
 	var qry strings.Builder
-	qry.WriteString("select c.id, c.message, c.photoid, c.userid, c.createdat, c.updatedat,")
-	qry.WriteString(" p.title, p.caption, p.photourl,")
-	qry.WriteString(" u.email, u.username from comments c")
-	qry.WriteString(" join photos p on c.photoid=p.id")
-	qry.WriteString(" join users u on c.userid=u.id")
+	qry.WriteString(commentGetOutputQuery)
+	qry.WriteString(where.String())
+	qry.WriteString(q.orderBy("c.id"))
+	qry.WriteString(s.sqlDialect().limit("@limit"))
 
-	rows, err := s.SqlDb.QueryContext(ctx, qry.String())
+	rows, err := s.queryContext(ctx, qry.String(), append(where.args, sql.Named("limit", q.fetch()))...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var row entity.CommentGetOutput
-		err := rows.Scan(
-			&row.ID,
-			&row.Message,
-			&row.PhotoID,
-			&row.UserID,
-			&row.CreatedAt,
-			&row.UpdatedAt,
-			&row.Photo.Title,
-			&row.Photo.Caption,
-			&row.Photo.PhotoUrl,
-			&row.User.Email,
-			&row.User.Username,
-		)
+		row, err := scanCommentGetOutput(rows)
 		if err != nil {
 			return nil, err
 		}
-		row.User.ID = row.UserID
-		row.Photo.UserID = row.UserID
-		row.Photo.ID = row.PhotoID
 		result = append(result, row)
 	}
-	return result, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.withCommentMentions(ctx, result); err != nil {
+		return nil, err
+	}
+	return makePage(result, q, func(c entity.CommentGetOutput) int64 { return c.ID }, value), nil
 }
 
-func (s *Database) GetCommentByID(ctx context.Context, id int64) (*entity.Comment, error) {
-	result := &entity.Comment{}
+func (s *Database) GetCommentByID(ctx context.Context, id int64) (*entity.CommentGetOutput, error) {
+	result := &entity.CommentGetOutput{}
 
-	rows, err := s.SqlDb.QueryContext(ctx, "select id, message, photoid, userid, createdat, updatedat from comments where id = @ID",
+	rows, err := s.queryContext(ctx, commentGetOutputQuery+" where c.id = @ID",
 		sql.Named("ID", id))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		err := rows.Scan(
-			&result.ID,
-			&result.Message,
-			&result.PhotoID,
-			&result.UserID,
-			&result.CreatedAt,
-			&result.UpdatedAt,
-		)
+		row, err := scanCommentGetOutput(rows)
 		if err != nil {
 			return nil, err
 		}
+		result = &row
 	}
-	return result, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if result.ID == 0 {
+		return nil, ErrNotFound
+	}
+	one := []entity.CommentGetOutput{*result}
+	if err := s.withCommentMentions(ctx, one); err != nil {
+		return nil, err
+	}
+	return &one[0], nil
 }
 
 func (s *Database) UpdateComment(ctx context.Context, userid int64, id int64, message string) (*entity.Comment, error) {
 	result := &entity.Comment{}
 	now := time.Now()
-	qry := "update comments set message=@message, updatedat=@updatedat where id = @ID and userid = userid; select id, userid, photoid, message, updatedat from comments where id = @ID"
-	rows, err := s.SqlDb.QueryContext(ctx, qry,
-		sql.Named("message", message),
-		sql.Named("updatedat", now),
-		sql.Named("userid", userid),
-		sql.Named("ID", id))
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		err := rows.Scan(
-			&result.ID,
-			&result.UserID,
-			&result.PhotoID,
-			&result.Message,
-			&result.UpdatedAt,
-		)
+	qry := "update comments set message=@message, updatedat=@updatedat where id = @ID and userid = @userid" +
+		s.sqlDialect().updateReturning("comments", "id, userid, photoid, message, updatedat", "id = @ID")
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := s.txQueryContext(ctx, tx, qry,
+			sql.Named("message", message),
+			sql.Named("updatedat", now),
+			sql.Named("userid", userid),
+			sql.Named("ID", id))
 		if err != nil {
-			return nil, err
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			err := rows.Scan(
+				&result.ID,
+				&result.UserID,
+				&result.PhotoID,
+				&result.Message,
+				&result.UpdatedAt,
+			)
+			if err != nil {
+				return err
+			}
 		}
+		if err := rows.Err(); err != nil {
+			return s.translateError(err)
+		}
+		rows.Close()
+		if result.ID == 0 {
+			return ErrNotFound
+		}
+		result.Mentions, err = s.setMentions(ctx, tx, mentionSource{actorID: result.UserID, photoID: result.PhotoID, commentID: &result.ID}, message, false, now)
+		if err != nil {
+			return err
+		}
+		return s.addToOutbox(ctx, tx, entity.EventCommentUpdated, result, now)
+	})
+	if err != nil {
+		return nil, err
 	}
 	return result, nil
 }
 
+// DeleteComment deletes a comment, or leaves a tombstone in its place when it
+// has replies.
 func (s *Database) DeleteComment(ctx context.Context, userid int64, id int64) (string, error) {
 	var result string
-	qry := "delete from comments where id=@id and userid = @userid"
-	_, err := s.SqlDb.ExecContext(ctx, qry,
+	qry := []string{
+		// A tombstone has no message left to mention anyone in.
+		"delete from mentions where commentid in (select id from comments where id=@id and userid=@userid)",
+		"delete from notifications where commentid in (select id from comments where id=@id and userid=@userid)",
+		"update comments set userid=null, message='', deletedat=@now, updatedat=@now" +
+			" where id=@id and userid=@userid and exists (select 1 from comments r where r.parentid=@id)",
+		// A tombstone no longer has userid, so only a comment without replies is left.
+		"delete from comments where id=@id and userid=@userid",
+	}
+	now := time.Now()
+	args := []interface{}{
+		sql.Named("now", now),
 		sql.Named("userid", userid),
-		sql.Named("id", id))
+		sql.Named("id", id),
+	}
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		parent, err := s.commentParent(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		var n, deleted int64
+		for _, stmt := range qry {
+			res, err := s.txExecContext(ctx, tx, stmt, args...)
+			if err != nil {
+				return err
+			}
+			deleted, err = res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			n += deleted
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		if deleted > 0 {
+			if err := s.pruneTombstones(ctx, tx, parent); err != nil {
+				return err
+			}
+		}
+		return s.addToOutbox(ctx, tx, entity.EventCommentDeleted, entity.DeletedResource{ID: id, UserID: userid}, now)
+	})
 	if err != nil {
 		return "", err
 	}
@@ -146,3 +321,199 @@ func (s *Database) DeleteComment(ctx context.Context, userid int64, id int64) (s
 
 	return result, nil
 }
+
+// commentParent is the comment comment id replies to, if any.
+func (s *Database) commentParent(ctx context.Context, tx *sql.Tx, id int64) (sql.NullInt64, error) {
+	var parent sql.NullInt64
+	rows, err := s.txQueryContext(ctx, tx, "select parentid from comments where id=@id", sql.Named("id", id))
+	if err != nil {
+		return parent, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&parent); err != nil {
+			return parent, err
+		}
+	}
+	return parent, rows.Err()
+}
+
+// pruneTombstones deletes the tombstone parent once its last reply is gone,
+// then its own parent in the same way, up the thread.
+func (s *Database) pruneTombstones(ctx context.Context, tx *sql.Tx, parent sql.NullInt64) error {
+	for parent.Valid {
+		id := parent.Int64
+		var err error
+		parent, err = s.commentParent(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		res, err := s.txExecContext(ctx, tx, "delete from comments where id=@id and deletedat is not null"+
+			" and not exists (select 1 from comments r where r.parentid=@id)",
+			sql.Named("id", id))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPhotoExists returns ErrForeignKey unless photo id exists, so a comment
+// can't be left pointing at nothing.
+func (s *Database) checkPhotoExists(ctx context.Context, id int64) error {
+	ok, err := s.exists(ctx, "photos", id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: photo %d does not exist", ErrForeignKey, id)
+	}
+	return nil
+}
+
+// exists tells whether table has a row with the given id.
+func (s *Database) exists(ctx context.Context, table string, id int64) (bool, error) {
+	rows, err := s.queryContext(ctx, "select id from "+table+" where id = @ID",
+		sql.Named("ID", id))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+	return true, nil
+}
+
+// GetPhotoComments is one page of the comments on a photo, ErrNotFound when
+// there is no such photo.
+func (s *Database) GetPhotoComments(ctx context.Context, photoid int64, page entity.PageRequest) (*entity.Page[entity.CommentGetOutput], error) {
+	result, err := s.GetComments(ctx, entity.CommentFilter{PhotoID: photoid}, page)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Items) == 0 {
+		if ok, err := s.exists(ctx, "photos", photoid); err != nil || !ok {
+			return nil, notFoundUnless(err)
+		}
+	}
+	return result, nil
+}
+
+// GetCommentReplies is one page of the replies to a comment, ErrNotFound
+// when there is no such comment.
+func (s *Database) GetCommentReplies(ctx context.Context, commentid int64, page entity.PageRequest) (*entity.Page[entity.CommentGetOutput], error) {
+	result, err := s.GetComments(ctx, entity.CommentFilter{ParentID: commentid}, page)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Items) == 0 {
+		if ok, err := s.exists(ctx, "comments", commentid); err != nil || !ok {
+			return nil, notFoundUnless(err)
+		}
+	}
+	return result, nil
+}
+
+// MaxThreadReplies caps the replies read with each top-level comment in
+// GetPhotoCommentThreads.
+const MaxThreadReplies = 100
+
+// GetPhotoCommentThreads is one page of the top-level comments on a photo,
+// each with its first MaxThreadReplies replies, ErrNotFound when there is no
+// such photo.
+func (s *Database) GetPhotoCommentThreads(ctx context.Context, photoid int64, page entity.PageRequest) (*entity.Page[entity.CommentThread], error) {
+	roots, err := s.GetComments(ctx, entity.CommentFilter{PhotoID: photoid, TopLevel: true}, page)
+	if err != nil {
+		return nil, err
+	}
+	if len(roots.Items) == 0 {
+		if ok, err := s.exists(ctx, "photos", photoid); err != nil || !ok {
+			return nil, notFoundUnless(err)
+		}
+		return threadPage(roots, nil), nil
+	}
+	// The page's threads are the photo's top-level comments in an id range,
+	// so their replies are read with a range on rootid. One reply past the
+	// cap tells threadPage a thread was cut short.
+	first, last := roots.Items[0].ID, roots.Items[0].ID
+	for _, c := range roots.Items {
+		if c.ID < first {
+			first = c.ID
+		}
+		if c.ID > last {
+			last = c.ID
+		}
+	}
+	var replies []entity.CommentGetOutput
+	rows, err := s.queryContext(ctx, commentGetOutputQuery+" where c.photoid = @photoid and c.id in"+
+		" (select id from (select id, row_number() over (partition by rootid order by id) as n from comments"+
+		" where photoid = @photoid and rootid between @first and @last) r where n <= @max) order by c.id",
+		sql.Named("photoid", photoid),
+		sql.Named("first", first),
+		sql.Named("last", last),
+		sql.Named("max", MaxThreadReplies+1))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		row, err := scanCommentGetOutput(rows)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.withCommentMentions(ctx, replies); err != nil {
+		return nil, err
+	}
+	return threadPage(roots, replies), nil
+}
+
+// threadPage hangs replies, in id order, under the comments of roots. A
+// thread keeps its first MaxThreadReplies replies and is marked MoreReplies
+// when there are more. A reply comes after its parent in id order, so the
+// replies kept always hang together.
+func threadPage(roots *entity.Page[entity.CommentGetOutput], replies []entity.CommentGetOutput) *entity.Page[entity.CommentThread] {
+	root := map[int64]int64{}
+	for _, c := range roots.Items {
+		root[c.ID] = c.ID
+	}
+	count := map[int64]int{}
+	more := map[int64]bool{}
+	children := map[int64][]entity.CommentGetOutput{}
+	for _, r := range replies {
+		rootid, ok := root[*r.ParentCommentID]
+		if !ok {
+			continue
+		}
+		if count[rootid] == MaxThreadReplies {
+			more[rootid] = true
+			continue
+		}
+		count[rootid]++
+		root[r.ID] = rootid
+		children[*r.ParentCommentID] = append(children[*r.ParentCommentID], r)
+	}
+	var thread func(c entity.CommentGetOutput, depth int) entity.CommentThread
+	thread = func(c entity.CommentGetOutput, depth int) entity.CommentThread {
+		t := entity.CommentThread{CommentGetOutput: c, Depth: depth, Replies: []entity.CommentThread{}}
+		for _, r := range children[c.ID] {
+			t.Replies = append(t.Replies, thread(r, depth+1))
+		}
+		return t
+	}
+	page := &entity.Page[entity.CommentThread]{Items: []entity.CommentThread{}, NextCursor: roots.NextCursor, PrevCursor: roots.PrevCursor}
+	for _, c := range roots.Items {
+		t := thread(c, 0)
+		t.MoreReplies = more[c.ID]
+		page.Items = append(page.Items, t)
+	}
+	return page
+}
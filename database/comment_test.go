@@ -5,7 +5,6 @@ import (
 	"errors"
 	"mygram/entity"
 	"regexp"
-	"strings"
 	"testing"
 	"time"
 
@@ -23,7 +22,8 @@ func TestDatabase_PostComment(t *testing.T) {
 	dbtes := Database{
 		SqlDb: db,
 	}
-	qry := "insert into comments (message, photoid, userid, createdat, updatedat) values (@message, @photoid, @userid, @createdat, @updatedat); select id, message, photoid, userid, createdat from comments where id = SCOPE_IDENTITY()"
+	qry := "insert into comments (message, photoid, userid, parentid, rootid, createdat, updatedat) values (@message, @photoid, @userid, @parentid, @rootid, @createdat, @updatedat); select id, message, photoid, userid, parentid, createdat from comments where id = SCOPE_IDENTITY()"
+	photoQry := "select id from photos where id = @ID"
 
 	inp := entity.CommentPost{
 		Message: "Foto Kopi",
@@ -31,9 +31,14 @@ func TestDatabase_PostComment(t *testing.T) {
 	}
 
 	t.Run("postcomment database down", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(photoQry)).
+			WithArgs(int64(inp.PhotoID)).
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Message, inp.PhotoID, int64(1), time.Now(), time.Now()).
+			WithArgs(inp.Message, inp.PhotoID, int64(1), nil, nil, AnyTime{}, AnyTime{}).
 			WillReturnError(errors.New("db down"))
+		mock.ExpectRollback()
 		out, err := dbtes.PostComment(ctx, int64(1), inp)
 		assert.Error(t, err)
 		assert.Nil(t, out)
@@ -41,22 +46,48 @@ func TestDatabase_PostComment(t *testing.T) {
 	})
 
 	t.Run("postcomment required userid", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(photoQry)).
+			WithArgs(int64(inp.PhotoID)).
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Message, inp.PhotoID, int64(0), time.Now(), time.Now()).
+			WithArgs(inp.Message, inp.PhotoID, int64(0), nil, nil, AnyTime{}, AnyTime{}).
 			WillReturnError(errors.New("required userid"))
+		mock.ExpectRollback()
 		out, err := dbtes.PostComment(ctx, int64(0), inp)
 		assert.Error(t, err)
 		assert.Nil(t, out)
 		assert.Equal(t, "required userid", err.Error())
 	})
 
+	t.Run("postcomment photo not found", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(photoQry)).
+			WithArgs(int64(inp.PhotoID)).
+			WillReturnRows(mock.NewRows([]string{"id"}))
+		out, err := dbtes.PostComment(ctx, int64(1), inp)
+		assert.Nil(t, out)
+		assert.ErrorIs(t, err, ErrForeignKey)
+	})
+
 	t.Run("postcomment success", func(t *testing.T) {
-		rows := mock.NewRows([]string{"id", "message", "photoid", "userid", "createdat"}).
-			AddRow(1, "Message nya apa", 1, 1, time.Now())
+		rows := mock.NewRows([]string{"id", "message", "photoid", "userid", "parentid", "createdat"}).
+			AddRow(1, "Message nya apa", 1, 1, nil, time.Now())
 
+		mock.ExpectQuery(regexp.QuoteMeta(photoQry)).
+			WithArgs(int64(inp.PhotoID)).
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Message, inp.PhotoID, int64(1), time.Now(), time.Now()).
+			WithArgs(inp.Message, inp.PhotoID, int64(1), nil, nil, AnyTime{}, AnyTime{}).
 			WillReturnRows(rows)
+		mock.ExpectQuery(regexp.QuoteMeta("select userid from photos where id = @id")).
+			WithArgs(int64(1)).
+			WillReturnRows(mock.NewRows([]string{"userid"}).AddRow(2))
+		mock.ExpectQuery(regexp.QuoteMeta("insert into notifications (userid, type, actorid, photoid, commentid, payload, createdat)")).
+			WithArgs(int64(2), "comment", int64(1), int64(1), int64(1), `{"photo_id":1,"comment_id":1}`, AnyTime{}).
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+		expectOutbox(mock, entity.EventCommentCreated)
+		mock.ExpectCommit()
 		out, err := dbtes.PostComment(ctx, int64(1), inp)
 		assert.NotNil(t, out)
 		assert.NoError(t, err)
@@ -72,29 +103,26 @@ func TestDatabase_GetComments(t *testing.T) {
 	dbtes := Database{
 		SqlDb: db,
 	}
-	var qry strings.Builder
-	qry.WriteString("select c.id, c.message, c.photoid, c.userid, c.createdat, c.updatedat,")
-	qry.WriteString(" p.title, p.caption, p.photourl,")
-	qry.WriteString(" u.email, u.username from comments c")
-	qry.WriteString(" join photos p on c.photoid=p.id")
-	qry.WriteString(" join users u on c.userid=u.id")
+	qry := regexp.QuoteMeta(commentGetOutputQuery)
 	t.Run("getcomments database down", func(t *testing.T) {
-		mock.ExpectQuery(qry.String()).
+		mock.ExpectQuery(qry).
 			WillReturnError(errors.New("db down"))
-		out, err := dbtes.GetComments(ctx)
+		out, err := dbtes.GetComments(ctx, entity.CommentFilter{}, entity.PageRequest{})
 		assert.Error(t, err)
 		assert.Nil(t, out)
 		assert.Equal(t, "db down", err.Error())
 	})
 
 	t.Run("getcomments success", func(t *testing.T) {
-		rows := mock.NewRows([]string{"id", "message", "photoid", "userid", "createdat", "updatedat", "title", "caption", "photourl", "email", "username"}).
-			AddRow(1, "Message nya apa", 1, 1, time.Now(), time.Now(), "Title photo", "Caption Photoo", "http://photourl.com/photourl.jpg", "deadapeipit@email.com", "deadapeipit")
+		rows := mock.NewRows([]string{"id", "message", "photoid", "userid", "parentid", "createdat", "updatedat", "deletedat", "title", "caption", "photourl", "email", "username"}).
+			AddRow(1, "Message nya apa", 1, 1, nil, time.Now(), time.Now(), nil, "Title photo", "Caption Photoo", "http://photourl.com/photourl.jpg", "deadapeipit@email.com", "deadapeipit")
 
-		mock.ExpectQuery(qry.String()).WillReturnRows(rows)
-		out, err := dbtes.GetComments(ctx)
+		mock.ExpectQuery(qry).WillReturnRows(rows)
+		expectMentions(mock, "m.commentid", mentionRows(mock).AddRow(1, 2, "ann", 8, 4), int64(1))
+		out, err := dbtes.GetComments(ctx, entity.CommentFilter{}, entity.PageRequest{})
 		assert.NotNil(t, out)
 		assert.NoError(t, err)
+		assert.Equal(t, []entity.Mention{{UserID: 2, Username: "ann", Offset: 8, Length: 4}}, out.Items[0].Mentions)
 	})
 }
 
@@ -107,7 +135,7 @@ func TestDatabase_GetCommentByID(t *testing.T) {
 	dbtes := Database{
 		SqlDb: db,
 	}
-	qry := "select id, message, photoid, userid, createdat, updatedat from comments where id = @ID"
+	qry := regexp.QuoteMeta(commentGetOutputQuery + " where c.id = @ID")
 	t.Run("getcommentbyid database down", func(t *testing.T) {
 		mock.ExpectQuery(qry).
 			WithArgs(int64(1)).
@@ -128,16 +156,27 @@ func TestDatabase_GetCommentByID(t *testing.T) {
 		assert.Equal(t, "required id", err.Error())
 	})
 
+	t.Run("getcommentbyid not found", func(t *testing.T) {
+		mock.ExpectQuery(qry).
+			WithArgs(int64(2)).
+			WillReturnRows(mock.NewRows([]string{"id", "message", "photoid", "userid", "parentid", "createdat", "updatedat", "deletedat", "title", "caption", "photourl", "email", "username"}))
+		out, err := dbtes.GetCommentByID(ctx, int64(2))
+		assert.Nil(t, out)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
 	t.Run("getcommentbyid success", func(t *testing.T) {
-		rows := mock.NewRows([]string{"id", "message", "photoid", "userid", "createdat", "updatedat"}).
-			AddRow(1, "Message nya apa", 1, 1, time.Now(), time.Now())
+		rows := mock.NewRows([]string{"id", "message", "photoid", "userid", "parentid", "createdat", "updatedat", "deletedat", "title", "caption", "photourl", "email", "username"}).
+			AddRow(1, "Message nya apa", 1, 1, nil, time.Now(), time.Now(), nil, "Title photo", "Caption Photoo", "http://photourl.com/photourl.jpg", "deadapeipit@email.com", "deadapeipit")
 
 		mock.ExpectQuery(qry).
 			WithArgs(int64(1)).
 			WillReturnRows(rows)
+		expectMentions(mock, "m.commentid", mentionRows(mock), int64(1))
 		out, err := dbtes.GetCommentByID(ctx, int64(1))
-		assert.NotNil(t, out)
 		assert.NoError(t, err)
+		assert.Equal(t, "deadapeipit", out.User.Username)
+		assert.Equal(t, "Title photo", out.Photo.Title)
 	})
 }
 
@@ -150,15 +189,17 @@ func TestDatabase_UpdateComment(t *testing.T) {
 	dbtes := Database{
 		SqlDb: db,
 	}
-	qry := "update comments set message=@message, updatedat=@updatedat where id = @ID and userid = userid; select id, userid, photoid, message, updatedat from comments where id = @ID"
+	qry := "update comments set message=@message, updatedat=@updatedat where id = @ID and userid = @userid; if @@ROWCOUNT > 0 select id, userid, photoid, message, updatedat from comments where id = @ID"
 	inp := entity.CommentPost{
 		Message: "Foto Kopi",
 		PhotoID: 1,
 	}
 	t.Run("updatecomment database down", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Message, time.Now(), int64(1), int64(1)).
+			WithArgs(inp.Message, AnyTime{}, int64(1), int64(1)).
 			WillReturnError(errors.New("db down"))
+		mock.ExpectRollback()
 		out, err := dbtes.UpdateComment(ctx, int64(1), int64(1), inp.Message)
 		assert.Error(t, err)
 		assert.Nil(t, out)
@@ -166,9 +207,11 @@ func TestDatabase_UpdateComment(t *testing.T) {
 	})
 
 	t.Run("updatecomment required id", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Message, time.Now(), int64(1), int64(0)).
+			WithArgs(inp.Message, AnyTime{}, int64(1), int64(0)).
 			WillReturnError(errors.New("required id"))
+		mock.ExpectRollback()
 		out, err := dbtes.UpdateComment(ctx, int64(1), int64(0), inp.Message)
 		assert.Error(t, err)
 		assert.Nil(t, out)
@@ -176,9 +219,11 @@ func TestDatabase_UpdateComment(t *testing.T) {
 	})
 
 	t.Run("updatecomment required userid", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Message, time.Now(), int64(0), int64(1)).
+			WithArgs(inp.Message, AnyTime{}, int64(0), int64(1)).
 			WillReturnError(errors.New("required userid"))
+		mock.ExpectRollback()
 		out, err := dbtes.UpdateComment(ctx, int64(0), int64(1), inp.Message)
 		assert.Error(t, err)
 		assert.Nil(t, out)
@@ -189,9 +234,16 @@ func TestDatabase_UpdateComment(t *testing.T) {
 		rows := mock.NewRows([]string{"id", "userid", "photoid", "message", "updatedat"}).
 			AddRow(1, 1, 1, "Foto kopi doang beneran cuk", time.Now())
 
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Message, time.Now(), int64(1), int64(1)).
+			WithArgs(inp.Message, AnyTime{}, int64(1), int64(1)).
 			WillReturnRows(rows)
+		// The message mentions no one, so no mention is left behind.
+		mock.ExpectExec(regexp.QuoteMeta("delete from mentions where commentid = @commentid")).
+			WithArgs(int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		expectOutbox(mock, entity.EventCommentUpdated)
+		mock.ExpectCommit()
 		out, err := dbtes.UpdateComment(ctx, int64(1), int64(1), inp.Message)
 		assert.NotNil(t, out)
 		assert.NoError(t, err)
@@ -207,11 +259,21 @@ func TestDatabase_DeleteComment(t *testing.T) {
 	dbtes := Database{
 		SqlDb: db,
 	}
-	qry := "delete from comments where id=@id and userid = @userid"
+	tombstone := regexp.QuoteMeta("update comments set userid=null, message='', deletedat=@now, updatedat=@now where id=@id and userid=@userid and exists (select 1 from comments r where r.parentid=@id)")
+	qry := regexp.QuoteMeta("delete from comments where id=@id and userid=@userid")
+	unmention := regexp.QuoteMeta("delete from mentions where commentid in (select id from comments where id=@id and userid=@userid)")
+	unnotify := regexp.QuoteMeta("delete from notifications where commentid in (select id from comments where id=@id and userid=@userid)")
+	parent := regexp.QuoteMeta("select parentid from comments where id=@id")
+	prune := regexp.QuoteMeta("delete from comments where id=@id and deletedat is not null and not exists (select 1 from comments r where r.parentid=@id)")
 	t.Run("deletecomment database down", func(t *testing.T) {
-		mock.ExpectExec(qry).
-			WithArgs(int64(1), int64(1)).
+		mock.ExpectBegin()
+		mock.ExpectQuery(parent).
+			WithArgs(int64(1)).
+			WillReturnRows(mock.NewRows([]string{"parentid"}))
+		mock.ExpectExec(unmention).
+			WithArgs(AnyTime{}, int64(1), int64(1)).
 			WillReturnError(errors.New("db down"))
+		mock.ExpectRollback()
 		out, err := dbtes.DeleteComment(ctx, int64(1), int64(1))
 		assert.Error(t, err)
 		assert.Equal(t, "", out)
@@ -219,9 +281,14 @@ func TestDatabase_DeleteComment(t *testing.T) {
 	})
 
 	t.Run("deletecomment required userid", func(t *testing.T) {
-		mock.ExpectExec(qry).
-			WithArgs(int64(0), int64(1)).
+		mock.ExpectBegin()
+		mock.ExpectQuery(parent).
+			WithArgs(int64(1)).
+			WillReturnRows(mock.NewRows([]string{"parentid"}))
+		mock.ExpectExec(unmention).
+			WithArgs(AnyTime{}, int64(0), int64(1)).
 			WillReturnError(errors.New("required userid"))
+		mock.ExpectRollback()
 		out, err := dbtes.DeleteComment(ctx, int64(0), int64(1))
 		assert.Error(t, err)
 		assert.Equal(t, "", out)
@@ -229,21 +296,119 @@ func TestDatabase_DeleteComment(t *testing.T) {
 	})
 
 	t.Run("deletecomment required id", func(t *testing.T) {
-		mock.ExpectExec(qry).
-			WithArgs(int64(1), int64(0)).
+		mock.ExpectBegin()
+		mock.ExpectQuery(parent).
+			WithArgs(int64(0)).
+			WillReturnRows(mock.NewRows([]string{"parentid"}))
+		mock.ExpectExec(unmention).
+			WithArgs(AnyTime{}, int64(1), int64(0)).
 			WillReturnError(errors.New("required id"))
+		mock.ExpectRollback()
 		out, err := dbtes.DeleteComment(ctx, int64(1), int64(0))
 		assert.Error(t, err)
 		assert.Equal(t, "", out)
 		assert.Equal(t, "required id", err.Error())
 	})
 
+	t.Run("deletecomment not found", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(parent).
+			WithArgs(int64(2)).
+			WillReturnRows(mock.NewRows([]string{"parentid"}))
+		mock.ExpectExec(unmention).
+			WithArgs(AnyTime{}, int64(1), int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(unnotify).
+			WithArgs(AnyTime{}, int64(1), int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(tombstone).
+			WithArgs(AnyTime{}, int64(1), int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(qry).
+			WithArgs(AnyTime{}, int64(1), int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		out, err := dbtes.DeleteComment(ctx, int64(1), int64(2))
+		assert.Equal(t, "", out)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("deletecomment with replies leaves a tombstone", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(parent).
+			WithArgs(int64(1)).
+			WillReturnRows(mock.NewRows([]string{"parentid"}))
+		mock.ExpectExec(unmention).
+			WithArgs(AnyTime{}, int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(unnotify).
+			WithArgs(AnyTime{}, int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(tombstone).
+			WithArgs(AnyTime{}, int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(qry).
+			WithArgs(AnyTime{}, int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		expectOutbox(mock, entity.EventCommentDeleted)
+		mock.ExpectCommit()
+		out, err := dbtes.DeleteComment(ctx, int64(1), int64(1))
+		assert.NotEmpty(t, out)
+		assert.NoError(t, err)
+	})
+
+	t.Run("deletecomment last reply prunes the tombstone", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(parent).
+			WithArgs(int64(2)).
+			WillReturnRows(mock.NewRows([]string{"parentid"}).AddRow(int64(1)))
+		mock.ExpectExec(unmention).
+			WithArgs(AnyTime{}, int64(1), int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(unnotify).
+			WithArgs(AnyTime{}, int64(1), int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(tombstone).
+			WithArgs(AnyTime{}, int64(1), int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(qry).
+			WithArgs(AnyTime{}, int64(1), int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(parent).
+			WithArgs(int64(1)).
+			WillReturnRows(mock.NewRows([]string{"parentid"}).AddRow(nil))
+		mock.ExpectExec(prune).
+			WithArgs(int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectOutbox(mock, entity.EventCommentDeleted)
+		mock.ExpectCommit()
+		out, err := dbtes.DeleteComment(ctx, int64(1), int64(2))
+		assert.NotEmpty(t, out)
+		assert.NoError(t, err)
+	})
+
 	t.Run("deletecomment success", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(parent).
+			WithArgs(int64(1)).
+			WillReturnRows(mock.NewRows([]string{"parentid"}))
+		mock.ExpectExec(unmention).
+			WithArgs(AnyTime{}, int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(unnotify).
+			WithArgs(AnyTime{}, int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(tombstone).
+			WithArgs(AnyTime{}, int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
 		mock.ExpectExec(qry).
-			WithArgs(int64(1), int64(1)).
+			WithArgs(AnyTime{}, int64(1), int64(1)).
 			WillReturnResult(sqlmock.NewResult(1, 1))
+		expectOutbox(mock, entity.EventCommentDeleted)
+		mock.ExpectCommit()
 		out, err := dbtes.DeleteComment(ctx, int64(1), int64(1))
 		assert.NotNil(t, out)
 		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
@@ -5,55 +5,157 @@ import (
 	"database/sql"
 	"fmt"
 	"mygram/entity"
+	"sync"
+	"time"
 
 	_ "github.com/denisenkom/go-mssqldb"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
 type DatabaseIface interface {
+	RevocationStore
+	WebhookOutbox
+
 	CloseConnection()
 	Login(ctx context.Context, userName string) (int64, string, error)
 	GetUserByID(ctx context.Context, userid int64) (*entity.User, error)
+	GetUserProfile(ctx context.Context, userid int64) (*entity.UserProfile, error)
+	GetUserProfileByUsername(ctx context.Context, username string) (*entity.UserProfile, error)
 	Register(ctx context.Context, user entity.UserRegister) (*entity.UserRegisterResp, error)
 	UpdateUser(ctx context.Context, userid int64, email string, username string) (*entity.User, error)
-	DeleteUser(ctx context.Context, userId int64) (string, error)
+	UpdateUserRole(ctx context.Context, userid int64, role entity.Role) (*entity.User, error)
+	DeleteUser(ctx context.Context, userId int64) (string, []string, error)
+
+	GetFollowers(ctx context.Context, userid int64, page entity.PageRequest) (*entity.Page[entity.FollowGetOutput], error)
+	GetFollowing(ctx context.Context, userid int64, page entity.PageRequest) (*entity.Page[entity.FollowGetOutput], error)
+	FollowUser(ctx context.Context, userid int64, followeeid int64) (*entity.UserFollows, error)
+	UnfollowUser(ctx context.Context, userid int64, followeeid int64) (*entity.UserFollows, error)
 
-	GetPhotos(ctx context.Context) ([]entity.PhotoGetOutput, error)
-	GetPhotoByID(ctx context.Context, id int64) (*entity.Photo, error)
+	PostRefreshToken(ctx context.Context, token entity.RefreshToken) (*entity.RefreshToken, error)
+	GetRefreshToken(ctx context.Context, tokenHash string) (*entity.RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, id int64) (bool, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userid int64) error
+
+	// The photo reads fill in liked_by_me for viewer, the logged on user.
+	GetPhotos(ctx context.Context, viewer int64, filter entity.PhotoFilter, page entity.PageRequest) (*entity.Page[entity.PhotoGetOutput], error)
+	GetUserPhotos(ctx context.Context, viewer int64, userid int64, page entity.PageRequest) (*entity.Page[entity.PhotoGetOutput], error)
+	GetPhotoByID(ctx context.Context, viewer int64, id int64) (*entity.PhotoGetOutput, error)
+	GetFeed(ctx context.Context, userid int64, page entity.PageRequest) (*entity.Page[entity.PhotoGetOutput], error)
+	GetTagPhotos(ctx context.Context, viewer int64, tag string, page entity.PageRequest) (*entity.Page[entity.PhotoGetOutput], error)
+	GetTrendingTags(ctx context.Context, since time.Time, limit int) ([]entity.TagCount, error)
+	GetNotifications(ctx context.Context, userid int64, filter entity.NotificationFilter, page entity.PageRequest) (*entity.Page[entity.Notification], error)
+	MarkNotificationsRead(ctx context.Context, userid int64, ids []int64) (*entity.NotificationReadOutput, error)
 	PostPhoto(ctx context.Context, userid int64, photo entity.PhotoPost) (*entity.Photo, error)
 	UpdatePhoto(ctx context.Context, userid int64, id int64, photo entity.PhotoPost) (*entity.Photo, error)
 	DeletePhoto(ctx context.Context, userid int64, id int64) (string, error)
+	SetPhotoVariants(ctx context.Context, id int64, photoURL string, state entity.ProcessingState, variants *entity.PhotoVariants) error
+	GetProcessingPhotos(ctx context.Context) ([]entity.Photo, error)
+
+	GetPhotoLikes(ctx context.Context, photoid int64, page entity.PageRequest) (*entity.Page[entity.LikeGetOutput], error)
+	LikePhoto(ctx context.Context, userid int64, photoid int64) (*entity.PhotoLikes, error)
+	UnlikePhoto(ctx context.Context, userid int64, photoid int64) (*entity.PhotoLikes, error)
 
-	GetComments(ctx context.Context) ([]entity.CommentGetOutput, error)
-	GetCommentByID(ctx context.Context, id int64) (*entity.Comment, error)
+	GetComments(ctx context.Context, filter entity.CommentFilter, page entity.PageRequest) (*entity.Page[entity.CommentGetOutput], error)
+	GetPhotoComments(ctx context.Context, photoid int64, page entity.PageRequest) (*entity.Page[entity.CommentGetOutput], error)
+	GetCommentByID(ctx context.Context, id int64) (*entity.CommentGetOutput, error)
+	GetCommentReplies(ctx context.Context, commentid int64, page entity.PageRequest) (*entity.Page[entity.CommentGetOutput], error)
+	GetPhotoCommentThreads(ctx context.Context, photoid int64, page entity.PageRequest) (*entity.Page[entity.CommentThread], error)
 	PostComment(ctx context.Context, userid int64, comment entity.CommentPost) (*entity.Comment, error)
 	UpdateComment(ctx context.Context, userid int64, id int64, message string) (*entity.Comment, error)
 	DeleteComment(ctx context.Context, userid int64, id int64) (string, error)
 
-	GetSocialMedias(ctx context.Context) ([]entity.SocialMediaGetOutput, error)
-	GetSocialMediaByID(ctx context.Context, id int64) (*entity.SocialMedia, error)
+	GetSocialMedias(ctx context.Context, filter entity.SocialMediaFilter, page entity.PageRequest) (*entity.Page[entity.SocialMediaGetOutput], error)
+	GetUserSocialMedias(ctx context.Context, userid int64, page entity.PageRequest) (*entity.Page[entity.SocialMediaGetOutput], error)
+	GetSocialMediaByID(ctx context.Context, id int64) (*entity.SocialMediaGetOutput, error)
 	PostSocialMedia(ctx context.Context, userid int64, socialmedia entity.SocialMediaPost) (*entity.SocialMedia, error)
 	UpdateSocialMedia(ctx context.Context, userid int64, id int64, socialmedia entity.SocialMediaPost) (*entity.SocialMedia, error)
 	DeleteSocialMedia(ctx context.Context, userid int64, id int64) (string, error)
+
+	// Webhooks are read back without their secret.
+	PostWebhook(ctx context.Context, userid int64, webhook entity.WebhookPost, secret string) (*entity.Webhook, error)
+	GetWebhooks(ctx context.Context, page entity.PageRequest) (*entity.Page[entity.Webhook], error)
+	GetWebhookByID(ctx context.Context, id int64) (*entity.Webhook, error)
+	DeleteWebhook(ctx context.Context, id int64) (string, error)
+	GetWebhookDeliveries(ctx context.Context, webhookid int64, status entity.DeliveryStatus, page entity.PageRequest) (*entity.Page[entity.WebhookDelivery], error)
+	RetryWebhookDelivery(ctx context.Context, id int64) (*entity.WebhookDelivery, error)
 }
 
 type Database struct {
-	SqlDb *sql.DB
+	SqlDb   *sql.DB
+	dialect dialect
+
+	mu sync.Mutex
+	// committed holds what to do once each open transaction commits.
+	committed map[*sql.Tx][]func()
 }
 
+// Drivers accepted by NewConnection, along with DriverMemory.
+const (
+	DriverSqlServer = "sqlserver"
+	DriverPostgres  = "postgres"
+	DriverSqlite    = "sqlite"
+)
+
 var SqlDatabase DatabaseIface
 
-func NewSqlConnection(connectionString string) DatabaseIface {
+func NewSqlConnection(connectionString string) (DatabaseIface, error) {
 
 	db, err := sql.Open("sqlserver", connectionString)
 	if err != nil {
-		fmt.Printf("[mssql] Error connecting to SQL Server: %v", err)
+		return nil, fmt.Errorf("[mssql] Error connecting to SQL Server: %w", err)
 	}
 	s := Database{}
 	s.SqlDb = db
 	s.SqlDb.SetMaxIdleConns(25)
 	s.SqlDb.SetMaxOpenConns(25)
 
-	return &s
+	return &s, nil
+}
+
+func NewPostgresConnection(connectionString string) (DatabaseIface, error) {
+
+	db, err := sql.Open("postgres", connectionString)
+	if err != nil {
+		return nil, fmt.Errorf("[postgres] Error connecting to PostgreSQL: %w", err)
+	}
+	s := Database{dialect: postgresDialect{}}
+	s.SqlDb = db
+	s.SqlDb.SetMaxIdleConns(25)
+	s.SqlDb.SetMaxOpenConns(25)
+
+	return &s, nil
+}
+
+func NewSqliteConnection(connectionString string) (DatabaseIface, error) {
+
+	db, err := sql.Open("sqlite", connectionString)
+	if err != nil {
+		return nil, fmt.Errorf("[sqlite] Error opening SQLite database: %w", err)
+	}
+	s := Database{dialect: sqliteDialect{}}
+	s.SqlDb = db
+	// SQLite has a single writer, so share one connection instead of
+	// failing with "database is locked".
+	s.SqlDb.SetMaxOpenConns(1)
+
+	return &s, nil
+}
+
+// NewConnection opens the backend named by driver, SQL Server when it is empty.
+func NewConnection(driver string, connectionString string) (DatabaseIface, error) {
+	switch driver {
+	case "", DriverSqlServer:
+		return NewSqlConnection(connectionString)
+	case DriverPostgres:
+		return NewPostgresConnection(connectionString)
+	case DriverSqlite:
+		return NewSqliteConnection(connectionString)
+	case DriverMemory:
+		return NewMemoryDatabase(), nil
+	}
+	return nil, fmt.Errorf("unknown database driver %q", driver)
 }
 
 func (d *Database) CloseConnection() {
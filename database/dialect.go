@@ -0,0 +1,272 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialect hides what differs between the SQL servers we support. Queries are
+// written once with @name parameters, the way SQL Server and SQLite take them.
+type dialect interface {
+	// rebind rewrites qry and args into what the driver understands.
+	rebind(qry string, args []interface{}) (string, []interface{})
+	// insertReturning is appended to an insert to read back the new row.
+	insertReturning(table string, cols string) string
+	// updateReturning is appended to an update to read back the changed row,
+	// which where picks out. Nothing is read when the update matched nothing.
+	updateReturning(table string, cols string, where string) string
+	// multiStatement reports whether several statements may be sent at once.
+	multiStatement() bool
+	// limit is appended after the order by to read at most param rows.
+	limit(param string) string
+	// types fills the column types in migrations.
+	types() sqlTypes
+	// createIfNotExists creates table unless it is already there.
+	createIfNotExists(table string, columns string) string
+	// classify returns ErrConflict or ErrForeignKey when err is that kind of
+	// constraint violation, nil otherwise.
+	classify(err error) error
+}
+
+// sqlTypes are the column types a migration may use, as {{.ID}}, {{.Text}} and so on.
+// Name is the driver, for the odd statement that can't be written for all of them.
+type sqlTypes struct {
+	Name      string
+	ID        string // auto numbered primary key
+	BigInt    string
+	String    string // short, indexable text
+	Text      string
+	Timestamp string
+	Bool      string
+}
+
+type sqlServerDialect struct{}
+
+func (sqlServerDialect) rebind(qry string, args []interface{}) (string, []interface{}) {
+	return qry, args
+}
+
+func (sqlServerDialect) insertReturning(table string, cols string) string {
+	return "; select " + cols + " from " + table + " where id = SCOPE_IDENTITY()"
+}
+
+func (sqlServerDialect) updateReturning(table string, cols string, where string) string {
+	return "; if @@ROWCOUNT > 0 select " + cols + " from " + table + " where " + where
+}
+
+func (sqlServerDialect) multiStatement() bool { return true }
+
+func (sqlServerDialect) limit(param string) string {
+	return " offset 0 rows fetch next " + param + " rows only"
+}
+
+func (sqlServerDialect) types() sqlTypes {
+	return sqlTypes{
+		Name:      DriverSqlServer,
+		ID:        "bigint identity(1,1) primary key",
+		BigInt:    "bigint",
+		String:    "nvarchar(255)",
+		Text:      "nvarchar(max)",
+		Timestamp: "datetime2",
+		Bool:      "bit",
+	}
+}
+
+func (sqlServerDialect) createIfNotExists(table string, columns string) string {
+	return "if object_id('" + table + "', 'U') is null create table " + table + " (" + columns + ")"
+}
+
+func (sqlServerDialect) classify(err error) error {
+	var e interface{ SQLErrorNumber() int32 }
+	if errors.As(err, &e) {
+		switch e.SQLErrorNumber() {
+		case 2601, 2627: // duplicate key in a unique index or constraint
+			return ErrConflict
+		case 547: // conflicted with a foreign key constraint
+			return ErrForeignKey
+		}
+	}
+	return nil
+}
+
+type sqliteDialect struct{}
+
+// sqliteTimeFormat is how times are written to SQLite, which keeps them as
+// text. Fixed width and in UTC, the text sorts in time order, so lists can be
+// filtered and sorted on time columns. Left to itself the driver would write
+// time.Time.String(), zone and monotonic clock reading included.
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000000"
+
+func (sqliteDialect) rebind(qry string, args []interface{}) (string, []interface{}) {
+	out := make([]interface{}, len(args))
+	for i, a := range args {
+		switch v := a.(type) {
+		case time.Time:
+			a = v.UTC().Format(sqliteTimeFormat)
+		case sql.NamedArg:
+			if t, ok := v.Value.(time.Time); ok {
+				v.Value = t.UTC().Format(sqliteTimeFormat)
+				a = v
+			}
+		}
+		out[i] = a
+	}
+	return qry, out
+}
+
+func (sqliteDialect) insertReturning(table string, cols string) string {
+	return " returning " + cols
+}
+
+func (sqliteDialect) updateReturning(table string, cols string, where string) string {
+	return " returning " + cols
+}
+
+func (sqliteDialect) multiStatement() bool { return true }
+
+func (sqliteDialect) limit(param string) string {
+	return " limit " + param
+}
+
+func (sqliteDialect) types() sqlTypes {
+	return sqlTypes{
+		Name:      DriverSqlite,
+		ID:        "integer primary key autoincrement",
+		BigInt:    "integer",
+		String:    "varchar(255)",
+		Text:      "text",
+		Timestamp: "datetime",
+		Bool:      "integer",
+	}
+}
+
+func (sqliteDialect) createIfNotExists(table string, columns string) string {
+	return "create table if not exists " + table + " (" + columns + ")"
+}
+
+func (sqliteDialect) classify(err error) error {
+	var e interface{ Code() int }
+	if errors.As(err, &e) {
+		switch e.Code() {
+		case 1555, 2067: // SQLITE_CONSTRAINT_PRIMARYKEY, SQLITE_CONSTRAINT_UNIQUE
+			return ErrConflict
+		case 787: // SQLITE_CONSTRAINT_FOREIGNKEY
+			return ErrForeignKey
+		}
+	}
+	return nil
+}
+
+type postgresDialect struct{}
+
+var namedParam = regexp.MustCompile(`@[A-Za-z_][A-Za-z0-9_]*`)
+
+// rebind turns @name parameters into $n ones, in order of first use.
+func (postgresDialect) rebind(qry string, args []interface{}) (string, []interface{}) {
+	named := map[string]interface{}{}
+	for _, a := range args {
+		if n, ok := a.(sql.NamedArg); ok {
+			named[n.Name] = n.Value
+		}
+	}
+	index := map[string]int{}
+	var out []interface{}
+	qry = namedParam.ReplaceAllStringFunc(qry, func(p string) string {
+		name := p[1:]
+		i, ok := index[name]
+		if !ok {
+			out = append(out, named[name])
+			i = len(out)
+			index[name] = i
+		}
+		return "$" + strconv.Itoa(i)
+	})
+	return qry, out
+}
+
+func (postgresDialect) insertReturning(table string, cols string) string {
+	return " returning " + cols
+}
+
+func (postgresDialect) updateReturning(table string, cols string, where string) string {
+	return " returning " + cols
+}
+
+func (postgresDialect) multiStatement() bool { return false }
+
+func (postgresDialect) limit(param string) string {
+	return " limit " + param
+}
+
+func (postgresDialect) types() sqlTypes {
+	return sqlTypes{
+		Name:      DriverPostgres,
+		ID:        "bigserial primary key",
+		BigInt:    "bigint",
+		String:    "varchar(255)",
+		Text:      "text",
+		Timestamp: "timestamptz",
+		Bool:      "smallint",
+	}
+}
+
+func (postgresDialect) createIfNotExists(table string, columns string) string {
+	return "create table if not exists " + table + " (" + columns + ")"
+}
+
+func (postgresDialect) classify(err error) error {
+	var e interface{ SQLState() string }
+	if errors.As(err, &e) {
+		switch e.SQLState() {
+		case "23505": // unique_violation
+			return ErrConflict
+		case "23503": // foreign_key_violation
+			return ErrForeignKey
+		}
+	}
+	return nil
+}
+
+// sqlDialect is SQL Server unless the connection was opened for another server.
+func (s *Database) sqlDialect() dialect {
+	if s.dialect == nil {
+		return sqlServerDialect{}
+	}
+	return s.dialect
+}
+
+func (s *Database) queryContext(ctx context.Context, qry string, args ...interface{}) (*sql.Rows, error) {
+	qry, args = s.sqlDialect().rebind(qry, args)
+	rows, err := s.SqlDb.QueryContext(ctx, qry, args...)
+	return rows, s.translateError(err)
+}
+
+func (s *Database) queryRowContext(ctx context.Context, qry string, args ...interface{}) *sql.Row {
+	qry, args = s.sqlDialect().rebind(qry, args)
+	return s.SqlDb.QueryRowContext(ctx, qry, args...)
+}
+
+func (s *Database) execContext(ctx context.Context, qry string, args ...interface{}) (sql.Result, error) {
+	qry, args = s.sqlDialect().rebind(qry, args)
+	res, err := s.SqlDb.ExecContext(ctx, qry, args...)
+	return res, s.translateError(err)
+}
+
+// execBatch runs stmts as one batch where the server allows it, one by one otherwise.
+func (s *Database) execBatch(ctx context.Context, stmts []string, args ...interface{}) error {
+	if s.sqlDialect().multiStatement() {
+		_, err := s.execContext(ctx, strings.Join(stmts, "; "), args...)
+		return err
+	}
+	for _, stmt := range stmts {
+		if _, err := s.execContext(ctx, stmt, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
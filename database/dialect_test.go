@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresDialect_Rebind(t *testing.T) {
+	qry, args := postgresDialect{}.rebind(
+		"update photos set title=@title where id = @ID and userid = @userid; select id from photos where id = @ID",
+		[]interface{}{sql.Named("title", "t"), sql.Named("userid", int64(2)), sql.Named("ID", int64(1))})
+	assert.Equal(t, "update photos set title=$1 where id = $2 and userid = $3; select id from photos where id = $2", qry)
+	assert.Equal(t, []interface{}{"t", int64(1), int64(2)}, args)
+}
+
+func TestSqliteDialect_Rebind(t *testing.T) {
+	at := time.Date(2022, 10, 5, 9, 30, 0, 5000, time.FixedZone("WIB", 7*60*60))
+	_, args := sqliteDialect{}.rebind("select id from photos where createdat >= @from",
+		[]interface{}{sql.Named("from", at), at, int64(1)})
+	assert.Equal(t, []interface{}{sql.Named("from", "2022-10-05 02:30:00.000005000"), "2022-10-05 02:30:00.000005000", int64(1)}, args)
+}
+
+func TestDialect_Returning(t *testing.T) {
+	assert.Equal(t, "; select id, title from photos where id = SCOPE_IDENTITY()", sqlServerDialect{}.insertReturning("photos", "id, title"))
+	assert.Equal(t, "; if @@ROWCOUNT > 0 select id from photos where id = @ID", sqlServerDialect{}.updateReturning("photos", "id", "id = @ID"))
+	assert.Equal(t, " returning id, title", postgresDialect{}.insertReturning("photos", "id, title"))
+	assert.Equal(t, " returning id", sqliteDialect{}.updateReturning("photos", "id", "id = @ID"))
+}
+
+func TestDatabase_ExecBatch(t *testing.T) {
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	stmts := []string{"delete from comments where photoid=@id", "delete from photos where id=@id"}
+
+	t.Run("execbatch single round trip", func(t *testing.T) {
+		dbtes := Database{SqlDb: db}
+		mock.ExpectExec(regexp.QuoteMeta("delete from comments where photoid=@id; delete from photos where id=@id")).
+			WithArgs(int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		assert.NoError(t, dbtes.execBatch(ctx, stmts, sql.Named("id", int64(1))))
+	})
+
+	t.Run("execbatch one by one", func(t *testing.T) {
+		dbtes := Database{SqlDb: db, dialect: postgresDialect{}}
+		mock.ExpectExec(regexp.QuoteMeta("delete from comments where photoid=$1")).
+			WithArgs(int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("delete from photos where id=$1")).
+			WithArgs(int64(1)).
+			WillReturnError(errors.New("db down"))
+		assert.Error(t, dbtes.execBatch(ctx, stmts, sql.Named("id", int64(1))))
+	})
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "pq: " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+type sqlServerError int32
+
+func (e sqlServerError) Error() string         { return "mssql: error" }
+func (e sqlServerError) SQLErrorNumber() int32 { return int32(e) }
+
+type sqliteError int
+
+func (e sqliteError) Error() string { return "sqlite: constraint failed" }
+func (e sqliteError) Code() int     { return int(e) }
+
+func TestDialect_Classify(t *testing.T) {
+	tests := []struct {
+		dialect dialect
+		err     error
+		want    error
+	}{
+		{postgresDialect{}, sqlStateError("23505"), ErrConflict},
+		{postgresDialect{}, sqlStateError("23503"), ErrForeignKey},
+		{postgresDialect{}, sqlStateError("42P01"), nil},
+		{sqlServerDialect{}, sqlServerError(2627), ErrConflict},
+		{sqlServerDialect{}, sqlServerError(547), ErrForeignKey},
+		{sqliteDialect{}, sqliteError(2067), ErrConflict},
+		{sqliteDialect{}, sqliteError(787), ErrForeignKey},
+		{sqliteDialect{}, errors.New("db down"), nil},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.dialect.classify(tt.err), tt.err.Error())
+	}
+
+	db := &Database{dialect: postgresDialect{}}
+	err := db.translateError(sqlStateError("23505"))
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.Contains(t, err.Error(), "pq: 23505")
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors a DatabaseIface method may return, compared with errors.Is. The SQL
+// backends wrap the driver error, so its message is kept for the logs.
+var (
+	// ErrNotFound means no row matched, e.g. an unknown id, or a row owned by
+	// someone else for the methods that filter on the owner.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means the write breaks a unique constraint, e.g. a username
+	// that is already taken.
+	ErrConflict = errors.New("conflict")
+	// ErrForeignKey means the write refers to a row that does not exist, or
+	// removes one that is still referred to.
+	ErrForeignKey = errors.New("foreign key violation")
+	// ErrSelfFollow means a user asked to follow themselves.
+	ErrSelfFollow = errors.New("users can't follow themselves")
+)
+
+// translateError wraps constraint violations reported by the driver into
+// ErrConflict or ErrForeignKey. Other errors are returned unchanged.
+func (s *Database) translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if kind := s.sqlDialect().classify(err); kind != nil {
+		return fmt.Errorf("%w: %v", kind, err)
+	}
+	return err
+}
+
+// notFoundUnless is err, or ErrNotFound when there is no error to report.
+func notFoundUnless(err error) error {
+	if err != nil {
+		return err
+	}
+	return ErrNotFound
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// conditions is the where clause of a list query. Callers write only fixed
+// column names and @parameters into the clauses; every value the caller
+// filters on goes in as a named argument.
+type conditions struct {
+	clauses []string
+	args    []interface{}
+}
+
+func (c *conditions) add(clause string, args ...sql.NamedArg) {
+	c.clauses = append(c.clauses, clause)
+	for _, a := range args {
+		c.args = append(c.args, a)
+	}
+}
+
+func (c *conditions) String() string {
+	if len(c.clauses) == 0 {
+		return ""
+	}
+	return " where " + strings.Join(c.clauses, " and ")
+}
+
+// likeEscaper escapes what like would take as a wildcard. SQL Server also
+// treats [ as one.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`, `[`, `\[`)
+
+// containing is the argument for a `lower(column) like @param escape '\'`
+// clause that finds s anywhere in the column, ignoring case.
+func containing(s string) string {
+	return "%" + likeEscaper.Replace(strings.ToLower(s)) + "%"
+}
+
+// contains is the memory backend's version of the same clause.
+func contains(column string, s string) bool {
+	return strings.Contains(strings.ToLower(column), strings.ToLower(s))
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"mygram/entity"
+	"time"
+)
+
+// userFollowerCount counts the followers of the user u.
+const userFollowerCount = "(select count(*) from follows f where f.followeeid=u.id)"
+
+// userFollowingCount counts the users u follows.
+const userFollowingCount = "(select count(*) from follows f where f.followerid=u.id)"
+
+// GetFollowers is one page of the users following userid, in the order they
+// followed, ErrNotFound when there is no such user.
+func (s *Database) GetFollowers(ctx context.Context, userid int64, page entity.PageRequest) (*entity.Page[entity.FollowGetOutput], error) {
+	return s.getFollows(ctx, "f.followeeid", "f.followerid", userid, page)
+}
+
+// GetFollowing is one page of the users userid follows, in the order they
+// were followed, ErrNotFound when there is no such user.
+func (s *Database) GetFollowing(ctx context.Context, userid int64, page entity.PageRequest) (*entity.Page[entity.FollowGetOutput], error) {
+	return s.getFollows(ctx, "f.followerid", "f.followeeid", userid, page)
+}
+
+// getFollows lists the users at the other end of userid's edges, where
+// userid is in column.
+func (s *Database) getFollows(ctx context.Context, column string, other string, userid int64, page entity.PageRequest) (*entity.Page[entity.FollowGetOutput], error) {
+	var result []entity.FollowGetOutput
+	q, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sortBy[entity.FollowGetOutput](&q, entity.Sort{}, nil); err != nil {
+		return nil, err
+	}
+	var where conditions
+	where.add(column+" = @userid", sql.Named("userid", userid))
+	if keyset := q.where("f.id"); keyset != "" {
+		where.add(keyset, sql.Named("cursor", q.cursor.ID))
+	}
+	qry := "select f.id, u.id, u.username, f.createdat from follows f join users u on " + other + "=u.id" +
+		where.String() + q.orderBy("f.id") + s.sqlDialect().limit("@limit")
+	rows, err := s.queryContext(ctx, qry, append(where.args, sql.Named("limit", q.fetch()))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row entity.FollowGetOutput
+		err := rows.Scan(
+			&row.ID,
+			&row.UserID,
+			&row.Username,
+			&row.FollowedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		if ok, err := s.exists(ctx, "users", userid); err != nil || !ok {
+			return nil, notFoundUnless(err)
+		}
+	}
+	return makePage(result, q, func(f entity.FollowGetOutput) int64 { return f.ID }, nil), nil
+}
+
+// FollowUser makes userid follow followeeid, and tells them. Following again
+// changes nothing.
+func (s *Database) FollowUser(ctx context.Context, userid int64, followeeid int64) (*entity.UserFollows, error) {
+	if userid == followeeid {
+		return nil, ErrSelfFollow
+	}
+	qry := "insert into follows (followerid, followeeid, createdat) select @userid, id, @createdat from users where id = @followeeid" +
+		" and not exists (select 1 from follows where followerid = @userid and followeeid = @followeeid)"
+	now := time.Now()
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := s.txExecContext(ctx, tx, qry,
+			sql.Named("userid", userid),
+			sql.Named("createdat", now),
+			sql.Named("followeeid", followeeid))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		return s.notify(ctx, tx, entity.NewFollowNotification(followeeid, userid), now)
+	})
+	// ErrConflict: the same follow, sent twice at once, was stored by the other request.
+	if err != nil && !errors.Is(err, ErrConflict) {
+		return nil, err
+	}
+	return s.userFollows(ctx, userid, followeeid)
+}
+
+// UnfollowUser makes userid stop following followeeid, if they do, and takes
+// back followeeid's notification of it.
+func (s *Database) UnfollowUser(ctx context.Context, userid int64, followeeid int64) (*entity.UserFollows, error) {
+	qry := []string{
+		"delete from notifications where type = @type and actorid = @userid and userid = @followeeid",
+		"delete from follows where followerid = @userid and followeeid = @followeeid",
+	}
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, stmt := range qry {
+			_, err := s.txExecContext(ctx, tx, stmt,
+				sql.Named("type", string(entity.NotificationFollow)),
+				sql.Named("userid", userid),
+				sql.Named("followeeid", followeeid))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.userFollows(ctx, userid, followeeid)
+}
+
+// userFollows reads the follow counts of a user as viewer sees them,
+// ErrNotFound when there is no such user.
+func (s *Database) userFollows(ctx context.Context, viewer int64, userid int64) (*entity.UserFollows, error) {
+	result := &entity.UserFollows{}
+	qry := "select u.id, " + userFollowerCount + ", " + userFollowingCount + ", " +
+		"(case when exists (select 1 from follows f where f.followerid=@viewer and f.followeeid=u.id) then 1 else 0 end)" +
+		" from users u where u.id = @userid"
+	rows, err := s.queryContext(ctx, qry,
+		sql.Named("viewer", viewer),
+		sql.Named("userid", userid))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(
+			&result.UserID,
+			&result.FollowerCount,
+			&result.FollowingCount,
+			&result.FollowedByMe,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if result.UserID == 0 {
+		return nil, ErrNotFound
+	}
+	return result, nil
+}
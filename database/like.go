@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"mygram/entity"
+	"time"
+)
+
+// GetPhotoLikes is one page of the likes of a photo, oldest first,
+// ErrNotFound when there is no such photo.
+func (s *Database) GetPhotoLikes(ctx context.Context, photoid int64, page entity.PageRequest) (*entity.Page[entity.LikeGetOutput], error) {
+	var result []entity.LikeGetOutput
+	q, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sortBy[entity.LikeGetOutput](&q, entity.Sort{}, nil); err != nil {
+		return nil, err
+	}
+	var where conditions
+	where.add("l.photoid = @photoid", sql.Named("photoid", photoid))
+	if keyset := q.where("l.id"); keyset != "" {
+		where.add(keyset, sql.Named("cursor", q.cursor.ID))
+	}
+	qry := "select l.id, l.photoid, l.userid, l.createdat, u.username from likes l join users u on l.userid=u.id" +
+		where.String() + q.orderBy("l.id") + s.sqlDialect().limit("@limit")
+	rows, err := s.queryContext(ctx, qry, append(where.args, sql.Named("limit", q.fetch()))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row entity.LikeGetOutput
+		err := rows.Scan(
+			&row.ID,
+			&row.PhotoID,
+			&row.UserID,
+			&row.CreatedAt,
+			&row.Username,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		if ok, err := s.exists(ctx, "photos", photoid); err != nil || !ok {
+			return nil, notFoundUnless(err)
+		}
+	}
+	return makePage(result, q, func(l entity.LikeGetOutput) int64 { return l.ID }, nil), nil
+}
+
+// LikePhoto makes userid like the photo, and tells its owner. Liking it
+// again changes nothing.
+func (s *Database) LikePhoto(ctx context.Context, userid int64, photoid int64) (*entity.PhotoLikes, error) {
+	qry := "insert into likes (photoid, userid, createdat) select id, @userid, @createdat from photos where id = @photoid" +
+		" and not exists (select 1 from likes where photoid = @photoid and userid = @userid)"
+	now := time.Now()
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := s.txExecContext(ctx, tx, qry,
+			sql.Named("userid", userid),
+			sql.Named("createdat", now),
+			sql.Named("photoid", photoid))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		owner, err := s.photoOwner(ctx, tx, photoid)
+		if err != nil {
+			return err
+		}
+		return s.notify(ctx, tx, entity.NewLikeNotification(owner, userid, photoid), now)
+	})
+	// ErrConflict: the same like, sent twice at once, was stored by the other request.
+	if err != nil && !errors.Is(err, ErrConflict) {
+		return nil, err
+	}
+	return s.photoLikes(ctx, userid, photoid)
+}
+
+// UnlikePhoto takes back userid's like of the photo, if there is one, and the
+// owner's notification of it.
+func (s *Database) UnlikePhoto(ctx context.Context, userid int64, photoid int64) (*entity.PhotoLikes, error) {
+	qry := []string{
+		"delete from notifications where type = @type and actorid = @userid and photoid = @photoid",
+		"delete from likes where photoid = @photoid and userid = @userid",
+	}
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, stmt := range qry {
+			_, err := s.txExecContext(ctx, tx, stmt,
+				sql.Named("type", string(entity.NotificationLike)),
+				sql.Named("photoid", photoid),
+				sql.Named("userid", userid))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.photoLikes(ctx, userid, photoid)
+}
+
+// photoLikes reads the likes of a photo as viewer sees them, ErrNotFound when
+// there is no such photo.
+func (s *Database) photoLikes(ctx context.Context, viewer int64, photoid int64) (*entity.PhotoLikes, error) {
+	result := &entity.PhotoLikes{}
+	rows, err := s.queryContext(ctx, "select p.id, "+photoLikeCount+", "+photoLikedByMe+" from photos p where p.id = @photoid",
+		sql.Named("viewer", viewer),
+		sql.Named("photoid", photoid))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(
+			&result.PhotoID,
+			&result.LikeCount,
+			&result.LikedByMe,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if result.PhotoID == 0 {
+		return nil, ErrNotFound
+	}
+	return result, nil
+}
@@ -0,0 +1,1612 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"mygram/entity"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DriverMemory keeps everything in process memory, for tests and demos.
+const DriverMemory = "memory"
+
+// MemoryDatabase is a DatabaseIface kept in process memory. It follows the
+// SQL implementation: same cascades, same ownership filters and the same
+// ErrNotFound, ErrConflict and ErrForeignKey errors.
+type MemoryDatabase struct {
+	*MemoryRevocationStore
+
+	mu            sync.RWMutex
+	lastID        map[string]int64
+	users         map[int64]*entity.User
+	photos        map[int64]*entity.Photo
+	comments      map[int64]*entity.Comment
+	socialmedias  map[int64]*entity.SocialMedia
+	refreshtokens map[int64]*entity.RefreshToken
+	likes         map[int64]*entity.Like
+	follows       map[int64]*entity.Follow
+	// phototags maps a photo to its tags and when it was tagged with each.
+	phototags map[int64]map[string]time.Time
+	// mentions are the resolved @usernames of each caption and comment.
+	mentions      map[mentionKey][]entity.Mention
+	notifications map[int64]*entity.Notification
+	webhooks      map[int64]*entity.Webhook
+	outbox        map[int64]*outboxEvent
+	deliveries    map[int64]*entity.WebhookDelivery
+}
+
+// outboxEvent is a row of the outbox.
+type outboxEvent struct {
+	event        entity.WebhookEvent
+	dispatched   bool
+	dispatchedAt time.Time
+}
+
+// mentionKey is the caption of photoID, or the comment commentID on it.
+type mentionKey struct {
+	photoID   int64
+	commentID int64
+}
+
+func NewMemoryDatabase() DatabaseIface {
+	return &MemoryDatabase{
+		MemoryRevocationStore: NewMemoryRevocationStore(),
+		lastID:                map[string]int64{},
+		users:                 map[int64]*entity.User{},
+		photos:                map[int64]*entity.Photo{},
+		comments:              map[int64]*entity.Comment{},
+		socialmedias:          map[int64]*entity.SocialMedia{},
+		refreshtokens:         map[int64]*entity.RefreshToken{},
+		likes:                 map[int64]*entity.Like{},
+		follows:               map[int64]*entity.Follow{},
+		phototags:             map[int64]map[string]time.Time{},
+		mentions:              map[mentionKey][]entity.Mention{},
+		notifications:         map[int64]*entity.Notification{},
+		webhooks:              map[int64]*entity.Webhook{},
+		outbox:                map[int64]*outboxEvent{},
+		deliveries:            map[int64]*entity.WebhookDelivery{},
+	}
+}
+
+func (m *MemoryDatabase) CloseConnection() {}
+
+// nextID works like an identity column; callers hold the write lock.
+func (m *MemoryDatabase) nextID(table string) int64 {
+	m.lastID[table]++
+	return m.lastID[table]
+}
+
+// exists tells whether rows, one of m's tables, has id.
+func exists[T any](m *MemoryDatabase, rows map[int64]T, id int64) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := rows[id]
+	return ok
+}
+
+func sortedIDs[T any](rows map[int64]T) []int64 {
+	ids := make([]int64, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// readPage picks from rows, sorted by id, what the SQL backends would read
+// for q, in the same order, for makePage to finish. value reads the sorted
+// column, and is nil in id order.
+func readPage[T any](rows []T, q pageQuery, id func(T) int64, value func(T) interface{}) []T {
+	// compare orders rows the way q.orderBy does.
+	compare := func(aValue interface{}, aID int64, bValue interface{}, bID int64) int {
+		c := compareValues(aValue, bValue)
+		if c == 0 {
+			c = compareValues(aID, bID)
+		}
+		if q.backwards() {
+			return -c
+		}
+		return c
+	}
+	key := func(row T) interface{} {
+		if value == nil {
+			return nil
+		}
+		return value(row)
+	}
+	sorted := append([]T(nil), rows...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compare(key(sorted[i]), id(sorted[i]), key(sorted[j]), id(sorted[j])) < 0
+	})
+	var result []T
+	for _, row := range sorted {
+		if len(result) == q.fetch() {
+			break
+		}
+		if !q.hasCursor || compare(key(row), id(row), q.cursor.value(), q.cursor.ID) > 0 {
+			result = append(result, row)
+		}
+	}
+	return result
+}
+
+// compareValues compares two values of a sorted column: times, int64s or nils.
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case time.Time:
+		b := b.(time.Time)
+		switch {
+		case a.Before(b):
+			return -1
+		case a.After(b):
+			return 1
+		}
+	case int64:
+		b := b.(int64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	}
+	return 0
+}
+
+func (m *MemoryDatabase) Login(ctx context.Context, email string) (int64, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, u := range m.users {
+		if u.Email == email {
+			return u.ID, u.Password, nil
+		}
+	}
+	return 0, "", ErrNotFound
+}
+
+func (m *MemoryDatabase) GetUserByID(ctx context.Context, id int64) (*entity.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := *u
+	return &result, nil
+}
+
+func (m *MemoryDatabase) GetUserProfile(ctx context.Context, id int64) (*entity.UserProfile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return m.userProfile(u), nil
+}
+
+func (m *MemoryDatabase) GetUserProfileByUsername(ctx context.Context, username string) (*entity.UserProfile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, u := range m.users {
+		if u.Username == username {
+			return m.userProfile(u), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// userProfile collects u's profile. Callers hold the lock.
+func (m *MemoryDatabase) userProfile(u *entity.User) *entity.UserProfile {
+	result := &entity.UserProfile{
+		ID:           u.ID,
+		Username:     u.Username,
+		SocialMedias: []entity.SocialMediaLink{},
+		JoinedAt:     u.CreatedAt,
+	}
+	for _, p := range m.photos {
+		if p.UserID == u.ID {
+			result.PhotoCount++
+		}
+	}
+	follows := m.userFollows(u.ID, 0)
+	result.FollowerCount, result.FollowingCount = follows.FollowerCount, follows.FollowingCount
+	for _, id := range sortedIDs(m.socialmedias) {
+		sm := m.socialmedias[id]
+		if sm.UserID == u.ID {
+			link := entity.SocialMediaLink{ID: sm.ID, Name: sm.Name, SocialMediaURL: sm.SocialMediaURL}
+			if sm.ProfileImageURL != nil {
+				url := *sm.ProfileImageURL
+				link.ProfileImageURL = &url
+			}
+			result.SocialMedias = append(result.SocialMedias, link)
+		}
+	}
+	return result
+}
+
+func (m *MemoryDatabase) Register(ctx context.Context, i entity.UserRegister) (*entity.UserRegisterResp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Email == i.Email || u.Username == i.Username {
+			return nil, fmt.Errorf("%w: user %s already registered", ErrConflict, i.Username)
+		}
+	}
+	now := time.Now()
+	u := &entity.User{
+		ID:        m.nextID("users"),
+		Username:  i.Username,
+		Email:     i.Email,
+		Password:  i.Password,
+		Age:       i.Age,
+		Role:      entity.RoleUser,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.users[u.ID] = u
+	return &entity.UserRegisterResp{Age: u.Age, Email: u.Email, ID: int(u.ID), Username: u.Username}, nil
+}
+
+func (m *MemoryDatabase) UpdateUser(ctx context.Context, id int64, email string, username string) (*entity.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := &entity.User{}
+	u, ok := m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	for _, other := range m.users {
+		if other.ID != id && (other.Email == email || other.Username == username) {
+			return nil, fmt.Errorf("%w: email or username already taken", ErrConflict)
+		}
+	}
+	u.Email = email
+	u.Username = username
+	u.UpdatedAt = time.Now()
+	result.ID, result.Email, result.Username, result.Age, result.UpdatedAt = u.ID, u.Email, u.Username, u.Age, u.UpdatedAt
+	return result, nil
+}
+
+func (m *MemoryDatabase) UpdateUserRole(ctx context.Context, id int64, role entity.Role) (*entity.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := &entity.User{}
+	u, ok := m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	u.Role = role
+	u.UpdatedAt = time.Now()
+	result.ID, result.Username, result.Role, result.UpdatedAt = u.ID, u.Username, u.Role, u.UpdatedAt
+	return result, nil
+}
+
+func (m *MemoryDatabase) DeleteUser(ctx context.Context, id int64) (string, []string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[id]; !ok {
+		return "", nil, ErrNotFound
+	}
+	var events []deletedEvent
+	for _, commentID := range sortedIDs(m.comments) {
+		c := m.comments[commentID]
+		if p, ok := m.photos[c.PhotoID]; c.DeletedAt == nil && (c.UserID == id || ok && p.UserID == id) {
+			events = append(events, deletedEvent{entity.EventCommentDeleted, entity.DeletedResource{ID: c.ID, UserID: c.UserID}})
+		}
+	}
+	for _, smID := range sortedIDs(m.socialmedias) {
+		if sm := m.socialmedias[smID]; sm.UserID == id {
+			events = append(events, deletedEvent{entity.EventSocialMediaDeleted, entity.DeletedResource{ID: sm.ID, UserID: sm.UserID}})
+		}
+	}
+	for _, photoID := range sortedIDs(m.photos) {
+		if p := m.photos[photoID]; p.UserID == id {
+			events = append(events, deletedEvent{entity.EventPhotoDeleted, entity.DeletedResource{ID: p.ID, UserID: p.UserID}})
+		}
+	}
+	for key, mentions := range m.mentions {
+		p, ok := m.photos[key.photoID]
+		c := m.comments[key.commentID]
+		if ok && p.UserID == id || c != nil && c.UserID == id {
+			delete(m.mentions, key)
+			continue
+		}
+		m.mentions[key] = withoutUser(mentions, id)
+	}
+	m.unnotify(func(n *entity.Notification) bool {
+		if n.UserID == id || n.ActorID == id {
+			return true
+		}
+		if n.PhotoID == nil {
+			return false
+		}
+		p, ok := m.photos[*n.PhotoID]
+		return ok && p.UserID == id
+	})
+	for commentID, c := range m.comments {
+		if p, ok := m.photos[c.PhotoID]; ok && p.UserID == id {
+			delete(m.comments, commentID)
+		}
+	}
+	now := time.Now()
+	for commentID, c := range m.comments {
+		if c.UserID == id && m.hasReplies(commentID) {
+			m.tombstone(c, now)
+		}
+	}
+	for commentID, c := range m.comments {
+		if c.UserID == id {
+			delete(m.comments, commentID)
+		}
+	}
+	for likeID, l := range m.likes {
+		if p, ok := m.photos[l.PhotoID]; l.UserID == id || ok && p.UserID == id {
+			delete(m.likes, likeID)
+		}
+	}
+	for followID, f := range m.follows {
+		if f.FollowerID == id || f.FolloweeID == id {
+			delete(m.follows, followID)
+		}
+	}
+	for smID, sm := range m.socialmedias {
+		if sm.UserID == id {
+			delete(m.socialmedias, smID)
+		}
+	}
+	var photoURLs []string
+	for _, photoID := range sortedIDs(m.photos) {
+		if p := m.photos[photoID]; p.UserID == id {
+			photoURLs = append(photoURLs, p.PhotoUrl)
+			delete(m.phototags, photoID)
+			delete(m.photos, photoID)
+		}
+	}
+	for tokenID, t := range m.refreshtokens {
+		if t.UserID == id {
+			delete(m.refreshtokens, tokenID)
+		}
+	}
+	for webhookID, w := range m.webhooks {
+		if w.UserID == id {
+			m.deleteWebhook(webhookID)
+		}
+	}
+	delete(m.users, id)
+	m.addDeletedToOutbox(events, now)
+	m.addToOutbox(entity.EventUserDeleted, entity.DeletedResource{ID: id, UserID: id}, now)
+	return "Your account has been successfully deleted", photoURLs, nil
+}
+
+func (m *MemoryDatabase) GetFollowers(ctx context.Context, userid int64, page entity.PageRequest) (*entity.Page[entity.FollowGetOutput], error) {
+	return m.getFollows(userid, page, func(f *entity.Follow) (int64, int64) { return f.FolloweeID, f.FollowerID })
+}
+
+func (m *MemoryDatabase) GetFollowing(ctx context.Context, userid int64, page entity.PageRequest) (*entity.Page[entity.FollowGetOutput], error) {
+	return m.getFollows(userid, page, func(f *entity.Follow) (int64, int64) { return f.FollowerID, f.FolloweeID })
+}
+
+// getFollows lists the users at the other end of userid's edges. ends reads
+// an edge's userid end and its other end.
+func (m *MemoryDatabase) getFollows(userid int64, page entity.PageRequest, ends func(f *entity.Follow) (int64, int64)) (*entity.Page[entity.FollowGetOutput], error) {
+	q, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sortBy[entity.FollowGetOutput](&q, entity.Sort{}, nil); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.users[userid]; !ok {
+		return nil, ErrNotFound
+	}
+	var result []entity.FollowGetOutput
+	for _, id := range sortedIDs(m.follows) {
+		f := m.follows[id]
+		end, other := ends(f)
+		u, ok := m.users[other]
+		if end != userid || !ok {
+			continue
+		}
+		result = append(result, entity.FollowGetOutput{ID: f.ID, UserID: u.ID, Username: u.Username, FollowedAt: f.CreatedAt})
+	}
+	id := func(row entity.FollowGetOutput) int64 { return row.ID }
+	return makePage(readPage(result, q, id, nil), q, id, nil), nil
+}
+
+func (m *MemoryDatabase) FollowUser(ctx context.Context, userid int64, followeeid int64) (*entity.UserFollows, error) {
+	if userid == followeeid {
+		return nil, ErrSelfFollow
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[followeeid]; !ok {
+		return nil, ErrNotFound
+	}
+	if !m.userFollows(followeeid, userid).FollowedByMe {
+		f := &entity.Follow{ID: m.nextID("follows"), FollowerID: userid, FolloweeID: followeeid, CreatedAt: time.Now()}
+		m.follows[f.ID] = f
+		m.notify(entity.NewFollowNotification(followeeid, userid), f.CreatedAt)
+	}
+	result := m.userFollows(followeeid, userid)
+	return &result, nil
+}
+
+func (m *MemoryDatabase) UnfollowUser(ctx context.Context, userid int64, followeeid int64) (*entity.UserFollows, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[followeeid]; !ok {
+		return nil, ErrNotFound
+	}
+	for followID, f := range m.follows {
+		if f.FollowerID == userid && f.FolloweeID == followeeid {
+			delete(m.follows, followID)
+		}
+	}
+	m.unnotify(func(n *entity.Notification) bool {
+		return n.Type == entity.NotificationFollow && n.ActorID == userid && n.UserID == followeeid
+	})
+	result := m.userFollows(followeeid, userid)
+	return &result, nil
+}
+
+// userFollows counts the follows of a user and tells whether viewer follows
+// them. Callers hold the lock.
+func (m *MemoryDatabase) userFollows(userid int64, viewer int64) entity.UserFollows {
+	result := entity.UserFollows{UserID: userid}
+	for _, f := range m.follows {
+		if f.FolloweeID == userid {
+			result.FollowerCount++
+			result.FollowedByMe = result.FollowedByMe || f.FollowerID == viewer
+		}
+		if f.FollowerID == userid {
+			result.FollowingCount++
+		}
+	}
+	return result
+}
+
+func (m *MemoryDatabase) PostRefreshToken(ctx context.Context, i entity.RefreshToken) (*entity.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range m.refreshtokens {
+		if t.TokenHash == i.TokenHash {
+			return nil, fmt.Errorf("%w: refresh token already stored", ErrConflict)
+		}
+	}
+	t := i
+	t.ID = m.nextID("refreshtokens")
+	t.Revoked = false
+	t.CreatedAt = time.Now()
+	m.refreshtokens[t.ID] = &t
+	result := t
+	return &result, nil
+}
+
+func (m *MemoryDatabase) GetRefreshToken(ctx context.Context, tokenHash string) (*entity.RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, t := range m.refreshtokens {
+		if t.TokenHash == tokenHash {
+			result := *t
+			return &result, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryDatabase) RevokeRefreshToken(ctx context.Context, id int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.refreshtokens[id]
+	if !ok || t.Revoked {
+		return false, nil
+	}
+	t.Revoked = true
+	return true, nil
+}
+
+func (m *MemoryDatabase) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range m.refreshtokens {
+		if t.FamilyID == familyID {
+			t.Revoked = true
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDatabase) RevokeUserRefreshTokens(ctx context.Context, userid int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range m.refreshtokens {
+		if t.UserID == userid {
+			t.Revoked = true
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDatabase) GetPhotos(ctx context.Context, viewer int64, filter entity.PhotoFilter, page entity.PageRequest) (*entity.Page[entity.PhotoGetOutput], error) {
+	q, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
+	value, err := sortBy(&q, filter.Sort, photoSorts)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	commentCounts := m.commentCounts()
+	followed := map[int64]bool{}
+	for _, f := range m.follows {
+		if f.FollowerID == filter.FollowedBy {
+			followed[f.FolloweeID] = true
+		}
+	}
+	var result []entity.PhotoGetOutput
+	for _, id := range sortedIDs(m.photos) {
+		p := m.photos[id]
+		switch {
+		case filter.UserID != 0 && p.UserID != filter.UserID,
+			filter.FollowedBy != 0 && !followed[p.UserID],
+			filter.Tag != "" && !hasTag(m.phototags[p.ID], filter.Tag),
+			!filter.CreatedFrom.IsZero() && p.CreatedAt.Before(filter.CreatedFrom),
+			!filter.CreatedTo.IsZero() && p.CreatedAt.After(filter.CreatedTo),
+			filter.Search != "" && !contains(p.Title, filter.Search) && !contains(p.Caption, filter.Search):
+			continue
+		}
+		if row, ok := m.photoGetOutput(p, commentCounts[p.ID], viewer); ok {
+			result = append(result, row)
+		}
+	}
+	id := func(row entity.PhotoGetOutput) int64 { return row.ID }
+	return makePage(readPage(result, q, id, value), q, id, value), nil
+}
+
+// commentCounts counts the comments of each photo, not the tombstones.
+// Callers hold the lock.
+func (m *MemoryDatabase) commentCounts() map[int64]int64 {
+	counts := map[int64]int64{}
+	for _, c := range m.comments {
+		if c.DeletedAt == nil {
+			counts[c.PhotoID]++
+		}
+	}
+	return counts
+}
+
+// photoGetOutput joins p with its owner and likes like photoGetOutputQuery,
+// and is not ok when the owner is gone. Callers hold the lock.
+func (m *MemoryDatabase) photoGetOutput(p *entity.Photo, commentCount int64, viewer int64) (entity.PhotoGetOutput, bool) {
+	u, ok := m.users[p.UserID]
+	if !ok {
+		return entity.PhotoGetOutput{}, false
+	}
+	likes := m.photoLikes(p.ID, viewer)
+	row := entity.PhotoGetOutput{Photo: *p, CommentCount: commentCount, LikeCount: likes.LikeCount, LikedByMe: likes.LikedByMe}
+	row.Mentions = m.mentionsOf(mentionKey{photoID: p.ID})
+	row.User.Email = u.Email
+	row.User.Username = u.Username
+	return row, true
+}
+
+func (m *MemoryDatabase) GetUserPhotos(ctx context.Context, viewer int64, userid int64, page entity.PageRequest) (*entity.Page[entity.PhotoGetOutput], error) {
+	result, err := m.GetPhotos(ctx, viewer, entity.PhotoFilter{UserID: userid}, page)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Items) == 0 && !exists(m, m.users, userid) {
+		return nil, ErrNotFound
+	}
+	return result, nil
+}
+
+func (m *MemoryDatabase) GetFeed(ctx context.Context, userid int64, page entity.PageRequest) (*entity.Page[entity.PhotoGetOutput], error) {
+	return m.GetPhotos(ctx, userid, feedFilter(userid), page)
+}
+
+func (m *MemoryDatabase) GetTagPhotos(ctx context.Context, viewer int64, tag string, page entity.PageRequest) (*entity.Page[entity.PhotoGetOutput], error) {
+	return m.GetPhotos(ctx, viewer, tagFilter(tag), page)
+}
+
+func hasTag(tags map[string]time.Time, tag string) bool {
+	_, ok := tags[tag]
+	return ok
+}
+
+func (m *MemoryDatabase) GetTrendingTags(ctx context.Context, since time.Time, limit int) ([]entity.TagCount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	counts := map[string]int64{}
+	for _, tags := range m.phototags {
+		for tag, at := range tags {
+			if !at.Before(since) {
+				counts[tag]++
+			}
+		}
+	}
+	result := []entity.TagCount{}
+	for tag, n := range counts {
+		result = append(result, entity.TagCount{Tag: tag, PhotoCount: n})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].PhotoCount != result[j].PhotoCount {
+			return result[i].PhotoCount > result[j].PhotoCount
+		}
+		return result[i].Tag < result[j].Tag
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// setPhotoTags works like the SQL one: tags the photo keeps keep their
+// time. Callers hold the write lock.
+func (m *MemoryDatabase) setPhotoTags(photoid int64, caption string, now time.Time) {
+	old := m.phototags[photoid]
+	tags := map[string]time.Time{}
+	for _, tag := range entity.ParseHashtags(caption) {
+		if at, ok := old[tag]; ok {
+			tags[tag] = at
+		} else {
+			tags[tag] = now
+		}
+	}
+	m.phototags[photoid] = tags
+}
+
+func (m *MemoryDatabase) GetPhotoByID(ctx context.Context, viewer int64, id int64) (*entity.PhotoGetOutput, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	p, ok := m.photos[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result, ok := m.photoGetOutput(p, m.commentCounts()[p.ID], viewer)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &result, nil
+}
+
+func (m *MemoryDatabase) PostPhoto(ctx context.Context, userid int64, i entity.PhotoPost) (*entity.Photo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[userid]; !ok {
+		return nil, fmt.Errorf("%w: user %d does not exist", ErrForeignKey, userid)
+	}
+	now := time.Now()
+	p := &entity.Photo{
+		ID:         m.nextID("photos"),
+		Title:      i.Title,
+		Caption:    i.Caption,
+		PhotoUrl:   i.PhotoUrl,
+		UserID:     userid,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Processing: i.Processing,
+	}
+	if p.Processing == "" {
+		p.Processing = entity.ProcessingNone
+	}
+	m.photos[p.ID] = p
+	m.setPhotoTags(p.ID, p.Caption, now)
+	result := *p
+	result.Mentions = m.setMentions(mentionSource{actorID: userid, photoID: p.ID}, p.Caption, now)
+	m.addToOutbox(entity.EventPhotoCreated, result, now)
+	return &result, nil
+}
+
+func (m *MemoryDatabase) UpdatePhoto(ctx context.Context, userid int64, id int64, i entity.PhotoPost) (*entity.Photo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := &entity.Photo{}
+	p, ok := m.photos[id]
+	if !ok || p.UserID != userid {
+		return nil, ErrNotFound
+	}
+	if p.PhotoUrl != i.PhotoUrl {
+		p.Processing = entity.ProcessingNone
+		p.Variants = nil
+	}
+	p.Title = i.Title
+	p.Caption = i.Caption
+	p.PhotoUrl = i.PhotoUrl
+	p.UpdatedAt = time.Now()
+	m.setPhotoTags(p.ID, p.Caption, p.UpdatedAt)
+	*result = *p
+	result.Mentions = m.setMentions(mentionSource{actorID: userid, photoID: p.ID}, p.Caption, p.UpdatedAt)
+	m.addToOutbox(entity.EventPhotoUpdated, result, p.UpdatedAt)
+	return result, nil
+}
+
+func (m *MemoryDatabase) DeletePhoto(ctx context.Context, userid int64, id int64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.photos[id]
+	if !ok || p.UserID != userid {
+		return "", ErrNotFound
+	}
+	var events []deletedEvent
+	for _, commentID := range sortedIDs(m.comments) {
+		if c := m.comments[commentID]; c.PhotoID == id {
+			if c.DeletedAt == nil {
+				events = append(events, deletedEvent{entity.EventCommentDeleted, entity.DeletedResource{ID: c.ID, UserID: c.UserID}})
+			}
+			delete(m.comments, commentID)
+		}
+	}
+	for likeID, l := range m.likes {
+		if l.PhotoID == id {
+			delete(m.likes, likeID)
+		}
+	}
+	for key := range m.mentions {
+		if key.photoID == id {
+			delete(m.mentions, key)
+		}
+	}
+	m.unnotify(func(n *entity.Notification) bool {
+		return n.PhotoID != nil && *n.PhotoID == id
+	})
+	delete(m.phototags, id)
+	delete(m.photos, id)
+	now := time.Now()
+	m.addDeletedToOutbox(events, now)
+	m.addToOutbox(entity.EventPhotoDeleted, entity.DeletedResource{ID: id, UserID: userid}, now)
+	return "Your photo has been successfully deleted", nil
+}
+
+func (m *MemoryDatabase) SetPhotoVariants(ctx context.Context, id int64, photoURL string, state entity.ProcessingState, variants *entity.PhotoVariants) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.photos[id]
+	if !ok || p.Processing != entity.ProcessingPending || p.PhotoUrl != photoURL {
+		return ErrNotFound
+	}
+	p.Processing = state
+	if variants != nil {
+		v := *variants
+		p.Variants = &v
+	}
+	return nil
+}
+
+func (m *MemoryDatabase) GetProcessingPhotos(ctx context.Context) ([]entity.Photo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var result []entity.Photo
+	for _, id := range sortedIDs(m.photos) {
+		if p := m.photos[id]; p.Processing == entity.ProcessingPending {
+			result = append(result, *p)
+		}
+	}
+	return result, nil
+}
+
+func (m *MemoryDatabase) GetPhotoLikes(ctx context.Context, photoid int64, page entity.PageRequest) (*entity.Page[entity.LikeGetOutput], error) {
+	q, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sortBy[entity.LikeGetOutput](&q, entity.Sort{}, nil); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.photos[photoid]; !ok {
+		return nil, ErrNotFound
+	}
+	var result []entity.LikeGetOutput
+	for _, id := range sortedIDs(m.likes) {
+		l := m.likes[id]
+		u, ok := m.users[l.UserID]
+		if l.PhotoID != photoid || !ok {
+			continue
+		}
+		result = append(result, entity.LikeGetOutput{Like: *l, Username: u.Username})
+	}
+	id := func(row entity.LikeGetOutput) int64 { return row.ID }
+	return makePage(readPage(result, q, id, nil), q, id, nil), nil
+}
+
+func (m *MemoryDatabase) LikePhoto(ctx context.Context, userid int64, photoid int64) (*entity.PhotoLikes, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.photos[photoid]; !ok {
+		return nil, ErrNotFound
+	}
+	if !m.photoLikes(photoid, userid).LikedByMe {
+		l := &entity.Like{ID: m.nextID("likes"), PhotoID: photoid, UserID: userid, CreatedAt: time.Now()}
+		m.likes[l.ID] = l
+		m.notify(entity.NewLikeNotification(m.photos[photoid].UserID, userid, photoid), l.CreatedAt)
+	}
+	result := m.photoLikes(photoid, userid)
+	return &result, nil
+}
+
+func (m *MemoryDatabase) UnlikePhoto(ctx context.Context, userid int64, photoid int64) (*entity.PhotoLikes, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.photos[photoid]; !ok {
+		return nil, ErrNotFound
+	}
+	for likeID, l := range m.likes {
+		if l.PhotoID == photoid && l.UserID == userid {
+			delete(m.likes, likeID)
+		}
+	}
+	m.unnotify(func(n *entity.Notification) bool {
+		return n.Type == entity.NotificationLike && n.ActorID == userid && n.PhotoID != nil && *n.PhotoID == photoid
+	})
+	result := m.photoLikes(photoid, userid)
+	return &result, nil
+}
+
+// photoLikes counts the likes of a photo and tells whether viewer is among
+// them. Callers hold the lock.
+func (m *MemoryDatabase) photoLikes(photoid int64, viewer int64) entity.PhotoLikes {
+	result := entity.PhotoLikes{PhotoID: photoid}
+	for _, l := range m.likes {
+		if l.PhotoID == photoid {
+			result.LikeCount++
+			result.LikedByMe = result.LikedByMe || l.UserID == viewer
+		}
+	}
+	return result
+}
+
+func (m *MemoryDatabase) GetComments(ctx context.Context, filter entity.CommentFilter, page entity.PageRequest) (*entity.Page[entity.CommentGetOutput], error) {
+	q, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
+	value, err := sortBy(&q, filter.Sort, commentSorts)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var result []entity.CommentGetOutput
+	for _, id := range sortedIDs(m.comments) {
+		c := m.comments[id]
+		switch {
+		case filter.PhotoID != 0 && c.PhotoID != filter.PhotoID,
+			filter.UserID != 0 && c.UserID != filter.UserID,
+			filter.ParentID != 0 && (c.ParentCommentID == nil || *c.ParentCommentID != filter.ParentID),
+			filter.TopLevel && c.ParentCommentID != nil:
+			continue
+		}
+		if row, ok := m.commentGetOutput(c); ok {
+			result = append(result, row)
+		}
+	}
+	id := func(row entity.CommentGetOutput) int64 { return row.ID }
+	return makePage(readPage(result, q, id, value), q, id, value), nil
+}
+
+// commentGetOutput joins c with its photo and author like
+// commentGetOutputQuery, and is not ok when either is gone, unless c is a
+// tombstone, which has no author. Callers hold the lock.
+func (m *MemoryDatabase) commentGetOutput(c *entity.Comment) (entity.CommentGetOutput, bool) {
+	p, ok := m.photos[c.PhotoID]
+	if !ok {
+		return entity.CommentGetOutput{}, false
+	}
+	u, ok := m.users[c.UserID]
+	if !ok && c.DeletedAt == nil {
+		return entity.CommentGetOutput{}, false
+	}
+	row := entity.CommentGetOutput{Comment: *c}
+	row.Mentions = m.mentionsOf(mentionKey{photoID: c.PhotoID, commentID: c.ID})
+	row.User.ID = c.UserID
+	if ok {
+		row.User.Email = u.Email
+		row.User.Username = u.Username
+	}
+	row.Photo.ID = c.PhotoID
+	row.Photo.Title = p.Title
+	row.Photo.Caption = p.Caption
+	row.Photo.PhotoUrl = p.PhotoUrl
+	row.Photo.UserID = c.UserID
+	return row, true
+}
+
+func (m *MemoryDatabase) GetPhotoComments(ctx context.Context, photoid int64, page entity.PageRequest) (*entity.Page[entity.CommentGetOutput], error) {
+	result, err := m.GetComments(ctx, entity.CommentFilter{PhotoID: photoid}, page)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Items) == 0 && !exists(m, m.photos, photoid) {
+		return nil, ErrNotFound
+	}
+	return result, nil
+}
+
+func (m *MemoryDatabase) GetCommentByID(ctx context.Context, id int64) (*entity.CommentGetOutput, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, ok := m.comments[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result, ok := m.commentGetOutput(c)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &result, nil
+}
+
+func (m *MemoryDatabase) PostComment(ctx context.Context, userid int64, i entity.CommentPost) (*entity.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.photos[int64(i.PhotoID)]; !ok {
+		return nil, fmt.Errorf("%w: photo %d does not exist", ErrForeignKey, i.PhotoID)
+	}
+	var parentid *int64
+	if i.ParentCommentID != nil {
+		parent, ok := m.comments[*i.ParentCommentID]
+		if !ok || parent.PhotoID != int64(i.PhotoID) || parent.DeletedAt != nil {
+			return nil, fmt.Errorf("%w: comment %d is not a comment on photo %d", ErrForeignKey, *i.ParentCommentID, i.PhotoID)
+		}
+		parentid = &parent.ID
+	}
+	now := time.Now()
+	c := &entity.Comment{
+		ID:              m.nextID("comments"),
+		UserID:          userid,
+		PhotoID:         int64(i.PhotoID),
+		ParentCommentID: parentid,
+		Message:         i.Message,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	m.comments[c.ID] = c
+	m.notify(entity.NewCommentNotification(m.photos[c.PhotoID].UserID, userid, c.PhotoID, c.ID), now)
+	result := *c
+	result.Mentions = m.setMentions(mentionSource{actorID: userid, photoID: c.PhotoID, commentID: &c.ID}, c.Message, now)
+	m.addToOutbox(entity.EventCommentCreated, result, now)
+	return &result, nil
+}
+
+func (m *MemoryDatabase) UpdateComment(ctx context.Context, userid int64, id int64, message string) (*entity.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := &entity.Comment{}
+	c, ok := m.comments[id]
+	if !ok || c.UserID != userid {
+		return nil, ErrNotFound
+	}
+	c.Message = message
+	c.UpdatedAt = time.Now()
+	*result = *c
+	result.Mentions = m.setMentions(mentionSource{actorID: userid, photoID: c.PhotoID, commentID: &c.ID}, c.Message, c.UpdatedAt)
+	m.addToOutbox(entity.EventCommentUpdated, result, c.UpdatedAt)
+	return result, nil
+}
+
+func (m *MemoryDatabase) DeleteComment(ctx context.Context, userid int64, id int64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.comments[id]
+	if !ok || c.DeletedAt != nil || c.UserID != userid {
+		return "", ErrNotFound
+	}
+	delete(m.mentions, mentionKey{photoID: c.PhotoID, commentID: c.ID})
+	m.unnotify(func(n *entity.Notification) bool {
+		return n.CommentID != nil && *n.CommentID == c.ID
+	})
+	now := time.Now()
+	if m.hasReplies(c.ID) {
+		m.tombstone(c, now)
+	} else {
+		delete(m.comments, c.ID)
+		m.pruneTombstones(c.ParentCommentID)
+	}
+	m.addToOutbox(entity.EventCommentDeleted, entity.DeletedResource{ID: id, UserID: userid}, now)
+	return "Your photo has been successfully deleted", nil
+}
+
+// hasReplies tells whether any comment replies to id. Callers hold the lock.
+func (m *MemoryDatabase) hasReplies(id int64) bool {
+	for _, c := range m.comments {
+		if c.ParentCommentID != nil && *c.ParentCommentID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneTombstones deletes the tombstone parent once its last reply is gone,
+// then its own parent in the same way, up the thread. Callers hold the write
+// lock.
+func (m *MemoryDatabase) pruneTombstones(parent *int64) {
+	for parent != nil {
+		c, ok := m.comments[*parent]
+		if !ok || c.DeletedAt == nil || m.hasReplies(c.ID) {
+			return
+		}
+		delete(m.comments, c.ID)
+		parent = c.ParentCommentID
+	}
+}
+
+// tombstone blanks c the way DeleteComment does when it has replies. Callers
+// hold the write lock.
+func (m *MemoryDatabase) tombstone(c *entity.Comment, now time.Time) {
+	c.UserID = 0
+	c.Message = ""
+	c.UpdatedAt = now
+	c.DeletedAt = &now
+}
+
+// commentRoot is the top-level comment c's thread starts at. Callers hold the
+// lock.
+func (m *MemoryDatabase) commentRoot(c *entity.Comment) int64 {
+	for c.ParentCommentID != nil {
+		c = m.comments[*c.ParentCommentID]
+	}
+	return c.ID
+}
+
+func (m *MemoryDatabase) GetCommentReplies(ctx context.Context, commentid int64, page entity.PageRequest) (*entity.Page[entity.CommentGetOutput], error) {
+	result, err := m.GetComments(ctx, entity.CommentFilter{ParentID: commentid}, page)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Items) == 0 && !exists(m, m.comments, commentid) {
+		return nil, ErrNotFound
+	}
+	return result, nil
+}
+
+func (m *MemoryDatabase) GetPhotoCommentThreads(ctx context.Context, photoid int64, page entity.PageRequest) (*entity.Page[entity.CommentThread], error) {
+	roots, err := m.GetComments(ctx, entity.CommentFilter{PhotoID: photoid, TopLevel: true}, page)
+	if err != nil {
+		return nil, err
+	}
+	if len(roots.Items) == 0 && !exists(m, m.photos, photoid) {
+		return nil, ErrNotFound
+	}
+	onPage := map[int64]bool{}
+	for _, c := range roots.Items {
+		onPage[c.ID] = true
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var replies []entity.CommentGetOutput
+	for _, id := range sortedIDs(m.comments) {
+		c := m.comments[id]
+		if c.PhotoID != photoid || c.ParentCommentID == nil || !onPage[m.commentRoot(c)] {
+			continue
+		}
+		if row, ok := m.commentGetOutput(c); ok {
+			replies = append(replies, row)
+		}
+	}
+	return threadPage(roots, replies), nil
+}
+
+func (m *MemoryDatabase) GetSocialMedias(ctx context.Context, filter entity.SocialMediaFilter, page entity.PageRequest) (*entity.Page[entity.SocialMediaGetOutput], error) {
+	q, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
+	value, err := sortBy(&q, filter.Sort, socialMediaSorts)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var result []entity.SocialMediaGetOutput
+	for _, id := range sortedIDs(m.socialmedias) {
+		sm := m.socialmedias[id]
+		if (filter.UserID != 0 && sm.UserID != filter.UserID) || (filter.Search != "" && !contains(sm.Name, filter.Search)) {
+			continue
+		}
+		if row, ok := m.socialMediaGetOutput(sm); ok {
+			result = append(result, row)
+		}
+	}
+	id := func(row entity.SocialMediaGetOutput) int64 { return row.ID }
+	return makePage(readPage(result, q, id, value), q, id, value), nil
+}
+
+// socialMediaGetOutput joins sm with its owner like
+// socialMediaGetOutputQuery, and is not ok when the owner is gone. Callers
+// hold the lock.
+func (m *MemoryDatabase) socialMediaGetOutput(sm *entity.SocialMedia) (entity.SocialMediaGetOutput, bool) {
+	u, ok := m.users[sm.UserID]
+	if !ok {
+		return entity.SocialMediaGetOutput{}, false
+	}
+	row := entity.SocialMediaGetOutput{SocialMedia: *sm}
+	row.ProfileImageURL = nil
+	row.User.ID = sm.UserID
+	row.User.Username = u.Username
+	if sm.ProfileImageURL != nil {
+		row.User.ProfileImageURL = *sm.ProfileImageURL
+	}
+	return row, true
+}
+
+func (m *MemoryDatabase) GetUserSocialMedias(ctx context.Context, userid int64, page entity.PageRequest) (*entity.Page[entity.SocialMediaGetOutput], error) {
+	result, err := m.GetSocialMedias(ctx, entity.SocialMediaFilter{UserID: userid}, page)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Items) == 0 && !exists(m, m.users, userid) {
+		return nil, ErrNotFound
+	}
+	return result, nil
+}
+
+func (m *MemoryDatabase) GetSocialMediaByID(ctx context.Context, id int64) (*entity.SocialMediaGetOutput, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sm, ok := m.socialmedias[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result, ok := m.socialMediaGetOutput(sm)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &result, nil
+}
+
+func (m *MemoryDatabase) PostSocialMedia(ctx context.Context, userid int64, i entity.SocialMediaPost) (*entity.SocialMedia, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[userid]; !ok {
+		return nil, fmt.Errorf("%w: user %d does not exist", ErrForeignKey, userid)
+	}
+	now := time.Now()
+	profileImageURL := i.ProfileImageURL
+	sm := &entity.SocialMedia{
+		ID:              m.nextID("socialmedias"),
+		Name:            i.Name,
+		SocialMediaURL:  i.SocialMediaURL,
+		ProfileImageURL: &profileImageURL,
+		UserID:          userid,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	m.socialmedias[sm.ID] = sm
+	result := *sm
+	m.addToOutbox(entity.EventSocialMediaCreated, result, now)
+	return &result, nil
+}
+
+func (m *MemoryDatabase) UpdateSocialMedia(ctx context.Context, userid int64, id int64, i entity.SocialMediaPost) (*entity.SocialMedia, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := &entity.SocialMedia{}
+	sm, ok := m.socialmedias[id]
+	if !ok || sm.UserID != userid {
+		return nil, ErrNotFound
+	}
+	profileImageURL := i.ProfileImageURL
+	sm.Name = i.Name
+	sm.SocialMediaURL = i.SocialMediaURL
+	sm.ProfileImageURL = &profileImageURL
+	sm.UpdatedAt = time.Now()
+	*result = *sm
+	m.addToOutbox(entity.EventSocialMediaUpdated, result, sm.UpdatedAt)
+	return result, nil
+}
+
+func (m *MemoryDatabase) DeleteSocialMedia(ctx context.Context, userid int64, id int64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sm, ok := m.socialmedias[id]
+	if !ok || sm.UserID != userid {
+		return "", ErrNotFound
+	}
+	delete(m.socialmedias, sm.ID)
+	m.addToOutbox(entity.EventSocialMediaDeleted, entity.DeletedResource{ID: id, UserID: userid}, time.Now())
+	return "Your social media has been successfully deleted", nil
+}
+
+// setMentions works like the SQL one. Callers hold the write lock.
+func (m *MemoryDatabase) setMentions(src mentionSource, text string, now time.Time) []entity.Mention {
+	key := mentionKey{photoID: src.photoID}
+	if src.commentID != nil {
+		key.commentID = *src.commentID
+	}
+	mentioned := map[int64]bool{}
+	for _, mention := range m.mentions[key] {
+		mentioned[mention.UserID] = true
+	}
+	var mentions []entity.Mention
+	for _, t := range entity.ParseMentions(text) {
+		u := m.userByName(t.Username)
+		if u == nil {
+			continue
+		}
+		mentions = append(mentions, entity.Mention{UserID: u.ID, Offset: t.Offset, Length: t.Length})
+		if mentioned[u.ID] || u.ID == src.actorID {
+			continue
+		}
+		mentioned[u.ID] = true
+		m.notify(entity.NewMentionNotification(u.ID, src.actorID, src.photoID, src.commentID), now)
+	}
+	if mentions == nil {
+		delete(m.mentions, key)
+	} else {
+		m.mentions[key] = mentions
+	}
+	return m.mentionsOf(key)
+}
+
+// userByName is the earliest user called username whatever its case, the
+// way the SQL usersByName resolves mentions, nil if there is none. Callers
+// hold the lock.
+func (m *MemoryDatabase) userByName(username string) *entity.User {
+	for _, id := range sortedIDs(m.users) {
+		if u := m.users[id]; strings.EqualFold(u.Username, username) {
+			return u
+		}
+	}
+	return nil
+}
+
+// mentionsOf is the mentions of key with the users' current names. Callers
+// hold the lock.
+func (m *MemoryDatabase) mentionsOf(key mentionKey) []entity.Mention {
+	result := []entity.Mention{}
+	for _, mention := range m.mentions[key] {
+		if u, ok := m.users[mention.UserID]; ok {
+			mention.Username = u.Username
+			result = append(result, mention)
+		}
+	}
+	return result
+}
+
+// withoutUser is mentions less those of userid.
+func withoutUser(mentions []entity.Mention, userid int64) []entity.Mention {
+	var result []entity.Mention
+	for _, mention := range mentions {
+		if mention.UserID != userid {
+			result = append(result, mention)
+		}
+	}
+	return result
+}
+
+func (m *MemoryDatabase) GetNotifications(ctx context.Context, userid int64, filter entity.NotificationFilter, page entity.PageRequest) (*entity.Page[entity.Notification], error) {
+	q, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sortBy[entity.Notification](&q, entity.Sort{Desc: true}, nil); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var result []entity.Notification
+	for _, id := range sortedIDs(m.notifications) {
+		n := m.notifications[id]
+		if n.UserID != userid || filter.Unread && n.ReadAt != nil {
+			continue
+		}
+		row := *n
+		row.ActorUsername = m.users[n.ActorID].Username
+		result = append(result, row)
+	}
+	id := func(row entity.Notification) int64 { return row.ID }
+	return makePage(readPage(result, q, id, nil), q, id, nil), nil
+}
+
+func (m *MemoryDatabase) MarkNotificationsRead(ctx context.Context, userid int64, ids []int64) (*entity.NotificationReadOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := &entity.NotificationReadOutput{}
+	marked := map[int64]bool{}
+	for _, id := range ids {
+		marked[id] = true
+	}
+	now := time.Now()
+	for _, n := range m.notifications {
+		if n.UserID != userid || n.ReadAt != nil {
+			continue
+		}
+		if ids == nil || marked[n.ID] {
+			readAt := now
+			n.ReadAt = &readAt
+			result.Read++
+			continue
+		}
+		result.Unread++
+	}
+	return result, nil
+}
+
+// notify works like the SQL one. Callers hold the write lock.
+func (m *MemoryDatabase) notify(n entity.Notification, now time.Time) {
+	if n.UserID == n.ActorID {
+		return
+	}
+	n.ID = m.nextID("notifications")
+	n.CreatedAt = now
+	m.notifications[n.ID] = &n
+	Events.Publish(n)
+}
+
+// unnotify deletes the notifications matched by match. Callers hold the write
+// lock.
+func (m *MemoryDatabase) unnotify(match func(n *entity.Notification) bool) {
+	for id, n := range m.notifications {
+		if match(n) {
+			delete(m.notifications, id)
+		}
+	}
+}
+
+// addToOutbox works like the SQL one. Callers hold the write lock.
+func (m *MemoryDatabase) addToOutbox(t entity.WebhookEventType, data interface{}, now time.Time) {
+	e := entity.NewWebhookEvent(t, data)
+	e.ID = m.nextID("outbox")
+	e.CreatedAt = now
+	m.outbox[e.ID] = &outboxEvent{event: e}
+}
+
+// addDeletedToOutbox works like the SQL one. Callers hold the write lock.
+func (m *MemoryDatabase) addDeletedToOutbox(events []deletedEvent, now time.Time) {
+	for _, e := range events {
+		m.addToOutbox(e.event, e.resource, now)
+	}
+}
+
+func (m *MemoryDatabase) PostWebhook(ctx context.Context, userid int64, i entity.WebhookPost, secret string) (*entity.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[userid]; !ok {
+		return nil, fmt.Errorf("%w: user %d does not exist", ErrForeignKey, userid)
+	}
+	w := &entity.Webhook{
+		ID:        m.nextID("webhooks"),
+		UserID:    userid,
+		URL:       i.URL,
+		Events:    []entity.WebhookEventType{},
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	}
+	seen := map[entity.WebhookEventType]bool{}
+	for _, t := range i.Events {
+		if !seen[t] {
+			seen[t] = true
+			w.Events = append(w.Events, t)
+		}
+	}
+	sort.Slice(w.Events, func(i, j int) bool { return w.Events[i] < w.Events[j] })
+	m.webhooks[w.ID] = w
+	result := *w
+	return &result, nil
+}
+
+// webhook is w as read back: the SQL backends never read the secret back.
+func webhook(w *entity.Webhook) entity.Webhook {
+	result := *w
+	result.Events = append([]entity.WebhookEventType{}, w.Events...)
+	result.Secret = ""
+	return result
+}
+
+func (m *MemoryDatabase) GetWebhooks(ctx context.Context, page entity.PageRequest) (*entity.Page[entity.Webhook], error) {
+	q, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sortBy[entity.Webhook](&q, entity.Sort{}, nil); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var result []entity.Webhook
+	for _, id := range sortedIDs(m.webhooks) {
+		result = append(result, webhook(m.webhooks[id]))
+	}
+	id := func(row entity.Webhook) int64 { return row.ID }
+	return makePage(readPage(result, q, id, nil), q, id, nil), nil
+}
+
+func (m *MemoryDatabase) GetWebhookByID(ctx context.Context, id int64) (*entity.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	w, ok := m.webhooks[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := webhook(w)
+	return &result, nil
+}
+
+func (m *MemoryDatabase) DeleteWebhook(ctx context.Context, id int64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.webhooks[id]; !ok {
+		return "", ErrNotFound
+	}
+	m.deleteWebhook(id)
+	return "The webhook has been successfully deleted", nil
+}
+
+// deleteWebhook deletes webhook id and its deliveries. Callers hold the write
+// lock.
+func (m *MemoryDatabase) deleteWebhook(id int64) {
+	for deliveryID, d := range m.deliveries {
+		if d.WebhookID == id {
+			delete(m.deliveries, deliveryID)
+		}
+	}
+	delete(m.webhooks, id)
+}
+
+// delivery is d as read back, ready to send. Callers hold the lock.
+func (m *MemoryDatabase) delivery(d *entity.WebhookDelivery) entity.WebhookDelivery {
+	result := *d
+	if d.DeliveredAt != nil {
+		deliveredAt := *d.DeliveredAt
+		result.DeliveredAt = &deliveredAt
+	}
+	w := m.webhooks[d.WebhookID]
+	result.URL = w.URL
+	result.Secret = w.Secret
+	return result
+}
+
+func (m *MemoryDatabase) GetWebhookDeliveries(ctx context.Context, webhookid int64, status entity.DeliveryStatus, page entity.PageRequest) (*entity.Page[entity.WebhookDelivery], error) {
+	q, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sortBy[entity.WebhookDelivery](&q, entity.Sort{}, nil); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.webhooks[webhookid]; !ok {
+		return nil, ErrNotFound
+	}
+	var result []entity.WebhookDelivery
+	for _, id := range sortedIDs(m.deliveries) {
+		d := m.deliveries[id]
+		if d.WebhookID == webhookid && d.Status == status {
+			result = append(result, m.delivery(d))
+		}
+	}
+	id := func(row entity.WebhookDelivery) int64 { return row.ID }
+	return makePage(readPage(result, q, id, nil), q, id, nil), nil
+}
+
+func (m *MemoryDatabase) RetryWebhookDelivery(ctx context.Context, id int64) (*entity.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.deliveries[id]
+	if !ok || d.Status != entity.DeliveryDead {
+		return nil, ErrNotFound
+	}
+	d.Status = entity.DeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = time.Now()
+	result := m.delivery(d)
+	return &result, nil
+}
+
+func (m *MemoryDatabase) DispatchOutbox(ctx context.Context, now time.Time, limit int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result int
+	for _, id := range sortedIDs(m.outbox) {
+		if result == limit {
+			break
+		}
+		o := m.outbox[id]
+		if o.dispatched {
+			continue
+		}
+		o.dispatched, o.dispatchedAt = true, now
+		result++
+		for _, webhookID := range sortedIDs(m.webhooks) {
+			if !subscribed(m.webhooks[webhookID], o.event.Type) {
+				continue
+			}
+			d := &entity.WebhookDelivery{
+				ID:            m.nextID("webhookdeliveries"),
+				WebhookID:     webhookID,
+				Status:        entity.DeliveryPending,
+				NextAttemptAt: now,
+				CreatedAt:     now,
+				Event:         o.event,
+			}
+			m.deliveries[d.ID] = d
+		}
+	}
+	return result, nil
+}
+
+// subscribed tells whether w subscribed to t.
+func subscribed(w *entity.Webhook, t entity.WebhookEventType) bool {
+	for _, e := range w.Events {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryDatabase) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entity.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []*entity.WebhookDelivery
+	for _, d := range m.deliveries {
+		if d.Status == entity.DeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	var result []entity.WebhookDelivery
+	for _, d := range due {
+		if len(result) == limit {
+			break
+		}
+		result = append(result, m.delivery(d))
+		d.NextAttemptAt = now.Add(lease)
+	}
+	return result, nil
+}
+
+func (m *MemoryDatabase) UpdateWebhookDelivery(ctx context.Context, i entity.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.deliveries[i.ID]
+	if !ok {
+		return nil
+	}
+	d.Status = i.Status
+	d.Attempts = i.Attempts
+	d.NextAttemptAt = i.NextAttemptAt
+	d.LastStatus = i.LastStatus
+	d.LastError = i.LastError
+	d.DeliveredAt = nil
+	if i.DeliveredAt != nil {
+		deliveredAt := *i.DeliveredAt
+		d.DeliveredAt = &deliveredAt
+	}
+	return nil
+}
+
+func (m *MemoryDatabase) PruneWebhookOutbox(ctx context.Context, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	left := map[int64]bool{}
+	for id, d := range m.deliveries {
+		if d.Status == entity.DeliveryDelivered && d.DeliveredAt != nil && d.DeliveredAt.Before(before) {
+			delete(m.deliveries, id)
+			continue
+		}
+		left[d.Event.ID] = true
+	}
+	for id, o := range m.outbox {
+		if o.dispatched && o.dispatchedAt.Before(before) && !left[id] {
+			delete(m.outbox, id)
+		}
+	}
+	return nil
+}
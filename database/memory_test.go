@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"mygram/entity"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryDatabase_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDatabase()
+	u, err := db.Register(ctx, entity.UserRegister{Username: "user", Email: "user@email.com", Password: "hash", Age: 20})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p, err := db.PostPhoto(ctx, int64(u.ID), entity.PhotoPost{Title: fmt.Sprint(i), PhotoUrl: "https://photo.domain.com"})
+			assert.NoError(t, err)
+			_, err = db.PostComment(ctx, int64(u.ID), entity.CommentPost{PhotoID: int(p.ID), Message: "nice"})
+			assert.NoError(t, err)
+			_, err = db.GetPhotos(ctx, 0, entity.PhotoFilter{}, entity.PageRequest{})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	photos, err := db.GetPhotos(ctx, 0, entity.PhotoFilter{}, entity.PageRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, photos.Items, 20)
+	seen := map[int64]bool{}
+	for _, p := range photos.Items {
+		assert.False(t, seen[p.ID])
+		seen[p.ID] = true
+	}
+	comments, err := db.GetComments(ctx, entity.CommentFilter{}, entity.PageRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, comments.Items, 20)
+}
+
+func TestMemoryDatabase_OwnershipFilters(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDatabase()
+	u, err := db.Register(ctx, entity.UserRegister{Username: "user", Email: "user@email.com", Password: "hash", Age: 20})
+	require.NoError(t, err)
+	p, err := db.PostPhoto(ctx, int64(u.ID), entity.PhotoPost{Title: "title", PhotoUrl: "https://photo.domain.com"})
+	require.NoError(t, err)
+
+	_, err = db.UpdatePhoto(ctx, int64(u.ID)+1, p.ID, entity.PhotoPost{Title: "stolen", PhotoUrl: "https://photo.domain.com"})
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = db.DeletePhoto(ctx, int64(u.ID)+1, p.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	got, err := db.GetPhotoByID(ctx, 0, p.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "title", got.Title)
+
+	// changes to a returned row never leak into the store
+	got.Title = "changed"
+	again, _ := db.GetPhotoByID(ctx, 0, p.ID)
+	assert.Equal(t, "title", again.Title)
+}
+
+func TestMemoryDatabase_DuplicateUser(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDatabase()
+	_, err := db.Register(ctx, entity.UserRegister{Username: "user", Email: "user@email.com", Password: "hash", Age: 20})
+	require.NoError(t, err)
+	_, err = db.Register(ctx, entity.UserRegister{Username: "other", Email: "user@email.com", Password: "hash", Age: 20})
+	assert.ErrorIs(t, err, ErrConflict)
+}
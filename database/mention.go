@@ -0,0 +1,204 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"mygram/entity"
+	"strings"
+	"time"
+)
+
+// mentionSource is the text mentions are written in: the caption of photoID,
+// or the comment commentID on it. actorID wrote it.
+type mentionSource struct {
+	actorID   int64
+	photoID   int64
+	commentID *int64
+}
+
+// where matches the mentions and notifications of the text.
+func (src mentionSource) where() (string, []interface{}) {
+	if src.commentID != nil {
+		return "commentid = @commentid", []interface{}{sql.Named("commentid", *src.commentID)}
+	}
+	return "photoid = @photoid and commentid is null", []interface{}{sql.Named("photoid", src.photoID)}
+}
+
+// setMentions replaces the mentions of src with the @usernames of text that
+// name a user, and tells the users newly mentioned. Posting is when the text
+// is new, so it has no mentions yet. The mentions are returned in order.
+func (s *Database) setMentions(ctx context.Context, tx *sql.Tx, src mentionSource, text string, posting bool, now time.Time) ([]entity.Mention, error) {
+	result := []entity.Mention{}
+	tokens := entity.ParseMentions(text)
+	where, args := src.where()
+	if len(tokens) == 0 {
+		if posting {
+			return result, nil
+		}
+		_, err := s.txExecContext(ctx, tx, "delete from mentions where "+where, args...)
+		return result, err
+	}
+
+	users, err := s.usersByName(ctx, tx, tokens)
+	if err != nil {
+		return nil, err
+	}
+	mentioned := map[int64]bool{}
+	if !posting {
+		rows, err := s.txQueryContext(ctx, tx, "select userid from mentions where "+where, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return nil, err
+			}
+			mentioned[id] = true
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		rows.Close()
+		if _, err := s.txExecContext(ctx, tx, "delete from mentions where "+where, args...); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, t := range tokens {
+		user, ok := users[strings.ToLower(t.Username)]
+		if !ok {
+			continue
+		}
+		userid := user.UserID
+		_, err := s.txExecContext(ctx, tx, "insert into mentions (photoid, commentid, userid, textoffset, textlength, createdat)"+
+			" values (@photoid, @commentid, @userid, @textoffset, @textlength, @createdat)",
+			sql.Named("photoid", src.photoID),
+			sql.Named("commentid", src.commentID),
+			sql.Named("userid", userid),
+			sql.Named("textoffset", t.Offset),
+			sql.Named("textlength", t.Length),
+			sql.Named("createdat", now))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entity.Mention{UserID: userid, Username: user.Username, Offset: t.Offset, Length: t.Length})
+		if mentioned[userid] || userid == src.actorID {
+			continue
+		}
+		mentioned[userid] = true
+		n := entity.NewMentionNotification(userid, src.actorID, src.photoID, src.commentID)
+		if err := s.notify(ctx, tx, n, now); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// usersByName resolves the usernames of tokens to users, keyed by the
+// lowercase name: a mention matches a username whatever its case, and the
+// earliest user when several names differ only in case. Names of no user are
+// left out.
+func (s *Database) usersByName(ctx context.Context, tx *sql.Tx, tokens []entity.MentionToken) (map[string]entity.Mention, error) {
+	result := map[string]entity.Mention{}
+	names := make([]string, len(tokens))
+	for i, t := range tokens {
+		names[i] = strings.ToLower(t.Username)
+	}
+	list, args := namedList("username", names)
+	rows, err := s.txQueryContext(ctx, tx, "select id, username from users where lower(username) in ("+list+") order by id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var username string
+		if err := rows.Scan(&id, &username); err != nil {
+			return nil, err
+		}
+		if _, ok := result[strings.ToLower(username)]; !ok {
+			result[strings.ToLower(username)] = entity.Mention{UserID: id, Username: username}
+		}
+	}
+	return result, rows.Err()
+}
+
+// photoMentions reads the mentions in the captions of the photos ids.
+func (s *Database) photoMentions(ctx context.Context, ids []int64) (map[int64][]entity.Mention, error) {
+	return s.readMentions(ctx, "m.photoid", "m.commentid is null and m.photoid", ids)
+}
+
+// commentMentions reads the mentions in the comments ids.
+func (s *Database) commentMentions(ctx context.Context, ids []int64) (map[int64][]entity.Mention, error) {
+	return s.readMentions(ctx, "m.commentid", "m.commentid", ids)
+}
+
+// readMentions reads the mentions whose column is one of ids, by key, each
+// text's in order.
+func (s *Database) readMentions(ctx context.Context, key string, column string, ids []int64) (map[int64][]entity.Mention, error) {
+	result := map[int64][]entity.Mention{}
+	if len(ids) == 0 {
+		return result, nil
+	}
+	list, args := namedList("id", ids)
+	rows, err := s.queryContext(ctx, "select "+key+", m.userid, u.username, m.textoffset, m.textlength from mentions m join users u on m.userid=u.id"+
+		" where "+column+" in ("+list+") order by "+key+", m.textoffset", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var row entity.Mention
+		if err := rows.Scan(&id, &row.UserID, &row.Username, &row.Offset, &row.Length); err != nil {
+			return nil, err
+		}
+		result[id] = append(result[id], row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// withPhotoMentions fills in the mentions of photos.
+func (s *Database) withPhotoMentions(ctx context.Context, photos []entity.PhotoGetOutput) error {
+	ids := make([]int64, len(photos))
+	for i, p := range photos {
+		ids[i] = p.ID
+	}
+	mentions, err := s.photoMentions(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range photos {
+		photos[i].Mentions = mentionsOrEmpty(mentions[photos[i].ID])
+	}
+	return nil
+}
+
+// withCommentMentions fills in the mentions of comments.
+func (s *Database) withCommentMentions(ctx context.Context, comments []entity.CommentGetOutput) error {
+	ids := make([]int64, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+	mentions, err := s.commentMentions(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		comments[i].Mentions = mentionsOrEmpty(mentions[comments[i].ID])
+	}
+	return nil
+}
+
+// mentionsOrEmpty is mentions, [] rather than null in JSON when there are none.
+func mentionsOrEmpty(mentions []entity.Mention) []entity.Mention {
+	if mentions == nil {
+		return []entity.Mention{}
+	}
+	return mentions
+}
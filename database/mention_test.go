@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"mygram/entity"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expectMentions expects the read of the mentions of the photos or comments
+// ids, key being m.photoid or m.commentid, and returns rows.
+func expectMentions(mock sqlmock.Sqlmock, key string, rows *sqlmock.Rows, ids ...driver.Value) {
+	mock.ExpectQuery(regexp.QuoteMeta("select " + key + ", m.userid, u.username, m.textoffset, m.textlength from mentions m")).
+		WithArgs(ids...).
+		WillReturnRows(rows)
+}
+
+func mentionRows(mock sqlmock.Sqlmock) *sqlmock.Rows {
+	return mock.NewRows([]string{"id", "userid", "username", "textoffset", "textlength"})
+}
+
+func TestDatabase_PostPhotoMentions(t *testing.T) {
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	inp := entity.PhotoPost{Title: "Foto Kopi", Caption: "with @Ann and @nobody, @ann again", PhotoUrl: "https://imageurl.com/fotokopi.jpg"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("insert into photos")).
+		WillReturnRows(mock.NewRows([]string{"id", "title", "caption", "photourl", "userid", "createdat"}).
+			AddRow(3, inp.Title, inp.Caption, inp.PhotoUrl, 1, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("select id, username from users where lower(username) in (@username0, @username1, @username2) order by id")).
+		WithArgs("ann", "nobody", "ann").
+		WillReturnRows(mock.NewRows([]string{"id", "username"}).AddRow(2, "ann"))
+	insert := regexp.QuoteMeta("insert into mentions (photoid, commentid, userid, textoffset, textlength, createdat)")
+	mock.ExpectExec(insert).
+		WithArgs(int64(3), nil, int64(2), 5, 4, AnyTime{}).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("insert into notifications (userid, type, actorid, photoid, commentid, payload, createdat)")).
+		WithArgs(int64(2), "mention", int64(1), int64(3), nil, `{"photo_id":3,"comment_id":null}`, AnyTime{}).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+	// ann is told once, however often she is mentioned
+	mock.ExpectExec(insert).
+		WithArgs(int64(3), nil, int64(2), 23, 4, AnyTime{}).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	expectOutbox(mock, entity.EventPhotoCreated)
+	mock.ExpectCommit()
+
+	out, err := dbtes.PostPhoto(ctx, 1, inp)
+	require.NoError(t, err)
+	assert.Equal(t, []entity.Mention{
+		{UserID: 2, Username: "ann", Offset: 5, Length: 4},
+		{UserID: 2, Username: "ann", Offset: 23, Length: 4},
+	}, out.Mentions)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
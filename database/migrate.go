@@ -0,0 +1,213 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is one versioned schema change, read from
+// migrations/<version>_<name>.up.sql and its matching .down.sql.
+type Migration struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+	up        string
+	down      string
+}
+
+func (m Migration) Applied() bool {
+	return m.AppliedAt != nil
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Migrator is implemented by the SQL backends. The memory one has no schema.
+type Migrator interface {
+	MigrateUp(ctx context.Context) ([]Migration, error)
+	MigrateDown(ctx context.Context) (*Migration, error)
+	MigrationStatus(ctx context.Context) ([]Migration, error)
+}
+
+// PendingMigrations lists the migrations m has not applied yet.
+func PendingMigrations(ctx context.Context, m Migrator) ([]Migration, error) {
+	status, err := m.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result []Migration
+	for _, migration := range status {
+		if !migration.Applied() {
+			result = append(result, migration)
+		}
+	}
+	return result, nil
+}
+
+func loadMigrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		direction := "up"
+		if strings.HasSuffix(name, ".down.sql") {
+			direction = "down"
+		}
+		parts := strings.SplitN(strings.TrimSuffix(name, "."+direction+".sql"), "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("migration %s: expected <version>_<name>.<up|down>.sql", name)
+		}
+		b, err := migrationFiles.ReadFile("migrations/" + name)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.up = string(b)
+		} else {
+			m.down = string(b)
+		}
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %s: needs both an up and a down file", m)
+		}
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// renderMigration fills the column types of the connected server into qry.
+func (s *Database) renderMigration(qry string) (string, error) {
+	t, err := template.New("migration").Option("missingkey=error").Parse(qry)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, s.sqlDialect().types()); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func (s *Database) MigrationStatus(ctx context.Context) ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	t := s.sqlDialect().types()
+	_, err = s.execContext(ctx, s.sqlDialect().createIfNotExists("schemamigrations",
+		"version int not null primary key, name "+t.String+" not null, appliedat "+t.Timestamp+" not null"))
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[int]time.Time{}
+	rows, err := s.queryContext(ctx, "select version, appliedat from schemamigrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range migrations {
+		if at, ok := applied[migrations[i].Version]; ok {
+			migrations[i].AppliedAt = &at
+		}
+	}
+	return migrations, nil
+}
+
+// MigrateUp applies every pending migration in order, each in its own transaction.
+func (s *Database) MigrateUp(ctx context.Context) ([]Migration, error) {
+	status, err := s.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result []Migration
+	for _, m := range status {
+		if m.Applied() {
+			continue
+		}
+		now := time.Now()
+		err := s.runMigration(ctx, m.up, "insert into schemamigrations (version, name, appliedat) values (@version, @name, @appliedat)",
+			sql.Named("version", m.Version),
+			sql.Named("name", m.Name),
+			sql.Named("appliedat", now))
+		if err != nil {
+			return result, fmt.Errorf("migration %s: %w", m, err)
+		}
+		m.AppliedAt = &now
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// MigrateDown rolls back the latest applied migration. It returns nil when there is none.
+func (s *Database) MigrateDown(ctx context.Context) (*Migration, error) {
+	status, err := s.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(status) - 1; i >= 0; i-- {
+		m := status[i]
+		if !m.Applied() {
+			continue
+		}
+		err := s.runMigration(ctx, m.down, "delete from schemamigrations where version = @version",
+			sql.Named("version", m.Version))
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", m, err)
+		}
+		m.AppliedAt = nil
+		return &m, nil
+	}
+	return nil, nil
+}
+
+// runMigration runs the migration script and its bookkeeping statement in one transaction.
+func (s *Database) runMigration(ctx context.Context, script string, record string, args ...interface{}) error {
+	qry, err := s.renderMigration(script)
+	if err != nil {
+		return err
+	}
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, qry); err != nil {
+			return err
+		}
+		_, err := s.txExecContext(ctx, tx, record, args...)
+		return err
+	})
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	assert.Equal(t, 1, migrations[0].Version)
+	assert.Equal(t, "init", migrations[0].Name)
+	for i, m := range migrations {
+		assert.NotEmpty(t, m.up, m.String())
+		assert.NotEmpty(t, m.down, m.String())
+		if i > 0 {
+			assert.Greater(t, m.Version, migrations[i-1].Version)
+		}
+	}
+}
+
+func TestRenderMigration(t *testing.T) {
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+	for _, d := range []dialect{sqlServerDialect{}, postgresDialect{}, sqliteDialect{}} {
+		db := &Database{dialect: d}
+		for _, m := range migrations {
+			for _, script := range []string{m.up, m.down} {
+				qry, err := db.renderMigration(script)
+				require.NoError(t, err, m.String())
+				assert.NotContains(t, qry, "{{", m.String())
+			}
+		}
+	}
+	qry, err := (&Database{dialect: postgresDialect{}}).renderMigration("create table t (id {{.ID}})")
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(qry, "bigserial"), qry)
+}
+
+func TestSqliteMigrations(t *testing.T) {
+	ctx := context.Background()
+	conn, err := NewSqliteConnection("file:" + t.TempDir() + "/mygram.db")
+	require.NoError(t, err)
+	db := conn.(*Database)
+	defer db.CloseConnection()
+
+	pending, err := PendingMigrations(ctx, db)
+	require.NoError(t, err)
+	all, err := loadMigrations()
+	require.NoError(t, err)
+	assert.Len(t, pending, len(all))
+
+	applied, err := db.MigrateUp(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(all))
+	for _, m := range applied {
+		assert.True(t, m.Applied())
+	}
+
+	// Running it again is a no-op.
+	applied, err = db.MigrateUp(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+	pending, err = PendingMigrations(ctx, db)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	last := all[len(all)-1]
+	down, err := db.MigrateDown(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, down)
+	assert.Equal(t, last.Version, down.Version)
+	assert.False(t, down.Applied())
+
+	status, err := db.MigrationStatus(ctx)
+	require.NoError(t, err)
+	assert.False(t, status[len(status)-1].Applied())
+
+	for down != nil {
+		down, err = db.MigrateDown(ctx)
+		require.NoError(t, err)
+	}
+	_, err = db.SqlDb.Exec("select 1 from users")
+	assert.Error(t, err, "users should be dropped")
+
+	_, err = db.MigrateUp(ctx)
+	require.NoError(t, err)
+	_, err = db.SqlDb.Exec("select 1 from users")
+	assert.NoError(t, err)
+}
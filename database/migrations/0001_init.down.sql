@@ -0,0 +1,6 @@
+drop table revokedtokens;
+drop table refreshtokens;
+drop table socialmedias;
+drop table comments;
+drop table photos;
+drop table users;
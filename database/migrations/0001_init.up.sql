@@ -0,0 +1,58 @@
+create table users (
+	id {{.ID}},
+	username {{.String}} not null unique,
+	email {{.String}} not null unique,
+	password {{.String}} not null,
+	age int not null,
+	role varchar(20) not null default 'user',
+	tokengeneration int not null default 0,
+	createdat {{.Timestamp}} not null,
+	updatedat {{.Timestamp}} not null
+);
+
+create table photos (
+	id {{.ID}},
+	title {{.String}} not null,
+	caption {{.Text}},
+	photourl {{.Text}} not null,
+	userid {{.BigInt}} not null,
+	createdat {{.Timestamp}} not null,
+	updatedat {{.Timestamp}} not null
+);
+
+create table comments (
+	id {{.ID}},
+	userid {{.BigInt}} not null,
+	photoid {{.BigInt}} not null,
+	message {{.Text}} not null,
+	createdat {{.Timestamp}} not null,
+	updatedat {{.Timestamp}} not null
+);
+
+create table socialmedias (
+	id {{.ID}},
+	name {{.String}} not null,
+	socialmediaurl {{.Text}} not null,
+	profileimageurl {{.Text}},
+	userid {{.BigInt}} not null,
+	createdat {{.Timestamp}} not null,
+	updatedat {{.Timestamp}} not null
+);
+
+create table refreshtokens (
+	id {{.ID}},
+	userid {{.BigInt}} not null,
+	familyid varchar(64) not null,
+	tokenhash varchar(64) not null unique,
+	expiresat {{.Timestamp}} not null,
+	revoked {{.Bool}} not null default 0,
+	createdat {{.Timestamp}} not null
+);
+
+create index ix_refreshtokens_familyid on refreshtokens (familyid);
+create index ix_refreshtokens_userid on refreshtokens (userid);
+
+create table revokedtokens (
+	jti varchar(64) not null primary key,
+	expiresat {{.Timestamp}} not null
+);
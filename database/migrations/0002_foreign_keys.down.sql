@@ -0,0 +1,68 @@
+drop index ix_socialmedias_userid{{if eq .Name "sqlserver"}} on socialmedias{{end}};
+drop index ix_comments_userid{{if eq .Name "sqlserver"}} on comments{{end}};
+drop index ix_comments_photoid{{if eq .Name "sqlserver"}} on comments{{end}};
+drop index ix_photos_userid{{if eq .Name "sqlserver"}} on photos{{end}};
+{{if eq .Name "sqlite"}}
+create table refreshtokens_old (
+	id {{.ID}},
+	userid {{.BigInt}} not null,
+	familyid varchar(64) not null,
+	tokenhash varchar(64) not null unique,
+	expiresat {{.Timestamp}} not null,
+	revoked {{.Bool}} not null default 0,
+	createdat {{.Timestamp}} not null
+);
+insert into refreshtokens_old (id, userid, familyid, tokenhash, expiresat, revoked, createdat)
+	select id, userid, familyid, tokenhash, expiresat, revoked, createdat from refreshtokens;
+drop table refreshtokens;
+alter table refreshtokens_old rename to refreshtokens;
+create index ix_refreshtokens_familyid on refreshtokens (familyid);
+create index ix_refreshtokens_userid on refreshtokens (userid);
+
+create table socialmedias_old (
+	id {{.ID}},
+	name {{.String}} not null,
+	socialmediaurl {{.Text}} not null,
+	profileimageurl {{.Text}},
+	userid {{.BigInt}} not null,
+	createdat {{.Timestamp}} not null,
+	updatedat {{.Timestamp}} not null
+);
+insert into socialmedias_old (id, name, socialmediaurl, profileimageurl, userid, createdat, updatedat)
+	select id, name, socialmediaurl, profileimageurl, userid, createdat, updatedat from socialmedias;
+drop table socialmedias;
+alter table socialmedias_old rename to socialmedias;
+
+create table comments_old (
+	id {{.ID}},
+	userid {{.BigInt}} not null,
+	photoid {{.BigInt}} not null,
+	message {{.Text}} not null,
+	createdat {{.Timestamp}} not null,
+	updatedat {{.Timestamp}} not null
+);
+insert into comments_old (id, userid, photoid, message, createdat, updatedat)
+	select id, userid, photoid, message, createdat, updatedat from comments;
+drop table comments;
+alter table comments_old rename to comments;
+
+create table photos_old (
+	id {{.ID}},
+	title {{.String}} not null,
+	caption {{.Text}},
+	photourl {{.Text}} not null,
+	userid {{.BigInt}} not null,
+	createdat {{.Timestamp}} not null,
+	updatedat {{.Timestamp}} not null
+);
+insert into photos_old (id, title, caption, photourl, userid, createdat, updatedat)
+	select id, title, caption, photourl, userid, createdat, updatedat from photos;
+drop table photos;
+alter table photos_old rename to photos;
+{{else}}
+alter table refreshtokens drop constraint fk_refreshtokens_users;
+alter table socialmedias drop constraint fk_socialmedias_users;
+alter table comments drop constraint fk_comments_photos;
+alter table comments drop constraint fk_comments_users;
+alter table photos drop constraint fk_photos_users;
+{{end}}
@@ -0,0 +1,77 @@
+-- Rows left behind by deletes that used to run outside a transaction.
+delete from photos where userid not in (select id from users);
+delete from comments where photoid not in (select id from photos) or userid not in (select id from users);
+delete from socialmedias where userid not in (select id from users);
+delete from refreshtokens where userid not in (select id from users);
+
+-- The constraints don't cascade: SQL Server refuses the two paths from users
+-- to comments, so deletes cascade in code, inside one transaction.
+{{if eq .Name "sqlite"}}
+-- SQLite can't add a constraint to an existing table, so the tables are rebuilt.
+create table photos_new (
+	id {{.ID}},
+	title {{.String}} not null,
+	caption {{.Text}},
+	photourl {{.Text}} not null,
+	userid {{.BigInt}} not null references users (id),
+	createdat {{.Timestamp}} not null,
+	updatedat {{.Timestamp}} not null
+);
+insert into photos_new (id, title, caption, photourl, userid, createdat, updatedat)
+	select id, title, caption, photourl, userid, createdat, updatedat from photos;
+drop table photos;
+alter table photos_new rename to photos;
+
+create table comments_new (
+	id {{.ID}},
+	userid {{.BigInt}} not null references users (id),
+	photoid {{.BigInt}} not null references photos (id),
+	message {{.Text}} not null,
+	createdat {{.Timestamp}} not null,
+	updatedat {{.Timestamp}} not null
+);
+insert into comments_new (id, userid, photoid, message, createdat, updatedat)
+	select id, userid, photoid, message, createdat, updatedat from comments;
+drop table comments;
+alter table comments_new rename to comments;
+
+create table socialmedias_new (
+	id {{.ID}},
+	name {{.String}} not null,
+	socialmediaurl {{.Text}} not null,
+	profileimageurl {{.Text}},
+	userid {{.BigInt}} not null references users (id),
+	createdat {{.Timestamp}} not null,
+	updatedat {{.Timestamp}} not null
+);
+insert into socialmedias_new (id, name, socialmediaurl, profileimageurl, userid, createdat, updatedat)
+	select id, name, socialmediaurl, profileimageurl, userid, createdat, updatedat from socialmedias;
+drop table socialmedias;
+alter table socialmedias_new rename to socialmedias;
+
+create table refreshtokens_new (
+	id {{.ID}},
+	userid {{.BigInt}} not null references users (id),
+	familyid varchar(64) not null,
+	tokenhash varchar(64) not null unique,
+	expiresat {{.Timestamp}} not null,
+	revoked {{.Bool}} not null default 0,
+	createdat {{.Timestamp}} not null
+);
+insert into refreshtokens_new (id, userid, familyid, tokenhash, expiresat, revoked, createdat)
+	select id, userid, familyid, tokenhash, expiresat, revoked, createdat from refreshtokens;
+drop table refreshtokens;
+alter table refreshtokens_new rename to refreshtokens;
+create index ix_refreshtokens_familyid on refreshtokens (familyid);
+create index ix_refreshtokens_userid on refreshtokens (userid);
+{{else}}
+alter table photos add constraint fk_photos_users foreign key (userid) references users (id);
+alter table comments add constraint fk_comments_users foreign key (userid) references users (id);
+alter table comments add constraint fk_comments_photos foreign key (photoid) references photos (id);
+alter table socialmedias add constraint fk_socialmedias_users foreign key (userid) references users (id);
+alter table refreshtokens add constraint fk_refreshtokens_users foreign key (userid) references users (id);
+{{end}}
+create index ix_photos_userid on photos (userid);
+create index ix_comments_photoid on comments (photoid);
+create index ix_comments_userid on comments (userid);
+create index ix_socialmedias_userid on socialmedias (userid);
@@ -0,0 +1,6 @@
+drop index ix_socialmedias_userid{{if eq .Name "sqlserver"}} on socialmedias{{end}};
+drop index ix_comments_photoid{{if eq .Name "sqlserver"}} on comments{{end}};
+drop index ix_photos_userid{{if eq .Name "sqlserver"}} on photos{{end}};
+create index ix_photos_userid on photos (userid);
+create index ix_comments_photoid on comments (photoid);
+create index ix_socialmedias_userid on socialmedias (userid);
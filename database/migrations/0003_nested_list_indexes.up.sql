@@ -0,0 +1,9 @@
+-- The nested lists read one photo's comments, or one user's photos and
+-- social media, in id order. With the id in the index they seek straight to
+-- the page cursor.
+drop index ix_photos_userid{{if eq .Name "sqlserver"}} on photos{{end}};
+drop index ix_comments_photoid{{if eq .Name "sqlserver"}} on comments{{end}};
+drop index ix_socialmedias_userid{{if eq .Name "sqlserver"}} on socialmedias{{end}};
+create index ix_photos_userid on photos (userid, id);
+create index ix_comments_photoid on comments (photoid, id);
+create index ix_socialmedias_userid on socialmedias (userid, id);
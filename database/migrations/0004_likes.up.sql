@@ -0,0 +1,10 @@
+create table likes (
+	id {{.ID}},
+	photoid {{.BigInt}} not null references photos (id),
+	userid {{.BigInt}} not null references users (id),
+	createdat {{.Timestamp}} not null,
+	constraint uq_likes_photoid_userid unique (photoid, userid)
+);
+-- A photo's likes are listed in id order; a user's are removed with the user.
+create index ix_likes_photoid on likes (photoid, id);
+create index ix_likes_userid on likes (userid);
@@ -0,0 +1,11 @@
+create table follows (
+	id {{.ID}},
+	followerid {{.BigInt}} not null references users (id),
+	followeeid {{.BigInt}} not null references users (id),
+	createdat {{.Timestamp}} not null,
+	constraint uq_follows_followerid_followeeid unique (followerid, followeeid),
+	constraint ck_follows_not_self check (followerid <> followeeid)
+);
+-- Both lists of a user are read in id order.
+create index ix_follows_followerid on follows (followerid, id);
+create index ix_follows_followeeid on follows (followeeid, id);
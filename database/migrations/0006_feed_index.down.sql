@@ -0,0 +1 @@
+drop index ix_photos_userid_createdat{{if eq .Name "sqlserver"}} on photos{{end}};
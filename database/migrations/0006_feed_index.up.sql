@@ -0,0 +1,3 @@
+-- The feed reads the photos of every followed user newest first. With the
+-- time in the index, each user's photos are read in order, from the cursor on.
+create index ix_photos_userid_createdat on photos (userid, createdat, id);
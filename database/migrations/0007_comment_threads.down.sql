@@ -0,0 +1,34 @@
+-- Threads flatten back into a photo's list; tombstones have nowhere to go.
+{{if eq .Name "sqlite"}}
+create table comments_old (
+	id {{.ID}},
+	userid {{.BigInt}} not null references users (id),
+	photoid {{.BigInt}} not null references photos (id),
+	message {{.Text}} not null,
+	createdat {{.Timestamp}} not null,
+	updatedat {{.Timestamp}} not null
+);
+insert into comments_old (id, userid, photoid, message, createdat, updatedat)
+	select id, userid, photoid, message, createdat, updatedat from comments where deletedat is null;
+drop table comments;
+alter table comments_old rename to comments;
+create index ix_comments_photoid on comments (photoid, id);
+create index ix_comments_userid on comments (userid);
+{{else}}
+drop index ix_comments_rootid{{if eq .Name "sqlserver"}} on comments{{end}};
+drop index ix_comments_parentid{{if eq .Name "sqlserver"}} on comments{{end}};
+alter table comments drop constraint fk_comments_parent;
+delete from comments where deletedat is not null;
+alter table comments drop column parentid;
+alter table comments drop column rootid;
+alter table comments drop column deletedat;
+{{if eq .Name "sqlserver"}}
+alter table comments drop constraint fk_comments_users;
+drop index ix_comments_userid on comments;
+alter table comments alter column userid bigint not null;
+alter table comments add constraint fk_comments_users foreign key (userid) references users (id);
+create index ix_comments_userid on comments (userid);
+{{else}}
+alter table comments alter column userid set not null;
+{{end}}
+{{end}}
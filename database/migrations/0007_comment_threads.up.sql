@@ -0,0 +1,42 @@
+-- Replies point at the comment they answer, and at the top-level comment of
+-- their thread, so a page of threads is read with one range on rootid.
+-- A deleted comment that has replies stays as a tombstone: no author, no
+-- message, deletedat set. Its author may be gone, hence the nullable userid.
+{{if eq .Name "sqlite"}}
+create table comments_new (
+	id {{.ID}},
+	userid {{.BigInt}} references users (id),
+	photoid {{.BigInt}} not null references photos (id),
+	parentid {{.BigInt}} references comments (id),
+	rootid {{.BigInt}},
+	message {{.Text}} not null,
+	createdat {{.Timestamp}} not null,
+	updatedat {{.Timestamp}} not null,
+	deletedat {{.Timestamp}}
+);
+insert into comments_new (id, userid, photoid, message, createdat, updatedat)
+	select id, userid, photoid, message, createdat, updatedat from comments;
+drop table comments;
+alter table comments_new rename to comments;
+create index ix_comments_photoid on comments (photoid, id);
+create index ix_comments_userid on comments (userid);
+{{else if eq .Name "sqlserver"}}
+-- SQL Server won't change a column under a foreign key or an index.
+alter table comments drop constraint fk_comments_users;
+drop index ix_comments_userid on comments;
+alter table comments alter column userid bigint null;
+alter table comments add constraint fk_comments_users foreign key (userid) references users (id);
+create index ix_comments_userid on comments (userid);
+alter table comments add
+	parentid bigint null constraint fk_comments_parent references comments (id),
+	rootid bigint null,
+	deletedat {{.Timestamp}} null;
+{{else}}
+alter table comments alter column userid drop not null;
+alter table comments
+	add column parentid bigint constraint fk_comments_parent references comments (id),
+	add column rootid bigint,
+	add column deletedat {{.Timestamp}};
+{{end}}
+create index ix_comments_parentid on comments (parentid, id);
+create index ix_comments_rootid on comments (photoid, rootid, id);
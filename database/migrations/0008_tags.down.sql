@@ -0,0 +1,2 @@
+drop table phototags;
+drop table tags;
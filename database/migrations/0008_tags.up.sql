@@ -0,0 +1,16 @@
+-- Hashtags parsed from photo captions. A tag is stored once and linked to
+-- every photo using it; createdat is when the photo was tagged, for trending.
+create table tags (
+	id {{.ID}},
+	name {{.String}} not null,
+	constraint uq_tags_name unique (name)
+);
+create table phototags (
+	photoid {{.BigInt}} not null references photos (id),
+	tagid {{.BigInt}} not null references tags (id),
+	createdat {{.Timestamp}} not null,
+	constraint pk_phototags primary key (photoid, tagid)
+);
+-- A tag's photos are read by tag, trending tags by time.
+create index ix_phototags_tagid on phototags (tagid, photoid);
+create index ix_phototags_createdat on phototags (createdat, tagid);
@@ -0,0 +1,33 @@
+-- @usernames resolved when a caption or comment is written. photoid is the
+-- photo the text belongs to; commentid is set when the text is a comment.
+-- textoffset and textlength count characters, the @ included.
+create table mentions (
+	id {{.ID}},
+	photoid {{.BigInt}} not null references photos (id),
+	commentid {{.BigInt}} references comments (id),
+	userid {{.BigInt}} not null references users (id),
+	textoffset int not null,
+	textlength int not null,
+	createdat {{.Timestamp}} not null
+);
+create index ix_mentions_photoid on mentions (photoid, commentid);
+create index ix_mentions_commentid on mentions (commentid);
+create index ix_mentions_userid on mentions (userid);
+-- What a user is told about. payload is JSON whose shape depends on type;
+-- photoid and commentid are what it is about, so it goes when they do.
+create table notifications (
+	id {{.ID}},
+	userid {{.BigInt}} not null references users (id),
+	type {{.String}} not null,
+	actorid {{.BigInt}} not null references users (id),
+	photoid {{.BigInt}} references photos (id),
+	commentid {{.BigInt}} references comments (id),
+	payload {{.Text}} not null,
+	createdat {{.Timestamp}} not null,
+	readat {{.Timestamp}}
+);
+-- A user's notifications are listed newest first.
+create index ix_notifications_userid on notifications (userid, id);
+create index ix_notifications_actorid on notifications (actorid);
+create index ix_notifications_photoid on notifications (photoid);
+create index ix_notifications_commentid on notifications (commentid);
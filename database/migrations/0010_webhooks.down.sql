@@ -0,0 +1,4 @@
+drop table webhookdeliveries;
+drop table outbox;
+drop table webhookevents;
+drop table webhooks;
@@ -0,0 +1,44 @@
+-- Webhook subscriptions: url is sent the events listed in webhookevents,
+-- signed with secret.
+create table webhooks (
+	id {{.ID}},
+	userid {{.BigInt}} not null references users (id),
+	url {{.Text}} not null,
+	secret {{.String}} not null,
+	createdat {{.Timestamp}} not null
+);
+create index ix_webhooks_userid on webhooks (userid);
+create table webhookevents (
+	webhookid {{.BigInt}} not null references webhooks (id),
+	eventtype {{.String}} not null,
+	constraint pk_webhookevents primary key (webhookid, eventtype)
+);
+create index ix_webhookevents_eventtype on webhookevents (eventtype, webhookid);
+-- The transactional outbox: each event is written in the transaction of the
+-- change it tells about, and dispatched to the webhooks afterwards.
+create table outbox (
+	id {{.ID}},
+	eventtype {{.String}} not null,
+	payload {{.Text}} not null,
+	createdat {{.Timestamp}} not null,
+	dispatchedat {{.Timestamp}}
+);
+create index ix_outbox_dispatchedat on outbox (dispatchedat, id);
+-- One event for one webhook: pending until delivered, dead after too many
+-- failed attempts.
+create table webhookdeliveries (
+	id {{.ID}},
+	webhookid {{.BigInt}} not null references webhooks (id),
+	outboxid {{.BigInt}} not null references outbox (id),
+	status {{.String}} not null,
+	attempts int not null,
+	nextattemptat {{.Timestamp}} not null,
+	laststatus int not null,
+	lasterror {{.Text}} not null,
+	createdat {{.Timestamp}} not null,
+	deliveredat {{.Timestamp}}
+);
+-- Due deliveries are found by status and time, a webhook's by status.
+create index ix_webhookdeliveries_due on webhookdeliveries (status, nextattemptat);
+create index ix_webhookdeliveries_webhookid on webhookdeliveries (webhookid, status, id);
+create index ix_webhookdeliveries_outboxid on webhookdeliveries (outboxid);
@@ -0,0 +1,8 @@
+drop index ix_photos_processing{{if eq .Name "sqlserver"}} on photos{{end}};
+{{if eq .Name "sqlserver"}}
+alter table photos drop constraint df_photos_processing;
+{{end}}
+alter table photos drop column largeurl;
+alter table photos drop column mediumurl;
+alter table photos drop column thumbnailurl;
+alter table photos drop column processing;
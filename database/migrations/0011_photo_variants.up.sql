@@ -0,0 +1,9 @@
+-- Uploaded photos are scaled down in the background. processing is one of
+-- none (hosted elsewhere), processing, ready or failed; the variant URLs are
+-- set once it is ready.
+alter table photos add processing {{.String}} not null constraint df_photos_processing default 'none';
+alter table photos add thumbnailurl {{.Text}};
+alter table photos add mediumurl {{.Text}};
+alter table photos add largeurl {{.Text}};
+-- Uploads left processing are queued again when the server starts.
+create index ix_photos_processing on photos (processing, id);
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"mygram/entity"
+	"time"
+)
+
+// notify stores n in tx, so the user is told only if the change telling
+// them about is stored too, and publishes it to Events once tx commits. No
+// one is told about what they did themselves.
+func (s *Database) notify(ctx context.Context, tx *sql.Tx, n entity.Notification, now time.Time) error {
+	if n.UserID == n.ActorID {
+		return nil
+	}
+	qry := "insert into notifications (userid, type, actorid, photoid, commentid, payload, createdat)" +
+		" values (@userid, @type, @actorid, @photoid, @commentid, @payload, @createdat)" +
+		s.sqlDialect().insertReturning("notifications", "id")
+	rows, err := s.txQueryContext(ctx, tx, qry,
+		sql.Named("userid", n.UserID),
+		sql.Named("type", string(n.Type)),
+		sql.Named("actorid", n.ActorID),
+		sql.Named("photoid", n.PhotoID),
+		sql.Named("commentid", n.CommentID),
+		sql.Named("payload", string(n.Payload)),
+		sql.Named("createdat", now))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&n.ID); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return s.translateError(err)
+	}
+	n.CreatedAt = now
+	s.afterCommit(tx, func() { Events.Publish(n) })
+	return nil
+}
+
+// photoOwner is the user who posted the photo id, 0 when there is no such
+// photo.
+func (s *Database) photoOwner(ctx context.Context, tx *sql.Tx, id int64) (int64, error) {
+	var result int64
+	rows, err := s.txQueryContext(ctx, tx, "select userid from photos where id = @id", sql.Named("id", id))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&result); err != nil {
+			return 0, err
+		}
+	}
+	return result, rows.Err()
+}
+
+// GetNotifications is one page of the notifications of userid, newest first.
+func (s *Database) GetNotifications(ctx context.Context, userid int64, filter entity.NotificationFilter, page entity.PageRequest) (*entity.Page[entity.Notification], error) {
+	var result []entity.Notification
+	q, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sortBy[entity.Notification](&q, entity.Sort{Desc: true}, nil); err != nil {
+		return nil, err
+	}
+	var where conditions
+	where.add("n.userid = @userid", sql.Named("userid", userid))
+	if filter.Unread {
+		where.add("n.readat is null")
+	}
+	if keyset := q.where("n.id"); keyset != "" {
+		where.add(keyset, sql.Named("cursor", q.cursor.ID))
+	}
+	qry := "select n.id, n.userid, n.type, n.actorid, u.username, n.payload, n.createdat, n.readat from notifications n join users u on n.actorid=u.id" +
+		where.String() + q.orderBy("n.id") + s.sqlDialect().limit("@limit")
+	rows, err := s.queryContext(ctx, qry, append(where.args, sql.Named("limit", q.fetch()))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row entity.Notification
+		var payload string
+		err := rows.Scan(
+			&row.ID,
+			&row.UserID,
+			&row.Type,
+			&row.ActorID,
+			&row.ActorUsername,
+			&payload,
+			&row.CreatedAt,
+			&row.ReadAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		row.Payload = []byte(payload)
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return makePage(result, q, func(n entity.Notification) int64 { return n.ID }, nil), nil
+}
+
+// MarkNotificationsRead marks the notifications ids of userid read, all of
+// them when ids is nil. Other users' ids and those read already are left
+// alone.
+func (s *Database) MarkNotificationsRead(ctx context.Context, userid int64, ids []int64) (*entity.NotificationReadOutput, error) {
+	result := &entity.NotificationReadOutput{}
+	var where conditions
+	where.add("userid = @userid", sql.Named("userid", userid))
+	where.add("readat is null")
+	if ids != nil {
+		if len(ids) == 0 {
+			return s.unreadNotifications(ctx, userid, result)
+		}
+		list, args := namedList("id", ids)
+		where.add("id in (" + list + ")")
+		where.args = append(where.args, args...)
+	}
+	res, err := s.execContext(ctx, "update notifications set readat = @readat"+where.String(),
+		append([]interface{}{sql.Named("readat", time.Now())}, where.args...)...)
+	if err != nil {
+		return nil, err
+	}
+	if result.Read, err = res.RowsAffected(); err != nil {
+		return nil, err
+	}
+	return s.unreadNotifications(ctx, userid, result)
+}
+
+// unreadNotifications counts the unread notifications of userid into result.
+func (s *Database) unreadNotifications(ctx context.Context, userid int64, result *entity.NotificationReadOutput) (*entity.NotificationReadOutput, error) {
+	rows, err := s.queryContext(ctx, "select count(*) from notifications where userid = @userid and readat is null",
+		sql.Named("userid", userid))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&result.Unread); err != nil {
+			return nil, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"mygram/entity"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabase_GetNotifications(t *testing.T) {
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	qry := "select n.id, n.userid, n.type, n.actorid, u.username, n.payload, n.createdat, n.readat from notifications n join users u on n.actorid=u.id"
+
+	t.Run("getnotifications database down", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(qry)).
+			WillReturnError(errors.New("db down"))
+		out, err := dbtes.GetNotifications(ctx, 1, entity.NotificationFilter{}, entity.PageRequest{})
+		assert.Nil(t, out)
+		assert.EqualError(t, err, "db down")
+	})
+
+	t.Run("getnotifications unread", func(t *testing.T) {
+		rows := mock.NewRows([]string{"id", "userid", "type", "actorid", "username", "payload", "createdat", "readat"}).
+			AddRow(2, 1, "like", 3, "fan", `{"photo_id":4}`, time.Now(), nil)
+		mock.ExpectQuery(regexp.QuoteMeta(qry+" where n.userid = @userid and n.readat is null")).
+			WithArgs(int64(1), DefaultPageLimit+1).
+			WillReturnRows(rows)
+		out, err := dbtes.GetNotifications(ctx, 1, entity.NotificationFilter{Unread: true}, entity.PageRequest{})
+		require.NoError(t, err)
+		require.Len(t, out.Items, 1)
+		assert.Equal(t, "fan", out.Items[0].ActorUsername)
+		payload, err := out.Items[0].DecodePayload()
+		require.NoError(t, err)
+		assert.Equal(t, &entity.LikePayload{PhotoID: 4}, payload)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestDatabase_MarkNotificationsRead(t *testing.T) {
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	unread := regexp.QuoteMeta("select count(*) from notifications where userid = @userid and readat is null")
+
+	t.Run("marknotificationsread ids", func(t *testing.T) {
+		mock.ExpectExec(regexp.QuoteMeta("update notifications set readat = @readat where userid = @userid and readat is null and id in (@id0, @id1)")).
+			WithArgs(AnyTime{}, int64(1), int64(5), int64(6)).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectQuery(unread).
+			WithArgs(int64(1)).
+			WillReturnRows(mock.NewRows([]string{"count"}).AddRow(3))
+		out, err := dbtes.MarkNotificationsRead(ctx, 1, []int64{5, 6})
+		require.NoError(t, err)
+		assert.Equal(t, &entity.NotificationReadOutput{Read: 2, Unread: 3}, out)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("marknotificationsread all", func(t *testing.T) {
+		mock.ExpectExec(regexp.QuoteMeta("update notifications set readat = @readat where userid = @userid and readat is null")).
+			WithArgs(AnyTime{}, int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectQuery(unread).
+			WithArgs(int64(1)).
+			WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+		out, err := dbtes.MarkNotificationsRead(ctx, 1, nil)
+		require.NoError(t, err)
+		assert.Equal(t, &entity.NotificationReadOutput{Read: 3, Unread: 0}, out)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,226 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"mygram/entity"
+	"time"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+var (
+	// ErrInvalidCursor is returned for a page cursor this server did not hand
+	// out, or one handed out for another sort order.
+	ErrInvalidCursor = errors.New("invalid page cursor")
+	// ErrInvalidSort is returned for a sort field the list does not have.
+	ErrInvalidSort = errors.New("invalid sort field")
+)
+
+// cursor is what an opaque page cursor carries: the row the page continues
+// from, and whether it goes back towards the start. A sorted list also keeps
+// the sort order and the row's value in the sorted column.
+type cursor struct {
+	ID     int64      `json:"id"`
+	Before bool       `json:"before,omitempty"`
+	Sort   string     `json:"sort,omitempty"`
+	Desc   bool       `json:"desc,omitempty"`
+	At     *time.Time `json:"at,omitempty"`
+	Count  *int64     `json:"count,omitempty"`
+}
+
+// value is the sorted column of the row the cursor points at, nil in id order.
+func (c cursor) value() interface{} {
+	switch {
+	case c.At != nil:
+		return *c.At
+	case c.Count != nil:
+		return *c.Count
+	}
+	return nil
+}
+
+func (c *cursor) setValue(v interface{}) {
+	switch v := v.(type) {
+	case time.Time:
+		c.At = &v
+	case int64:
+		c.Count = &v
+	}
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.ID <= 0 {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// pageQuery is a validated PageRequest. Lists are ordered by id, or by a
+// column and then id, so that no two rows tie and a page never skips or
+// repeats one.
+type pageQuery struct {
+	limit     int
+	cursor    cursor
+	hasCursor bool
+	sort      string // the entity.Sort field, empty in id order
+	sortExpr  string // what the SQL backends order by before the id
+	desc      bool
+}
+
+func newPageQuery(req entity.PageRequest) (pageQuery, error) {
+	q := pageQuery{limit: req.Limit}
+	if q.limit <= 0 {
+		q.limit = DefaultPageLimit
+	}
+	if q.limit > MaxPageLimit {
+		q.limit = MaxPageLimit
+	}
+	if req.Cursor != "" {
+		c, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return q, err
+		}
+		q.cursor, q.hasCursor = c, true
+	}
+	return q, nil
+}
+
+// sortColumn is a column a list may be sorted by: expr for the SQL backends,
+// and value to read it from a row, for the memory backend and page cursors.
+// value returns a time.Time or an int64.
+type sortColumn[T any] struct {
+	expr  string
+	value func(T) interface{}
+}
+
+// sortBy orders q by s, which must be one of columns, and returns how to read
+// the sorted column from a row, nil in id order.
+func sortBy[T any](q *pageQuery, s entity.Sort, columns map[string]sortColumn[T]) (func(T) interface{}, error) {
+	var value func(T) interface{}
+	if s.Field != "" && s.Field != "id" {
+		c, ok := columns[s.Field]
+		if !ok {
+			return nil, ErrInvalidSort
+		}
+		q.sort, q.sortExpr, value = s.Field, c.expr, c.value
+	}
+	q.desc = s.Desc
+	if q.hasCursor {
+		var zero T
+		if q.cursor.Sort != q.sort || q.cursor.Desc != q.desc || (value != nil && !sameType(value(zero), q.cursor.value())) {
+			return nil, ErrInvalidCursor
+		}
+	}
+	return value, nil
+}
+
+func sameType(a, b interface{}) bool {
+	switch a.(type) {
+	case time.Time:
+		_, ok := b.(time.Time)
+		return ok
+	case int64:
+		_, ok := b.(int64)
+		return ok
+	}
+	return false
+}
+
+// backwards tells whether rows are read from the largest id down: for a
+// descending list, or towards the start of an ascending one, not both.
+func (q pageQuery) backwards() bool {
+	return q.cursor.Before != q.desc
+}
+
+// where is the keyset condition on the sorted column and the id column, empty
+// for the first page. It compares against @cursorvalue and @cursor.
+func (q pageQuery) where(idColumn string) string {
+	if !q.hasCursor {
+		return ""
+	}
+	op := " > "
+	if q.backwards() {
+		op = " < "
+	}
+	if q.sortExpr == "" {
+		return idColumn + op + "@cursor"
+	}
+	return "(" + q.sortExpr + op + "@cursorvalue or (" + q.sortExpr + " = @cursorvalue and " + idColumn + op + "@cursor))"
+}
+
+// orderBy reads backwards from the cursor when going to the previous page.
+func (q pageQuery) orderBy(idColumn string) string {
+	dir := ""
+	if q.backwards() {
+		dir = " desc"
+	}
+	if q.sortExpr == "" {
+		return " order by " + idColumn + dir
+	}
+	return " order by " + q.sortExpr + dir + ", " + idColumn + dir
+}
+
+// fetch is how many rows to read: one more than the page tells whether
+// there is another page.
+func (q pageQuery) fetch() int {
+	return q.limit + 1
+}
+
+// makePage turns the rows read in the order of q.orderBy into a page in the
+// list's order, with the cursors to its neighbours. value reads the sorted
+// column, and is nil in id order.
+func makePage[T any](rows []T, q pageQuery, id func(T) int64, value func(T) interface{}) *entity.Page[T] {
+	more := len(rows) > q.limit
+	if more {
+		rows = rows[:q.limit]
+	}
+	if q.cursor.Before {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+	page := &entity.Page[T]{Items: rows}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	if len(rows) == 0 {
+		return page
+	}
+	at := func(row T, before bool) string {
+		c := cursor{ID: id(row), Before: before, Sort: q.sort, Desc: q.desc}
+		if value != nil {
+			c.setValue(value(row))
+		}
+		return encodeCursor(c)
+	}
+	first, last := rows[0], rows[len(rows)-1]
+	if q.cursor.Before {
+		if more {
+			page.PrevCursor = at(first, true)
+		}
+		page.NextCursor = at(last, false)
+	} else {
+		if more {
+			page.NextCursor = at(last, false)
+		}
+		if q.hasCursor {
+			page.PrevCursor = at(first, true)
+		}
+	}
+	return page
+}
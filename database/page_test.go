@@ -0,0 +1,74 @@
+package database
+
+import (
+	"mygram/entity"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPageQuery(t *testing.T) {
+	q, err := newPageQuery(entity.PageRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultPageLimit, q.limit)
+	assert.False(t, q.hasCursor)
+	assert.Equal(t, "", q.where("id"))
+	assert.Equal(t, " order by id", q.orderBy("id"))
+
+	q, err = newPageQuery(entity.PageRequest{Limit: 1000, Cursor: encodeCursor(cursor{ID: 7, Before: true})})
+	require.NoError(t, err)
+	assert.Equal(t, MaxPageLimit, q.limit)
+	assert.Equal(t, "id < @cursor", q.where("id"))
+	assert.Equal(t, " order by id desc", q.orderBy("id"))
+
+	for _, c := range []string{"!!", "e30", encodeCursor(cursor{ID: -1})} {
+		_, err = newPageQuery(entity.PageRequest{Cursor: c})
+		assert.ErrorIs(t, err, ErrInvalidCursor, c)
+	}
+}
+
+func TestSortBy(t *testing.T) {
+	columns := map[string]sortColumn[entity.Photo]{
+		entity.SortCreatedAt: {"createdat", func(p entity.Photo) interface{} { return p.CreatedAt }},
+	}
+	byCreatedAt := entity.Sort{Field: entity.SortCreatedAt, Desc: true}
+	at := time.Date(2022, 10, 5, 9, 30, 0, 0, time.UTC)
+	c := cursor{ID: 7, Sort: entity.SortCreatedAt, Desc: true}
+	c.setValue(at)
+
+	q, err := newPageQuery(entity.PageRequest{Cursor: encodeCursor(c)})
+	require.NoError(t, err)
+	value, err := sortBy(&q, byCreatedAt, columns)
+	require.NoError(t, err)
+	assert.Equal(t, at, value(entity.Photo{CreatedAt: at}))
+	assert.Equal(t, "(createdat < @cursorvalue or (createdat = @cursorvalue and id < @cursor))", q.where("id"))
+	assert.Equal(t, " order by createdat desc, id desc", q.orderBy("id"))
+	assert.Equal(t, at, q.cursor.value())
+
+	c.Before = true
+	q, err = newPageQuery(entity.PageRequest{Cursor: encodeCursor(c)})
+	require.NoError(t, err)
+	_, err = sortBy(&q, byCreatedAt, columns)
+	require.NoError(t, err)
+	assert.Equal(t, "(createdat > @cursorvalue or (createdat = @cursorvalue and id > @cursor))", q.where("id"))
+	assert.Equal(t, " order by createdat, id", q.orderBy("id"))
+
+	// A cursor only continues the order it was handed out for.
+	q, err = newPageQuery(entity.PageRequest{Cursor: encodeCursor(c)})
+	require.NoError(t, err)
+	_, err = sortBy(&q, entity.Sort{}, columns)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	count := cursor{ID: 7, Sort: entity.SortCreatedAt, Desc: true}
+	count.setValue(int64(3))
+	q, err = newPageQuery(entity.PageRequest{Cursor: encodeCursor(count)})
+	require.NoError(t, err)
+	_, err = sortBy(&q, byCreatedAt, columns)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	q, err = newPageQuery(entity.PageRequest{})
+	require.NoError(t, err)
+	_, err = sortBy(&q, entity.Sort{Field: "comment_count"}, columns)
+	assert.ErrorIs(t, err, ErrInvalidSort)
+}
@@ -8,133 +8,336 @@ import (
 	"time"
 )
 
+// PostPhoto stores the photo and tags it with the hashtags of its caption.
 func (s *Database) PostPhoto(ctx context.Context, u int64, i entity.PhotoPost) (*entity.Photo, error) {
 	result := &entity.Photo{}
-	qry := "insert into photos (title, caption, photourl, userid, createdat, updatedat) values (@title, @caption, @photourl, @userid, @createdat, @updatedat); select id, title, caption, photourl, userid, createdat from photos where id = SCOPE_IDENTITY()"
+	tags := entity.ParseHashtags(i.Caption)
+	qry := "insert into photos (title, caption, photourl, processing, userid, createdat, updatedat) values (@title, @caption, @photourl, @processing, @userid, @createdat, @updatedat)" +
+		s.sqlDialect().insertReturning("photos", "id, title, caption, photourl, userid, createdat")
 	now := time.Now()
-
-	rows, err := s.SqlDb.QueryContext(ctx, qry,
-		sql.Named("title", i.Title),
-		sql.Named("caption", i.Caption),
-		sql.Named("photourl", i.PhotoUrl),
-		sql.Named("userid", u),
-		sql.Named("createdat", now),
-		sql.Named("updatedat", now))
-	if err != nil {
-		return nil, err
+	processing := i.Processing
+	if processing == "" {
+		processing = entity.ProcessingNone
 	}
-	defer rows.Close()
-	for rows.Next() {
-		err := rows.Scan(
-			&result.ID,
-			&result.Title,
-			&result.Caption,
-			&result.PhotoUrl,
-			&result.UserID,
-			&result.CreatedAt,
-		)
+
+	err := s.inTagTx(ctx, func(tx *sql.Tx) error {
+		*result = entity.Photo{Processing: processing}
+		rows, err := s.txQueryContext(ctx, tx, qry,
+			sql.Named("title", i.Title),
+			sql.Named("caption", i.Caption),
+			sql.Named("photourl", i.PhotoUrl),
+			sql.Named("processing", string(result.Processing)),
+			sql.Named("userid", u),
+			sql.Named("createdat", now),
+			sql.Named("updatedat", now))
 		if err != nil {
-			return nil, err
+			return err
 		}
+		defer rows.Close()
+		for rows.Next() {
+			err := rows.Scan(
+				&result.ID,
+				&result.Title,
+				&result.Caption,
+				&result.PhotoUrl,
+				&result.UserID,
+				&result.CreatedAt,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return s.translateError(err)
+		}
+		rows.Close()
+		result.Mentions, err = s.setMentions(ctx, tx, mentionSource{actorID: u, photoID: result.ID}, i.Caption, true, now)
+		if err != nil {
+			return err
+		}
+		if len(tags) > 0 {
+			if err := s.createTags(ctx, tx, tags); err != nil {
+				return err
+			}
+			if err := s.setPhotoTags(ctx, tx, result.ID, tags, now); err != nil {
+				return err
+			}
+		}
+		return s.addToOutbox(ctx, tx, entity.EventPhotoCreated, result, now)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return result, nil
 }
 
-func (s *Database) GetPhotos(ctx context.Context) ([]entity.PhotoGetOutput, error) {
+// photoCommentCount counts the comments of the photo p, not the tombstones.
+const photoCommentCount = "(select count(*) from comments c where c.photoid=p.id and c.deletedat is null)"
+
+// photoLikeCount counts the likes of the photo p.
+const photoLikeCount = "(select count(*) from likes l where l.photoid=p.id)"
+
+// photoLikedByMe is 1 when @viewer likes the photo p, 0 otherwise.
+const photoLikedByMe = "(case when exists (select 1 from likes l where l.photoid=p.id and l.userid=@viewer) then 1 else 0 end)"
+
+// photoGetOutputQuery reads entity.PhotoGetOutput rows for scanPhotoGetOutput,
+// with liked_by_me for @viewer.
+const photoGetOutputQuery = "select p.id, p.title, p.caption, p.photourl, p.userid, p.createdat, p.updatedat, p.processing, p.thumbnailurl, p.mediumurl, p.largeurl, " + photoCommentCount + ", " + photoLikeCount + ", " + photoLikedByMe + ", u.email, u.username from photos p" +
+	" join users u on p.userid=u.id"
+
+func scanPhotoGetOutput(rows *sql.Rows) (entity.PhotoGetOutput, error) {
+	var row entity.PhotoGetOutput
+	var thumbnail, medium, large sql.NullString
+	err := rows.Scan(
+		&row.ID,
+		&row.Title,
+		&row.Caption,
+		&row.PhotoUrl,
+		&row.UserID,
+		&row.CreatedAt,
+		&row.UpdatedAt,
+		&row.Processing,
+		&thumbnail,
+		&medium,
+		&large,
+		&row.CommentCount,
+		&row.LikeCount,
+		&row.LikedByMe,
+		&row.User.Email,
+		&row.User.Username,
+	)
+	if thumbnail.Valid {
+		row.Variants = &entity.PhotoVariants{Thumbnail: thumbnail.String, Medium: medium.String, Large: large.String}
+	}
+	return row, err
+}
+
+// photoSorts are the columns GET /photos may be sorted by.
+var photoSorts = map[string]sortColumn[entity.PhotoGetOutput]{
+	entity.SortCreatedAt:    {"p.createdat", func(p entity.PhotoGetOutput) interface{} { return p.CreatedAt }},
+	entity.SortUpdatedAt:    {"p.updatedat", func(p entity.PhotoGetOutput) interface{} { return p.UpdatedAt }},
+	entity.SortCommentCount: {photoCommentCount, func(p entity.PhotoGetOutput) interface{} { return p.CommentCount }},
+}
+
+// GetPhotos is one page of the photos matching filter, liked_by_me telling
+// whether viewer likes them.
+func (s *Database) GetPhotos(ctx context.Context, viewer int64, filter entity.PhotoFilter, page entity.PageRequest) (*entity.Page[entity.PhotoGetOutput], error) {
 	var result []entity.PhotoGetOutput
+	q, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
+	value, err := sortBy(&q, filter.Sort, photoSorts)
+	if err != nil {
+		return nil, err
+	}
+	var where conditions
+	if filter.UserID != 0 {
+		where.add("p.userid = @userid", sql.Named("userid", filter.UserID))
+	}
+	if filter.FollowedBy != 0 {
+		where.add("p.userid in (select f.followeeid from follows f where f.followerid = @followedby)", sql.Named("followedby", filter.FollowedBy))
+	}
+	if filter.Tag != "" {
+		where.add("p.id in (select pt.photoid from phototags pt join tags t on pt.tagid=t.id where t.name = @tag)", sql.Named("tag", filter.Tag))
+	}
+	if !filter.CreatedFrom.IsZero() {
+		where.add("p.createdat >= @createdfrom", sql.Named("createdfrom", filter.CreatedFrom))
+	}
+	if !filter.CreatedTo.IsZero() {
+		where.add("p.createdat <= @createdto", sql.Named("createdto", filter.CreatedTo))
+	}
+	if filter.Search != "" {
+		where.add(`(lower(p.title) like @search escape '\' or lower(p.caption) like @search escape '\')`,
+			sql.Named("search", containing(filter.Search)))
+	}
+	if keyset := q.where("p.id"); keyset != "" {
+		where.add(keyset, sql.Named("cursor", q.cursor.ID), sql.Named("cursorvalue", q.cursor.value()))
+	}
 	var qry strings.Builder
-	qry.WriteString("select p.id, p.title, p.caption, p.photourl, p.userid, p.createdat, p.updatedat, u.email, u.username from photos p")
-	qry.WriteString(" join users u on p.userid=u.id")
-	rows, err := s.SqlDb.QueryContext(ctx, qry.String())
+	qry.WriteString(photoGetOutputQuery)
+	qry.WriteString(where.String())
+	qry.WriteString(q.orderBy("p.id"))
+	qry.WriteString(s.sqlDialect().limit("@limit"))
+	rows, err := s.queryContext(ctx, qry.String(), append(where.args, sql.Named("viewer", viewer), sql.Named("limit", q.fetch()))...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var row entity.PhotoGetOutput
-		err := rows.Scan(
-			&row.ID,
-			&row.Title,
-			&row.Caption,
-			&row.PhotoUrl,
-			&row.UserID,
-			&row.CreatedAt,
-			&row.UpdatedAt,
-			&row.User.Email,
-			&row.User.Username,
-		)
+		row, err := scanPhotoGetOutput(rows)
 		if err != nil {
 			return nil, err
 		}
 		result = append(result, row)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.withPhotoMentions(ctx, result); err != nil {
+		return nil, err
+	}
+	return makePage(result, q, func(p entity.PhotoGetOutput) int64 { return p.ID }, value), nil
+}
+
+// GetUserPhotos is one page of a user's photos as viewer sees them,
+// ErrNotFound when there is no such user.
+func (s *Database) GetUserPhotos(ctx context.Context, viewer int64, userid int64, page entity.PageRequest) (*entity.Page[entity.PhotoGetOutput], error) {
+	result, err := s.GetPhotos(ctx, viewer, entity.PhotoFilter{UserID: userid}, page)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Items) == 0 {
+		if ok, err := s.exists(ctx, "users", userid); err != nil || !ok {
+			return nil, notFoundUnless(err)
+		}
+	}
 	return result, nil
 }
 
-func (s *Database) GetPhotoByID(ctx context.Context, id int64) (*entity.Photo, error) {
-	result := &entity.Photo{}
-	qry := "select id, title, caption, photourl, userid, createdat, updatedat from photos where id = @ID"
-	rows, err := s.SqlDb.QueryContext(ctx, qry,
+// GetFeed is one page of the photos of the users userid follows, newest first.
+func (s *Database) GetFeed(ctx context.Context, userid int64, page entity.PageRequest) (*entity.Page[entity.PhotoGetOutput], error) {
+	return s.GetPhotos(ctx, userid, feedFilter(userid), page)
+}
+
+// feedFilter is the feed of userid as a PhotoFilter.
+func feedFilter(userid int64) entity.PhotoFilter {
+	return entity.PhotoFilter{FollowedBy: userid, Sort: entity.Sort{Field: entity.SortCreatedAt, Desc: true}}
+}
+
+func (s *Database) GetPhotoByID(ctx context.Context, viewer int64, id int64) (*entity.PhotoGetOutput, error) {
+	result := &entity.PhotoGetOutput{}
+	rows, err := s.queryContext(ctx, photoGetOutputQuery+" where p.id = @ID",
+		sql.Named("viewer", viewer),
 		sql.Named("ID", id))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		err := rows.Scan(
-			&result.ID,
-			&result.Title,
-			&result.Caption,
-			&result.PhotoUrl,
-			&result.UserID,
-			&result.CreatedAt,
-			&result.UpdatedAt,
-		)
+		row, err := scanPhotoGetOutput(rows)
 		if err != nil {
 			return nil, err
 		}
+		result = &row
 	}
-	return result, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if result.ID == 0 {
+		return nil, ErrNotFound
+	}
+	one := []entity.PhotoGetOutput{*result}
+	if err := s.withPhotoMentions(ctx, one); err != nil {
+		return nil, err
+	}
+	return &one[0], nil
 }
 
+// UpdatePhoto changes the caller's photo, and its tags with its caption.
 func (s *Database) UpdatePhoto(ctx context.Context, userid int64, id int64, i entity.PhotoPost) (*entity.Photo, error) {
 	result := &entity.Photo{}
+	tags := entity.ParseHashtags(i.Caption)
 	now := time.Now()
-	qry := "update photos set title=@title, caption=@caption, photourl=@photourl, updatedat=@updatedat where id = @ID and userid = @userid; select id, title, caption, photourl, userid, updatedat from photos where id = @ID"
-	rows, err := s.SqlDb.QueryContext(ctx, qry,
-		sql.Named("title", i.Title),
-		sql.Named("caption", i.Caption),
-		sql.Named("photourl", i.PhotoUrl),
-		sql.Named("updatedat", now),
-		sql.Named("userid", userid),
-		sql.Named("ID", id))
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		err := rows.Scan(
-			&result.ID,
-			&result.Title,
-			&result.Caption,
-			&result.PhotoUrl,
-			&result.UserID,
-			&result.UpdatedAt,
-		)
+	// A new photo_url is hosted elsewhere, and the variants of the old one
+	// no longer apply.
+	qry := "update photos set title=@title, caption=@caption, photourl=@photourl, updatedat=@updatedat," +
+		" processing=case when photourl=@photourl then processing else @none end," +
+		" thumbnailurl=case when photourl=@photourl then thumbnailurl end," +
+		" mediumurl=case when photourl=@photourl then mediumurl end," +
+		" largeurl=case when photourl=@photourl then largeurl end" +
+		" where id = @ID and userid = @userid" +
+		s.sqlDialect().updateReturning("photos", "id, title, caption, photourl, userid, updatedat", "id = @ID")
+	err := s.inTagTx(ctx, func(tx *sql.Tx) error {
+		*result = entity.Photo{}
+		rows, err := s.txQueryContext(ctx, tx, qry,
+			sql.Named("title", i.Title),
+			sql.Named("caption", i.Caption),
+			sql.Named("photourl", i.PhotoUrl),
+			sql.Named("updatedat", now),
+			sql.Named("none", string(entity.ProcessingNone)),
+			sql.Named("userid", userid),
+			sql.Named("ID", id))
 		if err != nil {
-			return nil, err
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			err := rows.Scan(
+				&result.ID,
+				&result.Title,
+				&result.Caption,
+				&result.PhotoUrl,
+				&result.UserID,
+				&result.UpdatedAt,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return s.translateError(err)
+		}
+		rows.Close()
+		if result.ID == 0 {
+			return ErrNotFound
+		}
+		result.Mentions, err = s.setMentions(ctx, tx, mentionSource{actorID: userid, photoID: result.ID}, i.Caption, false, now)
+		if err != nil {
+			return err
+		}
+		if err := s.createTags(ctx, tx, tags); err != nil {
+			return err
+		}
+		if err := s.setPhotoTags(ctx, tx, result.ID, tags, now); err != nil {
+			return err
 		}
+		return s.addToOutbox(ctx, tx, entity.EventPhotoUpdated, result, now)
+	})
+	if err != nil {
+		return nil, err
 	}
 	return result, nil
 }
 
 func (s *Database) DeletePhoto(ctx context.Context, userid int64, id int64) (string, error) {
 	var result string
-	qry := "delete from comments where photoid=@id and userid=@userid; delete from photos where id=@id and userid=@userid"
-	_, err := s.SqlDb.ExecContext(ctx, qry,
-		sql.Named("userid", userid),
-		sql.Named("id", id))
+	// Everyone's comments and likes go with the photo, and so do its tags,
+	// mentions and notifications. They are rolled back with the rest when
+	// the photo is not the caller's. Each comment has its deleted event
+	// before the photo's.
+	// Replies are unhooked first, so no server trips over a comment deleted
+	// before its replies.
+	qry := []string{
+		"update comments set parentid=null where photoid=@id",
+		"delete from mentions where photoid=@id",
+		"delete from notifications where photoid=@id",
+		"delete from comments where photoid=@id",
+		"delete from likes where photoid=@id",
+		"delete from phototags where photoid=@id",
+		"delete from photos where id=@id and userid=@userid",
+	}
+	deleted := []deletedSelect{
+		{entity.EventCommentDeleted, "select id, userid from comments where photoid=@id and deletedat is null order by id"},
+	}
+	now := time.Now()
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		events, err := s.selectDeleted(ctx, tx, deleted, sql.Named("id", id))
+		if err != nil {
+			return err
+		}
+		err = s.txDeleteCascade(ctx, tx, qry,
+			sql.Named("userid", userid),
+			sql.Named("id", id))
+		if err != nil {
+			return err
+		}
+		if err := s.addDeletedToOutbox(ctx, tx, events, now); err != nil {
+			return err
+		}
+		return s.addToOutbox(ctx, tx, entity.EventPhotoDeleted, entity.DeletedResource{ID: id, UserID: userid}, now)
+	})
 	if err != nil {
 		return "", err
 	}
@@ -143,3 +346,56 @@ func (s *Database) DeletePhoto(ctx context.Context, userid int64, id int64) (str
 
 	return result, nil
 }
+
+// SetPhotoVariants records how making the variants of a photo went, with the
+// variants when it is ready. It is ErrNotFound unless the photo is still
+// processing the upload at photoURL: deleted, or given another photo_url
+// meanwhile.
+func (s *Database) SetPhotoVariants(ctx context.Context, id int64, photoURL string, state entity.ProcessingState, variants *entity.PhotoVariants) error {
+	var thumbnail, medium, large sql.NullString
+	if variants != nil {
+		thumbnail = sql.NullString{String: variants.Thumbnail, Valid: true}
+		medium = sql.NullString{String: variants.Medium, Valid: true}
+		large = sql.NullString{String: variants.Large, Valid: true}
+	}
+	res, err := s.execContext(ctx, "update photos set processing=@state, thumbnailurl=@thumbnail, mediumurl=@medium, largeurl=@large"+
+		" where id=@id and processing=@processing and photourl=@photourl",
+		sql.Named("state", string(state)),
+		sql.Named("thumbnail", thumbnail),
+		sql.Named("medium", medium),
+		sql.Named("large", large),
+		sql.Named("id", id),
+		sql.Named("processing", string(entity.ProcessingPending)),
+		sql.Named("photourl", photoURL))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetProcessingPhotos lists the uploaded photos whose variants are still to
+// be made, oldest first.
+func (s *Database) GetProcessingPhotos(ctx context.Context) ([]entity.Photo, error) {
+	rows, err := s.queryContext(ctx, "select id, title, caption, photourl, userid, createdat, updatedat from photos where processing=@processing order by id",
+		sql.Named("processing", string(entity.ProcessingPending)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []entity.Photo
+	for rows.Next() {
+		p := entity.Photo{Processing: entity.ProcessingPending}
+		if err := rows.Scan(&p.ID, &p.Title, &p.Caption, &p.PhotoUrl, &p.UserID, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, p)
+	}
+	return result, rows.Err()
+}
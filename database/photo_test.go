@@ -23,7 +23,7 @@ func TestDatabase_PostPhoto(t *testing.T) {
 	dbtes := Database{
 		SqlDb: db,
 	}
-	qry := "insert into photos (title, caption, photourl, userid, createdat, updatedat) values (@title, @caption, @photourl, @userid, @createdat, @updatedat); select id, title, caption, photourl, userid, createdat from photos where id = SCOPE_IDENTITY()"
+	qry := "insert into photos (title, caption, photourl, processing, userid, createdat, updatedat) values (@title, @caption, @photourl, @processing, @userid, @createdat, @updatedat); select id, title, caption, photourl, userid, createdat from photos where id = SCOPE_IDENTITY()"
 
 	inp := entity.PhotoPost{
 		Title:    "Foto Kopi",
@@ -32,9 +32,11 @@ func TestDatabase_PostPhoto(t *testing.T) {
 	}
 
 	t.Run("postphoto database down", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Title, inp.Caption, inp.PhotoUrl, int64(1), time.Now(), time.Now()).
+			WithArgs(inp.Title, inp.Caption, inp.PhotoUrl, "none", int64(1), AnyTime{}, AnyTime{}).
 			WillReturnError(errors.New("db down"))
+		mock.ExpectRollback()
 		out, err := dbtes.PostPhoto(ctx, int64(1), inp)
 		assert.Error(t, err)
 		assert.Nil(t, out)
@@ -42,9 +44,11 @@ func TestDatabase_PostPhoto(t *testing.T) {
 	})
 
 	t.Run("postphoto required userid", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Title, inp.Caption, inp.PhotoUrl, int64(0), time.Now(), time.Now()).
+			WithArgs(inp.Title, inp.Caption, inp.PhotoUrl, "none", int64(0), AnyTime{}, AnyTime{}).
 			WillReturnError(errors.New("required userid"))
+		mock.ExpectRollback()
 		out, err := dbtes.PostPhoto(ctx, int64(0), inp)
 		assert.Error(t, err)
 		assert.Nil(t, out)
@@ -55,15 +59,76 @@ func TestDatabase_PostPhoto(t *testing.T) {
 		rows := mock.NewRows([]string{"id", "title", "caption", "photourl", "userid", "createdat"}).
 			AddRow(1, "Foto Kopi", "Foto kopi doang beneran", "http://imageurl.com/fotokopi.jpg", 1, time.Now())
 
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Title, inp.Caption, inp.PhotoUrl, int64(1), time.Now(), time.Now()).
+			WithArgs(inp.Title, inp.Caption, inp.PhotoUrl, "none", int64(1), AnyTime{}, AnyTime{}).
 			WillReturnRows(rows)
+		expectOutbox(mock, entity.EventPhotoCreated)
+		mock.ExpectCommit()
 		out, err := dbtes.PostPhoto(ctx, int64(1), inp)
 		assert.NotNil(t, out)
 		assert.NoError(t, err)
 	})
+
+	t.Run("postphoto with hashtags", func(t *testing.T) {
+		tagged := entity.PhotoPost{Title: "Foto Kopi", Caption: "Kopi pagi #Kopi #pagi #kopi", PhotoUrl: inp.PhotoUrl}
+		rows := mock.NewRows([]string{"id", "title", "caption", "photourl", "userid", "createdat"}).
+			AddRow(1, tagged.Title, tagged.Caption, tagged.PhotoUrl, 1, time.Now())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(qry)).
+			WithArgs(tagged.Title, tagged.Caption, tagged.PhotoUrl, "none", int64(1), AnyTime{}, AnyTime{}).
+			WillReturnRows(rows)
+		for _, tag := range []string{"kopi", "pagi"} {
+			mock.ExpectExec(regexp.QuoteMeta(insertTag)).
+				WithArgs(tag).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectExec(regexp.QuoteMeta("delete from phototags where photoid = @photoid and tagid not in (select id from tags where name in (@tag0, @tag1))")).
+			WithArgs("kopi", "pagi", int64(1), AnyTime{}).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("insert into phototags (photoid, tagid, createdat) select @photoid, t.id, @createdat from tags t where t.name in (@tag0, @tag1)")).
+			WithArgs("kopi", "pagi", int64(1), AnyTime{}).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		expectOutbox(mock, entity.EventPhotoCreated)
+		mock.ExpectCommit()
+		out, err := dbtes.PostPhoto(ctx, int64(1), tagged)
+		assert.NotNil(t, out)
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("postphoto with a tag stored concurrently", func(t *testing.T) {
+		tagged := entity.PhotoPost{Title: "Foto Kopi", Caption: "#kopi", PhotoUrl: inp.PhotoUrl}
+		photo := func() *sqlmock.Rows {
+			return mock.NewRows([]string{"id", "title", "caption", "photourl", "userid", "createdat"}).
+				AddRow(1, tagged.Title, tagged.Caption, tagged.PhotoUrl, 1, time.Now())
+		}
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(qry)).WillReturnRows(photo())
+		mock.ExpectExec(regexp.QuoteMeta(insertTag)).
+			WithArgs("kopi").
+			WillReturnError(sqlServerError(2627))
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(qry)).WillReturnRows(photo())
+		mock.ExpectExec(regexp.QuoteMeta(insertTag)).
+			WithArgs("kopi").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("delete from phototags")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("insert into phototags")).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectOutbox(mock, entity.EventPhotoCreated)
+		mock.ExpectCommit()
+		out, err := dbtes.PostPhoto(ctx, int64(1), tagged)
+		assert.NotNil(t, out)
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
 }
 
+const insertTag = "insert into tags (name) select @name where not exists (select 1 from tags where name = @name)"
+
 func TestDatabase_GetPhotos(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -74,25 +139,105 @@ func TestDatabase_GetPhotos(t *testing.T) {
 		SqlDb: db,
 	}
 	var qry strings.Builder
-	qry.WriteString("select p.id, p.title, p.caption, p.photourl, p.userid, p.createdat, p.updatedat, u.email, u.username from photos p")
+	qry.WriteString("select p.id, p.title, p.caption, p.photourl, p.userid, p.createdat, p.updatedat, p.processing, p.thumbnailurl, p.mediumurl, p.largeurl,")
+	qry.WriteString(" (select count(*) from comments c where c.photoid=p.id and c.deletedat is null), (select count(*) from likes l where l.photoid=p.id),")
+	qry.WriteString(" (case when exists (select 1 from likes l where l.photoid=p.id and l.userid=@viewer) then 1 else 0 end), u.email, u.username from photos p")
 	qry.WriteString(" join users u on p.userid=u.id")
 	t.Run("getphotos database down", func(t *testing.T) {
-		mock.ExpectQuery(qry.String()).
+		mock.ExpectQuery(regexp.QuoteMeta(qry.String())).
 			WillReturnError(errors.New("db down"))
-		out, err := dbtes.GetPhotos(ctx)
+		out, err := dbtes.GetPhotos(ctx, 0, entity.PhotoFilter{}, entity.PageRequest{})
 		assert.Error(t, err)
 		assert.Nil(t, out)
 		assert.Equal(t, "db down", err.Error())
 	})
 
 	t.Run("getphotos success", func(t *testing.T) {
-		rows := mock.NewRows([]string{"id", "title", "caption", "photourl", "userid", "createdat", "updatedat", "email", "username"}).
-			AddRow(1, "Foto Kopi", "Foto kopi doang beneran", "http://imageurl.com/fotokopi.jpg", 1, time.Now(), time.Now(), "deadapeipit@email.com", "deadapeipit")
+		rows := mock.NewRows([]string{"id", "title", "caption", "photourl", "userid", "createdat", "updatedat", "processing", "thumbnailurl", "mediumurl", "largeurl", "commentcount", "likecount", "likedbyme", "email", "username"}).
+			AddRow(1, "Foto Kopi", "Foto kopi doang beneran", "http://imageurl.com/fotokopi.jpg", 1, time.Now(), time.Now(), "none", nil, nil, nil, 2, 0, 0, "deadapeipit@email.com", "deadapeipit")
 
-		mock.ExpectQuery(qry.String()).WillReturnRows(rows)
-		out, err := dbtes.GetPhotos(ctx)
+		mock.ExpectQuery(regexp.QuoteMeta(qry.String())).WillReturnRows(rows)
+		expectMentions(mock, "m.photoid", mentionRows(mock).AddRow(1, 2, "ann", 0, 4), int64(1))
+		out, err := dbtes.GetPhotos(ctx, 0, entity.PhotoFilter{}, entity.PageRequest{})
 		assert.NotNil(t, out)
 		assert.NoError(t, err)
+		assert.Equal(t, []entity.Mention{{UserID: 2, Username: "ann", Offset: 0, Length: 4}}, out.Items[0].Mentions)
+		assert.Equal(t, entity.ProcessingNone, out.Items[0].Processing)
+		assert.Nil(t, out.Items[0].Variants)
+	})
+
+	t.Run("getphotos filters are parameters", func(t *testing.T) {
+		filtered := qry.String() + ` where p.userid = @userid and (lower(p.title) like @search escape '\' or lower(p.caption) like @search escape '\')` +
+			" order by (select count(*) from comments c where c.photoid=p.id and c.deletedat is null) desc, p.id desc"
+		mock.ExpectQuery(regexp.QuoteMeta(filtered)).
+			WithArgs(int64(3), `%50\%' or 1=1 --%`, int64(7), DefaultPageLimit+1).
+			WillReturnRows(mock.NewRows([]string{"id", "title", "caption", "photourl", "userid", "createdat", "updatedat", "processing", "thumbnailurl", "mediumurl", "largeurl", "commentcount", "likecount", "likedbyme", "email", "username"}))
+		out, err := dbtes.GetPhotos(ctx, 7, entity.PhotoFilter{
+			UserID: 3,
+			Search: "50%' OR 1=1 --",
+			Sort:   entity.Sort{Field: entity.SortCommentCount, Desc: true},
+		}, entity.PageRequest{})
+		assert.NoError(t, err)
+		assert.Empty(t, out.Items)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("getphotos unknown sort", func(t *testing.T) {
+		out, err := dbtes.GetPhotos(ctx, 0, entity.PhotoFilter{Sort: entity.Sort{Field: "p.id; drop table photos"}}, entity.PageRequest{})
+		assert.Nil(t, out)
+		assert.ErrorIs(t, err, ErrInvalidSort)
+	})
+}
+
+func TestDatabase_GetPhotoByID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	qry := regexp.QuoteMeta(photoGetOutputQuery + " where p.id = @ID")
+	cols := []string{"id", "title", "caption", "photourl", "userid", "createdat", "updatedat", "processing", "thumbnailurl", "mediumurl", "largeurl", "commentcount", "likecount", "likedbyme", "email", "username"}
+	t.Run("getphotobyid database down", func(t *testing.T) {
+		mock.ExpectQuery(qry).
+			WithArgs(int64(0), int64(1)).
+			WillReturnError(errors.New("db down"))
+		out, err := dbtes.GetPhotoByID(ctx, 0, int64(1))
+		assert.Nil(t, out)
+		assert.EqualError(t, err, "db down")
+	})
+
+	t.Run("getphotobyid not found", func(t *testing.T) {
+		mock.ExpectQuery(qry).
+			WithArgs(int64(0), int64(2)).
+			WillReturnRows(mock.NewRows(cols))
+		out, err := dbtes.GetPhotoByID(ctx, 0, int64(2))
+		assert.Nil(t, out)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("getphotobyid success", func(t *testing.T) {
+		mock.ExpectQuery(qry).
+			WithArgs(int64(5), int64(1)).
+			WillReturnRows(mock.NewRows(cols).
+				AddRow(1, "Foto Kopi", "Foto kopi doang beneran", "/media/photos/a.png", 1, time.Now(), time.Now(), "ready",
+					"/media/photos/a_thumbnail.jpg", "/media/photos/a_medium.jpg", "/media/photos/a_large.jpg", 3, 4, 1, "deadapeipit@email.com", "deadapeipit"))
+		expectMentions(mock, "m.photoid", mentionRows(mock), int64(1))
+		out, err := dbtes.GetPhotoByID(ctx, 5, int64(1))
+		assert.NoError(t, err)
+		assert.Empty(t, out.Mentions)
+		assert.Equal(t, int64(3), out.CommentCount)
+		assert.Equal(t, int64(4), out.LikeCount)
+		assert.True(t, out.LikedByMe)
+		assert.Equal(t, "deadapeipit", out.User.Username)
+		assert.Equal(t, entity.ProcessingReady, out.Processing)
+		assert.Equal(t, &entity.PhotoVariants{
+			Thumbnail: "/media/photos/a_thumbnail.jpg",
+			Medium:    "/media/photos/a_medium.jpg",
+			Large:     "/media/photos/a_large.jpg",
+		}, out.Variants)
 	})
 }
 
@@ -105,7 +250,12 @@ func TestDatabase_UpdatePhoto(t *testing.T) {
 	dbtes := Database{
 		SqlDb: db,
 	}
-	qry := "update photos set title=@title, caption=@caption, photourl=@photourl, updatedat=@updatedat where id = @ID and userid = @userid; select id, title, caption, photourl, userid, updatedat from photos where id = @ID"
+	qry := "update photos set title=@title, caption=@caption, photourl=@photourl, updatedat=@updatedat," +
+		" processing=case when photourl=@photourl then processing else @none end," +
+		" thumbnailurl=case when photourl=@photourl then thumbnailurl end," +
+		" mediumurl=case when photourl=@photourl then mediumurl end," +
+		" largeurl=case when photourl=@photourl then largeurl end" +
+		" where id = @ID and userid = @userid; if @@ROWCOUNT > 0 select id, title, caption, photourl, userid, updatedat from photos where id = @ID"
 	inp := entity.PhotoPost{
 		Title:    "Foto Kopi",
 		Caption:  "Foto kopi doang beneran",
@@ -113,9 +263,11 @@ func TestDatabase_UpdatePhoto(t *testing.T) {
 	}
 
 	t.Run("updatephoto database down", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Title, inp.Caption, inp.PhotoUrl, time.Now(), int64(1), int64(1)).
+			WithArgs(inp.Title, inp.Caption, inp.PhotoUrl, AnyTime{}, "none", int64(1), int64(1)).
 			WillReturnError(errors.New("db down"))
+		mock.ExpectRollback()
 		out, err := dbtes.UpdatePhoto(ctx, int64(1), int64(1), inp)
 		assert.Error(t, err)
 		assert.Nil(t, out)
@@ -123,9 +275,11 @@ func TestDatabase_UpdatePhoto(t *testing.T) {
 	})
 
 	t.Run("updatephoto required id", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Title, inp.Caption, inp.PhotoUrl, time.Now(), int64(1), int64(0)).
+			WithArgs(inp.Title, inp.Caption, inp.PhotoUrl, AnyTime{}, "none", int64(1), int64(0)).
 			WillReturnError(errors.New("required id"))
+		mock.ExpectRollback()
 		out, err := dbtes.UpdatePhoto(ctx, int64(1), int64(0), inp)
 		assert.Error(t, err)
 		assert.Nil(t, out)
@@ -133,9 +287,11 @@ func TestDatabase_UpdatePhoto(t *testing.T) {
 	})
 
 	t.Run("updatephoto required userid", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Title, inp.Caption, inp.PhotoUrl, time.Now(), int64(0), int64(1)).
+			WithArgs(inp.Title, inp.Caption, inp.PhotoUrl, AnyTime{}, "none", int64(0), int64(1)).
 			WillReturnError(errors.New("required userid"))
+		mock.ExpectRollback()
 		out, err := dbtes.UpdatePhoto(ctx, int64(0), int64(1), inp)
 		assert.Error(t, err)
 		assert.Nil(t, out)
@@ -146,12 +302,45 @@ func TestDatabase_UpdatePhoto(t *testing.T) {
 		rows := mock.NewRows([]string{"id", "title", "caption", "photourl", "userid", "updatedat"}).
 			AddRow(1, "Foto Kopi", "Foto kopi doang beneran", "http://imageurl.com/fotokopi.jpg", 1, time.Now())
 
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Title, inp.Caption, inp.PhotoUrl, time.Now(), int64(1), int64(1)).
+			WithArgs(inp.Title, inp.Caption, inp.PhotoUrl, AnyTime{}, "none", int64(1), int64(1)).
 			WillReturnRows(rows)
+		mock.ExpectExec(regexp.QuoteMeta("delete from mentions where photoid = @photoid and commentid is null")).
+			WithArgs(int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("delete from phototags where photoid = @photoid")).
+			WithArgs(int64(1), AnyTime{}).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		expectOutbox(mock, entity.EventPhotoUpdated)
+		mock.ExpectCommit()
 		out, err := dbtes.UpdatePhoto(ctx, int64(1), int64(1), inp)
 		assert.NotNil(t, out)
 		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("updatephoto deleted while a tag was stored concurrently", func(t *testing.T) {
+		tagged := entity.PhotoPost{Title: inp.Title, Caption: "#kopi", PhotoUrl: inp.PhotoUrl}
+		rows := mock.NewRows([]string{"id", "title", "caption", "photourl", "userid", "updatedat"}).
+			AddRow(1, tagged.Title, tagged.Caption, tagged.PhotoUrl, 1, time.Now())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(qry)).WillReturnRows(rows)
+		mock.ExpectExec(regexp.QuoteMeta("delete from mentions where photoid = @photoid and commentid is null")).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(insertTag)).
+			WithArgs("kopi").
+			WillReturnError(sqlServerError(2627))
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(qry)).
+			WillReturnRows(mock.NewRows([]string{"id", "title", "caption", "photourl", "userid", "updatedat"}))
+		mock.ExpectRollback()
+		out, err := dbtes.UpdatePhoto(ctx, int64(1), int64(1), tagged)
+		assert.Nil(t, out)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
 
@@ -164,10 +353,16 @@ func TestDatabase_DeletePhoto(t *testing.T) {
 	dbtes := Database{
 		SqlDb: db,
 	}
-	qry := "delete from comments where photoid=@id and userid=@userid; delete from photos where id=@id and userid=@userid"
+	replies := regexp.QuoteMeta("update comments set parentid=null where photoid=@id")
+	mentions := regexp.QuoteMeta("delete from mentions where photoid=@id")
+	notifications := regexp.QuoteMeta("delete from notifications where photoid=@id")
+	comments := regexp.QuoteMeta("delete from comments where photoid=@id")
+	likes := regexp.QuoteMeta("delete from likes where photoid=@id")
+	phototags := regexp.QuoteMeta("delete from phototags where photoid=@id")
+	photos := regexp.QuoteMeta("delete from photos where id=@id and userid=@userid")
+	deleted := regexp.QuoteMeta("select id, userid from comments where photoid=@id and deletedat is null order by id")
 	t.Run("deletephoto database down", func(t *testing.T) {
-		mock.ExpectExec(qry).
-			WithArgs(int64(1), int64(1)).
+		mock.ExpectBegin().
 			WillReturnError(errors.New("db down"))
 		out, err := dbtes.DeletePhoto(ctx, int64(1), int64(1))
 		assert.Error(t, err)
@@ -176,31 +371,164 @@ func TestDatabase_DeletePhoto(t *testing.T) {
 	})
 
 	t.Run("deletephoto required userid", func(t *testing.T) {
-		mock.ExpectExec(qry).
+		mock.ExpectBegin()
+		mock.ExpectQuery(deleted).
+			WithArgs(int64(1)).
+			WillReturnRows(mock.NewRows([]string{"id", "userid"}))
+		mock.ExpectExec(replies).
 			WithArgs(int64(0), int64(1)).
 			WillReturnError(errors.New("required userid"))
+		mock.ExpectRollback()
 		out, err := dbtes.DeletePhoto(ctx, int64(0), int64(1))
 		assert.Error(t, err)
 		assert.Equal(t, "", out)
 		assert.Equal(t, "required userid", err.Error())
 	})
 
-	t.Run("deletephoto required id", func(t *testing.T) {
-		mock.ExpectExec(qry).
-			WithArgs(int64(1), int64(0)).
-			WillReturnError(errors.New("required id"))
-		out, err := dbtes.DeletePhoto(ctx, int64(1), int64(0))
-		assert.Error(t, err)
+	t.Run("deletephoto fails mid-cascade", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(deleted).
+			WithArgs(int64(1)).
+			WillReturnRows(mock.NewRows([]string{"id", "userid"}))
+		mock.ExpectExec(replies).
+			WithArgs(int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(mentions).
+			WithArgs(int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(notifications).
+			WithArgs(int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(comments).
+			WithArgs(int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(likes).
+			WithArgs(int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(phototags).
+			WithArgs(int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(photos).
+			WithArgs(int64(1), int64(1)).
+			WillReturnError(errors.New("db down"))
+		mock.ExpectRollback()
+		out, err := dbtes.DeletePhoto(ctx, int64(1), int64(1))
 		assert.Equal(t, "", out)
-		assert.Equal(t, "required id", err.Error())
+		assert.EqualError(t, err, "db down")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("deletephoto not owner", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(deleted).
+			WithArgs(int64(1)).
+			WillReturnRows(mock.NewRows([]string{"id", "userid"}))
+		mock.ExpectExec(replies).
+			WithArgs(int64(2), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(mentions).
+			WithArgs(int64(2), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(notifications).
+			WithArgs(int64(2), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(comments).
+			WithArgs(int64(2), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(likes).
+			WithArgs(int64(2), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(phototags).
+			WithArgs(int64(2), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(photos).
+			WithArgs(int64(2), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		out, err := dbtes.DeletePhoto(ctx, int64(2), int64(1))
+		assert.Equal(t, "", out)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
 	t.Run("deletephoto success", func(t *testing.T) {
-		mock.ExpectExec(qry).
+		mock.ExpectBegin()
+		mock.ExpectQuery(deleted).
+			WithArgs(int64(1)).
+			WillReturnRows(mock.NewRows([]string{"id", "userid"}).AddRow(4, 1).AddRow(5, 2))
+		mock.ExpectExec(replies).
+			WithArgs(int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(mentions).
+			WithArgs(int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(notifications).
+			WithArgs(int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(comments).
+			WithArgs(int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(likes).
+			WithArgs(int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(phototags).
+			WithArgs(int64(1), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(photos).
 			WithArgs(int64(1), int64(1)).
 			WillReturnResult(sqlmock.NewResult(1, 1))
+		expectOutbox(mock, entity.EventCommentDeleted)
+		expectOutbox(mock, entity.EventCommentDeleted)
+		expectOutbox(mock, entity.EventPhotoDeleted)
+		mock.ExpectCommit()
 		out, err := dbtes.DeletePhoto(ctx, int64(1), int64(1))
 		assert.NotNil(t, out)
 		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestDatabase_SetPhotoVariants(t *testing.T) {
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	qry := regexp.QuoteMeta("update photos set processing=@state, thumbnailurl=@thumbnail, mediumurl=@medium, largeurl=@large where id=@id and processing=@processing and photourl=@photourl")
+	variants := &entity.PhotoVariants{Thumbnail: "/media/a_thumbnail.jpg", Medium: "/media/a_medium.jpg", Large: "/media/a_large.jpg"}
+
+	t.Run("setphotovariants ready", func(t *testing.T) {
+		mock.ExpectExec(qry).
+			WithArgs("ready", variants.Thumbnail, variants.Medium, variants.Large, int64(1), "processing", "/media/a.png").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		assert.NoError(t, dbtes.SetPhotoVariants(ctx, 1, "/media/a.png", entity.ProcessingReady, variants))
+	})
+
+	t.Run("setphotovariants failed", func(t *testing.T) {
+		mock.ExpectExec(qry).
+			WithArgs("failed", nil, nil, nil, int64(1), "processing", "/media/a.png").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		assert.NoError(t, dbtes.SetPhotoVariants(ctx, 1, "/media/a.png", entity.ProcessingFailed, nil))
+	})
+
+	t.Run("setphotovariants no longer processing", func(t *testing.T) {
+		mock.ExpectExec(qry).
+			WithArgs("ready", variants.Thumbnail, variants.Medium, variants.Large, int64(2), "processing", "/media/a.png").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		assert.ErrorIs(t, dbtes.SetPhotoVariants(ctx, 2, "/media/a.png", entity.ProcessingReady, variants), ErrNotFound)
+	})
+
+	t.Run("getprocessingphotos", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("select id, title, caption, photourl, userid, createdat, updatedat from photos where processing=@processing order by id")).
+			WithArgs("processing").
+			WillReturnRows(mock.NewRows([]string{"id", "title", "caption", "photourl", "userid", "createdat", "updatedat"}).
+				AddRow(3, "Foto Kopi", "", "/media/photos/a.png", 1, time.Now(), time.Now()))
+		out, err := dbtes.GetProcessingPhotos(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, out, 1)
+		assert.Equal(t, int64(3), out[0].ID)
+		assert.Equal(t, entity.ProcessingPending, out[0].Processing)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// RevocationStore is consulted by SecureMiddleware for every access token that verifies.
+// A token is rejected when its jti was revoked or when it was issued under an
+// older generation than the user's current one.
+type RevocationStore interface {
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	GetTokenGeneration(ctx context.Context, userid int64) (int64, error)
+	IncrementTokenGeneration(ctx context.Context, userid int64) (int64, error)
+}
+
+var Revocations RevocationStore
+
+// RevokeToken revokes jti. Revoking it again, as two logouts with the same
+// token at once do, is no error.
+func (s *Database) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	qry := []string{
+		"insert into revokedtokens (jti, expiresat) select @jti, @expiresat where not exists (select 1 from revokedtokens where jti = @jti)",
+		"delete from revokedtokens where expiresat < @now",
+	}
+	err := s.execBatch(ctx, qry,
+		sql.Named("jti", jti),
+		sql.Named("expiresat", expiresAt),
+		sql.Named("now", time.Now()))
+	// ErrConflict: another request revoked it in the meantime.
+	if errors.Is(err, ErrConflict) {
+		return nil
+	}
+	return err
+}
+
+func (s *Database) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int
+	qry := "select count(1) from revokedtokens where jti = @jti"
+	err := s.queryRowContext(ctx, qry,
+		sql.Named("jti", jti)).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *Database) GetTokenGeneration(ctx context.Context, userid int64) (int64, error) {
+	var result int64
+	qry := "select tokengeneration from users where id = @id"
+	rows, err := s.queryContext(ctx, qry,
+		sql.Named("id", userid))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&result); err != nil {
+			return 0, err
+		}
+	}
+	return result, nil
+}
+
+func (s *Database) IncrementTokenGeneration(ctx context.Context, userid int64) (int64, error) {
+	var result int64
+	qry := "update users set tokengeneration = tokengeneration + 1 where id = @id" +
+		s.sqlDialect().updateReturning("users", "tokengeneration", "id = @id")
+	rows, err := s.queryContext(ctx, qry,
+		sql.Named("id", userid))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&result); err != nil {
+			return 0, err
+		}
+	}
+	return result, nil
+}
+
+// MemoryRevocationStore is a RevocationStore kept in process memory, for tests
+// and single instance deployments.
+type MemoryRevocationStore struct {
+	mu          sync.Mutex
+	revoked     map[string]time.Time
+	generations map[int64]int64
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		revoked:     map[string]time.Time{},
+		generations: map[int64]int64{},
+	}
+}
+
+func (m *MemoryRevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for k, exp := range m.revoked {
+		if exp.Before(now) {
+			delete(m.revoked, k)
+		}
+	}
+	m.revoked[jti] = expiresAt
+	return nil
+}
+
+func (m *MemoryRevocationStore) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.revoked[jti]
+	return ok, nil
+}
+
+func (m *MemoryRevocationStore) GetTokenGeneration(ctx context.Context, userid int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.generations[userid], nil
+}
+
+func (m *MemoryRevocationStore) IncrementTokenGeneration(ctx context.Context, userid int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.generations[userid]++
+	return m.generations[userid], nil
+}
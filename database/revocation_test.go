@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatabase_RevokeToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	qry := "insert into revokedtokens (jti, expiresat) select @jti, @expiresat where not exists (select 1 from revokedtokens where jti = @jti);" +
+		" delete from revokedtokens where expiresat < @now"
+	exp := time.Now().Add(time.Minute)
+
+	t.Run("revoketoken database down", func(t *testing.T) {
+		mock.ExpectExec(regexp.QuoteMeta(qry)).
+			WithArgs("jti", exp, AnyTime{}).
+			WillReturnError(errors.New("db down"))
+		err := dbtes.RevokeToken(ctx, "jti", exp)
+		assert.Error(t, err)
+	})
+
+	t.Run("revoketoken revoked concurrently", func(t *testing.T) {
+		mock.ExpectExec(regexp.QuoteMeta(qry)).
+			WithArgs("jti", exp, AnyTime{}).
+			WillReturnError(sqlServerError(2627))
+		err := dbtes.RevokeToken(ctx, "jti", exp)
+		assert.NoError(t, err)
+	})
+
+	t.Run("revoketoken success", func(t *testing.T) {
+		mock.ExpectExec(regexp.QuoteMeta(qry)).
+			WithArgs("jti", exp, AnyTime{}).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		err := dbtes.RevokeToken(ctx, "jti", exp)
+		assert.NoError(t, err)
+	})
+}
+
+func TestDatabase_IsTokenRevoked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	qry := "select count(1) from revokedtokens where jti = @jti"
+
+	t.Run("istokenrevoked database down", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(qry)).
+			WithArgs("jti").
+			WillReturnError(errors.New("db down"))
+		revoked, err := dbtes.IsTokenRevoked(ctx, "jti")
+		assert.Error(t, err)
+		assert.False(t, revoked)
+	})
+
+	t.Run("istokenrevoked success", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(qry)).
+			WithArgs("jti").
+			WillReturnRows(mock.NewRows([]string{"count"}).AddRow(1))
+		revoked, err := dbtes.IsTokenRevoked(ctx, "jti")
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+	})
+}
+
+func TestDatabase_TokenGeneration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+
+	t.Run("gettokengeneration success", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("select tokengeneration from users where id = @id")).
+			WithArgs(int64(1)).
+			WillReturnRows(mock.NewRows([]string{"tokengeneration"}).AddRow(2))
+		gen, err := dbtes.GetTokenGeneration(ctx, int64(1))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), gen)
+	})
+
+	t.Run("incrementtokengeneration success", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("update users set tokengeneration = tokengeneration + 1 where id = @id; if @@ROWCOUNT > 0 select tokengeneration from users where id = @id")).
+			WithArgs(int64(1)).
+			WillReturnRows(mock.NewRows([]string{"tokengeneration"}).AddRow(3))
+		gen, err := dbtes.IncrementTokenGeneration(ctx, int64(1))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), gen)
+	})
+
+	t.Run("incrementtokengeneration database down", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("update users set tokengeneration = tokengeneration + 1 where id = @id; if @@ROWCOUNT > 0 select tokengeneration from users where id = @id")).
+			WithArgs(int64(1)).
+			WillReturnError(errors.New("db down"))
+		_, err := dbtes.IncrementTokenGeneration(ctx, int64(1))
+		assert.Error(t, err)
+	})
+}
+
+func TestMemoryRevocationStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+
+	revoked, _ := store.IsTokenRevoked(ctx, "jti")
+	assert.False(t, revoked)
+	assert.NoError(t, store.RevokeToken(ctx, "jti", time.Now().Add(time.Minute)))
+	revoked, _ = store.IsTokenRevoked(ctx, "jti")
+	assert.True(t, revoked)
+
+	// expired entries are dropped on the next revocation
+	assert.NoError(t, store.RevokeToken(ctx, "old", time.Now().Add(-time.Minute)))
+	assert.NoError(t, store.RevokeToken(ctx, "new", time.Now().Add(time.Minute)))
+	revoked, _ = store.IsTokenRevoked(ctx, "old")
+	assert.False(t, revoked)
+
+	gen, _ := store.GetTokenGeneration(ctx, 1)
+	assert.Equal(t, int64(0), gen)
+	gen, _ = store.IncrementTokenGeneration(ctx, 1)
+	assert.Equal(t, int64(1), gen)
+	gen, _ = store.GetTokenGeneration(ctx, 2)
+	assert.Equal(t, int64(0), gen)
+}
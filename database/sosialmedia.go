@@ -10,90 +10,153 @@ import (
 
 func (s *Database) PostSocialMedia(ctx context.Context, userid int64, i entity.SocialMediaPost) (*entity.SocialMedia, error) {
 	result := &entity.SocialMedia{}
-	qry := "insert into socialmedias (name, socialmediaurl, profileimageurl, userid, createdat, updatedat) values (@name, @socialmediaurl, @profileimageurl, @userid, @createdat, @updatedat); select id, name, socialmediaurl, profileimageurl, userid, createdat,updatedat from socialmedias"
+	qry := "insert into socialmedias (name, socialmediaurl, profileimageurl, userid, createdat, updatedat) values (@name, @socialmediaurl, @profileimageurl, @userid, @createdat, @updatedat)" +
+		s.sqlDialect().insertReturning("socialmedias", "id, name, socialmediaurl, profileimageurl, userid, createdat, updatedat")
 	now := time.Now()
-	rows, err := s.SqlDb.QueryContext(ctx, qry,
-		sql.Named("name", i.Name),
-		sql.Named("socialmediaurl", i.SocialMediaURL),
-		sql.Named("profileimageurl", i.ProfileImageURL),
-		sql.Named("userid", userid),
-		sql.Named("createdat", now),
-		sql.Named("updatedat", now))
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		err := rows.Scan(
-			&result.ID,
-			&result.Name,
-			&result.SocialMediaURL,
-			&result.ProfileImageURL,
-			&result.UserID,
-			&result.CreatedAt,
-			&result.UpdatedAt,
-		)
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := s.txQueryContext(ctx, tx, qry,
+			sql.Named("name", i.Name),
+			sql.Named("socialmediaurl", i.SocialMediaURL),
+			sql.Named("profileimageurl", i.ProfileImageURL),
+			sql.Named("userid", userid),
+			sql.Named("createdat", now),
+			sql.Named("updatedat", now))
 		if err != nil {
-			return nil, err
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			err := rows.Scan(
+				&result.ID,
+				&result.Name,
+				&result.SocialMediaURL,
+				&result.ProfileImageURL,
+				&result.UserID,
+				&result.CreatedAt,
+				&result.UpdatedAt,
+			)
+			if err != nil {
+				return err
+			}
 		}
+		if err := rows.Err(); err != nil {
+			return s.translateError(err)
+		}
+		rows.Close()
+		return s.addToOutbox(ctx, tx, entity.EventSocialMediaCreated, result, now)
+	})
+	if err != nil {
+		return nil, err
 	}
-
 	return result, nil
 }
 
-func (s *Database) GetSocialMedias(ctx context.Context) ([]entity.SocialMediaGetOutput, error) {
+// socialMediaGetOutputQuery reads entity.SocialMediaGetOutput rows for scanSocialMediaGetOutput.
+const socialMediaGetOutputQuery = "select s.id, s.name, s.socialmediaurl, s.userid, s.createdat, s.updatedat," +
+	" u.username, s.profileimageurl" +
+	" from socialmedias s join users u on s.userid=u.id"
+
+func scanSocialMediaGetOutput(rows *sql.Rows) (entity.SocialMediaGetOutput, error) {
+	var row entity.SocialMediaGetOutput
+	err := rows.Scan(
+		&row.ID,
+		&row.Name,
+		&row.SocialMediaURL,
+		&row.UserID,
+		&row.CreatedAt,
+		&row.UpdatedAt,
+		&row.User.Username,
+		&row.User.ProfileImageURL,
+	)
+	row.User.ID = row.UserID
+	return row, err
+}
+
+// socialMediaSorts are the columns GET /socialmedias may be sorted by.
+var socialMediaSorts = map[string]sortColumn[entity.SocialMediaGetOutput]{
+	entity.SortCreatedAt: {"s.createdat", func(sm entity.SocialMediaGetOutput) interface{} { return sm.CreatedAt }},
+	entity.SortUpdatedAt: {"s.updatedat", func(sm entity.SocialMediaGetOutput) interface{} { return sm.UpdatedAt }},
+}
+
+func (s *Database) GetSocialMedias(ctx context.Context, filter entity.SocialMediaFilter, page entity.PageRequest) (*entity.Page[entity.SocialMediaGetOutput], error) {
 	var result []entity.SocialMediaGetOutput
+	q, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
+	value, err := sortBy(&q, filter.Sort, socialMediaSorts)
+	if err != nil {
+		return nil, err
+	}
+	var where conditions
+	if filter.UserID != 0 {
+		where.add("s.userid = @userid", sql.Named("userid", filter.UserID))
+	}
+	if filter.Search != "" {
+		where.add(`lower(s.name) like @search escape '\'`, sql.Named("search", containing(filter.Search)))
+	}
+	if keyset := q.where("s.id"); keyset != "" {
+		where.add(keyset, sql.Named("cursor", q.cursor.ID), sql.Named("cursorvalue", q.cursor.value()))
+	}
 	var qry strings.Builder
-	qry.WriteString("select s.id, s.name, s.socialmediaurl, s.userid, s.createdat, s.updatedat,")
-	qry.WriteString(" u.username, s.profileimageurl")
-	qry.WriteString(" from socialmedias s join users u on s.userid=u.id")
-	rows, err := s.SqlDb.QueryContext(ctx, qry.String())
+	qry.WriteString(socialMediaGetOutputQuery)
+	qry.WriteString(where.String())
+	qry.WriteString(q.orderBy("s.id"))
+	qry.WriteString(s.sqlDialect().limit("@limit"))
+	rows, err := s.queryContext(ctx, qry.String(), append(where.args, sql.Named("limit", q.fetch()))...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var row entity.SocialMediaGetOutput
-		err := rows.Scan(
-			&row.ID,
-			&row.Name,
-			&row.SocialMediaURL,
-			&row.UserID,
-			&row.CreatedAt,
-			&row.UpdatedAt,
-			&row.User.Username,
-			&row.User.ProfileImageURL,
-		)
+		row, err := scanSocialMediaGetOutput(rows)
 		if err != nil {
 			return nil, err
 		}
-		row.User.ID = row.UserID
 		result = append(result, row)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return makePage(result, q, func(sm entity.SocialMediaGetOutput) int64 { return sm.ID }, value), nil
+}
+
+// GetUserSocialMedias is one page of a user's social media, ErrNotFound when
+// there is no such user.
+func (s *Database) GetUserSocialMedias(ctx context.Context, userid int64, page entity.PageRequest) (*entity.Page[entity.SocialMediaGetOutput], error) {
+	result, err := s.GetSocialMedias(ctx, entity.SocialMediaFilter{UserID: userid}, page)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Items) == 0 {
+		if ok, err := s.exists(ctx, "users", userid); err != nil || !ok {
+			return nil, notFoundUnless(err)
+		}
+	}
 	return result, nil
 }
 
-func (s *Database) GetSocialMediaByID(ctx context.Context, id int64) (*entity.SocialMedia, error) {
-	result := &entity.SocialMedia{}
+func (s *Database) GetSocialMediaByID(ctx context.Context, id int64) (*entity.SocialMediaGetOutput, error) {
+	result := &entity.SocialMediaGetOutput{}
 
-	rows, err := s.SqlDb.QueryContext(ctx, "select id, name, socialmediaurl, userid, createdat, updatedat from socialmedias where id = @ID",
+	rows, err := s.queryContext(ctx, socialMediaGetOutputQuery+" where s.id = @ID",
 		sql.Named("ID", id))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		err := rows.Scan(
-			&result.ID,
-			&result.Name,
-			&result.SocialMediaURL,
-			&result.UserID,
-			&result.CreatedAt,
-			&result.UpdatedAt,
-		)
+		row, err := scanSocialMediaGetOutput(rows)
 		if err != nil {
 			return nil, err
 		}
+		result = &row
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if result.ID == 0 {
+		return nil, ErrNotFound
 	}
 	return result, nil
 }
@@ -101,30 +164,44 @@ func (s *Database) GetSocialMediaByID(ctx context.Context, id int64) (*entity.So
 func (s *Database) UpdateSocialMedia(ctx context.Context, userid int64, id int64, i entity.SocialMediaPost) (*entity.SocialMedia, error) {
 	result := &entity.SocialMedia{}
 	now := time.Now()
-	qry := "update socialmedias set name=@name, socialmediaurl=@socialmediaurl, profileimageurl=@profileimageurl, updatedat=@updatedat where id = @ID; select id, name, socialmediaurl, profileimageurl, userid, updatedat from socialmedias where id = @ID"
-	rows, err := s.SqlDb.QueryContext(ctx, qry,
-		sql.Named("name", i.Name),
-		sql.Named("socialmediaurl", i.SocialMediaURL),
-		sql.Named("profileimageurl", i.ProfileImageURL),
-		sql.Named("updatedat", now),
-		sql.Named("userid", userid),
-		sql.Named("ID", id))
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		err := rows.Scan(
-			&result.ID,
-			&result.Name,
-			&result.SocialMediaURL,
-			&result.ProfileImageURL,
-			&result.UserID,
-			&result.UpdatedAt,
-		)
+	qry := "update socialmedias set name=@name, socialmediaurl=@socialmediaurl, profileimageurl=@profileimageurl, updatedat=@updatedat where id = @ID and userid = @userid" +
+		s.sqlDialect().updateReturning("socialmedias", "id, name, socialmediaurl, profileimageurl, userid, updatedat", "id = @ID")
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := s.txQueryContext(ctx, tx, qry,
+			sql.Named("name", i.Name),
+			sql.Named("socialmediaurl", i.SocialMediaURL),
+			sql.Named("profileimageurl", i.ProfileImageURL),
+			sql.Named("updatedat", now),
+			sql.Named("userid", userid),
+			sql.Named("ID", id))
 		if err != nil {
-			return nil, err
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			err := rows.Scan(
+				&result.ID,
+				&result.Name,
+				&result.SocialMediaURL,
+				&result.ProfileImageURL,
+				&result.UserID,
+				&result.UpdatedAt,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return s.translateError(err)
 		}
+		if result.ID == 0 {
+			return ErrNotFound
+		}
+		rows.Close()
+		return s.addToOutbox(ctx, tx, entity.EventSocialMediaUpdated, result, now)
+	})
+	if err != nil {
+		return nil, err
 	}
 	return result, nil
 }
@@ -132,9 +209,20 @@ func (s *Database) UpdateSocialMedia(ctx context.Context, userid int64, id int64
 func (s *Database) DeleteSocialMedia(ctx context.Context, userid int64, id int64) (string, error) {
 	var result string
 	qry := "delete from socialmedias where id=@id and userid=@userid"
-	_, err := s.SqlDb.ExecContext(ctx, qry,
-		sql.Named("userid", userid),
-		sql.Named("id", id))
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := s.txExecContext(ctx, tx, qry,
+			sql.Named("userid", userid),
+			sql.Named("id", id))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return s.addToOutbox(ctx, tx, entity.EventSocialMediaDeleted, entity.DeletedResource{ID: id, UserID: userid}, time.Now())
+	})
 	if err != nil {
 		return "", err
 	}
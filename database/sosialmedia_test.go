@@ -23,7 +23,7 @@ func TestDatabase_PostSocialMedia(t *testing.T) {
 	dbtes := Database{
 		SqlDb: db,
 	}
-	qry := "insert into socialmedias (name, socialmediaurl, profileimageurl, userid, createdat, updatedat) values (@name, @socialmediaurl, @profileimageurl, @userid, @createdat, @updatedat); select id, name, socialmediaurl, profileimageurl, userid, createdat,updatedat from socialmedias"
+	qry := "insert into socialmedias (name, socialmediaurl, profileimageurl, userid, createdat, updatedat) values (@name, @socialmediaurl, @profileimageurl, @userid, @createdat, @updatedat); select id, name, socialmediaurl, profileimageurl, userid, createdat, updatedat from socialmedias where id = SCOPE_IDENTITY()"
 
 	inp := entity.SocialMediaPost{
 		Name:            "socialmedia orang ganteng",
@@ -32,9 +32,11 @@ func TestDatabase_PostSocialMedia(t *testing.T) {
 	}
 
 	t.Run("postsocialmedia database down", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Name, inp.SocialMediaURL, inp.ProfileImageURL, int64(1), time.Now(), time.Now()).
+			WithArgs(inp.Name, inp.SocialMediaURL, inp.ProfileImageURL, int64(1), AnyTime{}, AnyTime{}).
 			WillReturnError(errors.New("db down"))
+		mock.ExpectRollback()
 		out, err := dbtes.PostSocialMedia(ctx, int64(1), inp)
 		assert.Error(t, err)
 		assert.Nil(t, out)
@@ -42,9 +44,11 @@ func TestDatabase_PostSocialMedia(t *testing.T) {
 	})
 
 	t.Run("postsocialmedia required userid", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Name, inp.SocialMediaURL, inp.ProfileImageURL, int64(0), time.Now(), time.Now()).
+			WithArgs(inp.Name, inp.SocialMediaURL, inp.ProfileImageURL, int64(0), AnyTime{}, AnyTime{}).
 			WillReturnError(errors.New("required userid"))
+		mock.ExpectRollback()
 		out, err := dbtes.PostSocialMedia(ctx, int64(0), inp)
 		assert.Error(t, err)
 		assert.Nil(t, out)
@@ -55,12 +59,16 @@ func TestDatabase_PostSocialMedia(t *testing.T) {
 		rows := mock.NewRows([]string{"id", "name", "socialmediaurl", "profileimageurl", "userid", "createdat", "updatedat"}).
 			AddRow(1, "SocialMedia Name", "http://socialmediaurl.com/socialmediaurl.jpg", "http://profileimageurl.com/profileimageurl.jpg", 1, time.Now(), time.Now())
 
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Name, inp.SocialMediaURL, inp.ProfileImageURL, int64(1), time.Now(), time.Now()).
+			WithArgs(inp.Name, inp.SocialMediaURL, inp.ProfileImageURL, int64(1), AnyTime{}, AnyTime{}).
 			WillReturnRows(rows)
+		expectOutbox(mock, entity.EventSocialMediaCreated)
+		mock.ExpectCommit()
 		out, err := dbtes.PostSocialMedia(ctx, int64(1), inp)
 		assert.NotNil(t, out)
 		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
 
@@ -80,7 +88,7 @@ func TestDatabase_GetSocialMedias(t *testing.T) {
 	t.Run("getsocialmedias database down", func(t *testing.T) {
 		mock.ExpectQuery(qry.String()).
 			WillReturnError(errors.New("db down"))
-		out, err := dbtes.GetSocialMedias(ctx)
+		out, err := dbtes.GetSocialMedias(ctx, entity.SocialMediaFilter{}, entity.PageRequest{})
 		assert.Error(t, err)
 		assert.Nil(t, out)
 		assert.Equal(t, "db down", err.Error())
@@ -91,7 +99,7 @@ func TestDatabase_GetSocialMedias(t *testing.T) {
 			AddRow(1, "SocialMedia Name", "http://socialmediaurl.com/socialmediaurl.jpg", 1, time.Now(), time.Now(), "User Name", "http://profileimageurl/profile.jpg")
 
 		mock.ExpectQuery(qry.String()).WillReturnRows(rows)
-		out, err := dbtes.GetSocialMedias(ctx)
+		out, err := dbtes.GetSocialMedias(ctx, entity.SocialMediaFilter{}, entity.PageRequest{})
 		assert.NotNil(t, out)
 		assert.NoError(t, err)
 	})
@@ -107,7 +115,7 @@ func TestDatabase_GetSocialMediaByID(t *testing.T) {
 		SqlDb: db,
 	}
 
-	qry := "select id, name, socialmediaurl, userid, createdat, updatedat from socialmedias where id = @ID"
+	qry := regexp.QuoteMeta(socialMediaGetOutputQuery + " where s.id = @ID")
 	t.Run("getsocialmediabyid database down", func(t *testing.T) {
 		mock.ExpectQuery(qry).
 			WithArgs(int64(1)).
@@ -129,15 +137,25 @@ func TestDatabase_GetSocialMediaByID(t *testing.T) {
 	})
 
 	t.Run("getsocialmediabyid success", func(t *testing.T) {
-		rows := mock.NewRows([]string{"id", "name", "socialmediaurl", "userid", "createdat", "updatedat"}).
-			AddRow(1, "SocialMedia Name", "http://socialmediaurl.com/socialmediaurl.jpg", 1, time.Now(), time.Now())
+		rows := mock.NewRows([]string{"id", "name", "socialmediaurl", "userid", "createdat", "updatedat", "username", "profileimageurl"}).
+			AddRow(1, "SocialMedia Name", "http://socialmediaurl.com/socialmediaurl.jpg", 1, time.Now(), time.Now(), "User Name", "http://profileimageurl/profile.jpg")
 
 		mock.ExpectQuery(qry).
 			WithArgs(int64(1)).
 			WillReturnRows(rows)
 		out, err := dbtes.GetSocialMediaByID(ctx, int64(1))
-		assert.NotNil(t, out)
 		assert.NoError(t, err)
+		assert.Equal(t, "User Name", out.User.Username)
+		assert.Equal(t, "http://profileimageurl/profile.jpg", out.User.ProfileImageURL)
+	})
+
+	t.Run("getsocialmediabyid not found", func(t *testing.T) {
+		mock.ExpectQuery(qry).
+			WithArgs(int64(2)).
+			WillReturnRows(mock.NewRows([]string{"id", "name", "socialmediaurl", "userid", "createdat", "updatedat", "username", "profileimageurl"}))
+		out, err := dbtes.GetSocialMediaByID(ctx, int64(2))
+		assert.Nil(t, out)
+		assert.ErrorIs(t, err, ErrNotFound)
 	})
 }
 
@@ -151,16 +169,18 @@ func TestDatabase_UpdateSocialMedia(t *testing.T) {
 		SqlDb: db,
 	}
 
-	qry := "update socialmedias set name=@name, socialmediaurl=@socialmediaurl, profileimageurl=@profileimageurl, updatedat=@updatedat where id = @ID; select id, name, socialmediaurl, profileimageurl, userid, updatedat from socialmedias where id = @ID"
+	qry := "update socialmedias set name=@name, socialmediaurl=@socialmediaurl, profileimageurl=@profileimageurl, updatedat=@updatedat where id = @ID and userid = @userid; if @@ROWCOUNT > 0 select id, name, socialmediaurl, profileimageurl, userid, updatedat from socialmedias where id = @ID"
 	inp := entity.SocialMediaPost{
 		Name:            "socialmedia orang ganteng",
 		SocialMediaURL:  "https://socialmediaurl.com/socialmediaurl.jpg",
 		ProfileImageURL: "https://profileimageurl.com/profileimageurl.jpg",
 	}
 	t.Run("updatesocialmedia database down", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Name, inp.SocialMediaURL, inp.ProfileImageURL, time.Now(), int64(1), int64(1)).
+			WithArgs(inp.Name, inp.SocialMediaURL, inp.ProfileImageURL, AnyTime{}, int64(1), int64(1)).
 			WillReturnError(errors.New("db down"))
+		mock.ExpectRollback()
 		out, err := dbtes.UpdateSocialMedia(ctx, int64(1), int64(1), inp)
 		assert.Error(t, err)
 		assert.Nil(t, out)
@@ -168,18 +188,22 @@ func TestDatabase_UpdateSocialMedia(t *testing.T) {
 	})
 
 	t.Run("updatesocialmedia required userid", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Name, inp.SocialMediaURL, inp.ProfileImageURL, time.Now(), int64(0), int64(1)).
+			WithArgs(inp.Name, inp.SocialMediaURL, inp.ProfileImageURL, AnyTime{}, int64(0), int64(1)).
 			WillReturnError(errors.New("required userid"))
+		mock.ExpectRollback()
 		out, err := dbtes.UpdateSocialMedia(ctx, int64(0), int64(1), inp)
 		assert.Nil(t, out)
 		assert.Equal(t, "required userid", err.Error())
 	})
 
 	t.Run("updatesocialmedia required id", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Name, inp.SocialMediaURL, inp.ProfileImageURL, time.Now(), int64(1), int64(0)).
+			WithArgs(inp.Name, inp.SocialMediaURL, inp.ProfileImageURL, AnyTime{}, int64(1), int64(0)).
 			WillReturnError(errors.New("required id"))
+		mock.ExpectRollback()
 		out, err := dbtes.UpdateSocialMedia(ctx, int64(1), int64(0), inp)
 		assert.Nil(t, out)
 		assert.Equal(t, "required id", err.Error())
@@ -189,12 +213,16 @@ func TestDatabase_UpdateSocialMedia(t *testing.T) {
 		rows := mock.NewRows([]string{"id", "name", "socialmediaurl", "profileimageurl", "userid", "updatedat"}).
 			AddRow(1, "SocialMedia Name", "http://socialmediaurl.com/socialmediaurl.jpg", "http://profileimageurl.com/profileimage.jpg", 1, time.Now())
 
+		mock.ExpectBegin()
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Name, inp.SocialMediaURL, inp.ProfileImageURL, time.Now(), int64(1), int64(1)).
+			WithArgs(inp.Name, inp.SocialMediaURL, inp.ProfileImageURL, AnyTime{}, int64(1), int64(1)).
 			WillReturnRows(rows)
+		expectOutbox(mock, entity.EventSocialMediaUpdated)
+		mock.ExpectCommit()
 		out, err := dbtes.UpdateSocialMedia(ctx, int64(1), int64(1), inp)
 		assert.NotNil(t, out)
 		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
 
@@ -209,18 +237,22 @@ func TestDatabase_DeleteSocialMedia(t *testing.T) {
 	}
 	qry := "delete from socialmedias where id=@id and userid=@userid"
 	t.Run("deletesocialmedia database down", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectExec(qry).
 			WithArgs(int64(1), int64(1)).
 			WillReturnError(errors.New("db down"))
+		mock.ExpectRollback()
 		out, err := dbtes.DeleteSocialMedia(ctx, int64(1), int64(1))
 		assert.Error(t, err)
 		assert.Equal(t, "", out)
 		assert.Equal(t, "db down", err.Error())
 	})
 	t.Run("deletesocialmedia required userid", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectExec(qry).
 			WithArgs(int64(0), int64(1)).
 			WillReturnError(errors.New("required userid"))
+		mock.ExpectRollback()
 		out, err := dbtes.DeleteSocialMedia(ctx, int64(0), int64(1))
 		assert.Error(t, err)
 		assert.Equal(t, "", out)
@@ -228,9 +260,11 @@ func TestDatabase_DeleteSocialMedia(t *testing.T) {
 	})
 
 	t.Run("deletesocialmedia required id", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectExec(qry).
 			WithArgs(int64(1), int64(0)).
 			WillReturnError(errors.New("required id"))
+		mock.ExpectRollback()
 		out, err := dbtes.DeleteSocialMedia(ctx, int64(1), int64(0))
 		assert.Error(t, err)
 		assert.Equal(t, "", out)
@@ -238,11 +272,15 @@ func TestDatabase_DeleteSocialMedia(t *testing.T) {
 	})
 
 	t.Run("deletesocialmedia success", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectExec(qry).
 			WithArgs(int64(1), int64(1)).
 			WillReturnResult(sqlmock.NewResult(1, 1))
+		expectOutbox(mock, entity.EventSocialMediaDeleted)
+		mock.ExpectCommit()
 		out, err := dbtes.DeleteSocialMedia(ctx, int64(1), int64(1))
 		assert.NotNil(t, out)
 		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
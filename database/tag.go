@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"mygram/entity"
+	"strings"
+	"time"
+)
+
+// GetTagPhotos is one page of the photos tagged with tag, newest first, as
+// viewer sees them.
+func (s *Database) GetTagPhotos(ctx context.Context, viewer int64, tag string, page entity.PageRequest) (*entity.Page[entity.PhotoGetOutput], error) {
+	return s.GetPhotos(ctx, viewer, tagFilter(tag), page)
+}
+
+// tagFilter is the photos of a tag as a PhotoFilter.
+func tagFilter(tag string) entity.PhotoFilter {
+	return entity.PhotoFilter{Tag: tag, Sort: entity.Sort{Field: entity.SortCreatedAt, Desc: true}}
+}
+
+// GetTrendingTags is the limit tags most photos were tagged with since since,
+// most used first.
+func (s *Database) GetTrendingTags(ctx context.Context, since time.Time, limit int) ([]entity.TagCount, error) {
+	result := []entity.TagCount{}
+	qry := "select t.name, count(*) from phototags pt join tags t on pt.tagid=t.id" +
+		" where pt.createdat >= @since group by t.name order by count(*) desc, t.name" +
+		s.sqlDialect().limit("@limit")
+	rows, err := s.queryContext(ctx, qry,
+		sql.Named("since", since),
+		sql.Named("limit", limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row entity.TagCount
+		if err := rows.Scan(&row.Tag, &row.PhotoCount); err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// errTagRace is returned by createTags when another request stored one of
+// the tags in the meantime. The transaction is aborted by then, and
+// inTagTx runs it again.
+var errTagRace = errors.New("tag stored concurrently")
+
+// createTags stores the tags in names that are not stored yet, in tx.
+func (s *Database) createTags(ctx context.Context, tx *sql.Tx, names []string) error {
+	for _, name := range names {
+		_, err := s.txExecContext(ctx, tx, "insert into tags (name) select @name where not exists (select 1 from tags where name = @name)",
+			sql.Named("name", name))
+		if errors.Is(err, ErrConflict) {
+			return errTagRace
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inTagTx is inTx for fn calling createTags. When a tag races another
+// request fn is run once more, in a new transaction that sees the tag, so fn
+// starts by resetting whatever it fills in.
+func (s *Database) inTagTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	err := s.inTx(ctx, fn)
+	if errors.Is(err, errTagRace) {
+		err = s.inTx(ctx, fn)
+	}
+	return err
+}
+
+// setPhotoTags links the photo to exactly the tags in names, which
+// createTags has stored. A tag the photo already had keeps the time it was
+// first linked, so editing a caption does not make its tags trend again.
+func (s *Database) setPhotoTags(ctx context.Context, tx *sql.Tx, photoid int64, names []string, now time.Time) error {
+	list, args := namedList("tag", names)
+	args = append(args, sql.Named("photoid", photoid), sql.Named("createdat", now))
+	stale := "delete from phototags where photoid = @photoid"
+	if len(names) > 0 {
+		stale += " and tagid not in (select id from tags where name in (" + list + "))"
+	}
+	if _, err := s.txExecContext(ctx, tx, stale, args...); err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	_, err := s.txExecContext(ctx, tx, "insert into phototags (photoid, tagid, createdat) select @photoid, t.id, @createdat from tags t"+
+		" where t.name in ("+list+") and not exists (select 1 from phototags pt where pt.photoid = @photoid and pt.tagid = t.id)",
+		args...)
+	return err
+}
+
+// namedList is the parameters @<prefix>0, @<prefix>1, ... for values, for an
+// in (...) list.
+func namedList[T any](prefix string, values []T) (string, []interface{}) {
+	params := make([]string, len(values))
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		params[i] = "@" + name
+		args[i] = sql.Named(name, v)
+	}
+	return strings.Join(params, ", "), args
+}
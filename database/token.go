@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"mygram/entity"
+	"time"
+)
+
+func (s *Database) PostRefreshToken(ctx context.Context, i entity.RefreshToken) (*entity.RefreshToken, error) {
+	result := &entity.RefreshToken{}
+	qry := "insert into refreshtokens (userid, familyid, tokenhash, expiresat, revoked, createdat) values (@userid, @familyid, @tokenhash, @expiresat, 0, @createdat)" +
+		s.sqlDialect().insertReturning("refreshtokens", "id, userid, familyid, tokenhash, expiresat, revoked, createdat")
+	now := time.Now()
+	rows, err := s.queryContext(ctx, qry,
+		sql.Named("userid", i.UserID),
+		sql.Named("familyid", i.FamilyID),
+		sql.Named("tokenhash", i.TokenHash),
+		sql.Named("expiresat", i.ExpiresAt),
+		sql.Named("createdat", now))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(
+			&result.ID,
+			&result.UserID,
+			&result.FamilyID,
+			&result.TokenHash,
+			&result.ExpiresAt,
+			&result.Revoked,
+			&result.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, s.translateError(err)
+	}
+	return result, nil
+}
+
+func (s *Database) GetRefreshToken(ctx context.Context, tokenHash string) (*entity.RefreshToken, error) {
+	result := &entity.RefreshToken{}
+	qry := "select id, userid, familyid, tokenhash, expiresat, revoked, createdat from refreshtokens where tokenhash = @tokenhash"
+	rows, err := s.queryContext(ctx, qry,
+		sql.Named("tokenhash", tokenHash))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(
+			&result.ID,
+			&result.UserID,
+			&result.FamilyID,
+			&result.TokenHash,
+			&result.ExpiresAt,
+			&result.Revoked,
+			&result.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if result.ID == 0 {
+		return nil, ErrNotFound
+	}
+	return result, nil
+}
+
+// RevokeRefreshToken marks a refresh token as used. It reports false when the
+// token had already been revoked, which means it is being replayed.
+func (s *Database) RevokeRefreshToken(ctx context.Context, id int64) (bool, error) {
+	qry := "update refreshtokens set revoked = 1 where id = @id and revoked = 0"
+	res, err := s.execContext(ctx, qry,
+		sql.Named("id", id))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *Database) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	qry := "update refreshtokens set revoked = 1 where familyid = @familyid"
+	_, err := s.execContext(ctx, qry,
+		sql.Named("familyid", familyID))
+	return err
+}
+
+func (s *Database) RevokeUserRefreshTokens(ctx context.Context, userid int64) error {
+	qry := "update refreshtokens set revoked = 1 where userid = @userid"
+	_, err := s.execContext(ctx, qry,
+		sql.Named("userid", userid))
+	return err
+}
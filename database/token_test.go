@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"mygram/entity"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatabase_PostRefreshToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	qry := "insert into refreshtokens (userid, familyid, tokenhash, expiresat, revoked, createdat) values (@userid, @familyid, @tokenhash, @expiresat, 0, @createdat); select id, userid, familyid, tokenhash, expiresat, revoked, createdat from refreshtokens where id = SCOPE_IDENTITY()"
+	inp := entity.RefreshToken{
+		UserID:    1,
+		FamilyID:  "family",
+		TokenHash: "hash",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	t.Run("postrefreshtoken database down", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(qry)).
+			WithArgs(inp.UserID, inp.FamilyID, inp.TokenHash, inp.ExpiresAt, AnyTime{}).
+			WillReturnError(errors.New("db down"))
+		out, err := dbtes.PostRefreshToken(ctx, inp)
+		assert.Error(t, err)
+		assert.Nil(t, out)
+		assert.Equal(t, "db down", err.Error())
+	})
+
+	t.Run("postrefreshtoken success", func(t *testing.T) {
+		rows := mock.NewRows([]string{"id", "userid", "familyid", "tokenhash", "expiresat", "revoked", "createdat"}).
+			AddRow(1, 1, "family", "hash", inp.ExpiresAt, false, time.Now())
+
+		mock.ExpectQuery(regexp.QuoteMeta(qry)).
+			WithArgs(inp.UserID, inp.FamilyID, inp.TokenHash, inp.ExpiresAt, AnyTime{}).
+			WillReturnRows(rows)
+		out, err := dbtes.PostRefreshToken(ctx, inp)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), out.ID)
+		assert.Equal(t, "family", out.FamilyID)
+	})
+}
+
+func TestDatabase_GetRefreshToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	qry := "select id, userid, familyid, tokenhash, expiresat, revoked, createdat from refreshtokens where tokenhash = @tokenhash"
+
+	t.Run("getrefreshtoken database down", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(qry)).
+			WithArgs("hash").
+			WillReturnError(errors.New("db down"))
+		out, err := dbtes.GetRefreshToken(ctx, "hash")
+		assert.Error(t, err)
+		assert.Nil(t, out)
+		assert.Equal(t, "db down", err.Error())
+	})
+
+	t.Run("getrefreshtoken success", func(t *testing.T) {
+		rows := mock.NewRows([]string{"id", "userid", "familyid", "tokenhash", "expiresat", "revoked", "createdat"}).
+			AddRow(1, 1, "family", "hash", time.Now(), true, time.Now())
+
+		mock.ExpectQuery(regexp.QuoteMeta(qry)).
+			WithArgs("hash").
+			WillReturnRows(rows)
+		out, err := dbtes.GetRefreshToken(ctx, "hash")
+		assert.NoError(t, err)
+		assert.True(t, out.Revoked)
+	})
+}
+
+func TestDatabase_RevokeRefreshToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	qry := "update refreshtokens set revoked = 1 where id = @id and revoked = 0"
+
+	t.Run("revokerefreshtoken database down", func(t *testing.T) {
+		mock.ExpectExec(regexp.QuoteMeta(qry)).
+			WithArgs(int64(1)).
+			WillReturnError(errors.New("db down"))
+		ok, err := dbtes.RevokeRefreshToken(ctx, int64(1))
+		assert.Error(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("revokerefreshtoken active", func(t *testing.T) {
+		mock.ExpectExec(regexp.QuoteMeta(qry)).
+			WithArgs(int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		ok, err := dbtes.RevokeRefreshToken(ctx, int64(1))
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("revokerefreshtoken already revoked", func(t *testing.T) {
+		mock.ExpectExec(regexp.QuoteMeta(qry)).
+			WithArgs(int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		ok, err := dbtes.RevokeRefreshToken(ctx, int64(1))
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+}
+
+func TestDatabase_RevokeRefreshTokenFamily(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	qry := "update refreshtokens set revoked = 1 where familyid = @familyid"
+
+	t.Run("revokerefreshtokenfamily database down", func(t *testing.T) {
+		mock.ExpectExec(regexp.QuoteMeta(qry)).
+			WithArgs("family").
+			WillReturnError(errors.New("db down"))
+		err := dbtes.RevokeRefreshTokenFamily(ctx, "family")
+		assert.Error(t, err)
+	})
+
+	t.Run("revokerefreshtokenfamily success", func(t *testing.T) {
+		mock.ExpectExec(regexp.QuoteMeta(qry)).
+			WithArgs("family").
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		err := dbtes.RevokeRefreshTokenFamily(ctx, "family")
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// inTx runs fn in a transaction. It commits when fn returns nil and rolls
+// back otherwise, so a failure never leaves half of a change behind.
+func (s *Database) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.SqlDb.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = fn(tx)
+	s.mu.Lock()
+	committed := s.committed[tx]
+	delete(s.committed, tx)
+	s.mu.Unlock()
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, f := range committed {
+		f()
+	}
+	return nil
+}
+
+// afterCommit runs f once tx, opened by inTx, commits, and never if it is
+// rolled back.
+func (s *Database) afterCommit(tx *sql.Tx, f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.committed == nil {
+		s.committed = map[*sql.Tx][]func(){}
+	}
+	s.committed[tx] = append(s.committed[tx], f)
+}
+
+// txExecContext is execContext inside tx.
+func (s *Database) txExecContext(ctx context.Context, tx *sql.Tx, qry string, args ...interface{}) (sql.Result, error) {
+	qry, args = s.sqlDialect().rebind(qry, args)
+	res, err := tx.ExecContext(ctx, qry, args...)
+	return res, s.translateError(err)
+}
+
+// deleteCascade runs stmts in order in one transaction. The last statement
+// deletes the row itself: when it matches nothing, the whole cascade is
+// rolled back and ErrNotFound returned.
+func (s *Database) deleteCascade(ctx context.Context, stmts []string, args ...interface{}) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.txDeleteCascade(ctx, tx, stmts, args...)
+	})
+}
+
+// txDeleteCascade is deleteCascade inside tx, for a caller with more to do in
+// it.
+func (s *Database) txDeleteCascade(ctx context.Context, tx *sql.Tx, stmts []string, args ...interface{}) error {
+	var res sql.Result
+	for _, stmt := range stmts {
+		var err error
+		res, err = s.txExecContext(ctx, tx, stmt, args...)
+		if err != nil {
+			return err
+		}
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// txQueryContext is queryContext inside tx. The rows have to be closed before
+// the next statement in tx.
+func (s *Database) txQueryContext(ctx context.Context, tx *sql.Tx, qry string, args ...interface{}) (*sql.Rows, error) {
+	qry, args = s.sqlDialect().rebind(qry, args)
+	rows, err := tx.QueryContext(ctx, qry, args...)
+	return rows, s.translateError(err)
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"mygram/entity"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSqliteDeleteCascadeRollback makes the server fail halfway through a
+// cascade and checks that nothing was deleted.
+func TestSqliteDeleteCascadeRollback(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDatabase(t, DriverSqlite, "file:"+t.TempDir()+"/mygram.db?_pragma=foreign_keys(1)").(*Database)
+
+	owner, err := db.Register(ctx, entity.UserRegister{Username: "owner", Email: "owner@email.com", Password: "hash", Age: 20})
+	require.NoError(t, err)
+	other, err := db.Register(ctx, entity.UserRegister{Username: "other", Email: "other@email.com", Password: "hash", Age: 20})
+	require.NoError(t, err)
+	p, err := db.PostPhoto(ctx, int64(owner.ID), entity.PhotoPost{Title: "title", PhotoUrl: "https://photo.domain.com"})
+	require.NoError(t, err)
+	_, err = db.PostComment(ctx, int64(other.ID), entity.CommentPost{PhotoID: int(p.ID), Message: "nice"})
+	require.NoError(t, err)
+
+	// Comments are deleted first, photos fail after them.
+	_, err = db.SqlDb.Exec("create trigger failphotos before delete on photos begin select raise(abort, 'injected failure'); end")
+	require.NoError(t, err)
+
+	_, err = db.DeletePhoto(ctx, int64(owner.ID), p.ID)
+	assert.ErrorContains(t, err, "injected failure")
+	_, _, err = db.DeleteUser(ctx, int64(owner.ID))
+	assert.ErrorContains(t, err, "injected failure")
+
+	comments, err := db.GetComments(ctx, entity.CommentFilter{}, entity.PageRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, comments.Items, 1)
+	photos, err := db.GetPhotos(ctx, 0, entity.PhotoFilter{}, entity.PageRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, photos.Items, 1)
+	_, err = db.GetUserByID(ctx, int64(owner.ID))
+	assert.NoError(t, err)
+
+	_, err = db.SqlDb.Exec("drop trigger failphotos")
+	require.NoError(t, err)
+	_, _, err = db.DeleteUser(ctx, int64(owner.ID))
+	assert.NoError(t, err)
+	comments, err = db.GetComments(ctx, entity.CommentFilter{}, entity.PageRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, comments.Items, 0)
+}
+
+// The foreign keys reject rows that the cascade would have missed.
+func TestSqliteForeignKeys(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDatabase(t, DriverSqlite, "file:"+t.TempDir()+"/mygram.db?_pragma=foreign_keys(1)").(*Database)
+
+	_, err := db.PostPhoto(ctx, 99, entity.PhotoPost{Title: "title", PhotoUrl: "https://photo.domain.com"})
+	assert.ErrorIs(t, err, ErrForeignKey)
+
+	u, err := db.Register(ctx, entity.UserRegister{Username: "owner", Email: "owner@email.com", Password: "hash", Age: 20})
+	require.NoError(t, err)
+	p, err := db.PostPhoto(ctx, int64(u.ID), entity.PhotoPost{Title: "title", PhotoUrl: "https://photo.domain.com"})
+	require.NoError(t, err)
+	_, err = db.PostComment(ctx, int64(u.ID), entity.CommentPost{PhotoID: int(p.ID), Message: "nice"})
+	require.NoError(t, err)
+	_, err = db.execContext(ctx, "delete from photos where id = @id", sql.Named("id", p.ID))
+	assert.ErrorIs(t, err, ErrForeignKey)
+}
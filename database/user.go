@@ -9,7 +9,7 @@ import (
 
 func (s *Database) Login(ctx context.Context, email string) (userid int64, resultpassword string, err error) {
 	qry := "select id, password from users where email = @email"
-	rows, err := s.SqlDb.QueryContext(ctx, qry,
+	rows, err := s.queryContext(ctx, qry,
 		sql.Named("email", email))
 	if err != nil {
 		return 0, "", err
@@ -24,13 +24,16 @@ func (s *Database) Login(ctx context.Context, email string) (userid int64, resul
 			return 0, "", err
 		}
 	}
+	if userid == 0 {
+		return 0, "", ErrNotFound
+	}
 	return userid, resultpassword, nil
 }
 
 func (s *Database) GetUserByID(ctx context.Context, id int64) (*entity.User, error) {
 	result := &entity.User{}
 
-	rows, err := s.SqlDb.QueryContext(ctx, "select id, username, email, password, age, createdat, updatedat from users where id = @ID",
+	rows, err := s.queryContext(ctx, "select id, username, email, password, age, role, createdat, updatedat from users where id = @ID",
 		sql.Named("ID", id))
 	if err != nil {
 		return nil, err
@@ -43,6 +46,7 @@ func (s *Database) GetUserByID(ctx context.Context, id int64) (*entity.User, err
 			&result.Email,
 			&result.Password,
 			&result.Age,
+			&result.Role,
 			&result.CreatedAt,
 			&result.UpdatedAt,
 		)
@@ -50,14 +54,83 @@ func (s *Database) GetUserByID(ctx context.Context, id int64) (*entity.User, err
 			return nil, err
 		}
 	}
+	if result.ID == 0 {
+		return nil, ErrNotFound
+	}
+	return result, nil
+}
+
+func (s *Database) GetUserProfile(ctx context.Context, id int64) (*entity.UserProfile, error) {
+	return s.getUserProfile(ctx, "u.id = @user", sql.Named("user", id))
+}
+
+func (s *Database) GetUserProfileByUsername(ctx context.Context, username string) (*entity.UserProfile, error) {
+	return s.getUserProfile(ctx, "u.username = @user", sql.Named("user", username))
+}
+
+// getUserProfile reads the profile of the user matching where, which
+// compares against @user.
+func (s *Database) getUserProfile(ctx context.Context, where string, user sql.NamedArg) (*entity.UserProfile, error) {
+	result := &entity.UserProfile{}
+	qry := "select u.id, u.username, u.createdat, (select count(*) from photos p where p.userid=u.id), " +
+		userFollowerCount + ", " + userFollowingCount + " from users u where " + where
+	rows, err := s.queryContext(ctx, qry, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(
+			&result.ID,
+			&result.Username,
+			&result.JoinedAt,
+			&result.PhotoCount,
+			&result.FollowerCount,
+			&result.FollowingCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if result.ID == 0 {
+		return nil, ErrNotFound
+	}
+
+	rows, err = s.queryContext(ctx, "select id, name, socialmediaurl, profileimageurl from socialmedias where userid = @userid order by id",
+		sql.Named("userid", result.ID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result.SocialMedias = []entity.SocialMediaLink{}
+	for rows.Next() {
+		var link entity.SocialMediaLink
+		err := rows.Scan(
+			&link.ID,
+			&link.Name,
+			&link.SocialMediaURL,
+			&link.ProfileImageURL,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result.SocialMedias = append(result.SocialMedias, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 	return result, nil
 }
 
 func (s *Database) UpdateUser(ctx context.Context, id int64, email string, username string) (*entity.User, error) {
 	result := &entity.User{}
 	now := time.Now()
-	qry := "update users set email=@email, username=@username, updatedat=@updatedat where id = @ID; select ID, email, username, age, updatedat from users where id = @ID"
-	rows, err := s.SqlDb.QueryContext(ctx, qry,
+	qry := "update users set email=@email, username=@username, updatedat=@updatedat where id = @ID" +
+		s.sqlDialect().updateReturning("users", "ID, email, username, age, updatedat", "id = @ID")
+	rows, err := s.queryContext(ctx, qry,
 		sql.Named("email", email),
 		sql.Named("username", username),
 		sql.Named("updatedat", now),
@@ -78,14 +151,51 @@ func (s *Database) UpdateUser(ctx context.Context, id int64, email string, usern
 			return nil, err
 		}
 	}
+	if err := rows.Err(); err != nil {
+		return nil, s.translateError(err)
+	}
+	if result.ID == 0 {
+		return nil, ErrNotFound
+	}
+	return result, nil
+}
+
+func (s *Database) UpdateUserRole(ctx context.Context, id int64, role entity.Role) (*entity.User, error) {
+	result := &entity.User{}
+	now := time.Now()
+	qry := "update users set role=@role, updatedat=@updatedat where id = @ID" +
+		s.sqlDialect().updateReturning("users", "id, username, role, updatedat", "id = @ID")
+	rows, err := s.queryContext(ctx, qry,
+		sql.Named("role", role),
+		sql.Named("updatedat", now),
+		sql.Named("ID", id))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(
+			&result.ID,
+			&result.Username,
+			&result.Role,
+			&result.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if result.ID == 0 {
+		return nil, ErrNotFound
+	}
 	return result, nil
 }
 
 func (s *Database) Register(ctx context.Context, i entity.UserRegister) (*entity.UserRegisterResp, error) {
 	result := &entity.UserRegisterResp{}
-	qry := "insert into users (username, email, password, age, createdat, updatedat) values (@username, @email, @password, @age, @createdat, @updatedat); select top 1 age,email,id,username from users where email = @email order by id desc"
+	qry := "insert into users (username, email, password, age, createdat, updatedat) values (@username, @email, @password, @age, @createdat, @updatedat)" +
+		s.sqlDialect().insertReturning("users", "age, email, id, username")
 	now := time.Now()
-	rows, err := s.SqlDb.QueryContext(ctx, qry,
+	rows, err := s.queryContext(ctx, qry,
 		sql.Named("username", i.Username),
 		sql.Named("email", i.Email),
 		sql.Named("password", i.Password),
@@ -108,20 +218,87 @@ func (s *Database) Register(ctx context.Context, i entity.UserRegister) (*entity
 			return nil, err
 		}
 	}
+	if err := rows.Err(); err != nil {
+		return nil, s.translateError(err)
+	}
 
 	return result, nil
 }
 
-func (s *Database) DeleteUser(ctx context.Context, id int64) (string, error) {
+// DeleteUser deletes the user with everything of theirs, and reports the
+// photo_url of each photo that went with them, for what they point at to be
+// deleted too. Each comment, social media and photo that goes has its deleted
+// event before the user's.
+func (s *Database) DeleteUser(ctx context.Context, id int64) (string, []string, error) {
 	var result string
-	qry := "delete from socialmedias where userid=@id; delete from photos where userid=@id; delete from comments where userid=@id; delete from users where id=@id"
-	_, err := s.SqlDb.ExecContext(ctx, qry,
-		sql.Named("id", id))
+	var photoURLs []string
+	// Children first, so the foreign keys hold at every step.
+	qry := []string{
+		"update comments set parentid=null where photoid in (select id from photos where userid=@id)",
+		"delete from mentions where userid=@id or photoid in (select id from photos where userid=@id)" +
+			" or commentid in (select id from comments where userid=@id)",
+		"delete from notifications where userid=@id or actorid=@id or photoid in (select id from photos where userid=@id)",
+		"delete from comments where photoid in (select id from photos where userid=@id)",
+		// Comments elsewhere that have replies stay as tombstones.
+		"update comments set userid=null, message='', deletedat=@now, updatedat=@now" +
+			" where userid=@id and exists (select 1 from comments r where r.parentid=comments.id)",
+		"delete from comments where userid=@id",
+		"delete from likes where userid=@id or photoid in (select id from photos where userid=@id)",
+		"delete from phototags where photoid in (select id from photos where userid=@id)",
+		"delete from follows where followerid=@id or followeeid=@id",
+		"delete from socialmedias where userid=@id",
+		"delete from photos where userid=@id",
+		"delete from refreshtokens where userid=@id",
+		"delete from webhookdeliveries where webhookid in (select id from webhooks where userid=@id)",
+		"delete from webhookevents where webhookid in (select id from webhooks where userid=@id)",
+		"delete from webhooks where userid=@id",
+		"delete from users where id=@id",
+	}
+	deleted := []deletedSelect{
+		{entity.EventCommentDeleted, "select id, userid from comments where deletedat is null" +
+			" and (userid=@id or photoid in (select id from photos where userid=@id)) order by id"},
+		{entity.EventSocialMediaDeleted, "select id, userid from socialmedias where userid=@id order by id"},
+		{entity.EventPhotoDeleted, "select id, userid from photos where userid=@id order by id"},
+	}
+	now := time.Now()
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		photoURLs = nil
+		rows, err := s.txQueryContext(ctx, tx, "select photourl from photos where userid=@id order by id", sql.Named("id", id))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var url string
+			if err := rows.Scan(&url); err != nil {
+				return err
+			}
+			photoURLs = append(photoURLs, url)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+		events, err := s.selectDeleted(ctx, tx, deleted, sql.Named("id", id))
+		if err != nil {
+			return err
+		}
+		err = s.txDeleteCascade(ctx, tx, qry,
+			sql.Named("now", now),
+			sql.Named("id", id))
+		if err != nil {
+			return err
+		}
+		if err := s.addDeletedToOutbox(ctx, tx, events, now); err != nil {
+			return err
+		}
+		return s.addToOutbox(ctx, tx, entity.EventUserDeleted, entity.DeletedResource{ID: id, UserID: id}, now)
+	})
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	result = "Your account has been successfully deleted"
 
-	return result, nil
+	return result, photoURLs, nil
 }
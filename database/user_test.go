@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"log"
 	"mygram/entity"
@@ -24,6 +25,14 @@ func NewMock() (*sql.DB, sqlmock.Sqlmock) {
 	return db, mock
 }
 
+// AnyTime matches any time.Time argument, for timestamps taken inside the query methods.
+type AnyTime struct{}
+
+func (a AnyTime) Match(v driver.Value) bool {
+	_, ok := v.(time.Time)
+	return ok
+}
+
 func TestDatabase_Login(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -33,7 +42,7 @@ func TestDatabase_Login(t *testing.T) {
 	dbtes := Database{
 		SqlDb: db,
 	}
-	qry := "select id, password from users where username = @username"
+	qry := "select id, password from users where email = @email"
 	t.Run("login database down", func(t *testing.T) {
 		mock.ExpectQuery(qry).
 			WithArgs("deadapeipit").
@@ -68,7 +77,7 @@ func TestDatabase_GetUserByID(t *testing.T) {
 	dbtes := Database{
 		SqlDb: db,
 	}
-	qry := "select id, username, email, password, age, createdat, updatedat from users where id = @ID"
+	qry := "select id, username, email, password, age, role, createdat, updatedat from users where id = @ID"
 	t.Run("getuserbyid database down", func(t *testing.T) {
 		mock.ExpectQuery(qry).
 			WithArgs(int64(1)).
@@ -90,8 +99,8 @@ func TestDatabase_GetUserByID(t *testing.T) {
 	})
 
 	t.Run("getuserbyid success", func(t *testing.T) {
-		rows := mock.NewRows([]string{"id", "username", "email", "password", "age", "createdat", "updatedat"}).
-			AddRow(1, "deadapeipit", "deadapeipit@github.com", "$2a$10$rcIrmHvODKlw91zkIVeEGeAomU47EBbAveY8//HCvYK7cqrd23gx2", 22, time.Now(), time.Now())
+		rows := mock.NewRows([]string{"id", "username", "email", "password", "age", "role", "createdat", "updatedat"}).
+			AddRow(1, "deadapeipit", "deadapeipit@github.com", "$2a$10$rcIrmHvODKlw91zkIVeEGeAomU47EBbAveY8//HCvYK7cqrd23gx2", 22, "user", time.Now(), time.Now())
 
 		mock.ExpectQuery(qry).
 			WithArgs(int64(1)).
@@ -111,10 +120,10 @@ func TestDatabase_UpdateUser(t *testing.T) {
 	dbtes := Database{
 		SqlDb: db,
 	}
-	qry := "update users set email=@email, username=@username, updatedat=@updatedat where id = @ID; select ID, email, username, age, updatedat from users where id = @ID"
+	qry := "update users set email=@email, username=@username, updatedat=@updatedat where id = @ID; if @@ROWCOUNT > 0 select ID, email, username, age, updatedat from users where id = @ID"
 	t.Run("updateuser database down", func(t *testing.T) {
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs("deadapeipit@github.com", "deadapeipit", time.Now(), int64(1)).
+			WithArgs("deadapeipit@github.com", "deadapeipit", AnyTime{}, int64(1)).
 			WillReturnError(errors.New("db down"))
 		out, err := dbtes.UpdateUser(ctx, int64(1), "deadapeipit@github.com", "deadapeipit")
 		assert.Error(t, err)
@@ -124,7 +133,7 @@ func TestDatabase_UpdateUser(t *testing.T) {
 
 	t.Run("updateuser required userid", func(t *testing.T) {
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs("deadapeipit@github.com", "deadapeipit", time.Now(), int64(0)).
+			WithArgs("deadapeipit@github.com", "deadapeipit", AnyTime{}, int64(0)).
 			WillReturnError(errors.New("required userid"))
 		out, err := dbtes.UpdateUser(ctx, int64(0), "deadapeipit@github.com", "deadapeipit")
 		assert.Error(t, err)
@@ -137,7 +146,7 @@ func TestDatabase_UpdateUser(t *testing.T) {
 			AddRow(1, "deadapeipit", "deadapeipit@github.com", 22, time.Now())
 
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs("deadapeipit@github.com", "deadapeipit", time.Now(), int64(1)).
+			WithArgs("deadapeipit@github.com", "deadapeipit", AnyTime{}, int64(1)).
 			WillReturnRows(rows)
 		out, err := dbtes.UpdateUser(ctx, int64(1), "deadapeipit@github.com", "deadapeipit")
 		assert.NotNil(t, out)
@@ -145,6 +154,39 @@ func TestDatabase_UpdateUser(t *testing.T) {
 	})
 }
 
+func TestDatabase_UpdateUserRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	qry := "update users set role=@role, updatedat=@updatedat where id = @ID; if @@ROWCOUNT > 0 select id, username, role, updatedat from users where id = @ID"
+	t.Run("updateuserrole database down", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(qry)).
+			WithArgs(entity.RoleModerator, AnyTime{}, int64(1)).
+			WillReturnError(errors.New("db down"))
+		out, err := dbtes.UpdateUserRole(ctx, int64(1), entity.RoleModerator)
+		assert.Error(t, err)
+		assert.Nil(t, out)
+		assert.Equal(t, "db down", err.Error())
+	})
+
+	t.Run("updateuserrole success", func(t *testing.T) {
+		rows := mock.NewRows([]string{"id", "username", "role", "updatedat"}).
+			AddRow(1, "deadapeipit", "moderator", time.Now())
+
+		mock.ExpectQuery(regexp.QuoteMeta(qry)).
+			WithArgs(entity.RoleModerator, AnyTime{}, int64(1)).
+			WillReturnRows(rows)
+		out, err := dbtes.UpdateUserRole(ctx, int64(1), entity.RoleModerator)
+		assert.NoError(t, err)
+		assert.Equal(t, entity.RoleModerator, out.Role)
+	})
+}
+
 func TestDatabase_Register(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -163,7 +205,7 @@ func TestDatabase_Register(t *testing.T) {
 	qry := "insert into users (username, email, password, age, createdat, updatedat) values (@username, @email, @password, @age, @createdat, @updatedat)"
 	t.Run("register database down", func(t *testing.T) {
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Username, inp.Email, inp.Password, inp.Age, time.Now(), time.Now()).
+			WithArgs(inp.Username, inp.Email, inp.Password, inp.Age, AnyTime{}, AnyTime{}).
 			WillReturnError(errors.New("db down"))
 		out, err := dbtes.Register(ctx, inp)
 		assert.Error(t, err)
@@ -172,11 +214,11 @@ func TestDatabase_Register(t *testing.T) {
 	})
 
 	t.Run("register success", func(t *testing.T) {
-		rows := mock.NewRows([]string{"id", "username", "email", "age"}).
-			AddRow(1, "deadapeipit", "deadapeipit@github.com", 22)
+		rows := mock.NewRows([]string{"age", "email", "id", "username"}).
+			AddRow(22, "deadapeipit@github.com", 1, "deadapeipit")
 
 		mock.ExpectQuery(regexp.QuoteMeta(qry)).
-			WithArgs(inp.Username, inp.Email, inp.Password, inp.Age, time.Now(), time.Now()).
+			WithArgs(inp.Username, inp.Email, inp.Password, inp.Age, AnyTime{}, AnyTime{}).
 			WillReturnRows(rows)
 		out, err := dbtes.Register(ctx, inp)
 		assert.NotNil(t, out)
@@ -193,33 +235,119 @@ func TestDatabase_DeleteUser(t *testing.T) {
 	dbtes := Database{
 		SqlDb: db,
 	}
-	qry := "delete from socialmedias where userid=@id; delete from photos where userid=@id; delete from comments where userid=@id; delete from users where id=@id"
+	cascade := []string{
+		"update comments set parentid=null where photoid in (select id from photos where userid=@id)",
+		"delete from mentions where userid=@id or photoid in (select id from photos where userid=@id) or commentid in (select id from comments where userid=@id)",
+		"delete from notifications where userid=@id or actorid=@id or photoid in (select id from photos where userid=@id)",
+		"delete from comments where photoid in (select id from photos where userid=@id)",
+		"update comments set userid=null, message='', deletedat=@now, updatedat=@now where userid=@id and exists (select 1 from comments r where r.parentid=comments.id)",
+		"delete from comments where userid=@id",
+		"delete from likes where userid=@id or photoid in (select id from photos where userid=@id)",
+		"delete from phototags where photoid in (select id from photos where userid=@id)",
+		"delete from follows where followerid=@id or followeeid=@id",
+		"delete from socialmedias where userid=@id",
+		"delete from photos where userid=@id",
+		"delete from refreshtokens where userid=@id",
+		"delete from webhookdeliveries where webhookid in (select id from webhooks where userid=@id)",
+		"delete from webhookevents where webhookid in (select id from webhooks where userid=@id)",
+		"delete from webhooks where userid=@id",
+		"delete from users where id=@id",
+	}
+	photourls := regexp.QuoteMeta("select photourl from photos where userid=@id order by id")
+	deleted := []string{
+		"select id, userid from comments where deletedat is null and (userid=@id or photoid in (select id from photos where userid=@id)) order by id",
+		"select id, userid from socialmedias where userid=@id order by id",
+		"select id, userid from photos where userid=@id order by id",
+	}
+	expectDeleted := func(id int64, rows ...*sqlmock.Rows) {
+		for i, qry := range deleted {
+			r := mock.NewRows([]string{"id", "userid"})
+			if i < len(rows) {
+				r = rows[i]
+			}
+			mock.ExpectQuery(regexp.QuoteMeta(qry)).
+				WithArgs(id).
+				WillReturnRows(r)
+		}
+	}
 	t.Run("deleteuser database down", func(t *testing.T) {
-		mock.ExpectExec(qry).
-			WithArgs(int64(1)).
+		mock.ExpectBegin().
 			WillReturnError(errors.New("db down"))
-		out, err := dbtes.DeleteUser(ctx, int64(1))
+		out, photoURLs, err := dbtes.DeleteUser(ctx, int64(1))
 		assert.Error(t, err)
 		assert.Equal(t, "", out)
+		assert.Nil(t, photoURLs)
 		assert.Equal(t, "db down", err.Error())
 	})
 
-	t.Run("deleteuser required userid", func(t *testing.T) {
-		mock.ExpectExec(qry).
-			WithArgs(int64(0)).
-			WillReturnError(errors.New("required userid"))
-		out, err := dbtes.DeleteUser(ctx, int64(0))
-		assert.Error(t, err)
+	t.Run("deleteuser fails mid-cascade", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(photourls).
+			WithArgs(int64(1)).
+			WillReturnRows(mock.NewRows([]string{"photourl"}))
+		expectDeleted(int64(1))
+		for _, qry := range cascade[:8] {
+			mock.ExpectExec(regexp.QuoteMeta(qry)).
+				WithArgs(AnyTime{}, int64(1)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectExec(regexp.QuoteMeta(cascade[8])).
+			WithArgs(AnyTime{}, int64(1)).
+			WillReturnError(errors.New("db down"))
+		mock.ExpectRollback()
+		out, _, err := dbtes.DeleteUser(ctx, int64(1))
 		assert.Equal(t, "", out)
-		assert.Equal(t, "required userid", err.Error())
+		assert.EqualError(t, err, "db down")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("deleteuser not found", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(photourls).
+			WithArgs(int64(2)).
+			WillReturnRows(mock.NewRows([]string{"photourl"}))
+		expectDeleted(int64(2))
+		for _, qry := range cascade {
+			mock.ExpectExec(regexp.QuoteMeta(qry)).
+				WithArgs(AnyTime{}, int64(2)).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mock.ExpectRollback()
+		out, _, err := dbtes.DeleteUser(ctx, int64(2))
+		assert.Equal(t, "", out)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
 	t.Run("deleteuser success", func(t *testing.T) {
-		mock.ExpectExec(qry).
+		mock.ExpectBegin()
+		mock.ExpectQuery(photourls).
 			WithArgs(int64(1)).
-			WillReturnResult(sqlmock.NewResult(1, 1))
-		out, err := dbtes.DeleteUser(ctx, int64(1))
+			WillReturnRows(mock.NewRows([]string{"photourl"}).
+				AddRow("/media/photos/abc.png").
+				AddRow("https://photo.domain.com"))
+		expectDeleted(int64(1),
+			mock.NewRows([]string{"id", "userid"}).AddRow(5, 1).AddRow(6, 2),
+			mock.NewRows([]string{"id", "userid"}).AddRow(3, 1),
+			mock.NewRows([]string{"id", "userid"}).AddRow(7, 1).AddRow(8, 1))
+		for _, qry := range cascade {
+			mock.ExpectExec(regexp.QuoteMeta(qry)).
+				WithArgs(AnyTime{}, int64(1)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		for _, event := range []entity.WebhookEventType{
+			entity.EventCommentDeleted, entity.EventCommentDeleted,
+			entity.EventSocialMediaDeleted,
+			entity.EventPhotoDeleted, entity.EventPhotoDeleted,
+			entity.EventUserDeleted,
+		} {
+			expectOutbox(mock, event)
+		}
+		mock.ExpectCommit()
+		out, photoURLs, err := dbtes.DeleteUser(ctx, int64(1))
 		assert.NotNil(t, out)
 		assert.NoError(t, err)
+		assert.Equal(t, []string{"/media/photos/abc.png", "https://photo.domain.com"}, photoURLs)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
@@ -0,0 +1,516 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"mygram/entity"
+	"sort"
+	"time"
+)
+
+// WebhookOutbox is what delivers the outbox to the webhooks.
+type WebhookOutbox interface {
+	// DispatchOutbox turns up to limit events of the outbox into a delivery
+	// for each webhook subscribed to them, and reports how many events it
+	// dispatched.
+	DispatchOutbox(ctx context.Context, now time.Time, limit int) (int, error)
+	// ClaimWebhookDeliveries takes up to limit pending deliveries that are
+	// due at now. Nobody else gets them until lease has passed.
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entity.WebhookDelivery, error)
+	// UpdateWebhookDelivery stores the outcome of an attempt at d.
+	UpdateWebhookDelivery(ctx context.Context, d entity.WebhookDelivery) error
+	// PruneWebhookOutbox deletes the deliveries delivered before before, and
+	// the events dispatched before it that have no delivery left. Pending
+	// and dead deliveries are kept, the dead ones to be retried by hand.
+	PruneWebhookOutbox(ctx context.Context, before time.Time) error
+}
+
+// addToOutbox writes an event of type t about data to the outbox in tx, so
+// it is sent exactly when the change it tells about is stored.
+func (s *Database) addToOutbox(ctx context.Context, tx *sql.Tx, t entity.WebhookEventType, data interface{}, now time.Time) error {
+	e := entity.NewWebhookEvent(t, data)
+	_, err := s.txExecContext(ctx, tx, "insert into outbox (eventtype, payload, createdat) values (@eventtype, @payload, @createdat)",
+		sql.Named("eventtype", string(e.Type)),
+		sql.Named("payload", string(e.Data)),
+		sql.Named("createdat", now))
+	return err
+}
+
+// deletedSelect reads the rows a cascade is about to remove, each an id and
+// the id of the user it belongs to, for their event.
+type deletedSelect struct {
+	event entity.WebhookEventType
+	qry   string
+}
+
+// deletedEvent is the deleted event of a row a cascade removes.
+type deletedEvent struct {
+	event    entity.WebhookEventType
+	resource entity.DeletedResource
+}
+
+// selectDeleted runs selects in tx before the cascade, and lists their rows
+// in order as deleted events.
+func (s *Database) selectDeleted(ctx context.Context, tx *sql.Tx, selects []deletedSelect, args ...interface{}) ([]deletedEvent, error) {
+	var result []deletedEvent
+	for _, sel := range selects {
+		err := func() error {
+			rows, err := s.txQueryContext(ctx, tx, sel.qry, args...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				e := deletedEvent{event: sel.event}
+				if err := rows.Scan(&e.resource.ID, &e.resource.UserID); err != nil {
+					return err
+				}
+				result = append(result, e)
+			}
+			return rows.Err()
+		}()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// addDeletedToOutbox writes events, read by selectDeleted, to the outbox in
+// tx.
+func (s *Database) addDeletedToOutbox(ctx context.Context, tx *sql.Tx, events []deletedEvent, now time.Time) error {
+	for _, e := range events {
+		if err := s.addToOutbox(ctx, tx, e.event, e.resource, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Database) PostWebhook(ctx context.Context, userid int64, i entity.WebhookPost, secret string) (*entity.Webhook, error) {
+	result := &entity.Webhook{}
+	qry := "insert into webhooks (userid, url, secret, createdat) values (@userid, @url, @secret, @createdat)" +
+		s.sqlDialect().insertReturning("webhooks", "id, userid, url, secret, createdat")
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := s.txQueryContext(ctx, tx, qry,
+			sql.Named("userid", userid),
+			sql.Named("url", i.URL),
+			sql.Named("secret", secret),
+			sql.Named("createdat", time.Now()))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			err := rows.Scan(
+				&result.ID,
+				&result.UserID,
+				&result.URL,
+				&result.Secret,
+				&result.CreatedAt,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return s.translateError(err)
+		}
+		rows.Close()
+		result.Events = []entity.WebhookEventType{}
+		seen := map[entity.WebhookEventType]bool{}
+		for _, t := range i.Events {
+			if seen[t] {
+				continue
+			}
+			seen[t] = true
+			_, err := s.txExecContext(ctx, tx, "insert into webhookevents (webhookid, eventtype) values (@webhookid, @eventtype)",
+				sql.Named("webhookid", result.ID),
+				sql.Named("eventtype", string(t)))
+			if err != nil {
+				return err
+			}
+			result.Events = append(result.Events, t)
+		}
+		sort.Slice(result.Events, func(i, j int) bool { return result.Events[i] < result.Events[j] })
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetWebhooks is one page of all the webhooks, oldest first.
+func (s *Database) GetWebhooks(ctx context.Context, page entity.PageRequest) (*entity.Page[entity.Webhook], error) {
+	var result []entity.Webhook
+	q, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sortBy[entity.Webhook](&q, entity.Sort{}, nil); err != nil {
+		return nil, err
+	}
+	var where conditions
+	if keyset := q.where("w.id"); keyset != "" {
+		where.add(keyset, sql.Named("cursor", q.cursor.ID))
+	}
+	qry := "select w.id, w.userid, w.url, w.createdat from webhooks w" +
+		where.String() + q.orderBy("w.id") + s.sqlDialect().limit("@limit")
+	rows, err := s.queryContext(ctx, qry, append(where.args, sql.Named("limit", q.fetch()))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row entity.Webhook
+		if err := rows.Scan(&row.ID, &row.UserID, &row.URL, &row.CreatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if err := s.withWebhookEvents(ctx, result); err != nil {
+		return nil, err
+	}
+	return makePage(result, q, func(w entity.Webhook) int64 { return w.ID }, nil), nil
+}
+
+func (s *Database) GetWebhookByID(ctx context.Context, id int64) (*entity.Webhook, error) {
+	var result []entity.Webhook
+	rows, err := s.queryContext(ctx, "select w.id, w.userid, w.url, w.createdat from webhooks w where w.id = @id",
+		sql.Named("id", id))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row entity.Webhook
+		if err := rows.Scan(&row.ID, &row.UserID, &row.URL, &row.CreatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, ErrNotFound
+	}
+	rows.Close()
+	if err := s.withWebhookEvents(ctx, result); err != nil {
+		return nil, err
+	}
+	return &result[0], nil
+}
+
+// withWebhookEvents fills in the events of webhooks.
+func (s *Database) withWebhookEvents(ctx context.Context, webhooks []entity.Webhook) error {
+	if len(webhooks) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(webhooks))
+	for i, w := range webhooks {
+		ids[i] = w.ID
+	}
+	list, args := namedList("id", ids)
+	rows, err := s.queryContext(ctx, "select webhookid, eventtype from webhookevents where webhookid in ("+list+") order by webhookid, eventtype", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	events := map[int64][]entity.WebhookEventType{}
+	for rows.Next() {
+		var id int64
+		var t entity.WebhookEventType
+		if err := rows.Scan(&id, &t); err != nil {
+			return err
+		}
+		events[id] = append(events[id], t)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i := range webhooks {
+		webhooks[i].Events = events[webhooks[i].ID]
+		if webhooks[i].Events == nil {
+			webhooks[i].Events = []entity.WebhookEventType{}
+		}
+	}
+	return nil
+}
+
+// DeleteWebhook deletes a webhook along with its deliveries, sent or not.
+func (s *Database) DeleteWebhook(ctx context.Context, id int64) (string, error) {
+	qry := []string{
+		"delete from webhookdeliveries where webhookid=@id",
+		"delete from webhookevents where webhookid=@id",
+		"delete from webhooks where id=@id",
+	}
+	if err := s.deleteCascade(ctx, qry, sql.Named("id", id)); err != nil {
+		return "", err
+	}
+	return "The webhook has been successfully deleted", nil
+}
+
+// webhookDeliveryQuery reads entity.WebhookDelivery rows for scanWebhookDelivery.
+const webhookDeliveryQuery = "select d.id, d.webhookid, d.status, d.attempts, d.nextattemptat, d.laststatus, d.lasterror, d.createdat, d.deliveredat," +
+	" o.id, o.eventtype, o.createdat, o.payload, w.url, w.secret" +
+	" from webhookdeliveries d join outbox o on d.outboxid=o.id join webhooks w on d.webhookid=w.id"
+
+func scanWebhookDelivery(rows *sql.Rows) (entity.WebhookDelivery, error) {
+	var row entity.WebhookDelivery
+	var payload string
+	err := rows.Scan(
+		&row.ID,
+		&row.WebhookID,
+		&row.Status,
+		&row.Attempts,
+		&row.NextAttemptAt,
+		&row.LastStatus,
+		&row.LastError,
+		&row.CreatedAt,
+		&row.DeliveredAt,
+		&row.Event.ID,
+		&row.Event.Type,
+		&row.Event.CreatedAt,
+		&payload,
+		&row.URL,
+		&row.Secret,
+	)
+	row.Event.Data = []byte(payload)
+	return row, err
+}
+
+// GetWebhookDeliveries is one page of the deliveries of a webhook with
+// status, oldest first, ErrNotFound when there is no such webhook. The dead
+// ones are its dead-letter list.
+func (s *Database) GetWebhookDeliveries(ctx context.Context, webhookid int64, status entity.DeliveryStatus, page entity.PageRequest) (*entity.Page[entity.WebhookDelivery], error) {
+	var result []entity.WebhookDelivery
+	q, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sortBy[entity.WebhookDelivery](&q, entity.Sort{}, nil); err != nil {
+		return nil, err
+	}
+	var where conditions
+	where.add("d.webhookid = @webhookid", sql.Named("webhookid", webhookid))
+	where.add("d.status = @status", sql.Named("status", string(status)))
+	if keyset := q.where("d.id"); keyset != "" {
+		where.add(keyset, sql.Named("cursor", q.cursor.ID))
+	}
+	qry := webhookDeliveryQuery + where.String() + q.orderBy("d.id") + s.sqlDialect().limit("@limit")
+	rows, err := s.queryContext(ctx, qry, append(where.args, sql.Named("limit", q.fetch()))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		row, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		if ok, err := s.exists(ctx, "webhooks", webhookid); err != nil || !ok {
+			return nil, notFoundUnless(err)
+		}
+	}
+	return makePage(result, q, func(d entity.WebhookDelivery) int64 { return d.ID }, nil), nil
+}
+
+// RetryWebhookDelivery takes a dead delivery off the dead-letter list to be
+// tried again from scratch, ErrNotFound when there is no such dead delivery.
+func (s *Database) RetryWebhookDelivery(ctx context.Context, id int64) (*entity.WebhookDelivery, error) {
+	res, err := s.execContext(ctx, "update webhookdeliveries set status = @pending, attempts = 0, nextattemptat = @now where id = @id and status = @dead",
+		sql.Named("pending", string(entity.DeliveryPending)),
+		sql.Named("now", time.Now()),
+		sql.Named("id", id),
+		sql.Named("dead", string(entity.DeliveryDead)))
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrNotFound
+	}
+	deliveries, err := s.webhookDeliveries(ctx, " where d.id = @id", sql.Named("id", id))
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, ErrNotFound
+	}
+	return &deliveries[0], nil
+}
+
+// webhookDeliveries reads the deliveries matching where.
+func (s *Database) webhookDeliveries(ctx context.Context, where string, args ...interface{}) ([]entity.WebhookDelivery, error) {
+	var result []entity.WebhookDelivery
+	rows, err := s.queryContext(ctx, webhookDeliveryQuery+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		row, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *Database) DispatchOutbox(ctx context.Context, now time.Time, limit int) (int, error) {
+	type event struct {
+		id        int64
+		eventtype string
+	}
+	var result int
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var events []event
+		rows, err := s.txQueryContext(ctx, tx, "select id, eventtype from outbox where dispatchedat is null order by id"+s.sqlDialect().limit("@limit"),
+			sql.Named("limit", limit))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var e event
+			if err := rows.Scan(&e.id, &e.eventtype); err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+		for _, e := range events {
+			// Another dispatcher may have taken the event meanwhile.
+			res, err := s.txExecContext(ctx, tx, "update outbox set dispatchedat = @now where id = @id and dispatchedat is null",
+				sql.Named("now", now),
+				sql.Named("id", e.id))
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				continue
+			}
+			webhooks, err := s.subscribedWebhooks(ctx, tx, e.eventtype)
+			if err != nil {
+				return err
+			}
+			for _, webhookid := range webhooks {
+				_, err := s.txExecContext(ctx, tx, "insert into webhookdeliveries (webhookid, outboxid, status, attempts, nextattemptat, laststatus, lasterror, createdat)"+
+					" values (@webhookid, @outboxid, @status, 0, @nextattemptat, 0, '', @createdat)",
+					sql.Named("webhookid", webhookid),
+					sql.Named("outboxid", e.id),
+					sql.Named("status", string(entity.DeliveryPending)),
+					sql.Named("nextattemptat", now),
+					sql.Named("createdat", now))
+				if err != nil {
+					return err
+				}
+			}
+			result++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result, nil
+}
+
+// subscribedWebhooks are the ids of the webhooks subscribed to eventtype.
+func (s *Database) subscribedWebhooks(ctx context.Context, tx *sql.Tx, eventtype string) ([]int64, error) {
+	var result []int64
+	rows, err := s.txQueryContext(ctx, tx, "select webhookid from webhookevents where eventtype = @eventtype order by webhookid",
+		sql.Named("eventtype", eventtype))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		result = append(result, id)
+	}
+	return result, rows.Err()
+}
+
+func (s *Database) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entity.WebhookDelivery, error) {
+	due, err := s.webhookDeliveries(ctx, " where d.status = @status and d.nextattemptat <= @now order by d.nextattemptat, d.id"+s.sqlDialect().limit("@limit"),
+		sql.Named("status", string(entity.DeliveryPending)),
+		sql.Named("now", now),
+		sql.Named("limit", limit))
+	if err != nil {
+		return nil, err
+	}
+	var result []entity.WebhookDelivery
+	for _, d := range due {
+		// Whoever moves nextattemptat first has the delivery.
+		res, err := s.execContext(ctx, "update webhookdeliveries set nextattemptat = @leaseuntil where id = @id and status = @status and nextattemptat <= @now",
+			sql.Named("leaseuntil", now.Add(lease)),
+			sql.Named("id", d.ID),
+			sql.Named("status", string(entity.DeliveryPending)),
+			sql.Named("now", now))
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 1 {
+			result = append(result, d)
+		}
+	}
+	return result, nil
+}
+
+func (s *Database) UpdateWebhookDelivery(ctx context.Context, d entity.WebhookDelivery) error {
+	_, err := s.execContext(ctx, "update webhookdeliveries set status = @status, attempts = @attempts, nextattemptat = @nextattemptat,"+
+		" laststatus = @laststatus, lasterror = @lasterror, deliveredat = @deliveredat where id = @id",
+		sql.Named("status", string(d.Status)),
+		sql.Named("attempts", d.Attempts),
+		sql.Named("nextattemptat", d.NextAttemptAt),
+		sql.Named("laststatus", d.LastStatus),
+		sql.Named("lasterror", d.LastError),
+		sql.Named("deliveredat", d.DeliveredAt),
+		sql.Named("id", d.ID))
+	return err
+}
+
+func (s *Database) PruneWebhookOutbox(ctx context.Context, before time.Time) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := s.txExecContext(ctx, tx, "delete from webhookdeliveries where status = @delivered and deliveredat < @before",
+			sql.Named("delivered", string(entity.DeliveryDelivered)),
+			sql.Named("before", before))
+		if err != nil {
+			return err
+		}
+		_, err = s.txExecContext(ctx, tx, "delete from outbox where dispatchedat < @before"+
+			" and not exists (select 1 from webhookdeliveries d where d.outboxid = outbox.id)",
+			sql.Named("before", before))
+		return err
+	})
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"mygram/entity"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expectOutbox expects the event of type t to be written to the outbox.
+func expectOutbox(mock sqlmock.Sqlmock, t entity.WebhookEventType) {
+	mock.ExpectExec(regexp.QuoteMeta("insert into outbox (eventtype, payload, createdat) values (@eventtype, @payload, @createdat)")).
+		WithArgs(string(t), sqlmock.AnyArg(), AnyTime{}).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+func TestDatabase_OutboxInTransaction(t *testing.T) {
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	inp := entity.SocialMediaPost{Name: "ig", SocialMediaURL: "https://instagram.com/ann", ProfileImageURL: "https://instagram.com/ann.jpg"}
+
+	t.Run("no change without its event", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("insert into socialmedias")).
+			WillReturnRows(mock.NewRows([]string{"id", "name", "socialmediaurl", "profileimageurl", "userid", "createdat", "updatedat"}).
+				AddRow(1, inp.Name, inp.SocialMediaURL, inp.ProfileImageURL, 1, time.Now(), time.Now()))
+		mock.ExpectExec(regexp.QuoteMeta("insert into outbox")).
+			WillReturnError(errors.New("db down"))
+		mock.ExpectRollback()
+		out, err := dbtes.PostSocialMedia(ctx, 1, inp)
+		assert.Nil(t, out)
+		assert.EqualError(t, err, "db down")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("no event without its change", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("delete from socialmedias where id=@id and userid=@userid")).
+			WithArgs(int64(1), int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		out, err := dbtes.DeleteSocialMedia(ctx, 1, 2)
+		assert.Equal(t, "", out)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("the event carries the resource", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("delete from socialmedias where id=@id and userid=@userid")).
+			WithArgs(int64(1), int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("insert into outbox (eventtype, payload, createdat) values (@eventtype, @payload, @createdat)")).
+			WithArgs("socialmedia.deleted", `{"id":2,"user_id":1}`, AnyTime{}).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		_, err := dbtes.DeleteSocialMedia(ctx, 1, 2)
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestDatabase_DispatchOutbox(t *testing.T) {
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	now := time.Now()
+	claim := regexp.QuoteMeta("update outbox set dispatchedat = @now where id = @id and dispatchedat is null")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("select id, eventtype from outbox where dispatchedat is null order by id offset 0 rows fetch next @limit rows only")).
+		WithArgs(10).
+		WillReturnRows(mock.NewRows([]string{"id", "eventtype"}).
+			AddRow(1, "photo.created").
+			AddRow(2, "photo.deleted"))
+	mock.ExpectExec(claim).
+		WithArgs(now, int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("select webhookid from webhookevents where eventtype = @eventtype order by webhookid")).
+		WithArgs("photo.created").
+		WillReturnRows(mock.NewRows([]string{"webhookid"}).AddRow(4).AddRow(5))
+	for _, webhookid := range []int64{4, 5} {
+		mock.ExpectExec(regexp.QuoteMeta("insert into webhookdeliveries (webhookid, outboxid, status, attempts, nextattemptat, laststatus, lasterror, createdat)")).
+			WithArgs(webhookid, int64(1), "pending", now, now).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	// Another dispatcher already took event 2.
+	mock.ExpectExec(claim).
+		WithArgs(now, int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	n, err := dbtes.DispatchOutbox(ctx, now, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDatabase_ClaimWebhookDeliveries(t *testing.T) {
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	now := time.Now()
+	columns := []string{"id", "webhookid", "status", "attempts", "nextattemptat", "laststatus", "lasterror", "createdat", "deliveredat",
+		"outboxid", "eventtype", "eventcreatedat", "payload", "url", "secret"}
+	claim := regexp.QuoteMeta("update webhookdeliveries set nextattemptat = @leaseuntil where id = @id and status = @status and nextattemptat <= @now")
+
+	mock.ExpectQuery(regexp.QuoteMeta(webhookDeliveryQuery+" where d.status = @status and d.nextattemptat <= @now order by d.nextattemptat, d.id")).
+		WithArgs("pending", now, 10).
+		WillReturnRows(mock.NewRows(columns).
+			AddRow(1, 4, "pending", 0, now, 0, "", now, nil, 9, "photo.created", now, `{"id":3}`, "https://example.com/hook", "s3cret").
+			AddRow(2, 5, "pending", 2, now, 500, "500 Internal Server Error", now, nil, 9, "photo.created", now, `{"id":3}`, "https://example.org/hook", "other"))
+	mock.ExpectExec(claim).
+		WithArgs(now.Add(time.Minute), int64(1), "pending", now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Another dispatcher claimed delivery 2 first.
+	mock.ExpectExec(claim).
+		WithArgs(now.Add(time.Minute), int64(2), "pending", now).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	out, err := dbtes.ClaimWebhookDeliveries(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, out, 1)
+	assert.Equal(t, int64(1), out[0].ID)
+	assert.Equal(t, "https://example.com/hook", out[0].URL)
+	assert.Equal(t, "s3cret", out[0].Secret)
+	assert.Equal(t, entity.WebhookEvent{ID: 9, Type: entity.EventPhotoCreated, CreatedAt: now, Data: []byte(`{"id":3}`)}, out[0].Event)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDatabase_PruneWebhookOutbox(t *testing.T) {
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	before := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("delete from webhookdeliveries where status = @delivered and deliveredat < @before")).
+		WithArgs("delivered", before).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(regexp.QuoteMeta("delete from outbox where dispatchedat < @before and not exists (select 1 from webhookdeliveries d where d.outboxid = outbox.id)")).
+		WithArgs(before).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	require.NoError(t, dbtes.PruneWebhookOutbox(ctx, before))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDatabase_RetryWebhookDelivery(t *testing.T) {
+	ctx := context.Background()
+	db, mock := NewMock()
+	defer db.Close()
+	dbtes := Database{
+		SqlDb: db,
+	}
+	qry := regexp.QuoteMeta("update webhookdeliveries set status = @pending, attempts = 0, nextattemptat = @now where id = @id and status = @dead")
+
+	t.Run("retrywebhookdelivery not dead", func(t *testing.T) {
+		mock.ExpectExec(qry).
+			WithArgs("pending", AnyTime{}, int64(1), "dead").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		out, err := dbtes.RetryWebhookDelivery(ctx, 1)
+		assert.Nil(t, out)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
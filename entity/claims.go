@@ -2,9 +2,15 @@ package entity
 
 import "github.com/golang-jwt/jwt"
 
+// MyClaims are the claims of an access token. Issue and expiry times
+// live in the embedded StandardClaims as unix seconds, and Id is the jti
+// used to revoke a single token. Gen is the user's token generation at
+// issue time; bumping it logs out every session at once. Role mirrors the
+// stored role at issue time; handlers authorize against the user loaded by
+// SecureMiddleware, so a demotion takes effect immediately.
 type MyClaims struct {
 	jwt.StandardClaims
-	Iat int   `json:"iat"`
-	Exp int   `json:"exp"`
-	Uid int64 `json:"uid"`
+	Uid  int64 `json:"uid"`
+	Gen  int64 `json:"gen"`
+	Role Role  `json:"role"`
 }
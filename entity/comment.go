@@ -2,18 +2,27 @@ package entity
 
 import "time"
 
+// Comment is a comment on a photo, or a reply to one when ParentCommentID is
+// set. A deleted comment with replies stays as a tombstone: DeletedAt is set,
+// and UserID and Message are blank.
 type Comment struct {
-	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	PhotoID   int64     `json:"photo_id"`
-	Message   string    `json:"message"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              int64      `json:"id"`
+	UserID          int64      `json:"user_id"`
+	PhotoID         int64      `json:"photo_id"`
+	ParentCommentID *int64     `json:"parent_comment_id"`
+	Message         string     `json:"message"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+	// Mentions are the @usernames of the message.
+	Mentions []Mention `json:"mentions"`
 }
 
 type CommentPost struct {
 	PhotoID int    `json:"photo_id" validate:"required"`
 	Message string `json:"message" validate:"required"`
+	// ParentCommentID is the comment replied to, on the same photo.
+	ParentCommentID *int64 `json:"parent_comment_id"`
 }
 
 type CommentUpdate struct {
@@ -21,20 +30,24 @@ type CommentUpdate struct {
 }
 
 type CommentPostOutput struct {
-	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	PhotoID   int64     `json:"photo_id"`
-	Message   string    `json:"message"`
-	CreatedAt time.Time `json:"created_at"`
+	ID              int64     `json:"id"`
+	UserID          int64     `json:"user_id"`
+	PhotoID         int64     `json:"photo_id"`
+	ParentCommentID *int64    `json:"parent_comment_id"`
+	Message         string    `json:"message"`
+	CreatedAt       time.Time `json:"created_at"`
+	Mentions        []Mention `json:"mentions"`
 }
 
 func (c *Comment) ToCommentPostOutput() *CommentPostOutput {
 	out := &CommentPostOutput{
-		ID:        c.ID,
-		UserID:    c.UserID,
-		PhotoID:   c.PhotoID,
-		Message:   c.Message,
-		CreatedAt: c.CreatedAt,
+		ID:              c.ID,
+		UserID:          c.UserID,
+		PhotoID:         c.PhotoID,
+		ParentCommentID: c.ParentCommentID,
+		Message:         c.Message,
+		CreatedAt:       c.CreatedAt,
+		Mentions:        c.Mentions,
 	}
 	return out
 }
@@ -45,6 +58,7 @@ type CommentUpdateOutput struct {
 	PhotoID   int64     `json:"photo_id"`
 	Message   string    `json:"message"`
 	UpdatedAt time.Time `json:"updated_at"`
+	Mentions  []Mention `json:"mentions"`
 }
 
 func (c *Comment) ToCommentUpdateOutput() *CommentUpdateOutput {
@@ -54,6 +68,7 @@ func (c *Comment) ToCommentUpdateOutput() *CommentUpdateOutput {
 		PhotoID:   c.PhotoID,
 		Message:   c.Message,
 		UpdatedAt: c.UpdatedAt,
+		Mentions:  c.Mentions,
 	}
 	return out
 }
@@ -63,3 +78,36 @@ type CommentGetOutput struct {
 	User  UserGetComment  `json:"user"`
 	Photo PhotoGetComment `json:"photo"`
 }
+
+// CommentThread is a comment with the replies under it, in the tree view of
+// a photo's comments. Depth is 0 for a top-level comment. MoreReplies is set
+// on a top-level comment whose thread was cut short; the rest is read a
+// comment at a time through its replies.
+type CommentThread struct {
+	CommentGetOutput
+	Depth       int             `json:"depth"`
+	MoreReplies bool            `json:"more_replies"`
+	Replies     []CommentThread `json:"replies"`
+}
+
+// CommentWithDepth is a comment in the flattened view of a photo's comments.
+type CommentWithDepth struct {
+	CommentGetOutput
+	Depth       int  `json:"depth"`
+	MoreReplies bool `json:"more_replies"`
+}
+
+// FlattenCommentThreads lists threads depth first: each comment is followed
+// by its replies.
+func FlattenCommentThreads(threads []CommentThread) []CommentWithDepth {
+	out := []CommentWithDepth{}
+	var walk func(threads []CommentThread)
+	walk = func(threads []CommentThread) {
+		for _, t := range threads {
+			out = append(out, CommentWithDepth{CommentGetOutput: t.CommentGetOutput, Depth: t.Depth, MoreReplies: t.MoreReplies})
+			walk(t.Replies)
+		}
+	}
+	walk(threads)
+	return out
+}
@@ -0,0 +1,57 @@
+package entity
+
+import "time"
+
+// Fields a list may be sorted by, besides its id. Not every list has all of
+// them.
+const (
+	SortCreatedAt    = "created_at"
+	SortUpdatedAt    = "updated_at"
+	SortCommentCount = "comment_count"
+)
+
+// Sort orders a list by Field, largest or latest first when Desc. Rows that
+// tie are ordered by id, as is the whole list when Field is empty.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// PhotoFilter narrows GET /photos. Zero fields don't filter.
+type PhotoFilter struct {
+	UserID      int64
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	// FollowedBy keeps the photos of the users FollowedBy follows, for the feed.
+	FollowedBy int64
+	// Tag keeps the photos tagged with it, normalized as entity.NormalizeHashtag does.
+	Tag string
+	// Search is found in the title or the caption, ignoring case.
+	Search string
+	Sort   Sort
+}
+
+// CommentFilter narrows GET /comments. Zero fields don't filter.
+type CommentFilter struct {
+	PhotoID int64
+	UserID  int64
+	// ParentID keeps the replies to one comment.
+	ParentID int64
+	// TopLevel keeps the comments that are not replies.
+	TopLevel bool
+	Sort     Sort
+}
+
+// SocialMediaFilter narrows GET /socialmedias. Zero fields don't filter.
+type SocialMediaFilter struct {
+	UserID int64
+	// Search is found in the name, ignoring case.
+	Search string
+	Sort   Sort
+}
+
+// NotificationFilter narrows GET /notifications. Zero fields don't filter.
+type NotificationFilter struct {
+	// Unread keeps the notifications not read yet.
+	Unread bool
+}
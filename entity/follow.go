@@ -0,0 +1,29 @@
+package entity
+
+import "time"
+
+// Follow is an edge of the follow graph: FollowerID follows FolloweeID.
+type Follow struct {
+	ID         int64     `json:"id"`
+	FollowerID int64     `json:"follower_id"`
+	FolloweeID int64     `json:"followee_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// FollowGetOutput is a user in GET /users/{id}/followers or
+// /users/{id}/following. ID is the follow's, which the pages are ordered by.
+type FollowGetOutput struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	Username   string    `json:"username"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// UserFollows is where a user stands after the caller follows or unfollows
+// them.
+type UserFollows struct {
+	UserID         int64 `json:"user_id"`
+	FollowerCount  int64 `json:"follower_count"`
+	FollowingCount int64 `json:"following_count"`
+	FollowedByMe   bool  `json:"followed_by_me"`
+}
@@ -0,0 +1,24 @@
+package entity
+
+import "time"
+
+// Like is a user's like of a photo. A user likes a photo at most once.
+type Like struct {
+	ID        int64     `json:"id"`
+	PhotoID   int64     `json:"photo_id"`
+	UserID    int64     `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LikeGetOutput is a like in GET /photos/{id}/likes, with who it is from.
+type LikeGetOutput struct {
+	Like
+	Username string `json:"username"`
+}
+
+// PhotoLikes is where a photo stands after the caller likes or unlikes it.
+type PhotoLikes struct {
+	PhotoID   int64 `json:"photo_id"`
+	LikeCount int64 `json:"like_count"`
+	LikedByMe bool  `json:"liked_by_me"`
+}
@@ -0,0 +1,69 @@
+package entity
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Mention is an @username in a caption or a comment, resolved to the user
+// when the text was written. Offset and Length count characters (Unicode
+// code points) of the text, the @ included, so clients can link the
+// mention without parsing the text again. Username is the user's current
+// name, which may differ from the text after a rename.
+type Mention struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Offset   int    `json:"offset"`
+	Length   int    `json:"length"`
+}
+
+// MentionToken is an @username found in a text, not resolved to a user yet.
+type MentionToken struct {
+	Username string
+	Offset   int
+	Length   int
+}
+
+// ParseMentions lists the @usernames in text in order. A mention is an @
+// that does not follow a letter, digit or one of _.- (so an email address
+// is not one), then letters, digits and _.-, less any trailing . or -:
+// "hi @ann. mail bob@x.com" has ann.
+func ParseMentions(text string) []MentionToken {
+	var result []MentionToken
+	prev := ' '
+	offset := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r != '@' || isMentionRune(prev) || prev == '@' {
+			prev = r
+			i += size
+			offset++
+			continue
+		}
+		end := i + size
+		for end < len(text) {
+			r, size := utf8.DecodeRuneInString(text[end:])
+			if !isMentionRune(r) {
+				break
+			}
+			end += size
+		}
+		username := strings.TrimRight(text[i+size:end], ".-")
+		if username != "" {
+			result = append(result, MentionToken{
+				Username: username,
+				Offset:   offset,
+				Length:   1 + utf8.RuneCountInString(username),
+			})
+		}
+		prev, _ = utf8.DecodeLastRuneInString(text[:end])
+		offset += utf8.RuneCountInString(text[i:end])
+		i = end
+	}
+	return result
+}
+
+func isMentionRune(r rune) bool {
+	return r == '_' || r == '.' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,134 @@
+package entity
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// NotificationType says what a notification is about, and so what its
+// payload holds.
+type NotificationType string
+
+const (
+	// NotificationMention: someone mentioned the user. Payload is MentionPayload.
+	NotificationMention NotificationType = "mention"
+	// NotificationComment: someone commented on the user's photo. Payload is
+	// CommentPayload.
+	NotificationComment NotificationType = "comment"
+	// NotificationLike: someone liked the user's photo. Payload is LikePayload.
+	NotificationLike NotificationType = "like"
+	// NotificationFollow: someone followed the user. Payload is FollowPayload.
+	NotificationFollow NotificationType = "follow"
+)
+
+// notificationPayloads makes the payload of each type. A new type adds its
+// payload here.
+var notificationPayloads = map[NotificationType]func() interface{}{
+	NotificationMention: func() interface{} { return &MentionPayload{} },
+	NotificationComment: func() interface{} { return &CommentPayload{} },
+	NotificationLike:    func() interface{} { return &LikePayload{} },
+	NotificationFollow:  func() interface{} { return &FollowPayload{} },
+}
+
+// Notification tells UserID that ActorID did something. Payload depends on
+// Type.
+type Notification struct {
+	ID            int64            `json:"id"`
+	UserID        int64            `json:"user_id"`
+	Type          NotificationType `json:"type"`
+	ActorID       int64            `json:"actor_id"`
+	ActorUsername string           `json:"actor_username"`
+	Payload       json.RawMessage  `json:"payload"`
+	CreatedAt     time.Time        `json:"created_at"`
+	ReadAt        *time.Time       `json:"read_at"`
+	// PhotoID and CommentID are what the notification is about, so it goes
+	// when they do.
+	PhotoID   *int64 `json:"-"`
+	CommentID *int64 `json:"-"`
+}
+
+// DecodePayload is Payload as the struct of Type, e.g. *LikePayload for
+// NotificationLike.
+func (n *Notification) DecodePayload() (interface{}, error) {
+	newPayload, ok := notificationPayloads[n.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown notification type %q", n.Type)
+	}
+	payload := newPayload()
+	if err := json.Unmarshal(n.Payload, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// MentionPayload is where a user was mentioned: the caption of PhotoID, or
+// the comment CommentID on it.
+type MentionPayload struct {
+	PhotoID   int64  `json:"photo_id"`
+	CommentID *int64 `json:"comment_id"`
+}
+
+// CommentPayload is the comment CommentID on the photo PhotoID.
+type CommentPayload struct {
+	PhotoID   int64 `json:"photo_id"`
+	CommentID int64 `json:"comment_id"`
+}
+
+// LikePayload is the photo that was liked.
+type LikePayload struct {
+	PhotoID int64 `json:"photo_id"`
+}
+
+// FollowPayload is empty: the actor is all there is to tell.
+type FollowPayload struct{}
+
+// newNotification is a notification of type t with payload, about photoid
+// and commentid when they are not nil.
+func newNotification(t NotificationType, userid int64, actorid int64, payload interface{}, photoid *int64, commentid *int64) Notification {
+	b, _ := json.Marshal(payload)
+	return Notification{
+		UserID:    userid,
+		Type:      t,
+		ActorID:   actorid,
+		Payload:   b,
+		PhotoID:   photoid,
+		CommentID: commentid,
+	}
+}
+
+// NewMentionNotification tells userid that actorid mentioned them in the
+// caption of photoid, or in the comment commentid when it is not nil.
+func NewMentionNotification(userid int64, actorid int64, photoid int64, commentid *int64) Notification {
+	return newNotification(NotificationMention, userid, actorid, MentionPayload{PhotoID: photoid, CommentID: commentid}, &photoid, commentid)
+}
+
+// NewCommentNotification tells userid that actorid commented commentid on
+// their photo photoid.
+func NewCommentNotification(userid int64, actorid int64, photoid int64, commentid int64) Notification {
+	return newNotification(NotificationComment, userid, actorid, CommentPayload{PhotoID: photoid, CommentID: commentid}, &photoid, &commentid)
+}
+
+// NewLikeNotification tells userid that actorid liked their photo photoid.
+func NewLikeNotification(userid int64, actorid int64, photoid int64) Notification {
+	return newNotification(NotificationLike, userid, actorid, LikePayload{PhotoID: photoid}, &photoid, nil)
+}
+
+// NewFollowNotification tells userid that actorid followed them.
+func NewFollowNotification(userid int64, actorid int64) Notification {
+	return newNotification(NotificationFollow, userid, actorid, FollowPayload{}, nil, nil)
+}
+
+// NotificationRead is the body of POST /notifications/read: the
+// notifications IDs, or all of them when All.
+type NotificationRead struct {
+	IDs []int64 `json:"ids"`
+	All bool    `json:"all"`
+}
+
+// NotificationReadOutput is how many notifications were marked read, and how
+// many are left unread.
+type NotificationReadOutput struct {
+	Read   int64 `json:"read"`
+	Unread int64 `json:"unread"`
+}
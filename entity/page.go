@@ -0,0 +1,16 @@
+package entity
+
+// PageRequest asks a list for one page. Cursor is empty for the first page,
+// or a NextCursor/PrevCursor returned with an earlier page.
+type PageRequest struct {
+	Limit  int
+	Cursor string
+}
+
+// Page is one page of a list. The cursors are opaque and empty when there is
+// nothing further that way.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
@@ -10,6 +10,35 @@ type Photo struct {
 	UserID    int64     `json:"user_id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// Mentions are the @usernames of the caption.
+	Mentions []Mention `json:"mentions"`
+	// Processing tells whether Variants are there yet.
+	Processing ProcessingState `json:"processing"`
+	Variants   *PhotoVariants  `json:"variants"`
+}
+
+// ProcessingState tells how far the making of the variants of a photo is.
+type ProcessingState string
+
+const (
+	// ProcessingNone is a photo hosted elsewhere, which gets no variants.
+	ProcessingNone ProcessingState = "none"
+	// ProcessingPending is an upload whose variants are being made.
+	ProcessingPending ProcessingState = "processing"
+	// ProcessingReady is an upload with its variants.
+	ProcessingReady ProcessingState = "ready"
+	// ProcessingFailed is an upload that could not be decoded. Only its
+	// photo_url may be shown.
+	ProcessingFailed ProcessingState = "failed"
+)
+
+// PhotoVariants are the URLs of the copies of an uploaded photo scaled down
+// to fit a square: 160 pixels for the thumbnail, 640 for medium and 1280
+// for large. Images smaller than that keep their size.
+type PhotoVariants struct {
+	Thumbnail string `json:"thumbnail"`
+	Medium    string `json:"medium"`
+	Large     string `json:"large"`
 }
 
 type PhotoGetComment struct {
@@ -35,25 +64,33 @@ type PhotoPost struct {
 	Title    string `json:"title" validate:"required"`
 	Caption  string `json:"caption"`
 	PhotoUrl string `json:"photo_url" validate:"required"`
+	// Processing is ProcessingPending for uploads, which the server sets.
+	Processing ProcessingState `json:"-"`
 }
 
 type PhotoPostOutput struct {
-	ID        int64     `json:"id"`
-	Title     string    `json:"title"`
-	Caption   string    `json:"caption"`
-	PhotoUrl  string    `json:"photo_url"`
-	UserID    int64     `json:"user_id"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         int64           `json:"id"`
+	Title      string          `json:"title"`
+	Caption    string          `json:"caption"`
+	PhotoUrl   string          `json:"photo_url"`
+	UserID     int64           `json:"user_id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Mentions   []Mention       `json:"mentions"`
+	Processing ProcessingState `json:"processing"`
+	Variants   *PhotoVariants  `json:"variants"`
 }
 
 func (p *Photo) ToPhotoPostOutput() *PhotoPostOutput {
 	out := &PhotoPostOutput{
-		ID:        p.ID,
-		Title:     p.Title,
-		Caption:   p.Caption,
-		PhotoUrl:  p.PhotoUrl,
-		UserID:    p.UserID,
-		CreatedAt: p.CreatedAt,
+		ID:         p.ID,
+		Title:      p.Title,
+		Caption:    p.Caption,
+		PhotoUrl:   p.PhotoUrl,
+		UserID:     p.UserID,
+		CreatedAt:  p.CreatedAt,
+		Mentions:   p.Mentions,
+		Processing: p.Processing,
+		Variants:   p.Variants,
 	}
 	return out
 }
@@ -65,6 +102,7 @@ type PhotoUpdateOutput struct {
 	PhotoUrl  string    `json:"photo_url"`
 	UserID    int64     `json:"user_id"`
 	UpdatedAt time.Time `json:"updated_at"`
+	Mentions  []Mention `json:"mentions"`
 }
 
 func (p *Photo) ToPhotoUpdateOutput() *PhotoUpdateOutput {
@@ -75,11 +113,15 @@ func (p *Photo) ToPhotoUpdateOutput() *PhotoUpdateOutput {
 		PhotoUrl:  p.PhotoUrl,
 		UserID:    p.UserID,
 		UpdatedAt: p.UpdatedAt,
+		Mentions:  p.Mentions,
 	}
 	return out
 }
 
 type PhotoGetOutput struct {
 	Photo
-	User UserUpdate `json:"user"`
+	CommentCount int64      `json:"comment_count"`
+	LikeCount    int64      `json:"like_count"`
+	LikedByMe    bool       `json:"liked_by_me"`
+	User         UserUpdate `json:"user"`
 }
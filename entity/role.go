@@ -0,0 +1,10 @@
+package entity
+
+// Role of a user. New users get RoleUser.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
@@ -64,3 +64,11 @@ type SocialMediaGetOutput struct {
 	SocialMedia
 	User UserGetSocialMedia `json:"user"`
 }
+
+// SocialMediaLink is a social media account as shown on its owner's profile.
+type SocialMediaLink struct {
+	ID              int64   `json:"id"`
+	Name            string  `json:"name"`
+	SocialMediaURL  string  `json:"social_media_url"`
+	ProfileImageURL *string `json:"profile_image_url"`
+}
@@ -0,0 +1,77 @@
+package entity
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxHashtagLength is the longest hashtag, in characters, that is kept.
+const MaxHashtagLength = 64
+
+// TagCount is how many photos were tagged with Tag in a trending window.
+type TagCount struct {
+	Tag        string `json:"tag"`
+	PhotoCount int64  `json:"photo_count"`
+}
+
+// TrendingTags is GET /tags/trending: the most used tags since Since.
+type TrendingTags struct {
+	Since time.Time  `json:"since"`
+	Items []TagCount `json:"items"`
+}
+
+// ParseHashtags lists the hashtags in text, normalized and without repeats,
+// in the order they first appear. A hashtag is a # that does not follow a
+// letter or digit, then letters, digits and underscores with at least one
+// letter: "#Go #go_1 a#b #42" has go and go_1.
+func ParseHashtags(text string) []string {
+	var result []string
+	seen := map[string]bool{}
+	prev := ' '
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r != '#' || isHashtagRune(prev) || prev == '#' {
+			prev = r
+			i += size
+			continue
+		}
+		end := i + size
+		for end < len(text) {
+			r, size := utf8.DecodeRuneInString(text[end:])
+			if !isHashtagRune(r) {
+				break
+			}
+			end += size
+		}
+		if tag, ok := NormalizeHashtag(text[i+1 : end]); ok && !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+		prev, _ = utf8.DecodeLastRuneInString(text[:end])
+		i = end
+	}
+	return result
+}
+
+// NormalizeHashtag is tag as stored, lower case without the leading #. It
+// reports false when tag is not a hashtag.
+func NormalizeHashtag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+	if tag == "" || utf8.RuneCountInString(tag) > MaxHashtagLength {
+		return "", false
+	}
+	letter := false
+	for _, r := range tag {
+		if !isHashtagRune(r) {
+			return "", false
+		}
+		letter = letter || unicode.IsLetter(r)
+	}
+	return tag, letter
+}
+
+func isHashtagRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
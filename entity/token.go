@@ -0,0 +1,24 @@
+package entity
+
+import "time"
+
+// RefreshToken same struct as table. Only the hash of the token is stored.
+type RefreshToken struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	FamilyID  string    `json:"family_id"`
+	TokenHash string    `json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Revoked   bool      `json:"revoked"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TokenRefresh struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
@@ -7,8 +7,9 @@ type User struct {
 	ID        int64     `json:"id"`
 	Username  string    `json:"username"`
 	Email     string    `json:"email"`
-	Password  string    `json:"password"`
+	Password  string    `json:"-"` // bcrypt hash, never sent to clients
 	Age       int       `json:"age"`
+	Role      Role      `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -32,6 +33,10 @@ type UserUpdate struct {
 	Email    string `json:"email" validate:"required,email"`
 }
 
+type UserRoleUpdate struct {
+	Role Role `json:"role" validate:"required,oneof=user moderator admin"`
+}
+
 type UserGetComment struct {
 	ID       int64  `json:"id"`
 	Username string `json:"username"`
@@ -67,3 +72,52 @@ func (u *User) ToUserUpdateOutput() *UserUpdateOutput {
 	}
 	return out
 }
+
+type UserRoleOutput struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	Role      Role      `json:"role"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (u *User) ToUserRoleOutput() *UserRoleOutput {
+	out := &UserRoleOutput{
+		ID:        u.ID,
+		Username:  u.Username,
+		Role:      u.Role,
+		UpdatedAt: u.UpdatedAt,
+	}
+	return out
+}
+
+// UserProfile is what anyone may see of a user.
+type UserProfile struct {
+	ID             int64             `json:"id"`
+	Username       string            `json:"username"`
+	PhotoCount     int64             `json:"photo_count"`
+	FollowerCount  int64             `json:"follower_count"`
+	FollowingCount int64             `json:"following_count"`
+	SocialMedias   []SocialMediaLink `json:"social_medias"`
+	JoinedAt       time.Time         `json:"joined_at"`
+}
+
+// UserPrivateProfile is a user's view of their own account: the public
+// profile and the account details only they may see.
+type UserPrivateProfile struct {
+	UserProfile
+	Email     string    `json:"email"`
+	Age       int       `json:"age"`
+	Role      Role      `json:"role"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (u *User) ToUserPrivateProfile(profile UserProfile) *UserPrivateProfile {
+	out := &UserPrivateProfile{
+		UserProfile: profile,
+		Email:       u.Email,
+		Age:         u.Age,
+		Role:        u.Role,
+		UpdatedAt:   u.UpdatedAt,
+	}
+	return out
+}
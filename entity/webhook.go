@@ -0,0 +1,111 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebhookEventType is what happened to which kind of resource.
+type WebhookEventType string
+
+const (
+	EventPhotoCreated       WebhookEventType = "photo.created"
+	EventPhotoUpdated       WebhookEventType = "photo.updated"
+	EventPhotoDeleted       WebhookEventType = "photo.deleted"
+	EventCommentCreated     WebhookEventType = "comment.created"
+	EventCommentUpdated     WebhookEventType = "comment.updated"
+	EventCommentDeleted     WebhookEventType = "comment.deleted"
+	EventSocialMediaCreated WebhookEventType = "socialmedia.created"
+	EventSocialMediaUpdated WebhookEventType = "socialmedia.updated"
+	EventSocialMediaDeleted WebhookEventType = "socialmedia.deleted"
+	// EventUserDeleted: the user is gone, and with them everything they
+	// posted and every comment on their photos. Each of those has its own
+	// deleted event first.
+	EventUserDeleted WebhookEventType = "user.deleted"
+)
+
+// WebhookEventTypes are the events a webhook may subscribe to.
+var WebhookEventTypes = []WebhookEventType{
+	EventPhotoCreated, EventPhotoUpdated, EventPhotoDeleted,
+	EventCommentCreated, EventCommentUpdated, EventCommentDeleted,
+	EventSocialMediaCreated, EventSocialMediaUpdated, EventSocialMediaDeleted,
+	EventUserDeleted,
+}
+
+// Valid tells whether t is one of WebhookEventTypes.
+func (t WebhookEventType) Valid() bool {
+	for _, v := range WebhookEventTypes {
+		if t == v {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEvent is what a webhook is sent: Data is the resource as the API
+// returns it, or a DeletedResource for the deleted events. ID is the same in
+// every delivery of the event, so receivers can ignore repeats.
+type WebhookEvent struct {
+	ID        int64            `json:"id"`
+	Type      WebhookEventType `json:"type"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      json.RawMessage  `json:"data"`
+}
+
+// NewWebhookEvent is an event of type t about data, to be stored in the
+// outbox.
+func NewWebhookEvent(t WebhookEventType, data interface{}) WebhookEvent {
+	b, _ := json.Marshal(data)
+	return WebhookEvent{Type: t, Data: b}
+}
+
+// DeletedResource is the data of the deleted events.
+type DeletedResource struct {
+	ID     int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+}
+
+// Webhook is a subscription of URL to Events. Secret signs what is sent; it
+// is shown only when the webhook is created.
+type Webhook struct {
+	ID        int64              `json:"id"`
+	UserID    int64              `json:"user_id"`
+	URL       string             `json:"url"`
+	Events    []WebhookEventType `json:"events"`
+	Secret    string             `json:"secret,omitempty"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+type WebhookPost struct {
+	URL    string             `json:"url" validate:"required,url"`
+	Events []WebhookEventType `json:"events" validate:"required,min=1"`
+}
+
+// DeliveryStatus is where a delivery is: pending until the webhook accepts
+// it, dead once it has failed too often.
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryDead      DeliveryStatus = "dead"
+)
+
+// WebhookDelivery is one event sent, or to be sent, to one webhook.
+type WebhookDelivery struct {
+	ID            int64          `json:"id"`
+	WebhookID     int64          `json:"webhook_id"`
+	Status        DeliveryStatus `json:"status"`
+	Attempts      int            `json:"attempts"`
+	NextAttemptAt time.Time      `json:"next_attempt_at"`
+	// LastStatus is the HTTP status of the last attempt, 0 when it got no
+	// response; LastError says what went wrong.
+	LastStatus  int          `json:"last_status"`
+	LastError   string       `json:"last_error"`
+	CreatedAt   time.Time    `json:"created_at"`
+	DeliveredAt *time.Time   `json:"delivered_at"`
+	Event       WebhookEvent `json:"event"`
+	// URL and Secret are the webhook's, for sending.
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
@@ -0,0 +1,60 @@
+package handler
+
+import "mygram/entity"
+
+type Action string
+
+const (
+	ActionUpdate     Action = "update"
+	ActionDelete     Action = "delete"
+	ActionChangeRole Action = "changerole"
+	ActionManage     Action = "manage"
+)
+
+type Resource string
+
+const (
+	ResourceUser        Resource = "user"
+	ResourcePhoto       Resource = "photo"
+	ResourceComment     Resource = "comment"
+	ResourceSocialMedia Resource = "socialmedia"
+	ResourceWebhook     Resource = "webhook"
+)
+
+// ownerActions are allowed to anyone on what they own.
+var ownerActions = []Action{ActionUpdate, ActionDelete}
+
+// roleActions are allowed to a role on resources owned by anybody.
+var roleActions = map[entity.Role]map[Resource][]Action{
+	entity.RoleModerator: {
+		ResourceComment: {ActionDelete},
+	},
+	entity.RoleAdmin: {
+		ResourceUser:        {ActionUpdate, ActionDelete, ActionChangeRole},
+		ResourcePhoto:       {ActionUpdate, ActionDelete},
+		ResourceComment:     {ActionUpdate, ActionDelete},
+		ResourceSocialMedia: {ActionUpdate, ActionDelete},
+		ResourceWebhook:     {ActionManage},
+	},
+}
+
+// Authorize reports whether user may perform action on resource owned by ownerID.
+// Every ownership check in the handlers goes through here.
+func Authorize(user *entity.User, action Action, resource Resource, ownerID int64) bool {
+	if user == nil {
+		return false
+	}
+	if user.ID == ownerID && hasAction(ownerActions, action) {
+		return true
+	}
+	return hasAction(roleActions[user.Role][resource], action)
+}
+
+func hasAction(actions []Action, action Action) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
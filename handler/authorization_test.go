@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"mygram/entity"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorize(t *testing.T) {
+	user := &entity.User{ID: 1, Role: entity.RoleUser}
+	moderator := &entity.User{ID: 2, Role: entity.RoleModerator}
+	admin := &entity.User{ID: 3, Role: entity.RoleAdmin}
+
+	tests := []struct {
+		name     string
+		user     *entity.User
+		action   Action
+		resource Resource
+		owner    int64
+		want     bool
+	}{
+		{"no user", nil, ActionUpdate, ResourcePhoto, 1, false},
+		{"owner updates photo", user, ActionUpdate, ResourcePhoto, 1, true},
+		{"owner deletes comment", user, ActionDelete, ResourceComment, 1, true},
+		{"user updates other photo", user, ActionUpdate, ResourcePhoto, 9, false},
+		{"user changes own role", user, ActionChangeRole, ResourceUser, 1, false},
+		{"moderator deletes other comment", moderator, ActionDelete, ResourceComment, 9, true},
+		{"moderator updates other comment", moderator, ActionUpdate, ResourceComment, 9, false},
+		{"moderator deletes other photo", moderator, ActionDelete, ResourcePhoto, 9, false},
+		{"admin updates other photo", admin, ActionUpdate, ResourcePhoto, 9, true},
+		{"admin deletes other social media", admin, ActionDelete, ResourceSocialMedia, 9, true},
+		{"admin deletes other user", admin, ActionDelete, ResourceUser, 9, true},
+		{"admin changes role", admin, ActionChangeRole, ResourceUser, 9, true},
+		{"moderator manages webhooks", moderator, ActionManage, ResourceWebhook, 0, false},
+		{"admin manages webhooks", admin, ActionManage, ResourceWebhook, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Authorize(tt.user, tt.action, tt.resource, tt.owner))
+		})
+	}
+}
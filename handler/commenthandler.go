@@ -18,6 +18,8 @@ func InstallCommentHandler(r *mux.Router) {
 	api := CommentHandler{}
 	r.HandleFunc("/comments/{id}", api.CommentsHandler)
 	r.HandleFunc("/comments", api.CommentsHandler)
+	r.HandleFunc("/comments/{id}/replies", api.CommentRepliesHandler)
+	r.HandleFunc("/photos/{id}/comments", api.PhotoCommentsHandler)
 }
 
 type CommentHandlerInterface interface {
@@ -34,6 +36,10 @@ func (h *CommentHandler) CommentsHandler(w http.ResponseWriter, r *http.Request)
 
 	switch r.Method {
 	case http.MethodGet:
+		if id != "" {
+			getCommentHandler(w, r, id)
+			return
+		}
 		getCommentsHandler(w, r)
 	case http.MethodPost:
 		postCommentHandler(w, r)
@@ -47,15 +53,85 @@ func (h *CommentHandler) CommentsHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// PhotoCommentsHandler
+// Method: GET
+// Example: localhost/photos/1/comments?view=tree&limit=20&cursor=<next_cursor of the previous page>
+// Without view every comment is listed on its own. view=tree pages through
+// top-level comments with their replies nested under them, and view=flat
+// lists the same threads depth first. A thread longer than
+// database.MaxThreadReplies has more_replies set, and the rest of it is read
+// through /comments/{id}/replies.
+func (h *CommentHandler) PhotoCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Query().Get("view") {
+	case "":
+		writeNestedPage(w, r, database.SqlDatabase.GetPhotoComments)
+	case "tree":
+		writeNestedPage(w, r, database.SqlDatabase.GetPhotoCommentThreads)
+	case "flat":
+		writeNestedPage(w, r, getPhotoCommentsFlat)
+	default:
+		WriteJsonResp(w, ErrorBadRequest, "view must be tree or flat")
+	}
+}
+
+func getPhotoCommentsFlat(ctx context.Context, photoid int64, page entity.PageRequest) (*entity.Page[entity.CommentWithDepth], error) {
+	threads, err := database.SqlDatabase.GetPhotoCommentThreads(ctx, photoid, page)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.Page[entity.CommentWithDepth]{
+		Items:      entity.FlattenCommentThreads(threads.Items),
+		NextCursor: threads.NextCursor,
+		PrevCursor: threads.PrevCursor,
+	}, nil
+}
+
+// CommentRepliesHandler
+// Method: GET
+// Example: localhost/comments/1/replies?limit=20&cursor=<next_cursor of the previous page>
+func (h *CommentHandler) CommentRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	writeNestedPage(w, r, database.SqlDatabase.GetCommentReplies)
+}
+
 // getCommentsHandler
 // Method: GET
-// Example: localhost/comments
+// Example: localhost/comments?photo_id=1&user_id=1&sort=-created_at&limit=20&cursor=<next_cursor of the previous page>
 func getCommentsHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := r.Context()
+	filter, err := commentFilter(r)
+	if err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
+	page, err := pageRequest(r)
+	if err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
 
-	retVal, err := database.SqlDatabase.GetComments(ctx)
+	retVal, err := database.SqlDatabase.GetComments(ctx, filter, page)
 	if err != nil {
-		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success, newPageOutput(r, retVal))
+}
+
+// getCommentHandler
+// Method: GET
+// Example: localhost/comments/1
+func getCommentHandler(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+	idInt, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		WriteJsonResp(w, ErrorNotFound, "NOT FOUND")
+		return
+	}
+
+	retVal, err := database.SqlDatabase.GetCommentByID(ctx, idInt)
+	if err != nil {
+		WriteDatabaseError(w, err)
 		return
 	}
 
@@ -68,10 +144,16 @@ func getCommentsHandler(w http.ResponseWriter, r *http.Request) {
 // JSON Body:
 // {
 // 	"message": "comment message",
-// 	"photo_id": 1
+// 	"photo_id": 1,
+// 	"parent_comment_id": null
 // }
 func postCommentHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
 	validate := validator.New()
 	decoder := json.NewDecoder(r.Body)
 	var inp entity.CommentPost
@@ -85,9 +167,9 @@ func postCommentHandler(w http.ResponseWriter, r *http.Request) {
 		WriteJsonResp(w, ErrorBadRequest, err.Error())
 		return
 	}
-	c, err := database.SqlDatabase.PostComment(ctx, LogonUser.ID, inp)
+	c, err := database.SqlDatabase.PostComment(ctx, logonUser.ID, inp)
 	if err != nil {
-		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		WriteDatabaseError(w, err)
 		return
 	}
 
@@ -104,7 +186,12 @@ func postCommentHandler(w http.ResponseWriter, r *http.Request) {
 // 	"message": "comment message"
 // }
 func updateCommentHandler(w http.ResponseWriter, r *http.Request, id string) {
-	ctx := context.Background()
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
 
 	if id != "" { // get by id
 		if idInt, err := strconv.ParseInt(id, 10, 64); err == nil {
@@ -123,17 +210,17 @@ func updateCommentHandler(w http.ResponseWriter, r *http.Request, id string) {
 			}
 			c, err := database.SqlDatabase.GetCommentByID(ctx, idInt)
 			if err != nil {
-				WriteJsonResp(w, ErrorDataHandleError, err.Error())
+				WriteDatabaseError(w, err)
 				return
 			}
-			if c.UserID != LogonUser.ID {
+			if !Authorize(logonUser, ActionUpdate, ResourceComment, c.UserID) {
 				WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
 				return
 			}
 
-			p, err := database.SqlDatabase.UpdateComment(ctx, LogonUser.ID, idInt, inp.Message)
+			p, err := database.SqlDatabase.UpdateComment(ctx, c.UserID, idInt, inp.Message)
 			if err != nil {
-				WriteJsonResp(w, ErrorDataHandleError, err.Error())
+				WriteDatabaseError(w, err)
 				return
 			}
 			retVal := p.ToCommentUpdateOutput()
@@ -146,21 +233,26 @@ func updateCommentHandler(w http.ResponseWriter, r *http.Request, id string) {
 // Method: DELETE
 // Example: localhost/comments/1
 func deleteCommentHandler(w http.ResponseWriter, r *http.Request, id string) {
-	ctx := context.Background()
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
 	if id != "" {
 		if idInt, err := strconv.ParseInt(id, 10, 64); err == nil {
 			c, err := database.SqlDatabase.GetCommentByID(ctx, idInt)
 			if err != nil {
-				WriteJsonResp(w, ErrorDataHandleError, err.Error())
+				WriteDatabaseError(w, err)
 				return
 			}
-			if c.UserID != LogonUser.ID {
+			if !Authorize(logonUser, ActionDelete, ResourceComment, c.UserID) {
 				WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
 				return
 			}
-			msg, err := database.SqlDatabase.DeleteComment(ctx, LogonUser.ID, idInt)
+			msg, err := database.SqlDatabase.DeleteComment(ctx, c.UserID, idInt)
 			if err != nil {
-				WriteJsonResp(w, ErrorDataHandleError, err.Error())
+				WriteDatabaseError(w, err)
 				return
 			}
 			retVal := map[string]string{
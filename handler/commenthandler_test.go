@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"fmt"
+	"mygram/entity"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommentsHandler(t *testing.T) {
+	db := useMemoryDatabase(t)
+	owner := registerUser(t, db, "owner", "password")
+	other := registerUser(t, db, "other", "password")
+	r := mux.NewRouter()
+	InstallPhotosHandler(r)
+	InstallCommentHandler(r)
+
+	code := doJson(t, r, owner, http.MethodPost, "/photos", entity.PhotoPost{Title: "title", PhotoUrl: "https://photo.domain.com"}, nil)
+	require.Equal(t, http.StatusCreated, code)
+
+	var posted entity.CommentPostOutput
+	code = doJson(t, r, other, http.MethodPost, "/comments", entity.CommentPost{PhotoID: 1, Message: "nice"}, &posted)
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, other.ID, posted.UserID)
+
+	// a comment on a photo that does not exist can't be stored
+	code = doJson(t, r, other, http.MethodPost, "/comments", entity.CommentPost{PhotoID: 99, Message: "nowhere"}, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+
+	code = doJson(t, r, owner, http.MethodPut, "/comments/1", entity.CommentUpdate{Message: "mine now"}, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code = doJson(t, r, other, http.MethodPut, "/comments/99", entity.CommentUpdate{Message: "missing"}, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	var comment entity.CommentGetOutput
+	code = doJson(t, r, owner, http.MethodGet, "/comments/1", nil, &comment)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "nice", comment.Message)
+	assert.Equal(t, "other", comment.User.Username)
+	assert.Equal(t, "title", comment.Photo.Title)
+
+	code = doJson(t, r, other, http.MethodDelete, "/comments/1", nil, nil)
+	assert.Equal(t, http.StatusOK, code)
+	code = doJson(t, r, other, http.MethodDelete, "/comments/1", nil, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+	code = doJson(t, r, other, http.MethodGet, "/comments/1", nil, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestNestedListHandlers(t *testing.T) {
+	db := useMemoryDatabase(t)
+	owner := registerUser(t, db, "owner", "password")
+	r := mux.NewRouter()
+	InstallPhotosHandler(r)
+	InstallCommentHandler(r)
+	InstallSocialMediaHandler(r)
+	for i := 0; i < 2; i++ {
+		code := doJson(t, r, owner, http.MethodPost, "/photos", entity.PhotoPost{Title: "title", PhotoUrl: "https://photo.domain.com"}, nil)
+		require.Equal(t, http.StatusCreated, code)
+	}
+	for i := 0; i < 3; i++ {
+		code := doJson(t, r, owner, http.MethodPost, "/comments", entity.CommentPost{PhotoID: 2, Message: "nice"}, nil)
+		require.Equal(t, http.StatusCreated, code)
+	}
+
+	var comments pageOutput[entity.CommentGetOutput]
+	code := doJson(t, r, owner, http.MethodGet, "/photos/2/comments?limit=2", nil, &comments)
+	require.Equal(t, http.StatusOK, code)
+	assert.Len(t, comments.Items, 2)
+	assert.Contains(t, comments.Links.Next, "/photos/2/comments?")
+
+	var photos pageOutput[entity.PhotoGetOutput]
+	code = doJson(t, r, owner, http.MethodGet, fmt.Sprintf("/users/%d/photos", owner.ID), nil, &photos)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, photos.Items, 2)
+	assert.Equal(t, int64(3), photos.Items[1].CommentCount)
+
+	var socialmedias pageOutput[entity.SocialMediaGetOutput]
+	code = doJson(t, r, owner, http.MethodGet, fmt.Sprintf("/users/%d/socialmedias", owner.ID), nil, &socialmedias)
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, socialmedias.Items)
+
+	for _, url := range []string{"/photos/99/comments", "/users/99/photos", "/users/x/socialmedias"} {
+		code = doJson(t, r, owner, http.MethodGet, url, nil, nil)
+		assert.Equal(t, http.StatusNotFound, code, url)
+	}
+	code = doJson(t, r, owner, http.MethodPost, "/photos/2/comments", entity.CommentPost{Message: "nice"}, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestCommentThreadHandlers(t *testing.T) {
+	db := useMemoryDatabase(t)
+	owner := registerUser(t, db, "owner", "password")
+	r := mux.NewRouter()
+	InstallPhotosHandler(r)
+	InstallCommentHandler(r)
+	code := doJson(t, r, owner, http.MethodPost, "/photos", entity.PhotoPost{Title: "title", PhotoUrl: "https://photo.domain.com"}, nil)
+	require.Equal(t, http.StatusCreated, code)
+
+	var root, child entity.CommentPostOutput
+	code = doJson(t, r, owner, http.MethodPost, "/comments", entity.CommentPost{PhotoID: 1, Message: "root"}, &root)
+	require.Equal(t, http.StatusCreated, code)
+	assert.Nil(t, root.ParentCommentID)
+	code = doJson(t, r, owner, http.MethodPost, "/comments", entity.CommentPost{PhotoID: 1, Message: "child", ParentCommentID: &root.ID}, &child)
+	require.Equal(t, http.StatusCreated, code)
+	require.NotNil(t, child.ParentCommentID)
+	assert.Equal(t, root.ID, *child.ParentCommentID)
+	missing := int64(99)
+	code = doJson(t, r, owner, http.MethodPost, "/comments", entity.CommentPost{PhotoID: 1, Message: "orphan", ParentCommentID: &missing}, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+
+	var replies pageOutput[entity.CommentGetOutput]
+	code = doJson(t, r, owner, http.MethodGet, fmt.Sprintf("/comments/%d/replies", root.ID), nil, &replies)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, replies.Items, 1)
+	assert.Equal(t, child.ID, replies.Items[0].ID)
+	code = doJson(t, r, owner, http.MethodGet, "/comments/99/replies", nil, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	var tree pageOutput[entity.CommentThread]
+	code = doJson(t, r, owner, http.MethodGet, "/photos/1/comments?view=tree", nil, &tree)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, tree.Items, 1)
+	require.Len(t, tree.Items[0].Replies, 1)
+	assert.Equal(t, 1, tree.Items[0].Replies[0].Depth)
+
+	var flat pageOutput[entity.CommentWithDepth]
+	code = doJson(t, r, owner, http.MethodGet, "/photos/1/comments?view=flat", nil, &flat)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, flat.Items, 2)
+	assert.Equal(t, []int{0, 1}, []int{flat.Items[0].Depth, flat.Items[1].Depth})
+
+	code = doJson(t, r, owner, http.MethodGet, "/photos/1/comments?view=sideways", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// the root has a reply, so deleting it leaves a tombstone in the thread
+	code = doJson(t, r, owner, http.MethodDelete, fmt.Sprintf("/comments/%d", root.ID), nil, nil)
+	require.Equal(t, http.StatusOK, code)
+	var tombstone entity.CommentGetOutput
+	code = doJson(t, r, owner, http.MethodGet, fmt.Sprintf("/comments/%d", root.ID), nil, &tombstone)
+	require.Equal(t, http.StatusOK, code)
+	assert.NotNil(t, tombstone.DeletedAt)
+	assert.Empty(t, tombstone.Message)
+}
+
+func TestMentionHandlers(t *testing.T) {
+	db := useMemoryDatabase(t)
+	owner := registerUser(t, db, "owner", "password")
+	ann := registerUser(t, db, "ann", "password")
+	r := mux.NewRouter()
+	InstallPhotosHandler(r)
+	InstallCommentHandler(r)
+
+	var photo entity.PhotoPostOutput
+	code := doJson(t, r, owner, http.MethodPost, "/photos", entity.PhotoPost{Title: "title", Caption: "hi @ann", PhotoUrl: "https://photo.domain.com"}, &photo)
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, []entity.Mention{{UserID: int64(ann.ID), Username: "ann", Offset: 3, Length: 4}}, photo.Mentions)
+	var got entity.PhotoGetOutput
+	code = doJson(t, r, owner, http.MethodGet, fmt.Sprintf("/photos/%d", photo.ID), nil, &got)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, photo.Mentions, got.Mentions)
+	var updated entity.PhotoUpdateOutput
+	code = doJson(t, r, owner, http.MethodPut, fmt.Sprintf("/photos/%d", photo.ID), entity.PhotoPost{Title: "title", Caption: "mail ann@email.com", PhotoUrl: "https://photo.domain.com"}, &updated)
+	require.Equal(t, http.StatusOK, code)
+	assert.NotNil(t, updated.Mentions)
+	assert.Empty(t, updated.Mentions)
+
+	var comment entity.CommentPostOutput
+	code = doJson(t, r, owner, http.MethodPost, "/comments", entity.CommentPost{PhotoID: int(photo.ID), Message: "@ann @nobody"}, &comment)
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, []entity.Mention{{UserID: int64(ann.ID), Username: "ann", Offset: 0, Length: 4}}, comment.Mentions)
+	var comments pageOutput[entity.CommentGetOutput]
+	code = doJson(t, r, owner, http.MethodGet, fmt.Sprintf("/photos/%d/comments", photo.ID), nil, &comments)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, comments.Items, 1)
+	assert.Equal(t, comment.Mentions, comments.Items[0].Mentions)
+}
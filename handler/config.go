@@ -3,12 +3,17 @@ package handler
 import (
 	"fmt"
 	"io/ioutil"
+	"mygram/database"
 	"os"
 
 	"gopkg.in/yaml.v2"
 )
 
 type sqlDb struct {
+	// Driver is one of sqlserver (default), postgres, sqlite or memory.
+	// For sqlite only SqldbName is used, as the database file path, and
+	// memory needs no connection settings at all.
+	Driver      string `yaml:"driver"`
 	Sqlserver   string `yaml:"sqlserver"`
 	Sqlport     int    `yaml:"sqlport"`
 	SqldbName   string `yaml:"sqldbName"`
@@ -16,13 +21,34 @@ type sqlDb struct {
 	Sqlpassword string `yaml:"sqlpassword"`
 }
 
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+type blobStorage struct {
+	// Driver is one of local (default) or s3. Local keeps uploads under Dir,
+	// "media" unless set; s3 keeps them in Bucket at Endpoint, which may be
+	// any S3-compatible service.
+	Driver    string `yaml:"driver"`
+	Dir       string `yaml:"dir"`
+	Endpoint  string `yaml:"endpoint"`
+	Bucket    string `yaml:"bucket"`
+	Region    string `yaml:"region"`
+	AccessKey string `yaml:"accessKey"`
+	SecretKey string `yaml:"secretKey"`
+}
+
 var configYaml = "config/mygram.yaml"
 
 type configuration struct {
 	// Raw file data to avoid re-reading of configuration file
 	// It's reset after config is parsed
-	ConnectionString sqlDb  `yaml:"sqldatabase"`
-	SecretKey        string `yaml:"secretKey"`
+	ConnectionString    sqlDb       `yaml:"sqldatabase"`
+	SecretKey           string      `yaml:"secretKey"`
+	AccessTokenMinutes  int         `yaml:"accessTokenMinutes"`
+	RefreshTokenMinutes int         `yaml:"refreshTokenMinutes"`
+	Storage             blobStorage `yaml:"storage"`
 }
 
 var Config = configuration{}
@@ -36,6 +62,20 @@ func ParseConfig() error {
 	if err != nil {
 		return err
 	}
+	switch Config.ConnectionString.Driver {
+	case "":
+		Config.ConnectionString.Driver = database.DriverSqlServer
+	case database.DriverSqlServer, database.DriverPostgres, database.DriverSqlite, database.DriverMemory:
+	default:
+		return fmt.Errorf("unknown sqldatabase driver %q", Config.ConnectionString.Driver)
+	}
+	switch Config.Storage.Driver {
+	case "":
+		Config.Storage.Driver = StorageLocal
+	case StorageLocal, StorageS3:
+	default:
+		return fmt.Errorf("unknown storage driver %q", Config.Storage.Driver)
+	}
 
 	return nil
 }
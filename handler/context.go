@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"context"
+	"mygram/entity"
+)
+
+type contextKey int
+
+const (
+	logonUserKey contextKey = iota
+	tokenClaimsKey
+)
+
+// WithLogonUser returns a copy of ctx carrying the authenticated user.
+func WithLogonUser(ctx context.Context, user *entity.User) context.Context {
+	return context.WithValue(ctx, logonUserKey, user)
+}
+
+// LogonUserFromContext returns the authenticated user stored in ctx by SecureMiddleware.
+func LogonUserFromContext(ctx context.Context) (*entity.User, bool) {
+	user, ok := ctx.Value(logonUserKey).(*entity.User)
+	return user, ok && user != nil
+}
+
+// viewerID is the id of the authenticated user, 0 when there is none. The
+// photo reads use it for liked_by_me.
+func viewerID(ctx context.Context) int64 {
+	if user, ok := LogonUserFromContext(ctx); ok {
+		return user.ID
+	}
+	return 0
+}
+
+// WithTokenClaims returns a copy of ctx carrying the claims of the access token used.
+func WithTokenClaims(ctx context.Context, claims *entity.MyClaims) context.Context {
+	return context.WithValue(ctx, tokenClaimsKey, claims)
+}
+
+// TokenClaimsFromContext returns the access token claims stored in ctx by SecureMiddleware.
+func TokenClaimsFromContext(ctx context.Context) (*entity.MyClaims, bool) {
+	claims, ok := ctx.Value(tokenClaimsKey).(*entity.MyClaims)
+	return claims, ok && claims != nil
+}
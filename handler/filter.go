@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"mygram/entity"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// photoFilter reads ?user_id=, ?created_from=, ?created_to=, ?search=, ?tag=
+// and ?sort= for GET /photos. Times are RFC 3339.
+func photoFilter(r *http.Request) (entity.PhotoFilter, error) {
+	var filter entity.PhotoFilter
+	var err error
+	if filter.UserID, err = queryID(r, "user_id"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedFrom, err = queryTime(r, "created_from"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedTo, err = queryTime(r, "created_to"); err != nil {
+		return filter, err
+	}
+	filter.Search = r.URL.Query().Get("search")
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		var ok bool
+		if filter.Tag, ok = entity.NormalizeHashtag(tag); !ok {
+			return filter, errors.New("tag must be a hashtag")
+		}
+	}
+	filter.Sort = querySort(r)
+	return filter, nil
+}
+
+// commentFilter reads ?photo_id=, ?user_id= and ?sort= for GET /comments.
+func commentFilter(r *http.Request) (entity.CommentFilter, error) {
+	var filter entity.CommentFilter
+	var err error
+	if filter.PhotoID, err = queryID(r, "photo_id"); err != nil {
+		return filter, err
+	}
+	if filter.UserID, err = queryID(r, "user_id"); err != nil {
+		return filter, err
+	}
+	filter.Sort = querySort(r)
+	return filter, nil
+}
+
+// socialMediaFilter reads ?user_id=, ?search= and ?sort= for GET /socialmedias.
+func socialMediaFilter(r *http.Request) (entity.SocialMediaFilter, error) {
+	var filter entity.SocialMediaFilter
+	var err error
+	if filter.UserID, err = queryID(r, "user_id"); err != nil {
+		return filter, err
+	}
+	filter.Search = r.URL.Query().Get("search")
+	filter.Sort = querySort(r)
+	return filter, nil
+}
+
+// notificationFilter reads ?unread= for GET /notifications.
+func notificationFilter(r *http.Request) (entity.NotificationFilter, error) {
+	var filter entity.NotificationFilter
+	if v := r.URL.Query().Get("unread"); v != "" {
+		unread, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, errors.New("unread must be true or false")
+		}
+		filter.Unread = unread
+	}
+	return filter, nil
+}
+
+func queryID(r *http.Request, name string) (int64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("%s must be a positive number", name)
+	}
+	return id, nil
+}
+
+func queryTime(r *http.Request, name string) (time.Time, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time", name)
+	}
+	return t, nil
+}
+
+// querySort reads ?sort=field, or ?sort=-field for descending order. The
+// database tells whether the list has that field.
+func querySort(r *http.Request) entity.Sort {
+	v := r.URL.Query().Get("sort")
+	return entity.Sort{Field: strings.TrimPrefix(v, "-"), Desc: strings.HasPrefix(v, "-")}
+}
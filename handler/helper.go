@@ -2,16 +2,18 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"mygram/entity"
+	"mygram/database"
+	"mygram/storage"
 	"net/http"
+	"net/url"
 
 	"github.com/golang-jwt/jwt"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var JWT_SIGNING_METHOD = jwt.SigningMethodHS256
-var LogonUser *entity.User
 
 type response struct {
 	Status int         `json:"status"`
@@ -25,6 +27,10 @@ const (
 	ErrorUnauthorized    int = 401
 	ErrorForbidden       int = 403
 	ErrorNotFound        int = 404
+	ErrorConflict        int = 409
+	ErrorTooLarge        int = 413
+	ErrorMediaType       int = 415
+	ErrorUnprocessable   int = 422
 	ErrorDataHandleError int = 500
 )
 
@@ -47,6 +53,25 @@ func WriteJsonResp(w http.ResponseWriter, status int, obj interface{}) {
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
+// WriteDatabaseError answers with the status matching an error returned by
+// database.SqlDatabase: 404 for a missing row, 409 for a duplicate, 422 for a
+// reference to a row that does not exist, 400 for a bad page cursor, 500 for
+// anything else.
+func WriteDatabaseError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrInvalidCursor), errors.Is(err, database.ErrInvalidSort), errors.Is(err, database.ErrSelfFollow):
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+	case errors.Is(err, database.ErrNotFound):
+		WriteJsonResp(w, ErrorNotFound, "NOT FOUND")
+	case errors.Is(err, database.ErrConflict):
+		WriteJsonResp(w, ErrorConflict, "CONFLICT")
+	case errors.Is(err, database.ErrForeignKey):
+		WriteJsonResp(w, ErrorUnprocessable, "UNPROCESSABLE ENTITY")
+	default:
+		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+	}
+}
+
 /*func encryptToken(key, text []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -78,7 +103,48 @@ func decryptToken(key, text []byte) ([]byte, error) {
 }*/
 
 func GetConnectionString() string {
-	connString := fmt.Sprintf("sqlserver://%s:%s@%s:%d?database=%s",
-		Config.ConnectionString.Sqluser, Config.ConnectionString.Sqlpassword, Config.ConnectionString.Sqlserver, Config.ConnectionString.Sqlport, Config.ConnectionString.SqldbName)
-	return connString
+	c := Config.ConnectionString
+	// Credentials may hold any character, so the URLs are built rather than
+	// formatted.
+	switch c.Driver {
+	case database.DriverPostgres:
+		u := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(c.Sqluser, c.Sqlpassword),
+			Host:     fmt.Sprintf("%s:%d", c.Sqlserver, c.Sqlport),
+			Path:     "/" + c.SqldbName,
+			RawQuery: "sslmode=disable",
+		}
+		return u.String()
+	case database.DriverSqlite:
+		return fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", c.SqldbName)
+	default:
+		u := url.URL{
+			Scheme:   "sqlserver",
+			User:     url.UserPassword(c.Sqluser, c.Sqlpassword),
+			Host:     fmt.Sprintf("%s:%d", c.Sqlserver, c.Sqlport),
+			RawQuery: url.Values{"database": {c.SqldbName}}.Encode(),
+		}
+		return u.String()
+	}
+}
+
+// NewBlobStore opens the store configured for uploads.
+func NewBlobStore() (storage.BlobStore, error) {
+	c := Config.Storage
+	switch c.Driver {
+	case StorageS3:
+		if c.Endpoint == "" || c.Bucket == "" {
+			return nil, errors.New("s3 storage needs an endpoint and a bucket")
+		}
+		return storage.NewS3Store(c.Endpoint, c.Bucket, c.Region, c.AccessKey, c.SecretKey), nil
+	case StorageLocal, "":
+		dir := c.Dir
+		if dir == "" {
+			dir = "media"
+		}
+		return storage.NewLocalStore(dir), nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", c.Driver)
+	}
 }
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"mygram/database"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetConnectionString(t *testing.T) {
+	saved := Config
+	defer func() { Config = saved }()
+	Config.ConnectionString = sqlDb{Sqlserver: "db.local", Sqlport: 5432, SqldbName: "mygram", Sqluser: "app", Sqlpassword: "p@ss/w:rd?"}
+
+	Config.ConnectionString.Driver = database.DriverPostgres
+	u, err := url.Parse(GetConnectionString())
+	require.NoError(t, err)
+	assert.Equal(t, "postgres", u.Scheme)
+	assert.Equal(t, "db.local:5432", u.Host)
+	assert.Equal(t, "/mygram", u.Path)
+	assert.Equal(t, "disable", u.Query().Get("sslmode"))
+	password, _ := u.User.Password()
+	assert.Equal(t, "p@ss/w:rd?", password)
+
+	Config.ConnectionString.Driver = database.DriverSqlServer
+	u, err = url.Parse(GetConnectionString())
+	require.NoError(t, err)
+	assert.Equal(t, "sqlserver", u.Scheme)
+	assert.Equal(t, "db.local:5432", u.Host)
+	assert.Equal(t, "mygram", u.Query().Get("database"))
+	password, _ = u.User.Password()
+	assert.Equal(t, "p@ss/w:rd?", password)
+}
+
+func TestNewBlobStore(t *testing.T) {
+	saved := Config
+	defer func() { Config = saved }()
+
+	Config.Storage = blobStorage{Driver: StorageLocal}
+	_, err := NewBlobStore()
+	assert.NoError(t, err)
+	Config.Storage = blobStorage{Driver: StorageS3}
+	_, err = NewBlobStore()
+	assert.Error(t, err)
+	Config.Storage = blobStorage{Driver: "s4"}
+	_, err = NewBlobStore()
+	assert.EqualError(t, err, `unknown storage driver "s4"`)
+}
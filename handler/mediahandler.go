@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"mygram/database"
+	"mygram/storage"
+	"mygram/thumbnail"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// mediaPrefix is where the blobs of storage.Blobs are served from.
+const mediaPrefix = "/media/"
+
+// MediaRoute names the route of the blobs. A large one takes as long to
+// download as the client's connection needs, so no write timeout may apply
+// to it.
+const MediaRoute = "media"
+
+type MediaHandler struct{}
+
+// InstallMediaHandler serves uploads. It is public, as photo URLs are
+// shown to everyone, so the security middleware lets it through.
+func InstallMediaHandler(r *mux.Router) {
+	api := MediaHandler{}
+	r.HandleFunc(mediaPrefix+"{key:.+}", api.MediaHandler).Name(MediaRoute)
+}
+
+// NewThumbnailPool makes the variants of uploads on workers, with room for
+// queue more to wait. It keeps them in storage.Blobs and records them in
+// database.SqlDatabase, which must be set first.
+func NewThumbnailPool(workers int, queue int) *thumbnail.Pool {
+	g := &thumbnail.Generator{Blobs: storage.Blobs, DB: database.SqlDatabase, URL: mediaURL}
+	return thumbnail.NewPool(workers, queue, g.Process)
+}
+
+// mediaURL is where the blob under key is served.
+func mediaURL(key string) string {
+	return mediaPrefix + key
+}
+
+// mediaKey is the key of the blob served at url, if it is one.
+func mediaKey(url string) (string, bool) {
+	if !strings.HasPrefix(url, mediaPrefix) {
+		return "", false
+	}
+	key := strings.TrimPrefix(url, mediaPrefix)
+	return key, storage.ValidKey(key)
+}
+
+// MediaHandler serves a blob. Keys are never reused, so it may be cached for
+// good.
+// Method: GET, HEAD
+// Example: localhost/media/photos/5f0c0f4e2b1a9d8c7e6f5a4b3c2d1e0f.jpg
+func (h *MediaHandler) MediaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		WriteJsonResp(w, ErrorNotFound, "PAGE NOT FOUND")
+		return
+	}
+	body, info, err := storage.Blobs.Get(r.Context(), mux.Vars(r)["key"])
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		WriteJsonResp(w, ErrorNotFound, "NOT FOUND")
+		return
+	}
+	if err != nil {
+		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		return
+	}
+	defer body.Close()
+
+	header := w.Header()
+	header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	header.Set("X-Content-Type-Options", "nosniff")
+	if info.ETag != "" {
+		header.Set("ETag", info.ETag)
+	}
+	if !info.ModTime.IsZero() {
+		header.Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if info.ETag != "" && etagMatches(r.Header.Get("If-None-Match"), info.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	header.Set("Content-Type", info.ContentType)
+	header.Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		_, _ = io.Copy(w, body)
+	}
+}
+
+// etagMatches tells whether the If-None-Match header names etag.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
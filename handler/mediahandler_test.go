@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMediaHandler(t *testing.T) {
+	blobs := useLocalBlobs(t)
+	require.NoError(t, blobs.Put(context.Background(), "photos/abc.png", strings.NewReader("png"), 3, "image/png"))
+	r := mux.NewRouter()
+	InstallMediaHandler(r)
+	serve := func(method string, url string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/media/photos/abc.png", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "png", rec.Body.String())
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "3", rec.Header().Get("Content-Length"))
+	assert.Equal(t, "public, max-age=31536000, immutable", rec.Header().Get("Cache-Control"))
+	assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+	assert.NotEmpty(t, rec.Header().Get("Last-Modified"))
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	rec = serve(http.MethodHead, "/media/photos/abc.png", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "3", rec.Header().Get("Content-Length"))
+	assert.Empty(t, rec.Body.String())
+
+	rec = serve(http.MethodGet, "/media/photos/abc.png", http.Header{"If-None-Match": {`"other", ` + etag}})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+	rec = serve(http.MethodGet, "/media/photos/abc.png", http.Header{"If-None-Match": {`"other"`}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/media/photos/missing.png", nil).Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/media/photos/ABC.png", nil).Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/media/photos", nil).Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodDelete, "/media/photos/abc.png", nil).Code)
+}
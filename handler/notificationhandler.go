@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"mygram/database"
+	"mygram/entity"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type NotificationHandler struct{}
+
+func InstallNotificationHandler(r *mux.Router) {
+	api := NotificationHandler{}
+	r.HandleFunc("/notifications", api.NotificationsHandler)
+	r.HandleFunc("/notifications/read", api.NotificationsReadHandler)
+}
+
+// NotificationsHandler is the caller's notifications, newest first, only the
+// unread ones with ?unread=true.
+// Method: GET
+// Example: localhost/notifications?unread=true&limit=20&cursor=<next_cursor of the previous page>
+func (h *NotificationHandler) NotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteJsonResp(w, ErrorNotFound, "PAGE NOT FOUND")
+		return
+	}
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
+	filter, err := notificationFilter(r)
+	if err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
+	page, err := pageRequest(r)
+	if err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
+
+	retVal, err := database.SqlDatabase.GetNotifications(ctx, logonUser.ID, filter, page)
+	if err != nil {
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success, newPageOutput(r, retVal))
+}
+
+// NotificationsReadHandler marks the caller's notifications ids read, or all
+// of them.
+// Method: POST
+// Example: localhost/notifications/read
+// JSON Body:
+// {
+// 	"ids": [1, 2]
+// }
+// or
+// {
+// 	"all": true
+// }
+func (h *NotificationHandler) NotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteJsonResp(w, ErrorNotFound, "PAGE NOT FOUND")
+		return
+	}
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
+	var inp entity.NotificationRead
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		return
+	}
+	ids := inp.IDs
+	switch {
+	case inp.All && len(ids) > 0:
+		WriteJsonResp(w, ErrorBadRequest, "send either ids or all, not both")
+		return
+	case inp.All:
+		ids = nil
+	case len(ids) == 0:
+		WriteJsonResp(w, ErrorBadRequest, "ids or all is required")
+		return
+	case len(ids) > database.MaxPageLimit:
+		WriteJsonResp(w, ErrorBadRequest, "at most "+strconv.Itoa(database.MaxPageLimit)+" ids at once")
+		return
+	}
+
+	retVal, err := database.SqlDatabase.MarkNotificationsRead(ctx, logonUser.ID, ids)
+	if err != nil {
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success, retVal)
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"fmt"
+	"mygram/entity"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationHandlers(t *testing.T) {
+	db := useMemoryDatabase(t)
+	owner := registerUser(t, db, "owner", "password")
+	fan := registerUser(t, db, "fan", "password")
+	r := mux.NewRouter()
+	InstallUsersHandler(r)
+	InstallPhotosHandler(r)
+	InstallCommentHandler(r)
+	InstallNotificationHandler(r)
+	code := doJson(t, r, owner, http.MethodPost, "/photos", entity.PhotoPost{Title: "title", PhotoUrl: "https://photo.domain.com"}, nil)
+	require.Equal(t, http.StatusCreated, code)
+	code = doJson(t, r, fan, http.MethodPost, fmt.Sprintf("/users/%d/follow", owner.ID), nil, nil)
+	require.Equal(t, http.StatusOK, code)
+	code = doJson(t, r, fan, http.MethodPost, "/photos/1/like", nil, nil)
+	require.Equal(t, http.StatusOK, code)
+	code = doJson(t, r, fan, http.MethodPost, "/comments", entity.CommentPost{PhotoID: 1, Message: "nice @owner"}, nil)
+	require.Equal(t, http.StatusCreated, code)
+
+	var notifications pageOutput[entity.Notification]
+	code = doJson(t, r, owner, http.MethodGet, "/notifications?limit=3", nil, &notifications)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, notifications.Items, 3)
+	assert.Equal(t, entity.NotificationMention, notifications.Items[0].Type)
+	assert.Equal(t, entity.NotificationComment, notifications.Items[1].Type)
+	assert.Equal(t, entity.NotificationLike, notifications.Items[2].Type)
+	assert.JSONEq(t, `{"photo_id":1}`, string(notifications.Items[2].Payload))
+	assert.Equal(t, "fan", notifications.Items[2].ActorUsername)
+	assert.Contains(t, notifications.Links.Next, "/notifications?")
+
+	var read entity.NotificationReadOutput
+	code = doJson(t, r, owner, http.MethodPost, "/notifications/read", entity.NotificationRead{IDs: []int64{notifications.Items[0].ID}}, &read)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, entity.NotificationReadOutput{Read: 1, Unread: 3}, read)
+	var unread pageOutput[entity.Notification]
+	code = doJson(t, r, owner, http.MethodGet, "/notifications?unread=true", nil, &unread)
+	require.Equal(t, http.StatusOK, code)
+	assert.Len(t, unread.Items, 3)
+	code = doJson(t, r, owner, http.MethodPost, "/notifications/read", entity.NotificationRead{All: true}, &read)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, entity.NotificationReadOutput{Read: 3, Unread: 0}, read)
+
+	for _, body := range []entity.NotificationRead{{}, {IDs: []int64{1}, All: true}} {
+		code = doJson(t, r, owner, http.MethodPost, "/notifications/read", body, nil)
+		assert.Equal(t, http.StatusBadRequest, code)
+	}
+	code = doJson(t, r, owner, http.MethodGet, "/notifications?unread=maybe", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code = doJson(t, r, owner, http.MethodGet, "/notifications/read", nil, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+	code = doJson(t, r, nil, http.MethodGet, "/notifications", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
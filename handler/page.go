@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"mygram/entity"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// pageOutput is the data of a list response: one page, plus links to the
+// pages around it that keep the rest of the query string.
+type pageOutput[T any] struct {
+	*entity.Page[T]
+	Links pageLinks `json:"links"`
+}
+
+type pageLinks struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// pageRequest reads ?limit= and ?cursor= from the request.
+func pageRequest(r *http.Request) (entity.PageRequest, error) {
+	var page entity.PageRequest
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return page, errors.New("limit must be a positive number")
+		}
+		page.Limit = n
+	}
+	page.Cursor = r.URL.Query().Get("cursor")
+	return page, nil
+}
+
+func newPageOutput[T any](r *http.Request, page *entity.Page[T]) pageOutput[T] {
+	out := pageOutput[T]{Page: page}
+	out.Links.Next = pageLink(r, page.NextCursor)
+	out.Links.Prev = pageLink(r, page.PrevCursor)
+	return out
+}
+
+// pageLink is the request URL with cursor in place of the current one.
+func pageLink(r *http.Request, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+	u := *r.URL
+	q := u.Query()
+	q.Set("cursor", cursor)
+	u.RawQuery = q.Encode()
+	return u.RequestURI()
+}
+
+// writeNestedPage serves a list nested under the row named by {id}, such as
+// /photos/{id}/comments, with one page read by list.
+func writeNestedPage[T any](w http.ResponseWriter, r *http.Request, list func(ctx context.Context, id int64, page entity.PageRequest) (*entity.Page[T], error)) {
+	if r.Method != http.MethodGet {
+		WriteJsonResp(w, ErrorNotFound, "PAGE NOT FOUND")
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		WriteJsonResp(w, ErrorNotFound, "NOT FOUND")
+		return
+	}
+	page, err := pageRequest(r)
+	if err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
+
+	retVal, err := list(r.Context(), id, page)
+	if err != nil {
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success, newPageOutput(r, retVal))
+}
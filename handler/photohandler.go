@@ -3,8 +3,13 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"io"
+	"log"
+	"mime"
 	"mygram/database"
 	"mygram/entity"
+	"mygram/storage"
+	"mygram/thumbnail"
 	"net/http"
 	"strconv"
 
@@ -12,12 +17,27 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// MaxUploadBytes is the largest photo that may be uploaded.
+const MaxUploadBytes = 10 << 20
+
+// uploadTypes are the image types that may be uploaded, with the extension
+// they are stored under. They are the ones package thumbnail can decode.
+var uploadTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
 type PhotoHandler struct{}
 
 func InstallPhotosHandler(r *mux.Router) {
 	api := PhotoHandler{}
 	r.HandleFunc("/photos/{id}", api.PhotosHandler)
 	r.HandleFunc("/photos", api.PhotosHandler)
+	r.HandleFunc("/photos/{id}/like", api.PhotoLikeHandler)
+	r.HandleFunc("/photos/{id}/likes", api.PhotoLikesHandler)
+	r.HandleFunc("/users/{id}/photos", api.UserPhotosHandler)
+	r.HandleFunc("/feed", api.FeedHandler)
 }
 
 type PhotoHandlerInterface interface {
@@ -34,6 +54,10 @@ func (h *PhotoHandler) PhotosHandler(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
+		if id != "" {
+			getPhotoHandler(w, r, id)
+			return
+		}
 		getPhotosHandler(w, r)
 	case http.MethodPost:
 		postPhotoHandler(w, r)
@@ -47,15 +71,127 @@ func (h *PhotoHandler) PhotosHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// UserPhotosHandler
+// Method: GET
+// Example: localhost/users/1/photos?limit=20&cursor=<next_cursor of the previous page>
+func (h *PhotoHandler) UserPhotosHandler(w http.ResponseWriter, r *http.Request) {
+	viewer := viewerID(r.Context())
+	writeNestedPage(w, r, func(ctx context.Context, userid int64, page entity.PageRequest) (*entity.Page[entity.PhotoGetOutput], error) {
+		return database.SqlDatabase.GetUserPhotos(ctx, viewer, userid, page)
+	})
+}
+
+// FeedHandler is the photos of the users the caller follows, newest first.
+// Method: GET
+// Example: localhost/feed?limit=20&cursor=<next_cursor of the previous page>
+func (h *PhotoHandler) FeedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteJsonResp(w, ErrorNotFound, "PAGE NOT FOUND")
+		return
+	}
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
+	page, err := pageRequest(r)
+	if err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
+
+	retVal, err := database.SqlDatabase.GetFeed(ctx, logonUser.ID, page)
+	if err != nil {
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success, newPageOutput(r, retVal))
+}
+
+// PhotoLikesHandler
+// Method: GET
+// Example: localhost/photos/1/likes?limit=20&cursor=<next_cursor of the previous page>
+func (h *PhotoHandler) PhotoLikesHandler(w http.ResponseWriter, r *http.Request) {
+	writeNestedPage(w, r, database.SqlDatabase.GetPhotoLikes)
+}
+
+// PhotoLikeHandler likes the photo on POST and takes the like back on
+// DELETE. Both may be repeated.
+// Method: POST, DELETE
+// Example: localhost/photos/1/like
+func (h *PhotoHandler) PhotoLikeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var like func(ctx context.Context, userid int64, photoid int64) (*entity.PhotoLikes, error)
+	switch r.Method {
+	case http.MethodPost:
+		like = database.SqlDatabase.LikePhoto
+	case http.MethodDelete:
+		like = database.SqlDatabase.UnlikePhoto
+	default:
+		WriteJsonResp(w, ErrorNotFound, "PAGE NOT FOUND")
+		return
+	}
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
+	idInt, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		WriteJsonResp(w, ErrorNotFound, "NOT FOUND")
+		return
+	}
+
+	retVal, err := like(ctx, logonUser.ID, idInt)
+	if err != nil {
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success, retVal)
+}
+
 // getPhotosHandler
 // Method: GET
-// Example: localhost/photos
+// Example: localhost/photos?user_id=1&created_from=2022-10-01T00:00:00Z&created_to=2022-11-01T00:00:00Z&search=beach&tag=sunset&sort=-comment_count&limit=20&cursor=<next_cursor of the previous page>
 func getPhotosHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := r.Context()
+	filter, err := photoFilter(r)
+	if err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
+	page, err := pageRequest(r)
+	if err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
 
-	retVal, err := database.SqlDatabase.GetPhotos(ctx)
+	retVal, err := database.SqlDatabase.GetPhotos(ctx, viewerID(ctx), filter, page)
 	if err != nil {
-		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success, newPageOutput(r, retVal))
+}
+
+// getPhotoHandler
+// Method: GET
+// Example: localhost/photos/1
+func getPhotoHandler(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+	idInt, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		WriteJsonResp(w, ErrorNotFound, "NOT FOUND")
+		return
+	}
+
+	retVal, err := database.SqlDatabase.GetPhotoByID(ctx, viewerID(ctx), idInt)
+	if err != nil {
+		WriteDatabaseError(w, err)
 		return
 	}
 
@@ -71,28 +207,165 @@ func getPhotosHandler(w http.ResponseWriter, r *http.Request) {
 // 	"caption": "caption photo",
 // 	"photo_url": "https://photo.domain.com"
 // }
+// or a multipart/form-data body with the fields title and caption and the
+// image itself, a JPEG, PNG or GIF of up to 10 MiB, as the file photo.
+// The upload is then served from the photo_url of the output, and is
+// processing until its variants are made.
 func postPhotoHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
 	validate := validator.New()
-	decoder := json.NewDecoder(r.Body)
 	var inp entity.PhotoPost
-	if err := decoder.Decode(&inp); err != nil {
-		WriteJsonResp(w, ErrorDataHandleError, err.Error())
-		return
+	var key string
+	if isMultipart(r) {
+		if key, ok = uploadPhoto(w, r, &inp); !ok {
+			return
+		}
+	} else {
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&inp); err != nil {
+			WriteJsonResp(w, ErrorDataHandleError, err.Error())
+			return
+		}
+		err := validate.Struct(inp)
+		if err != nil {
+			WriteJsonResp(w, ErrorBadRequest, err.Error())
+			return
+		}
+		if _, ok := mediaKey(inp.PhotoUrl); ok {
+			WriteJsonResp(w, ErrorBadRequest, "photo_url can't point at an upload")
+			return
+		}
 	}
-	err := validate.Struct(inp)
+	p, err := database.SqlDatabase.PostPhoto(ctx, logonUser.ID, inp)
 	if err != nil {
-		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		if key != "" {
+			deleteUpload(ctx, key)
+		}
+		WriteDatabaseError(w, err)
 		return
 	}
-	p, err := database.SqlDatabase.PostPhoto(ctx, LogonUser.ID, inp)
+	if key != "" {
+		queueVariants(ctx, p.ID, key)
+	}
+
+	retVal := p.ToPhotoPostOutput()
+	WriteJsonResp(w, Success201, retVal)
+}
+
+// isMultipart tells whether r carries a multipart/form-data body.
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// uploadPhoto reads the fields of a multipart photo post into inp and stores
+// its file, pointing inp.PhotoUrl at it. It answers the request itself when
+// it fails.
+func uploadPhoto(w http.ResponseWriter, r *http.Request, inp *entity.PhotoPost) (string, bool) {
+	// leave room for the other fields and the multipart framing
+	limit := int64(MaxUploadBytes + 1<<20)
+	if r.ContentLength > limit {
+		WriteJsonResp(w, ErrorTooLarge, "REQUEST TOO LARGE")
+		return "", false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return "", false
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	inp.Title = r.FormValue("title")
+	inp.Caption = r.FormValue("caption")
+	if err := validator.New().StructExcept(inp, "PhotoUrl"); err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return "", false
+	}
+	f, fh, err := r.FormFile("photo")
 	if err != nil {
+		WriteJsonResp(w, ErrorBadRequest, "photo: "+err.Error())
+		return "", false
+	}
+	defer f.Close()
+	if fh.Size > MaxUploadBytes {
+		WriteJsonResp(w, ErrorTooLarge, "REQUEST TOO LARGE")
+		return "", false
+	}
+
+	// trust the bytes rather than the name or the type the client sent
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		WriteJsonResp(w, ErrorBadRequest, "photo: "+err.Error())
+		return "", false
+	}
+	contentType := http.DetectContentType(head[:n])
+	ext, ok := uploadTypes[contentType]
+	if !ok {
+		WriteJsonResp(w, ErrorMediaType, "photo must be a JPEG, PNG or GIF image")
+		return "", false
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
 		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		return "", false
+	}
+
+	name, err := randomToken(16)
+	if err != nil {
+		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		return "", false
+	}
+	key := "photos/" + name + ext
+	if err := storage.Blobs.Put(r.Context(), key, f, fh.Size, contentType); err != nil {
+		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		return "", false
+	}
+	inp.PhotoUrl = mediaURL(key)
+	inp.Processing = entity.ProcessingPending
+	return key, true
+}
+
+// queueVariants asks for the variants of the photo id, uploaded under key.
+// A photo that can't be queued stays processing, and is queued again when
+// the server restarts.
+func queueVariants(ctx context.Context, id int64, key string) {
+	if thumbnail.Queue == nil {
 		return
 	}
+	if err := thumbnail.Queue.Submit(ctx, thumbnail.Job{PhotoID: id, Key: key}); err != nil {
+		log.Printf("queueing variants of photo %d: %v", id, err)
+	}
+}
 
-	retVal := p.ToPhotoPostOutput()
-	WriteJsonResp(w, Success201, retVal)
+// QueueProcessingPhotos queues the uploads whose variants were still being
+// made when the server stopped.
+func QueueProcessingPhotos(ctx context.Context) error {
+	photos, err := database.SqlDatabase.GetProcessingPhotos(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range photos {
+		if key, ok := mediaKey(p.PhotoUrl); ok {
+			queueVariants(ctx, p.ID, key)
+		}
+	}
+	return nil
+}
+
+// deleteUpload removes an upload that is no longer used, with its variants.
+// Failing to is not worth failing the request for: blobs are only left
+// behind.
+func deleteUpload(ctx context.Context, key string) {
+	for _, key := range append([]string{key}, thumbnail.VariantKeys(key)...) {
+		if err := storage.Blobs.Delete(ctx, key); err != nil {
+			log.Printf("deleting blob %s: %v", key, err)
+		}
+	}
 }
 
 // updatePhotoHandler
@@ -105,7 +378,12 @@ func postPhotoHandler(w http.ResponseWriter, r *http.Request) {
 // 	"photo_url": "https://photo.domain.com"
 // }
 func updatePhotoHandler(w http.ResponseWriter, r *http.Request, id string) {
-	ctx := context.Background()
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
 
 	if id != "" { // get by id
 		if idInt, err := strconv.ParseInt(id, 10, 64); err == nil {
@@ -122,22 +400,31 @@ func updatePhotoHandler(w http.ResponseWriter, r *http.Request, id string) {
 				WriteJsonResp(w, ErrorBadRequest, err.Error())
 				return
 			}
-			c, err := database.SqlDatabase.GetPhotoByID(ctx, idInt)
+			c, err := database.SqlDatabase.GetPhotoByID(ctx, logonUser.ID, idInt)
 			if err != nil {
-				WriteJsonResp(w, ErrorDataHandleError, err.Error())
+				WriteDatabaseError(w, err)
 				return
 			}
 
-			if c.UserID != LogonUser.ID {
+			if !Authorize(logonUser, ActionUpdate, ResourcePhoto, c.UserID) {
 				WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
 				return
 			}
+			if _, ok := mediaKey(inp.PhotoUrl); ok && inp.PhotoUrl != c.PhotoUrl {
+				WriteJsonResp(w, ErrorBadRequest, "photo_url can't point at an upload")
+				return
+			}
 
-			p, err := database.SqlDatabase.UpdatePhoto(ctx, LogonUser.ID, idInt, inp)
+			p, err := database.SqlDatabase.UpdatePhoto(ctx, c.UserID, idInt, inp)
 			if err != nil {
-				WriteJsonResp(w, ErrorDataHandleError, err.Error())
+				WriteDatabaseError(w, err)
 				return
 			}
+			// A job still making variants of the old upload removes
+			// them itself once it finds the photo has moved on.
+			if key, ok := mediaKey(c.PhotoUrl); ok && inp.PhotoUrl != c.PhotoUrl {
+				deleteUpload(ctx, key)
+			}
 			retVal := p.ToPhotoUpdateOutput()
 			WriteJsonResp(w, Success, retVal)
 		}
@@ -148,23 +435,31 @@ func updatePhotoHandler(w http.ResponseWriter, r *http.Request, id string) {
 // Method: DELETE
 // Example: localhost/photos/1
 func deletePhotoHandler(w http.ResponseWriter, r *http.Request, id string) {
-	ctx := context.Background()
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
 	if id != "" {
 		if idInt, err := strconv.ParseInt(id, 10, 64); err == nil {
-			c, err := database.SqlDatabase.GetPhotoByID(ctx, idInt)
+			c, err := database.SqlDatabase.GetPhotoByID(ctx, logonUser.ID, idInt)
 			if err != nil {
-				WriteJsonResp(w, ErrorDataHandleError, err.Error())
+				WriteDatabaseError(w, err)
 				return
 			}
-			if c.UserID != LogonUser.ID {
+			if !Authorize(logonUser, ActionDelete, ResourcePhoto, c.UserID) {
 				WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
 				return
 			}
-			msg, err := database.SqlDatabase.DeletePhoto(ctx, LogonUser.ID, idInt)
+			msg, err := database.SqlDatabase.DeletePhoto(ctx, c.UserID, idInt)
 			if err != nil {
-				WriteJsonResp(w, ErrorDataHandleError, err.Error())
+				WriteDatabaseError(w, err)
 				return
 			}
+			if key, ok := mediaKey(c.PhotoUrl); ok {
+				deleteUpload(ctx, key)
+			}
 			retVal := map[string]string{
 				"message": msg,
 			}
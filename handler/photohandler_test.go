@@ -0,0 +1,425 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"mygram/entity"
+	"mygram/storage"
+	"mygram/thumbnail"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPhotosHandler(t *testing.T) {
+	db := useMemoryDatabase(t)
+	owner := registerUser(t, db, "owner", "password")
+	other := registerUser(t, db, "other", "password")
+	r := mux.NewRouter()
+	InstallPhotosHandler(r)
+
+	var posted entity.PhotoPostOutput
+	code := doJson(t, r, owner, http.MethodPost, "/photos", entity.PhotoPost{Title: "title", PhotoUrl: "https://photo.domain.com"}, &posted)
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, owner.ID, posted.UserID)
+
+	code = doJson(t, r, owner, http.MethodPost, "/photos", entity.PhotoPost{Title: "no url"}, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code = doJson(t, r, other, http.MethodPut, "/photos/1", entity.PhotoPost{Title: "stolen", PhotoUrl: "https://photo.domain.com"}, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	var updated entity.PhotoUpdateOutput
+	code = doJson(t, r, owner, http.MethodPut, "/photos/1", entity.PhotoPost{Title: "new title", PhotoUrl: "https://photo.domain.com"}, &updated)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "new title", updated.Title)
+
+	var photos pageOutput[entity.PhotoGetOutput]
+	code = doJson(t, r, other, http.MethodGet, "/photos", nil, &photos)
+	assert.Equal(t, http.StatusOK, code)
+	require.Len(t, photos.Items, 1)
+	assert.Equal(t, "owner", photos.Items[0].User.Username)
+
+	var photo entity.PhotoGetOutput
+	code = doJson(t, r, other, http.MethodGet, "/photos/1", nil, &photo)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, photos.Items[0], photo)
+
+	code = doJson(t, r, other, http.MethodDelete, "/photos/1", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code = doJson(t, r, owner, http.MethodDelete, "/photos/1", nil, nil)
+	assert.Equal(t, http.StatusOK, code)
+
+	var left pageOutput[entity.PhotoGetOutput]
+	code = doJson(t, r, other, http.MethodGet, "/photos", nil, &left)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, left.Items, 0)
+
+	code = doJson(t, r, owner, http.MethodPut, "/photos/1", entity.PhotoPost{Title: "gone", PhotoUrl: "https://photo.domain.com"}, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+	code = doJson(t, r, owner, http.MethodDelete, "/photos/1", nil, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+	code = doJson(t, r, owner, http.MethodGet, "/photos/1", nil, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+	code = doJson(t, r, owner, http.MethodGet, "/photos/one", nil, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestPhotosHandler_Pages(t *testing.T) {
+	db := useMemoryDatabase(t)
+	owner := registerUser(t, db, "owner", "password")
+	r := mux.NewRouter()
+	InstallPhotosHandler(r)
+	for i := 0; i < 3; i++ {
+		code := doJson(t, r, owner, http.MethodPost, "/photos", entity.PhotoPost{Title: "title", PhotoUrl: "https://photo.domain.com"}, nil)
+		require.Equal(t, http.StatusCreated, code)
+	}
+
+	var first pageOutput[entity.PhotoGetOutput]
+	code := doJson(t, r, owner, http.MethodGet, "/photos?limit=2", nil, &first)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, first.Items, 2)
+	assert.Empty(t, first.Links.Prev)
+	require.NotEmpty(t, first.Links.Next)
+	assert.Contains(t, first.Links.Next, "limit=2")
+
+	var second pageOutput[entity.PhotoGetOutput]
+	code = doJson(t, r, owner, http.MethodGet, first.Links.Next, nil, &second)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, second.Items, 1)
+	assert.Equal(t, int64(3), second.Items[0].ID)
+	assert.Empty(t, second.Links.Next)
+	assert.NotEmpty(t, second.Links.Prev)
+
+	code = doJson(t, r, owner, http.MethodGet, "/photos?limit=none", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code = doJson(t, r, owner, http.MethodGet, "/photos?cursor=bogus", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestPhotosHandler_Filters(t *testing.T) {
+	db := useMemoryDatabase(t)
+	owner := registerUser(t, db, "owner", "password")
+	other := registerUser(t, db, "other", "password")
+	r := mux.NewRouter()
+	InstallPhotosHandler(r)
+	code := doJson(t, r, owner, http.MethodPost, "/photos", entity.PhotoPost{Title: "Beach", PhotoUrl: "https://photo.domain.com"}, nil)
+	require.Equal(t, http.StatusCreated, code)
+	code = doJson(t, r, other, http.MethodPost, "/photos", entity.PhotoPost{Title: "Mountain", PhotoUrl: "https://photo.domain.com"}, nil)
+	require.Equal(t, http.StatusCreated, code)
+
+	var photos pageOutput[entity.PhotoGetOutput]
+	code = doJson(t, r, owner, http.MethodGet, fmt.Sprintf("/photos?user_id=%d&sort=-created_at", other.ID), nil, &photos)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, photos.Items, 1)
+	assert.Equal(t, "Mountain", photos.Items[0].Title)
+
+	code = doJson(t, r, owner, http.MethodGet, "/photos?search=BEA&created_from=2000-01-01T00:00:00Z", nil, &photos)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, photos.Items, 1)
+	assert.Equal(t, "Beach", photos.Items[0].Title)
+
+	for _, query := range []string{"user_id=me", "created_to=yesterday", "sort=title"} {
+		code = doJson(t, r, owner, http.MethodGet, "/photos?"+query, nil, nil)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
+
+func TestPhotoLikeHandlers(t *testing.T) {
+	db := useMemoryDatabase(t)
+	owner := registerUser(t, db, "owner", "password")
+	other := registerUser(t, db, "other", "password")
+	r := mux.NewRouter()
+	InstallPhotosHandler(r)
+
+	var posted entity.PhotoPostOutput
+	code := doJson(t, r, owner, http.MethodPost, "/photos", entity.PhotoPost{Title: "title", PhotoUrl: "https://photo.domain.com"}, &posted)
+	require.Equal(t, http.StatusCreated, code)
+	like := fmt.Sprintf("/photos/%d/like", posted.ID)
+
+	var likes entity.PhotoLikes
+	for i := 0; i < 2; i++ {
+		code = doJson(t, r, other, http.MethodPost, like, nil, &likes)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, int64(1), likes.LikeCount)
+		assert.True(t, likes.LikedByMe)
+	}
+
+	var got entity.PhotoGetOutput
+	code = doJson(t, r, other, http.MethodGet, fmt.Sprintf("/photos/%d", posted.ID), nil, &got)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(1), got.LikeCount)
+	assert.True(t, got.LikedByMe)
+	code = doJson(t, r, owner, http.MethodGet, fmt.Sprintf("/photos/%d", posted.ID), nil, &got)
+	require.Equal(t, http.StatusOK, code)
+	assert.False(t, got.LikedByMe)
+
+	var list pageOutput[entity.LikeGetOutput]
+	code = doJson(t, r, owner, http.MethodGet, fmt.Sprintf("/photos/%d/likes", posted.ID), nil, &list)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, "other", list.Items[0].Username)
+
+	code = doJson(t, r, other, http.MethodDelete, like, nil, &likes)
+	require.Equal(t, http.StatusOK, code)
+	assert.Zero(t, likes.LikeCount)
+	assert.False(t, likes.LikedByMe)
+
+	assert.Equal(t, http.StatusUnauthorized, doJson(t, r, nil, http.MethodPost, like, nil, nil))
+	assert.Equal(t, http.StatusNotFound, doJson(t, r, other, http.MethodPut, like, nil, nil))
+	assert.Equal(t, http.StatusNotFound, doJson(t, r, other, http.MethodPost, "/photos/99/like", nil, nil))
+	assert.Equal(t, http.StatusNotFound, doJson(t, r, other, http.MethodGet, "/photos/99/likes", nil, nil))
+}
+
+func TestFeedHandler(t *testing.T) {
+	db := useMemoryDatabase(t)
+	reader := registerUser(t, db, "reader", "password")
+	followed := registerUser(t, db, "followed", "password")
+	stranger := registerUser(t, db, "stranger", "password")
+	_, err := db.FollowUser(context.Background(), reader.ID, followed.ID)
+	require.NoError(t, err)
+	r := mux.NewRouter()
+	InstallPhotosHandler(r)
+	for _, owner := range []*entity.User{followed, stranger, followed} {
+		code := doJson(t, r, owner, http.MethodPost, "/photos", entity.PhotoPost{Title: "title", PhotoUrl: "https://photo.domain.com"}, nil)
+		require.Equal(t, http.StatusCreated, code)
+	}
+
+	var feed pageOutput[entity.PhotoGetOutput]
+	code := doJson(t, r, reader, http.MethodGet, "/feed?limit=1", nil, &feed)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, feed.Items, 1)
+	assert.Equal(t, int64(3), feed.Items[0].ID)
+	assert.NotEmpty(t, feed.Links.Next)
+
+	var last pageOutput[entity.PhotoGetOutput]
+	code = doJson(t, r, reader, http.MethodGet, feed.Links.Next, nil, &last)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, last.Items, 1)
+	assert.Equal(t, int64(1), last.Items[0].ID)
+	assert.Empty(t, last.Links.Next)
+
+	assert.Equal(t, http.StatusUnauthorized, doJson(t, r, nil, http.MethodGet, "/feed", nil, nil))
+	assert.Equal(t, http.StatusNotFound, doJson(t, r, reader, http.MethodPost, "/feed", nil, nil))
+}
+
+// useThumbnails makes the variants of the uploads of one test. Closing the
+// pool waits for them.
+func useThumbnails(t *testing.T) *thumbnail.Pool {
+	pool := NewThumbnailPool(1, 4)
+	thumbnail.Queue = pool
+	t.Cleanup(func() { thumbnail.Queue = nil })
+	return pool
+}
+
+// useLocalBlobs keeps the uploads of one test in a temporary directory.
+func useLocalBlobs(t *testing.T) storage.BlobStore {
+	blobs := storage.NewLocalStore(t.TempDir())
+	storage.Blobs = blobs
+	t.Cleanup(func() { storage.Blobs = nil })
+	return blobs
+}
+
+func pngImage(t *testing.T) []byte {
+	return pngImageSized(t, 4, 3)
+}
+
+func pngImageSized(t *testing.T, w int, h int) []byte {
+	var b bytes.Buffer
+	require.NoError(t, png.Encode(&b, image.NewRGBA(image.Rect(0, 0, w, h))))
+	return b.Bytes()
+}
+
+// doUpload posts a photo as multipart/form-data, as user, and decodes the data of the response into out.
+func doUpload(t *testing.T, r http.Handler, user *entity.User, fields map[string]string, file []byte, out interface{}) int {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range fields {
+		require.NoError(t, mw.WriteField(name, value))
+	}
+	if file != nil {
+		fw, err := mw.CreateFormFile("photo", "photo.bin")
+		require.NoError(t, err)
+		_, err = fw.Write(file)
+		require.NoError(t, err)
+	}
+	require.NoError(t, mw.Close())
+	req := httptest.NewRequest(http.MethodPost, "/photos", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req = req.WithContext(WithLogonUser(req.Context(), user))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if out != nil {
+		resp := response{Data: out}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	}
+	return rec.Code
+}
+
+func TestPhotosHandler_Upload(t *testing.T) {
+	db := useMemoryDatabase(t)
+	blobs := useLocalBlobs(t)
+	owner := registerUser(t, db, "owner", "password")
+	other := registerUser(t, db, "other", "password")
+	r := mux.NewRouter()
+	InstallPhotosHandler(r)
+	ctx := context.Background()
+
+	img := pngImage(t)
+	var posted entity.PhotoPostOutput
+	code := doUpload(t, r, owner, map[string]string{"title": "title", "caption": "caption"}, img, &posted)
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "title", posted.Title)
+	assert.Equal(t, "caption", posted.Caption)
+	assert.Regexp(t, `^/media/photos/[0-9a-f]{32}\.png$`, posted.PhotoUrl)
+	// without a queue, nothing makes the variants
+	assert.Equal(t, entity.ProcessingPending, posted.Processing)
+	assert.Nil(t, posted.Variants)
+	key, ok := mediaKey(posted.PhotoUrl)
+	require.True(t, ok)
+	body, info, err := blobs.Get(ctx, key)
+	require.NoError(t, err)
+	stored, err := io.ReadAll(body)
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	assert.Equal(t, img, stored)
+	assert.Equal(t, "image/png", info.ContentType)
+
+	code = doUpload(t, r, owner, map[string]string{"caption": "no title"}, img, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code = doUpload(t, r, owner, map[string]string{"title": "no photo"}, nil, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code = doUpload(t, r, owner, map[string]string{"title": "text"}, []byte("not an image at all"), nil)
+	assert.Equal(t, http.StatusUnsupportedMediaType, code)
+	code = doUpload(t, r, owner, map[string]string{"title": "webp"}, []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), nil)
+	assert.Equal(t, http.StatusUnsupportedMediaType, code)
+	code = doUpload(t, r, owner, map[string]string{"title": "huge"}, append(img, make([]byte, MaxUploadBytes)...), nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+
+	// an upload can't be claimed by pointing at it
+	code = doJson(t, r, other, http.MethodPost, "/photos", entity.PhotoPost{Title: "mine", PhotoUrl: posted.PhotoUrl}, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	var own entity.PhotoPostOutput
+	code = doJson(t, r, other, http.MethodPost, "/photos", entity.PhotoPost{Title: "mine", PhotoUrl: "https://photo.domain.com"}, &own)
+	require.Equal(t, http.StatusCreated, code)
+	code = doJson(t, r, other, http.MethodPut, fmt.Sprintf("/photos/%d", own.ID), entity.PhotoPost{Title: "mine", PhotoUrl: posted.PhotoUrl}, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code = doJson(t, r, owner, http.MethodPut, fmt.Sprintf("/photos/%d", posted.ID), entity.PhotoPost{Title: "new title", PhotoUrl: posted.PhotoUrl}, nil)
+	assert.Equal(t, http.StatusOK, code)
+
+	code = doJson(t, r, owner, http.MethodDelete, fmt.Sprintf("/photos/%d", posted.ID), nil, nil)
+	assert.Equal(t, http.StatusOK, code)
+	_, _, err = blobs.Get(ctx, key)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestPhotosHandler_Variants(t *testing.T) {
+	db := useMemoryDatabase(t)
+	blobs := useLocalBlobs(t)
+	pool := useThumbnails(t)
+	owner := registerUser(t, db, "owner", "password")
+	r := mux.NewRouter()
+	InstallPhotosHandler(r)
+	InstallMediaHandler(r)
+	ctx := context.Background()
+
+	var posted entity.PhotoPostOutput
+	code := doUpload(t, r, owner, map[string]string{"title": "wide"}, pngImageSized(t, 800, 400), &posted)
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, entity.ProcessingPending, posted.Processing)
+	var broken entity.PhotoPostOutput
+	// sniffed as PNG, but not one
+	code = doUpload(t, r, owner, map[string]string{"title": "broken"}, []byte("\x89PNG\r\n\x1a\nnot really"), &broken)
+	require.Equal(t, http.StatusCreated, code)
+	pool.Close()
+
+	var photo entity.PhotoGetOutput
+	code = doJson(t, r, owner, http.MethodGet, fmt.Sprintf("/photos/%d", posted.ID), nil, &photo)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, entity.ProcessingReady, photo.Processing)
+	key, _ := mediaKey(posted.PhotoUrl)
+	base := strings.TrimSuffix(posted.PhotoUrl, ".png")
+	assert.Equal(t, &entity.PhotoVariants{Thumbnail: base + "_thumbnail.jpg", Medium: base + "_medium.jpg", Large: base + "_large.jpg"}, photo.Variants)
+
+	req := httptest.NewRequest(http.MethodGet, photo.Variants.Thumbnail, nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/jpeg", rec.Header().Get("Content-Type"))
+	config, err := jpeg.DecodeConfig(rec.Body)
+	require.NoError(t, err)
+	assert.Equal(t, [2]int{160, 80}, [2]int{config.Width, config.Height})
+
+	code = doJson(t, r, owner, http.MethodGet, fmt.Sprintf("/photos/%d", broken.ID), nil, &photo)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, entity.ProcessingFailed, photo.Processing)
+	assert.Nil(t, photo.Variants)
+
+	// the variants go with the photo
+	code = doJson(t, r, owner, http.MethodDelete, fmt.Sprintf("/photos/%d", posted.ID), nil, nil)
+	require.Equal(t, http.StatusOK, code)
+	for _, key := range append([]string{key}, thumbnail.VariantKeys(key)...) {
+		_, _, err := blobs.Get(ctx, key)
+		assert.ErrorIs(t, err, storage.ErrNotFound, key)
+	}
+}
+
+func TestPhotosHandler_DeleteUserUploads(t *testing.T) {
+	db := useMemoryDatabase(t)
+	blobs := useLocalBlobs(t)
+	pool := useThumbnails(t)
+	owner := registerUser(t, db, "owner", "password")
+	other := registerUser(t, db, "other", "password")
+	r := mux.NewRouter()
+	InstallPhotosHandler(r)
+	InstallUsersHandler(r)
+	ctx := context.Background()
+
+	var mine, theirs entity.PhotoPostOutput
+	require.Equal(t, http.StatusCreated, doUpload(t, r, owner, map[string]string{"title": "mine"}, pngImage(t), &mine))
+	require.Equal(t, http.StatusCreated, doUpload(t, r, other, map[string]string{"title": "theirs"}, pngImage(t), &theirs))
+	pool.Close()
+
+	// the uploads and their variants go with their owner, and nobody else's
+	require.Equal(t, http.StatusOK, doJson(t, r, owner, http.MethodDelete, "/users", nil, nil))
+	key, _ := mediaKey(mine.PhotoUrl)
+	for _, key := range append([]string{key}, thumbnail.VariantKeys(key)...) {
+		_, _, err := blobs.Get(ctx, key)
+		assert.ErrorIs(t, err, storage.ErrNotFound, key)
+	}
+	key, _ = mediaKey(theirs.PhotoUrl)
+	for _, key := range append([]string{key}, thumbnail.VariantKeys(key)...) {
+		_, _, err := blobs.Get(ctx, key)
+		assert.NoError(t, err, key)
+	}
+}
+
+func TestQueueProcessingPhotos(t *testing.T) {
+	db := useMemoryDatabase(t)
+	blobs := useLocalBlobs(t)
+	owner := registerUser(t, db, "owner", "password")
+	ctx := context.Background()
+	img := pngImage(t)
+	require.NoError(t, blobs.Put(ctx, "photos/left.png", bytes.NewReader(img), int64(len(img)), "image/png"))
+	p, err := db.PostPhoto(ctx, owner.ID, entity.PhotoPost{Title: "left", PhotoUrl: "/media/photos/left.png", Processing: entity.ProcessingPending})
+	require.NoError(t, err)
+
+	pool := useThumbnails(t)
+	require.NoError(t, QueueProcessingPhotos(ctx))
+	pool.Close()
+	got, err := db.GetPhotoByID(ctx, 0, p.ID)
+	require.NoError(t, err)
+	assert.Equal(t, entity.ProcessingReady, got.Processing)
+}
@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"context"
 	"encoding/json"
 	"mygram/database"
 	"mygram/entity"
@@ -18,6 +17,7 @@ func InstallSocialMediaHandler(r *mux.Router) {
 	api := SocialMediaHandler{}
 	r.HandleFunc("/socialmedias/{id}", api.SocialMediasHandler)
 	r.HandleFunc("/socialmedias", api.SocialMediasHandler)
+	r.HandleFunc("/users/{id}/socialmedias", api.UserSocialMediasHandler)
 }
 
 type SocialMediaHandlerInterface interface {
@@ -34,6 +34,10 @@ func (h *SocialMediaHandler) SocialMediasHandler(w http.ResponseWriter, r *http.
 
 	switch r.Method {
 	case http.MethodGet:
+		if id != "" {
+			getSocialMediaHandler(w, r, id)
+			return
+		}
 		getSocialMediasHandler(w, r)
 	case http.MethodPost:
 		postSocialMediaHandler(w, r)
@@ -47,15 +51,52 @@ func (h *SocialMediaHandler) SocialMediasHandler(w http.ResponseWriter, r *http.
 	}
 }
 
+// UserSocialMediasHandler
+// Method: GET
+// Example: localhost/users/1/socialmedias?limit=20&cursor=<next_cursor of the previous page>
+func (h *SocialMediaHandler) UserSocialMediasHandler(w http.ResponseWriter, r *http.Request) {
+	writeNestedPage(w, r, database.SqlDatabase.GetUserSocialMedias)
+}
+
 // getSocialMediasHandler
 // Method: GET
-// Example: localhost/socialmedias
+// Example: localhost/socialmedias?user_id=1&search=insta&sort=updated_at&limit=20&cursor=<next_cursor of the previous page>
 func getSocialMediasHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := r.Context()
+	filter, err := socialMediaFilter(r)
+	if err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
+	page, err := pageRequest(r)
+	if err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
 
-	retVal, err := database.SqlDatabase.GetSocialMedias(ctx)
+	retVal, err := database.SqlDatabase.GetSocialMedias(ctx, filter, page)
 	if err != nil {
-		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success, newPageOutput(r, retVal))
+}
+
+// getSocialMediaHandler
+// Method: GET
+// Example: localhost/socialmedias/1
+func getSocialMediaHandler(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+	idInt, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		WriteJsonResp(w, ErrorNotFound, "NOT FOUND")
+		return
+	}
+
+	retVal, err := database.SqlDatabase.GetSocialMediaByID(ctx, idInt)
+	if err != nil {
+		WriteDatabaseError(w, err)
 		return
 	}
 
@@ -72,7 +113,12 @@ func getSocialMediasHandler(w http.ResponseWriter, r *http.Request) {
 // 	"profile_image_url": "https://domainsocialmedia.com/userimage.jpg"
 // }
 func postSocialMediaHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
 	validate := validator.New()
 	decoder := json.NewDecoder(r.Body)
 	var inp entity.SocialMediaPost
@@ -85,9 +131,9 @@ func postSocialMediaHandler(w http.ResponseWriter, r *http.Request) {
 		WriteJsonResp(w, ErrorBadRequest, err.Error())
 		return
 	}
-	p, err := database.SqlDatabase.PostSocialMedia(ctx, LogonUser.ID, inp)
+	p, err := database.SqlDatabase.PostSocialMedia(ctx, logonUser.ID, inp)
 	if err != nil {
-		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		WriteDatabaseError(w, err)
 		return
 	}
 
@@ -106,7 +152,12 @@ func postSocialMediaHandler(w http.ResponseWriter, r *http.Request) {
 // 	"profile_image_url": "https://domainsocialmedia.com/userimage.jpg"
 // }
 func updateSocialMediaHandler(w http.ResponseWriter, r *http.Request, id string) {
-	ctx := context.Background()
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
 
 	if id != "" { // get by id
 		if idInt, err := strconv.ParseInt(id, 10, 64); err == nil {
@@ -124,17 +175,17 @@ func updateSocialMediaHandler(w http.ResponseWriter, r *http.Request, id string)
 			}
 			c, err := database.SqlDatabase.GetSocialMediaByID(ctx, idInt)
 			if err != nil {
-				WriteJsonResp(w, ErrorDataHandleError, err.Error())
+				WriteDatabaseError(w, err)
 				return
 			}
-			if c.UserID != LogonUser.ID {
+			if !Authorize(logonUser, ActionUpdate, ResourceSocialMedia, c.UserID) {
 				WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
 				return
 			}
 
-			p, err := database.SqlDatabase.UpdateSocialMedia(ctx, LogonUser.ID, idInt, inp)
+			p, err := database.SqlDatabase.UpdateSocialMedia(ctx, c.UserID, idInt, inp)
 			if err != nil {
-				WriteJsonResp(w, ErrorDataHandleError, err.Error())
+				WriteDatabaseError(w, err)
 				return
 			}
 			retVal := p.ToSocialMediaUpdateOutput()
@@ -147,21 +198,26 @@ func updateSocialMediaHandler(w http.ResponseWriter, r *http.Request, id string)
 // Method: DELETE
 // Example: localhost/socialmedias/1
 func deleteSocialMediaHandler(w http.ResponseWriter, r *http.Request, id string) {
-	ctx := context.Background()
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
 	if id != "" {
 		if idInt, err := strconv.ParseInt(id, 10, 64); err == nil {
 			c, err := database.SqlDatabase.GetSocialMediaByID(ctx, idInt)
 			if err != nil {
-				WriteJsonResp(w, ErrorDataHandleError, err.Error())
+				WriteDatabaseError(w, err)
 				return
 			}
-			if c.UserID != LogonUser.ID {
+			if !Authorize(logonUser, ActionDelete, ResourceSocialMedia, c.UserID) {
 				WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
 				return
 			}
-			msg, err := database.SqlDatabase.DeleteComment(ctx, LogonUser.ID, idInt)
+			msg, err := database.SqlDatabase.DeleteSocialMedia(ctx, c.UserID, idInt)
 			if err != nil {
-				WriteJsonResp(w, ErrorDataHandleError, err.Error())
+				WriteDatabaseError(w, err)
 				return
 			}
 			retVal := map[string]string{
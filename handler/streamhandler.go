@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mygram/database"
+	"mygram/entity"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// StreamRoute names the route of GET /stream, which stays open for as long
+// as the client listens, so no write timeout may apply to it.
+const StreamRoute = "stream"
+
+// streamHeartbeat is how often an idle stream sends a comment, so proxies
+// and clients can tell it is still alive.
+var streamHeartbeat = 15 * time.Second
+
+type StreamHandler struct{}
+
+func InstallStreamHandler(r *mux.Router) {
+	api := StreamHandler{}
+	r.HandleFunc("/stream", api.StreamHandler).Name(StreamRoute)
+}
+
+// StreamHandler pushes the caller's notifications (comments on their photos,
+// likes, new followers and mentions) as Server-Sent Events as they happen.
+// Each event is named after the notification type, has its id and carries
+// it as JSON data. A client that falls too far behind gets a lagged event and
+// is disconnected; it catches up from GET /notifications and reconnects.
+// Method: GET
+// Example: localhost/stream
+func (h *StreamHandler) StreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteJsonResp(w, ErrorNotFound, "PAGE NOT FOUND")
+		return
+	}
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		WriteJsonResp(w, ErrorDataHandleError, "streaming is not supported")
+		return
+	}
+
+	sub := database.Events.Subscribe(logonUser.ID, database.DefaultSubscriptionBuffer)
+	defer sub.Close()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(Success)
+	if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	actors := actorNames{}
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case n, ok := <-sub.C:
+			if !ok {
+				if sub.Lagged() {
+					_, _ = fmt.Fprint(w, "event: lagged\ndata: {}\n\n")
+					flusher.Flush()
+				}
+				return
+			}
+			n.ActorUsername = actors.get(ctx, n.ActorID)
+			err = writeEvent(w, n)
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes n as a Server-Sent Event.
+func writeEvent(w http.ResponseWriter, n entity.Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", n.ID, n.Type, data)
+	return err
+}
+
+// actorNames remembers the usernames of the actors a stream has seen.
+type actorNames map[int64]string
+
+// get is the username of the user id, empty when it can't be read.
+func (a actorNames) get(ctx context.Context, id int64) string {
+	if name, ok := a[id]; ok {
+		return name
+	}
+	u, err := database.SqlDatabase.GetUserByID(ctx, id)
+	if err != nil {
+		return ""
+	}
+	a[id] = u.Username
+	return u.Username
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"mygram/database"
+	"mygram/entity"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readEvent reads the next event or comment of a stream, without its
+// trailing blank line.
+func readEvent(t *testing.T, r *bufio.Reader) []string {
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestStreamHandler(t *testing.T) {
+	db := useMemoryDatabase(t)
+	owner := registerUser(t, db, "owner", "password")
+	fan := registerUser(t, db, "fan", "password")
+	heartbeat := streamHeartbeat
+	streamHeartbeat = 50 * time.Millisecond
+	t.Cleanup(func() { streamHeartbeat = heartbeat })
+	r := mux.NewRouter()
+	InstallStreamHandler(r)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.ServeHTTP(w, req.WithContext(WithLogonUser(req.Context(), owner)))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/stream", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	body := bufio.NewReader(resp.Body)
+	assert.Equal(t, []string{": connected"}, readEvent(t, body))
+
+	_, err = db.FollowUser(context.Background(), int64(fan.ID), int64(owner.ID))
+	require.NoError(t, err)
+	event := readEvent(t, body)
+	require.Len(t, event, 3)
+	assert.Regexp(t, `^id: \d+$`, event[0])
+	assert.Equal(t, "event: follow", event[1])
+	var n entity.Notification
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(event[2], "data: ")), &n))
+	assert.Equal(t, int64(fan.ID), n.ActorID)
+	assert.Equal(t, "fan", n.ActorUsername)
+
+	// nothing happens, but the stream says it is alive
+	assert.Equal(t, []string{": heartbeat"}, readEvent(t, body))
+
+	cancel()
+	assert.Eventually(t, func() bool { return database.Events.Subscribers(int64(owner.ID)) == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestStreamHandler_Lagged(t *testing.T) {
+	db := useMemoryDatabase(t)
+	owner := registerUser(t, db, "owner", "password")
+	r := mux.NewRouter()
+	InstallStreamHandler(r)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.ServeHTTP(w, req.WithContext(WithLogonUser(req.Context(), owner)))
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body := bufio.NewReader(resp.Body)
+	readEvent(t, body)
+	// a client that reads nothing while far more happens than fits its
+	// buffer and the connection's
+	for i := 0; i < 10000; i++ {
+		database.Events.Publish(entity.Notification{ID: int64(i + 1), UserID: int64(owner.ID), Type: entity.NotificationLike, ActorID: int64(owner.ID)})
+	}
+	var last []string
+	for {
+		event := readEvent(t, body)
+		if len(event) > 0 && event[0] == "event: lagged" {
+			last = event
+			break
+		}
+	}
+	assert.Equal(t, []string{"event: lagged", "data: {}"}, last)
+	_, err = body.ReadString('\n')
+	assert.Error(t, err, "the stream ends after lagged")
+}
+
+func TestStreamHandler_Errors(t *testing.T) {
+	useMemoryDatabase(t)
+	r := mux.NewRouter()
+	InstallStreamHandler(r)
+	code := doJson(t, r, nil, http.MethodGet, "/stream", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code = doJson(t, r, &entity.User{ID: 1}, http.MethodPost, "/stream", nil, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
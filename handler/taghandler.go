@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"errors"
+	"mygram/database"
+	"mygram/entity"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultTrendingWindow and maxTrendingWindow bound ?window= of GET /tags/trending.
+	defaultTrendingWindow = 24 * time.Hour
+	maxTrendingWindow     = 30 * 24 * time.Hour
+	defaultTrendingLimit  = 10
+)
+
+type TagHandler struct{}
+
+func InstallTagHandler(r *mux.Router) {
+	api := TagHandler{}
+	r.HandleFunc("/tags/trending", api.TrendingTagsHandler)
+	r.HandleFunc("/tags/{tag}/photos", api.TagPhotosHandler)
+}
+
+// TagPhotosHandler is the photos tagged with a hashtag, newest first. The
+// tag is matched ignoring case, with or without its #.
+// Method: GET
+// Example: localhost/tags/sunset/photos?limit=20&cursor=<next_cursor of the previous page>
+func (h *TagHandler) TagPhotosHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteJsonResp(w, ErrorNotFound, "PAGE NOT FOUND")
+		return
+	}
+	ctx := r.Context()
+	tag, ok := entity.NormalizeHashtag(mux.Vars(r)["tag"])
+	if !ok {
+		WriteJsonResp(w, ErrorBadRequest, "tag must be a hashtag")
+		return
+	}
+	page, err := pageRequest(r)
+	if err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
+
+	retVal, err := database.SqlDatabase.GetTagPhotos(ctx, viewerID(ctx), tag, page)
+	if err != nil {
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success, newPageOutput(r, retVal))
+}
+
+// TrendingTagsHandler is the tags most photos were tagged with in the last
+// window (a Go duration, 24h by default, 720h at most).
+// Method: GET
+// Example: localhost/tags/trending?window=168h&limit=10
+func (h *TagHandler) TrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteJsonResp(w, ErrorNotFound, "PAGE NOT FOUND")
+		return
+	}
+	window, limit, err := trendingRequest(r)
+	if err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
+
+	since := time.Now().Add(-window)
+	items, err := database.SqlDatabase.GetTrendingTags(r.Context(), since, limit)
+	if err != nil {
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success, entity.TrendingTags{Since: since, Items: items})
+}
+
+// trendingRequest reads ?window= and ?limit= for GET /tags/trending.
+func trendingRequest(r *http.Request) (time.Duration, int, error) {
+	window, limit := defaultTrendingWindow, defaultTrendingLimit
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxTrendingWindow {
+			return 0, 0, errors.New("window must be a duration up to 720h, e.g. 24h")
+		}
+		window = d
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return 0, 0, errors.New("limit must be a positive number")
+		}
+		limit = n
+	}
+	if limit > database.MaxPageLimit {
+		limit = database.MaxPageLimit
+	}
+	return window, limit, nil
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"mygram/entity"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagHandlers(t *testing.T) {
+	db := useMemoryDatabase(t)
+	owner := registerUser(t, db, "owner", "password")
+	r := mux.NewRouter()
+	InstallPhotosHandler(r)
+	InstallTagHandler(r)
+	for _, caption := range []string{"#Sunset on the #beach", "#sunset", "no tags"} {
+		code := doJson(t, r, owner, http.MethodPost, "/photos", entity.PhotoPost{Title: "title", Caption: caption, PhotoUrl: "https://photo.domain.com"}, nil)
+		require.Equal(t, http.StatusCreated, code)
+	}
+
+	var photos pageOutput[entity.PhotoGetOutput]
+	code := doJson(t, r, owner, http.MethodGet, "/tags/SUNSET/photos?limit=1", nil, &photos)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, photos.Items, 1)
+	assert.Equal(t, int64(2), photos.Items[0].ID)
+	assert.Contains(t, photos.Links.Next, "/tags/SUNSET/photos?")
+	var filtered pageOutput[entity.PhotoGetOutput]
+	code = doJson(t, r, owner, http.MethodGet, "/photos?tag=%23beach", nil, &filtered)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, filtered.Items, 1)
+	assert.Equal(t, int64(1), filtered.Items[0].ID)
+
+	var trending entity.TrendingTags
+	code = doJson(t, r, owner, http.MethodGet, "/tags/trending?window=1h", nil, &trending)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []entity.TagCount{{Tag: "sunset", PhotoCount: 2}, {Tag: "beach", PhotoCount: 1}}, trending.Items)
+	assert.False(t, trending.Since.IsZero())
+
+	for _, url := range []string{"/tags/trending?window=forever", "/tags/trending?window=8760h", "/tags/trending?limit=0", "/tags/no-tag!/photos", "/photos?tag=%23"} {
+		code = doJson(t, r, owner, http.MethodGet, url, nil, nil)
+		assert.Equal(t, http.StatusBadRequest, code, url)
+	}
+	code = doJson(t, r, owner, http.MethodPost, "/tags/trending", nil, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
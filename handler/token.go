@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"mygram/database"
+	"mygram/entity"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+func accessTokenTTL() time.Duration {
+	if Config.AccessTokenMinutes > 0 {
+		return time.Duration(Config.AccessTokenMinutes) * time.Minute
+	}
+	return defaultAccessTokenTTL
+}
+
+func refreshTokenTTL() time.Duration {
+	if Config.RefreshTokenMinutes > 0 {
+		return time.Duration(Config.RefreshTokenMinutes) * time.Minute
+	}
+	return defaultRefreshTokenTTL
+}
+
+// randomToken returns n random bytes hex encoded.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken is what gets stored for a refresh token, so a leaked table can't be replayed.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newAccessToken(ctx context.Context, userID int64) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	gen, err := database.Revocations.GetTokenGeneration(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	user, err := database.SqlDatabase.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := entity.MyClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(accessTokenTTL()).Unix(),
+		},
+		Uid:  userID,
+		Gen:  gen,
+		Role: user.Role,
+	}
+
+	token := jwt.NewWithClaims(
+		JWT_SIGNING_METHOD,
+		claims,
+	)
+	return token.SignedString([]byte(Config.SecretKey))
+}
+
+// issueTokenPair creates an access token and a new refresh token in familyID.
+// An empty familyID starts a new family, which is what a login does.
+func issueTokenPair(ctx context.Context, userID int64, familyID string) (*entity.TokenPair, error) {
+	accessToken, err := newAccessToken(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if familyID == "" {
+		familyID, err = randomToken(16)
+		if err != nil {
+			return nil, err
+		}
+	}
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	_, err = database.SqlDatabase.PostRefreshToken(ctx, entity.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(refreshTokenTTL()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.TokenPair{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTokenTTL().Seconds()),
+	}, nil
+}
@@ -11,7 +11,6 @@ import (
 	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/golang-jwt/jwt"
 	"github.com/gorilla/mux"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -20,6 +19,10 @@ type UserHandler struct{}
 
 func InstallUsersHandler(r *mux.Router) {
 	api := UserHandler{}
+	r.HandleFunc("/users/by-username/{username}", api.UserByUsernameHandler)
+	r.HandleFunc("/users/{id}/follow", api.FollowHandler)
+	r.HandleFunc("/users/{id}/followers", api.FollowersHandler)
+	r.HandleFunc("/users/{id}/following", api.FollowingHandler)
 	r.HandleFunc("/users/{action}", api.UsersHandler)
 	r.HandleFunc("/users", api.UsersHandler).Queries("userId", "{userId}").Methods("PUT")
 	r.HandleFunc("/users", api.UsersHandler)
@@ -38,14 +41,32 @@ func (h *UserHandler) UsersHandler(w http.ResponseWriter, r *http.Request) {
 	action := params["action"]
 
 	switch r.Method {
+	case http.MethodGet:
+		if action == "me" {
+			getMeHandler(w, r)
+		} else if action != "" {
+			getUserHandler(w, r, action)
+		} else {
+			WriteJsonResp(w, ErrorNotFound, "PAGE NOT FOUND")
+		}
 	case http.MethodPost:
 		if action == "login" {
 			loginUserHandler(w, r)
 		} else if action == "register" {
 			registerUsersHandler(w, r)
+		} else if action == "refresh" {
+			refreshTokenHandler(w, r)
+		} else if action == "logout" {
+			logoutHandler(w, r)
+		} else if action == "logout-all" {
+			logoutAllHandler(w, r)
 		}
 	case http.MethodPut:
-		updateUserHandler(w, r)
+		if action == "role" {
+			updateUserRoleHandler(w, r)
+		} else {
+			updateUserHandler(w, r)
+		}
 	case http.MethodDelete:
 		deleteUserHandler(w, r)
 	default:
@@ -54,6 +75,115 @@ func (h *UserHandler) UsersHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// UserByUsernameHandler
+// Method: GET
+// Example: localhost/users/by-username/deadapeipit
+func (h *UserHandler) UserByUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteJsonResp(w, ErrorNotFound, "PAGE NOT FOUND")
+		return
+	}
+	ctx := r.Context()
+
+	retVal, err := database.SqlDatabase.GetUserProfileByUsername(ctx, mux.Vars(r)["username"])
+	if err != nil {
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success, retVal)
+}
+
+// FollowersHandler
+// Method: GET
+// Example: localhost/users/1/followers?limit=20&cursor=<next_cursor of the previous page>
+func (h *UserHandler) FollowersHandler(w http.ResponseWriter, r *http.Request) {
+	writeNestedPage(w, r, database.SqlDatabase.GetFollowers)
+}
+
+// FollowingHandler
+// Method: GET
+// Example: localhost/users/1/following?limit=20&cursor=<next_cursor of the previous page>
+func (h *UserHandler) FollowingHandler(w http.ResponseWriter, r *http.Request) {
+	writeNestedPage(w, r, database.SqlDatabase.GetFollowing)
+}
+
+// FollowHandler follows the user on POST and unfollows them on DELETE. Both
+// may be repeated.
+// Method: POST, DELETE
+// Example: localhost/users/1/follow
+func (h *UserHandler) FollowHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var follow func(ctx context.Context, userid int64, followeeid int64) (*entity.UserFollows, error)
+	switch r.Method {
+	case http.MethodPost:
+		follow = database.SqlDatabase.FollowUser
+	case http.MethodDelete:
+		follow = database.SqlDatabase.UnfollowUser
+	default:
+		WriteJsonResp(w, ErrorNotFound, "PAGE NOT FOUND")
+		return
+	}
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
+	idInt, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		WriteJsonResp(w, ErrorNotFound, "NOT FOUND")
+		return
+	}
+
+	retVal, err := follow(ctx, logonUser.ID, idInt)
+	if err != nil {
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success, retVal)
+}
+
+// getUserHandler
+// Method: GET
+// Example: localhost/users/1
+func getUserHandler(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+	idInt, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		WriteJsonResp(w, ErrorNotFound, "NOT FOUND")
+		return
+	}
+
+	retVal, err := database.SqlDatabase.GetUserProfile(ctx, idInt)
+	if err != nil {
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success, retVal)
+}
+
+// getMeHandler
+// Method: GET
+// Example: localhost/users/me
+func getMeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
+
+	profile, err := database.SqlDatabase.GetUserProfile(ctx, logonUser.ID)
+	if err != nil {
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success, logonUser.ToUserPrivateProfile(*profile))
+}
+
 // loginUserHandler
 // Method: POST
 // Example: localhost/login
@@ -63,7 +193,7 @@ func (h *UserHandler) UsersHandler(w http.ResponseWriter, r *http.Request) {
 // 	"password": "password"
 // }
 func loginUserHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := r.Context()
 
 	decoder := json.NewDecoder(r.Body)
 	var inp entity.UserLogin
@@ -72,6 +202,11 @@ func loginUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	id, pw, err := database.SqlDatabase.Login(ctx, inp.Email)
+	if errors.Is(err, database.ErrNotFound) {
+		// Same answer as a wrong password, so emails can't be probed.
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
 	if err != nil {
 		WriteJsonResp(w, ErrorDataHandleError, err.Error())
 		return
@@ -82,24 +217,157 @@ func loginUserHandler(w http.ResponseWriter, r *http.Request) {
 		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
 		return
 	}
-	claims := entity.MyClaims{
-		Iat: int(time.Now().UnixMilli()),
-		Exp: int(time.Now().Add(time.Second * time.Duration(60)).UnixMilli()),
-		Uid: id,
+	retVal, err := issueTokenPair(ctx, id, "")
+	if err != nil {
+		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		return
 	}
+	WriteJsonResp(w, Success, retVal)
+}
 
-	token := jwt.NewWithClaims(
-		JWT_SIGNING_METHOD,
-		claims,
-	)
+// refreshTokenHandler
+// Method: POST
+// Example: localhost/users/refresh
+// JSON Body:
+// {
+// 	"refresh_token": "refresh token from login"
+// }
+func refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	validate := validator.New()
+	decoder := json.NewDecoder(r.Body)
+	var inp entity.TokenRefresh
+	if err := decoder.Decode(&inp); err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
+	err := validate.Struct(inp)
+	if err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
+
+	t, err := database.SqlDatabase.GetRefreshToken(ctx, hashToken(inp.RefreshToken))
+	if errors.Is(err, database.ErrNotFound) {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
+	if err != nil {
+		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		return
+	}
+	if time.Now().After(t.ExpiresAt) {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
 
-	tokenVal, err := token.SignedString([]byte(Config.SecretKey))
+	// Rotate: the presented token is spent. If it was already spent someone
+	// is replaying it, so the whole family is revoked.
+	active, err := database.SqlDatabase.RevokeRefreshToken(ctx, t.ID)
 	if err != nil {
-		WriteJsonResp(w, ErrorBadRequest, "BAD_REQUEST")
+		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		return
+	}
+	if !active {
+		if err := database.SqlDatabase.RevokeRefreshTokenFamily(ctx, t.FamilyID); err != nil {
+			WriteJsonResp(w, ErrorDataHandleError, err.Error())
+			return
+		}
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
 		return
 	}
+
+	retVal, err := issueTokenPair(ctx, t.UserID, t.FamilyID)
+	if errors.Is(err, database.ErrNotFound) {
+		// The user was deleted meanwhile.
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
+	if err != nil {
+		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		return
+	}
+	WriteJsonResp(w, Success, retVal)
+}
+
+// logoutHandler
+// Method: POST
+// Example: localhost/users/logout
+// JSON Body (optional, also ends the refresh token family):
+// {
+// 	"refresh_token": "refresh token from login"
+// }
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
+	claims, ok := TokenClaimsFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
+
+	var inp entity.TokenRefresh
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&inp); err != nil {
+			WriteJsonResp(w, ErrorBadRequest, err.Error())
+			return
+		}
+	}
+
+	err := database.Revocations.RevokeToken(ctx, claims.Id, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		return
+	}
+	if inp.RefreshToken != "" {
+		t, err := database.SqlDatabase.GetRefreshToken(ctx, hashToken(inp.RefreshToken))
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			WriteJsonResp(w, ErrorDataHandleError, err.Error())
+			return
+		}
+		if err == nil && t.UserID == logonUser.ID {
+			if err := database.SqlDatabase.RevokeRefreshTokenFamily(ctx, t.FamilyID); err != nil {
+				WriteJsonResp(w, ErrorDataHandleError, err.Error())
+				return
+			}
+		}
+	}
+
+	retVal := map[string]string{
+		"message": "You have been logged out",
+	}
+	WriteJsonResp(w, Success, retVal)
+}
+
+// logoutAllHandler
+// Method: POST
+// Example: localhost/users/logout-all
+func logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
+
+	_, err := database.Revocations.IncrementTokenGeneration(ctx, logonUser.ID)
+	if err != nil {
+		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		return
+	}
+	err = database.SqlDatabase.RevokeUserRefreshTokens(ctx, logonUser.ID)
+	if err != nil {
+		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		return
+	}
+
 	retVal := map[string]string{
-		"token": tokenVal,
+		"message": "All your sessions have been logged out",
 	}
 	WriteJsonResp(w, Success, retVal)
 }
@@ -115,7 +383,7 @@ func loginUserHandler(w http.ResponseWriter, r *http.Request) {
 //		"age": 22
 // }
 func registerUsersHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := r.Context()
 	validate := validator.New()
 	decoder := json.NewDecoder(r.Body)
 	var inp entity.UserRegister
@@ -138,7 +406,7 @@ func registerUsersHandler(w http.ResponseWriter, r *http.Request) {
 
 	users, err := database.SqlDatabase.Register(ctx, inp)
 	if err != nil {
-		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		WriteDatabaseError(w, err)
 		return
 	}
 	WriteJsonResp(w, Success201, users)
@@ -153,7 +421,12 @@ func registerUsersHandler(w http.ResponseWriter, r *http.Request) {
 //		"email": "user@email.com"
 // }
 func updateUserHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
 	vars := mux.Vars(r)
 	userid := vars["userId"]
 	id, err := strconv.ParseInt(userid, 10, 64)
@@ -161,7 +434,7 @@ func updateUserHandler(w http.ResponseWriter, r *http.Request) {
 		WriteJsonResp(w, ErrorBadRequest, err.Error())
 		return
 	}
-	if id != LogonUser.ID {
+	if !Authorize(logonUser, ActionUpdate, ResourceUser, id) {
 		WriteJsonResp(w, ErrorBadRequest, errors.New("wrong ID").Error())
 		return
 	}
@@ -180,7 +453,7 @@ func updateUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	users, err := database.SqlDatabase.UpdateUser(ctx, id, inp.Email, inp.Username)
 	if err != nil {
-		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		WriteDatabaseError(w, err)
 		return
 	}
 	retVal := users.ToUserUpdateOutput()
@@ -188,17 +461,85 @@ func updateUserHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// updateUserRoleHandler
+// Method: PUT
+// Example: localhost/users/role?userId=1
+// JSON Body:
+// {
+//		"role": "moderator"
+// }
+func updateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
+	id, err := strconv.ParseInt(r.URL.Query().Get("userId"), 10, 64)
+	if err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
+	if !Authorize(logonUser, ActionChangeRole, ResourceUser, id) {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	validate := validator.New()
+	var inp entity.UserRoleUpdate
+	if err := decoder.Decode(&inp); err != nil {
+		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		return
+	}
+	err = validate.Struct(inp)
+	if err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
+	users, err := database.SqlDatabase.UpdateUserRole(ctx, id, inp.Role)
+	if err != nil {
+		WriteDatabaseError(w, err)
+		return
+	}
+	retVal := users.ToUserRoleOutput()
+	WriteJsonResp(w, Success, retVal)
+}
+
 // deleteUserHandler
 // Method: DELETE
 // Example: localhost/users
+// Example (admin): localhost/users?userId=1
 func deleteUserHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	id := LogonUser.ID
-	users, err := database.SqlDatabase.DeleteUser(ctx, id)
+	ctx := r.Context()
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
+	id := logonUser.ID
+	if userid := r.URL.Query().Get("userId"); userid != "" {
+		var err error
+		id, err = strconv.ParseInt(userid, 10, 64)
+		if err != nil {
+			WriteJsonResp(w, ErrorBadRequest, err.Error())
+			return
+		}
+	}
+	if !Authorize(logonUser, ActionDelete, ResourceUser, id) {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return
+	}
+	users, photoURLs, err := database.SqlDatabase.DeleteUser(ctx, id)
 	if err != nil {
-		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		WriteDatabaseError(w, err)
 		return
 	}
+	for _, url := range photoURLs {
+		if key, ok := mediaKey(url); ok {
+			deleteUpload(ctx, key)
+		}
+	}
 	retVal := map[string]string{
 		"message": users,
 	}
@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mygram/database"
+	"mygram/entity"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useMemoryDatabase points the handlers at a fresh in-memory store for one test.
+func useMemoryDatabase(t *testing.T) database.DatabaseIface {
+	Config.SecretKey = "secret"
+	db := database.NewMemoryDatabase()
+	database.SqlDatabase = db
+	database.Revocations = db
+	t.Cleanup(func() {
+		database.SqlDatabase = nil
+		database.Revocations = nil
+	})
+	return db
+}
+
+func registerUser(t *testing.T, db database.DatabaseIface, username string, password string) *entity.User {
+	hash, err := EncryptPassword(password)
+	require.NoError(t, err)
+	u, err := db.Register(context.Background(), entity.UserRegister{Username: username, Email: username + "@email.com", Password: hash, Age: 20})
+	require.NoError(t, err)
+	user, err := db.GetUserByID(context.Background(), int64(u.ID))
+	require.NoError(t, err)
+	return user
+}
+
+// doJson sends body as JSON, as user when it is not nil, and decodes the data of the response into out.
+func doJson(t *testing.T, r http.Handler, user *entity.User, method string, url string, body interface{}, out interface{}) int {
+	b, err := json.Marshal(body)
+	require.NoError(t, err)
+	req := httptest.NewRequest(method, url, bytes.NewReader(b))
+	if user != nil {
+		req = req.WithContext(WithLogonUser(req.Context(), user))
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if out != nil {
+		resp := response{Data: out}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	}
+	return rec.Code
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	db := useMemoryDatabase(t)
+	registerUser(t, db, "user", "password")
+	r := mux.NewRouter()
+	InstallUsersHandler(r)
+
+	var login entity.TokenPair
+	code := doJson(t, r, nil, http.MethodPost, "/users/login", entity.UserLogin{Email: "user@email.com", Password: "password"}, &login)
+	require.Equal(t, http.StatusOK, code)
+	assert.NotEmpty(t, login.Token)
+	assert.NotEmpty(t, login.RefreshToken)
+
+	var refreshed entity.TokenPair
+	code = doJson(t, r, nil, http.MethodPost, "/users/refresh", entity.TokenRefresh{RefreshToken: login.RefreshToken}, &refreshed)
+	require.Equal(t, http.StatusOK, code)
+	assert.NotEqual(t, login.RefreshToken, refreshed.RefreshToken)
+
+	// replaying the spent token revokes the family, including the token just issued
+	code = doJson(t, r, nil, http.MethodPost, "/users/refresh", entity.TokenRefresh{RefreshToken: login.RefreshToken}, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code = doJson(t, r, nil, http.MethodPost, "/users/refresh", entity.TokenRefresh{RefreshToken: refreshed.RefreshToken}, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code = doJson(t, r, nil, http.MethodPost, "/users/refresh", entity.TokenRefresh{RefreshToken: "unknown"}, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// the token of a user deleted since is refused too
+	_, err := db.PostRefreshToken(context.Background(), entity.RefreshToken{UserID: 1000, FamilyID: "gone", TokenHash: hashToken("orphan"), ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	code = doJson(t, r, nil, http.MethodPost, "/users/refresh", entity.TokenRefresh{RefreshToken: "orphan"}, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestRegisterAndLoginErrors(t *testing.T) {
+	db := useMemoryDatabase(t)
+	registerUser(t, db, "user", "password")
+	r := mux.NewRouter()
+	InstallUsersHandler(r)
+
+	code := doJson(t, r, nil, http.MethodPost, "/users/register", entity.UserRegister{Username: "user", Email: "user@email.com", Password: "password", Age: 20}, nil)
+	assert.Equal(t, http.StatusConflict, code)
+
+	code = doJson(t, r, nil, http.MethodPost, "/users/login", entity.UserLogin{Email: "nobody@email.com", Password: "password"}, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestUserRoleHandler(t *testing.T) {
+	db := useMemoryDatabase(t)
+	user := registerUser(t, db, "user", "password")
+	admin := registerUser(t, db, "admin", "password")
+	_, err := db.UpdateUserRole(context.Background(), admin.ID, entity.RoleAdmin)
+	require.NoError(t, err)
+	admin.Role = entity.RoleAdmin
+	r := mux.NewRouter()
+	InstallUsersHandler(r)
+
+	code := doJson(t, r, user, http.MethodPut, "/users/role?userId=1", entity.UserRoleUpdate{Role: entity.RoleAdmin}, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	var out entity.UserRoleOutput
+	code = doJson(t, r, admin, http.MethodPut, "/users/role?userId=1", entity.UserRoleUpdate{Role: entity.RoleModerator}, &out)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, entity.RoleModerator, out.Role)
+
+	code = doJson(t, r, admin, http.MethodPut, "/users/role?userId=1", map[string]string{"role": "owner"}, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestUserProfileHandlers(t *testing.T) {
+	db := useMemoryDatabase(t)
+	owner := registerUser(t, db, "owner", "password")
+	other := registerUser(t, db, "other", "password")
+	r := mux.NewRouter()
+	InstallUsersHandler(r)
+	InstallPhotosHandler(r)
+	InstallSocialMediaHandler(r)
+	code := doJson(t, r, owner, http.MethodPost, "/photos", entity.PhotoPost{Title: "title", PhotoUrl: "https://photo.domain.com"}, nil)
+	require.Equal(t, http.StatusCreated, code)
+	code = doJson(t, r, owner, http.MethodPost, "/socialmedias", entity.SocialMediaPost{Name: "github", SocialMediaURL: "https://github.com/owner"}, nil)
+	require.Equal(t, http.StatusCreated, code)
+
+	var profile map[string]interface{}
+	code = doJson(t, r, other, http.MethodGet, fmt.Sprintf("/users/%d", owner.ID), nil, &profile)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "owner", profile["username"])
+	assert.Equal(t, float64(1), profile["photo_count"])
+	assert.Len(t, profile["social_medias"], 1)
+	assert.NotContains(t, profile, "email")
+	assert.NotContains(t, profile, "password")
+
+	var byName entity.UserProfile
+	code = doJson(t, r, other, http.MethodGet, "/users/by-username/owner", nil, &byName)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, owner.ID, byName.ID)
+	assert.True(t, owner.CreatedAt.Equal(byName.JoinedAt))
+
+	var me map[string]interface{}
+	code = doJson(t, r, owner, http.MethodGet, "/users/me", nil, &me)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "owner@email.com", me["email"])
+	assert.Equal(t, float64(1), me["photo_count"])
+	assert.Equal(t, "user", me["role"])
+	assert.NotContains(t, me, "password")
+
+	for _, url := range []string{"/users/99", "/users/nobody", "/users/by-username/nobody"} {
+		code = doJson(t, r, other, http.MethodGet, url, nil, nil)
+		assert.Equal(t, http.StatusNotFound, code, url)
+	}
+	code = doJson(t, r, nil, http.MethodGet, "/users/me", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestFollowHandlers(t *testing.T) {
+	db := useMemoryDatabase(t)
+	star := registerUser(t, db, "star", "password")
+	fan := registerUser(t, db, "fan", "password")
+	r := mux.NewRouter()
+	InstallUsersHandler(r)
+	follow := fmt.Sprintf("/users/%d/follow", star.ID)
+
+	var follows entity.UserFollows
+	for i := 0; i < 2; i++ {
+		code := doJson(t, r, fan, http.MethodPost, follow, nil, &follows)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, int64(1), follows.FollowerCount)
+		assert.True(t, follows.FollowedByMe)
+	}
+
+	var list pageOutput[entity.FollowGetOutput]
+	code := doJson(t, r, nil, http.MethodGet, fmt.Sprintf("/users/%d/followers", star.ID), nil, &list)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, "fan", list.Items[0].Username)
+	code = doJson(t, r, nil, http.MethodGet, fmt.Sprintf("/users/%d/following", fan.ID), nil, &list)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, "star", list.Items[0].Username)
+
+	var profile entity.UserProfile
+	code = doJson(t, r, fan, http.MethodGet, fmt.Sprintf("/users/%d", star.ID), nil, &profile)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(1), profile.FollowerCount)
+
+	code = doJson(t, r, fan, http.MethodDelete, follow, nil, &follows)
+	require.Equal(t, http.StatusOK, code)
+	assert.Zero(t, follows.FollowerCount)
+	assert.False(t, follows.FollowedByMe)
+
+	assert.Equal(t, http.StatusBadRequest, doJson(t, r, star, http.MethodPost, follow, nil, nil))
+	assert.Equal(t, http.StatusUnauthorized, doJson(t, r, nil, http.MethodPost, follow, nil, nil))
+	assert.Equal(t, http.StatusNotFound, doJson(t, r, fan, http.MethodPost, "/users/99/follow", nil, nil))
+	assert.Equal(t, http.StatusNotFound, doJson(t, r, fan, http.MethodGet, "/users/99/followers", nil, nil))
+}
@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"mygram/database"
+	"mygram/entity"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type WebhookHandler struct{}
+
+// InstallWebhookHandler installs the management of webhooks, which is for
+// admins only.
+func InstallWebhookHandler(r *mux.Router) {
+	api := WebhookHandler{}
+	r.HandleFunc("/webhooks/deliveries/{id}/retry", api.RetryDeliveryHandler)
+	r.HandleFunc("/webhooks/{id}/deadletters", api.DeadLettersHandler)
+	r.HandleFunc("/webhooks/{id}", api.WebhooksHandler)
+	r.HandleFunc("/webhooks", api.WebhooksHandler)
+}
+
+func (h *WebhookHandler) WebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	switch {
+	case r.Method == http.MethodGet && id != "":
+		getWebhookHandler(w, r, id)
+	case r.Method == http.MethodGet:
+		getWebhooksHandler(w, r)
+	case r.Method == http.MethodPost && id == "":
+		postWebhookHandler(w, r)
+	case r.Method == http.MethodDelete && id != "":
+		deleteWebhookHandler(w, r, id)
+	default:
+		WriteJsonResp(w, ErrorNotFound, "PAGE NOT FOUND")
+	}
+}
+
+// authorizeWebhooks tells whether the logon user may manage webhooks, and
+// answers the request when not.
+func authorizeWebhooks(w http.ResponseWriter, ctx context.Context) bool {
+	logonUser, ok := LogonUserFromContext(ctx)
+	if !ok || !Authorize(logonUser, ActionManage, ResourceWebhook, 0) {
+		WriteJsonResp(w, ErrorUnauthorized, "UNAUTHORIZED")
+		return false
+	}
+	return true
+}
+
+// getWebhooksHandler
+// Method: GET
+// Example: localhost/webhooks?limit=20&cursor=<next_cursor of the previous page>
+func getWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !authorizeWebhooks(w, ctx) {
+		return
+	}
+	page, err := pageRequest(r)
+	if err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
+
+	retVal, err := database.SqlDatabase.GetWebhooks(ctx, page)
+	if err != nil {
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success, newPageOutput(r, retVal))
+}
+
+// getWebhookHandler
+// Method: GET
+// Example: localhost/webhooks/1
+func getWebhookHandler(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+	if !authorizeWebhooks(w, ctx) {
+		return
+	}
+	idInt, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		WriteJsonResp(w, ErrorNotFound, "NOT FOUND")
+		return
+	}
+
+	retVal, err := database.SqlDatabase.GetWebhookByID(ctx, idInt)
+	if err != nil {
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success, retVal)
+}
+
+// postWebhookHandler subscribes url to events. The answer carries the secret
+// the deliveries are signed with; it is never shown again.
+// Method: POST
+// Example: localhost/webhooks
+// JSON Body:
+// {
+// 	"url": "https://partner.com/mygram",
+// 	"events": ["photo.created", "photo.deleted"]
+// }
+func postWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !authorizeWebhooks(w, ctx) {
+		return
+	}
+	logonUser, _ := LogonUserFromContext(ctx)
+
+	validate := validator.New()
+	decoder := json.NewDecoder(r.Body)
+	var inp entity.WebhookPost
+	if err := decoder.Decode(&inp); err != nil {
+		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		return
+	}
+	if err := validate.Struct(inp); err != nil {
+		WriteJsonResp(w, ErrorBadRequest, err.Error())
+		return
+	}
+	for _, t := range inp.Events {
+		if !t.Valid() {
+			WriteJsonResp(w, ErrorBadRequest, "unknown event "+strconv.Quote(string(t)))
+			return
+		}
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		WriteJsonResp(w, ErrorDataHandleError, err.Error())
+		return
+	}
+
+	retVal, err := database.SqlDatabase.PostWebhook(ctx, logonUser.ID, inp, secret)
+	if err != nil {
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success201, retVal)
+}
+
+// deleteWebhookHandler deletes a webhook, along with what it has not been
+// sent yet.
+// Method: DELETE
+// Example: localhost/webhooks/1
+func deleteWebhookHandler(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+	if !authorizeWebhooks(w, ctx) {
+		return
+	}
+	idInt, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		WriteJsonResp(w, ErrorNotFound, "NOT FOUND")
+		return
+	}
+
+	msg, err := database.SqlDatabase.DeleteWebhook(ctx, idInt)
+	if err != nil {
+		WriteDatabaseError(w, err)
+		return
+	}
+	retVal := map[string]string{
+		"message": msg,
+	}
+	WriteJsonResp(w, Success, retVal)
+}
+
+// DeadLettersHandler is the dead-letter list of a webhook: the deliveries it
+// failed too often, oldest first.
+// Method: GET
+// Example: localhost/webhooks/1/deadletters?limit=20&cursor=<next_cursor of the previous page>
+func (h *WebhookHandler) DeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && !authorizeWebhooks(w, r.Context()) {
+		return
+	}
+	writeNestedPage(w, r, func(ctx context.Context, id int64, page entity.PageRequest) (*entity.Page[entity.WebhookDelivery], error) {
+		return database.SqlDatabase.GetWebhookDeliveries(ctx, id, entity.DeliveryDead, page)
+	})
+}
+
+// RetryDeliveryHandler takes a delivery off the dead-letter list, to be sent
+// again with a fresh set of attempts.
+// Method: POST
+// Example: localhost/webhooks/deliveries/1/retry
+func (h *WebhookHandler) RetryDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteJsonResp(w, ErrorNotFound, "PAGE NOT FOUND")
+		return
+	}
+	ctx := r.Context()
+	if !authorizeWebhooks(w, ctx) {
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		WriteJsonResp(w, ErrorNotFound, "NOT FOUND")
+		return
+	}
+
+	retVal, err := database.SqlDatabase.RetryWebhookDelivery(ctx, id)
+	if err != nil {
+		WriteDatabaseError(w, err)
+		return
+	}
+
+	WriteJsonResp(w, Success, retVal)
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"mygram/entity"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookHandlers(t *testing.T) {
+	ctx := context.Background()
+	db := useMemoryDatabase(t)
+	user := registerUser(t, db, "user", "password")
+	admin := registerUser(t, db, "admin", "password")
+	_, err := db.UpdateUserRole(ctx, admin.ID, entity.RoleAdmin)
+	require.NoError(t, err)
+	admin.Role = entity.RoleAdmin
+	r := mux.NewRouter()
+	InstallPhotosHandler(r)
+	InstallWebhookHandler(r)
+	inp := entity.WebhookPost{URL: "https://partner.example.com/hook", Events: []entity.WebhookEventType{entity.EventPhotoCreated}}
+
+	// only admins manage webhooks
+	code := doJson(t, r, user, http.MethodPost, "/webhooks", inp, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code = doJson(t, r, nil, http.MethodGet, "/webhooks", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code = doJson(t, r, user, http.MethodGet, "/webhooks/1/deadletters", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	for _, bad := range []entity.WebhookPost{
+		{URL: "not a url", Events: inp.Events},
+		{URL: inp.URL},
+		{URL: inp.URL, Events: []entity.WebhookEventType{"photo.liked"}},
+	} {
+		code = doJson(t, r, admin, http.MethodPost, "/webhooks", bad, nil)
+		assert.Equal(t, http.StatusBadRequest, code, bad)
+	}
+
+	var hook entity.Webhook
+	code = doJson(t, r, admin, http.MethodPost, "/webhooks", inp, &hook)
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, admin.ID, hook.UserID)
+	assert.Equal(t, inp.Events, hook.Events)
+	assert.Regexp(t, "^[0-9a-f]{64}$", hook.Secret)
+
+	// the secret is shown once
+	var got entity.Webhook
+	code = doJson(t, r, admin, http.MethodGet, fmt.Sprintf("/webhooks/%d", hook.ID), nil, &got)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, inp.URL, got.URL)
+	assert.Empty(t, got.Secret)
+	var hooks pageOutput[entity.Webhook]
+	code = doJson(t, r, admin, http.MethodGet, "/webhooks", nil, &hooks)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, hooks.Items, 1)
+	assert.Empty(t, hooks.Items[0].Secret)
+
+	// a delivery that failed too often is on the dead-letter list until retried
+	code = doJson(t, r, user, http.MethodPost, "/photos", entity.PhotoPost{Title: "title", PhotoUrl: "https://photo.domain.com"}, nil)
+	require.Equal(t, http.StatusCreated, code)
+	now := time.Now()
+	_, err = db.DispatchOutbox(ctx, now, 10)
+	require.NoError(t, err)
+	deliveries, err := db.ClaimWebhookDeliveries(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	d := deliveries[0]
+	d.Status, d.Attempts, d.LastStatus, d.LastError = entity.DeliveryDead, 8, 502, "502 Bad Gateway"
+	require.NoError(t, db.UpdateWebhookDelivery(ctx, d))
+
+	var dead pageOutput[entity.WebhookDelivery]
+	code = doJson(t, r, admin, http.MethodGet, fmt.Sprintf("/webhooks/%d/deadletters", hook.ID), nil, &dead)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, dead.Items, 1)
+	assert.Equal(t, d.ID, dead.Items[0].ID)
+	assert.Equal(t, "502 Bad Gateway", dead.Items[0].LastError)
+	assert.Equal(t, entity.EventPhotoCreated, dead.Items[0].Event.Type)
+	var retried entity.WebhookDelivery
+	code = doJson(t, r, admin, http.MethodPost, fmt.Sprintf("/webhooks/deliveries/%d/retry", d.ID), nil, &retried)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, entity.DeliveryPending, retried.Status)
+	assert.Equal(t, 0, retried.Attempts)
+	code = doJson(t, r, admin, http.MethodPost, fmt.Sprintf("/webhooks/deliveries/%d/retry", d.ID), nil, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+	code = doJson(t, r, admin, http.MethodGet, fmt.Sprintf("/webhooks/deliveries/%d/retry", d.ID), nil, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code = doJson(t, r, admin, http.MethodDelete, fmt.Sprintf("/webhooks/%d", hook.ID), nil, nil)
+	require.Equal(t, http.StatusOK, code)
+	code = doJson(t, r, admin, http.MethodGet, fmt.Sprintf("/webhooks/%d", hook.ID), nil, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+	code = doJson(t, r, admin, http.MethodGet, fmt.Sprintf("/webhooks/%d/deadletters", hook.ID), nil, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+	code = doJson(t, r, admin, http.MethodDelete, "/webhooks", nil, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
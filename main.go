@@ -1,37 +1,84 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"mygram/database"
 	"mygram/handler"
 	"mygram/middleware"
+	"mygram/storage"
+	"mygram/thumbnail"
+	"mygram/webhook"
 	"net/http"
+	"os"
+	"runtime"
 	"time"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
+	driver := flag.String("driver", "", "database driver: sqlserver, postgres, sqlite or memory (overrides the config file)")
+	flag.Parse()
 
-	handler.ParseConfig()
-	sql := database.NewSqlConnection(handler.GetConnectionString())
+	if err := handler.ParseConfig(); err != nil {
+		log.Fatal(err)
+	}
+	if *driver != "" {
+		// e.g. `mygram -driver memory` runs a demo server without any database
+		handler.Config.ConnectionString.Driver = *driver
+	}
+	sql, err := database.NewConnection(handler.Config.ConnectionString.Driver, handler.GetConnectionString())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		code := runMigrate(sql, args[1:])
+		sql.CloseConnection()
+		os.Exit(code)
+	}
+	if err := checkSchema(sql); err != nil {
+		log.Fatal(err)
+	}
 	database.SqlDatabase = sql
+	database.Revocations = sql
+	blobs, err := handler.NewBlobStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+	storage.Blobs = blobs
+	thumbnail.Queue = handler.NewThumbnailPool(runtime.NumCPU(), 64)
+	go func() {
+		if err := handler.QueueProcessingPhotos(context.Background()); err != nil {
+			log.Printf("queueing processing photos: %v", err)
+		}
+	}()
 	defer sql.CloseConnection()
+	go webhook.NewDispatcher(sql).Run(context.Background())
 
 	r := mux.NewRouter()
 	handler.InstallUsersHandler(r)
 	handler.InstallPhotosHandler(r)
 	handler.InstallCommentHandler(r)
 	handler.InstallSocialMediaHandler(r)
+	handler.InstallTagHandler(r)
+	handler.InstallNotificationHandler(r)
+	handler.InstallStreamHandler(r)
+	handler.InstallWebhookHandler(r)
+	handler.InstallMediaHandler(r)
+	r.Use(middleware.WriteTimeout(15*time.Second, handler.StreamRoute, handler.MediaRoute))
 	r.Use(middleware.SecureMiddleware)
 
 	srv := &http.Server{
 		Handler: r,
 		Addr:    "127.0.0.1:8000",
-		// Good practice: enforce timeouts for servers you create!
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
+		// Good practice: enforce timeouts for servers you create! Writes are
+		// bounded per route by middleware.WriteTimeout instead of here, which
+		// would cut GET /stream and large downloads off.
+		ReadTimeout: 15 * time.Second,
+		IdleTimeout: 60 * time.Second,
 	}
 	fmt.Printf(" http://%s \n", srv.Addr)
 
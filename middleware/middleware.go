@@ -1,20 +1,29 @@
 package middleware
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"mygram/database"
+	"mygram/entity"
 	h "mygram/handler"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
 )
 
+// publicPaths are reached without a token: that is how one is got.
+var publicPaths = map[string]bool{
+	"/users/login":    true,
+	"/users/register": true,
+	"/users/refresh":  true,
+}
+
 func SecureMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.Contains(r.URL.Path, "/login") ||
-			strings.Contains(r.URL.Path, "/register") {
+		if publicPaths[r.URL.Path] || strings.HasPrefix(r.URL.Path, "/media/") {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -38,7 +47,7 @@ func SecureMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		token, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
+		token, err := jwt.ParseWithClaims(accessToken, &entity.MyClaims{}, func(token *jwt.Token) (interface{}, error) {
 			if method, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, fmt.Errorf("signing method invalid")
 			} else if method != h.JWT_SIGNING_METHOD {
@@ -49,31 +58,81 @@ func SecureMiddleware(next http.Handler) http.Handler {
 		})
 		if err != nil {
 			e, ok := err.(*jwt.ValidationError)
-			if !ok || ok && e.Errors&jwt.ValidationErrorIssuedAt == 0 { // Don't report error that token used before issued.
+			if ok && e.Errors&jwt.ValidationErrorExpired != 0 {
+				// Clients are expected to come back through /users/refresh.
+				h.WriteJsonResp(w, h.ErrorUnauthorized, "TOKEN EXPIRED")
+				return
+			}
+			if !ok || e.Errors&^jwt.ValidationErrorIssuedAt != 0 { // Don't report error that token used before issued.
 				h.WriteJsonResp(w, h.ErrorBadRequest, "BAD REQUEST")
 				return
 			}
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok { //|| !token.Valid {
+		claims, ok := token.Claims.(*entity.MyClaims)
+		if !ok {
 			h.WriteJsonResp(w, h.ErrorBadRequest, "BAD REQUEST")
 			return
 		}
+		// Tokens issued before revocation have no jti to revoke them by and
+		// an exp in milliseconds, which would read as never expiring.
+		if claims.Id == "" || claims.ExpiresAt == 0 {
+			h.WriteJsonResp(w, h.ErrorUnauthorized, "UNAUTHORIZED")
+			return
+		}
 
-		uid := claims["uid"].(float64)
+		userID := claims.Uid
 
-		userID := int64(uid)
+		revoked, err := database.Revocations.IsTokenRevoked(r.Context(), claims.Id)
+		if err != nil {
+			h.WriteJsonResp(w, h.ErrorDataHandleError, err.Error())
+			return
+		}
+		gen, err := database.Revocations.GetTokenGeneration(r.Context(), userID)
+		if err != nil {
+			h.WriteJsonResp(w, h.ErrorDataHandleError, err.Error())
+			return
+		}
+		if revoked || claims.Gen < gen {
+			h.WriteJsonResp(w, h.ErrorUnauthorized, "TOKEN REVOKED")
+			return
+		}
 
-		l, err := database.SqlDatabase.GetUserByID(context.Background(), userID)
+		l, err := database.SqlDatabase.GetUserByID(r.Context(), userID)
+		if errors.Is(err, database.ErrNotFound) {
+			// The account was deleted after the token was issued.
+			h.WriteJsonResp(w, h.ErrorUnauthorized, "UNAUTHORIZED")
+			return
+		}
 		if err != nil {
 			h.WriteJsonResp(w, h.ErrorDataHandleError, err)
 			return
 		}
-		//Set logonuser
-		h.LogonUser = l
-		//fmt.Println(uid)
+		//Set logonuser on the request context
+		ctx := h.WithLogonUser(r.Context(), l)
+		ctx = h.WithTokenClaims(ctx, claims)
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// WriteTimeout gives every response d to be written, answering 503 when it
+// runs out, as http.Server's WriteTimeout would. The routes named streaming
+// are left alone, so they can stay open for as long as the client listens
+// or downloads, and write straight through instead of being buffered.
+func WriteTimeout(d time.Duration, streaming ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		limited := http.TimeoutHandler(next, d, `{"status":503,"data":"TIMEOUT"}`)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route := mux.CurrentRoute(r); route != nil {
+				for _, name := range streaming {
+					if route.GetName() == name {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+			limited.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mygram/database"
+	"mygram/entity"
+	h "mygram/handler"
+	"mygram/storage"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubDatabase implements only the calls made by the requests under test.
+type stubDatabase struct {
+	database.DatabaseIface
+}
+
+func (s *stubDatabase) GetUserByID(ctx context.Context, id int64) (*entity.User, error) {
+	return &entity.User{ID: id, Username: fmt.Sprintf("user%d", id)}, nil
+}
+
+func (s *stubDatabase) PostPhoto(ctx context.Context, userid int64, i entity.PhotoPost) (*entity.Photo, error) {
+	// give concurrent requests a chance to interleave
+	time.Sleep(time.Millisecond)
+	return &entity.Photo{ID: userid, Title: i.Title, PhotoUrl: i.PhotoUrl, UserID: userid}, nil
+}
+
+func (s *stubDatabase) RevokeUserRefreshTokens(ctx context.Context, userid int64) error {
+	return nil
+}
+
+func newToken(t *testing.T, uid int64) string {
+	claims := entity.MyClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        fmt.Sprintf("jti-%d-%d", uid, time.Now().UnixNano()),
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		},
+		Uid: uid,
+	}
+	token := jwt.NewWithClaims(h.JWT_SIGNING_METHOD, claims)
+	tokenVal, err := token.SignedString([]byte(h.Config.SecretKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenVal
+}
+
+func TestSecureMiddleware_ConcurrentUsers(t *testing.T) {
+	h.Config.SecretKey = "secret"
+	database.SqlDatabase = &stubDatabase{}
+	database.Revocations = database.NewMemoryRevocationStore()
+	defer func() { database.SqlDatabase = nil }()
+
+	r := mux.NewRouter()
+	h.InstallPhotosHandler(r)
+	r.Use(SecureMiddleware)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	// tokens are minted up front, as newToken may only fail the test from here
+	tokens := make([]string, 50)
+	for i := range tokens {
+		tokens[i] = newToken(t, int64(i%10+1))
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		uid, token := int64(i%10+1), tokens[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, _ := json.Marshal(entity.PhotoPost{Title: "title", PhotoUrl: "https://photo.domain.com"})
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+"/photos", bytes.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := http.DefaultClient.Do(req)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+
+			var out struct {
+				Status int                    `json:"status"`
+				Data   entity.PhotoPostOutput `json:"data"`
+			}
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+			assert.Equal(t, http.StatusCreated, out.Status)
+			assert.Equal(t, uid, out.Data.UserID)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSecureMiddleware_MissingToken(t *testing.T) {
+	r := mux.NewRouter()
+	h.InstallPhotosHandler(r)
+	r.Use(SecureMiddleware)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/photos", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestSecureMiddleware_LegacyToken(t *testing.T) {
+	h.Config.SecretKey = "secret"
+	database.SqlDatabase = &stubDatabase{}
+	database.Revocations = database.NewMemoryRevocationStore()
+	defer func() { database.SqlDatabase = nil }()
+	r := mux.NewRouter()
+	h.InstallUsersHandler(r)
+	r.Use(SecureMiddleware)
+
+	now := time.Now()
+	for name, claims := range map[string]jwt.MapClaims{
+		// as the first releases issued them: no jti, times in milliseconds
+		"baseline": {"uid": 1, "iat": now.UnixNano() / 1e6, "exp": now.Add(time.Hour).UnixNano() / 1e6},
+		"no exp":   {"uid": 1, "jti": "jti-no-exp"},
+	} {
+		token, err := jwt.NewWithClaims(h.JWT_SIGNING_METHOD, claims).SignedString([]byte(h.Config.SecretKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range []string{"/users/logout", "/users"} {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			r.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusUnauthorized, rec.Code, name+" "+path)
+		}
+	}
+	// nothing was revoked on their behalf
+	revoked, err := database.Revocations.IsTokenRevoked(context.Background(), "")
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+}
+
+func TestSecureMiddleware_PublicPaths(t *testing.T) {
+	r := mux.NewRouter()
+	reached := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	r.PathPrefix("/").HandlerFunc(reached)
+	r.Use(SecureMiddleware)
+
+	for path, want := range map[string]int{
+		"/users/login":               http.StatusNoContent,
+		"/users/register":            http.StatusNoContent,
+		"/users/refresh":             http.StatusNoContent,
+		"/users/by-username/refresh": http.StatusForbidden,
+		"/photos/1/login":            http.StatusForbidden,
+		"/webhooks/refresh":          http.StatusForbidden,
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.URL.Path = path
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, want, rec.Code, path)
+	}
+}
+
+func TestSecureMiddleware_PublicMedia(t *testing.T) {
+	storage.Blobs = storage.NewLocalStore(t.TempDir())
+	defer func() { storage.Blobs = nil }()
+	if err := storage.Blobs.Put(context.Background(), "photos/abc.png", strings.NewReader("png"), 3, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	r := mux.NewRouter()
+	h.InstallMediaHandler(r)
+	r.Use(SecureMiddleware)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/media/photos/abc.png", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "png", rec.Body.String())
+}
+
+func TestSecureMiddleware_ExpiredToken(t *testing.T) {
+	h.Config.SecretKey = "secret"
+	r := mux.NewRouter()
+	h.InstallPhotosHandler(r)
+	r.Use(SecureMiddleware)
+
+	claims := entity.MyClaims{
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(-time.Minute).Unix()},
+		Uid:            1,
+	}
+	tokenVal, err := jwt.NewWithClaims(h.JWT_SIGNING_METHOD, claims).SignedString([]byte(h.Config.SecretKey))
+	assert.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/photos", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenVal)
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func doRequest(r http.Handler, method string, url string, token string) int {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, url, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	r.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestSecureMiddleware_Logout(t *testing.T) {
+	h.Config.SecretKey = "secret"
+	database.SqlDatabase = &stubDatabase{}
+	database.Revocations = database.NewMemoryRevocationStore()
+	defer func() { database.SqlDatabase = nil }()
+
+	r := mux.NewRouter()
+	h.InstallUsersHandler(r)
+	r.Use(SecureMiddleware)
+
+	token := newToken(t, 1)
+	other := newToken(t, 1)
+	assert.Equal(t, http.StatusOK, doRequest(r, http.MethodPost, "/users/logout", token))
+	assert.Equal(t, http.StatusUnauthorized, doRequest(r, http.MethodPost, "/users/logout", token))
+	// other sessions of the same user are left alone
+	assert.Equal(t, http.StatusOK, doRequest(r, http.MethodPost, "/users/logout", other))
+}
+
+func TestSecureMiddleware_LogoutAll(t *testing.T) {
+	h.Config.SecretKey = "secret"
+	database.SqlDatabase = &stubDatabase{}
+	database.Revocations = database.NewMemoryRevocationStore()
+	defer func() { database.SqlDatabase = nil }()
+
+	r := mux.NewRouter()
+	h.InstallUsersHandler(r)
+	r.Use(SecureMiddleware)
+
+	first := newToken(t, 1)
+	second := newToken(t, 1)
+	stranger := newToken(t, 2)
+	assert.Equal(t, http.StatusOK, doRequest(r, http.MethodPost, "/users/logout-all", first))
+	assert.Equal(t, http.StatusUnauthorized, doRequest(r, http.MethodPost, "/users/logout", first))
+	assert.Equal(t, http.StatusUnauthorized, doRequest(r, http.MethodPost, "/users/logout", second))
+	assert.Equal(t, http.StatusOK, doRequest(r, http.MethodPost, "/users/logout", stranger))
+}
+
+func TestWriteTimeout(t *testing.T) {
+	r := mux.NewRouter()
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+		h.WriteJsonResp(w, h.Success, "done")
+	}
+	r.HandleFunc("/slow", slow)
+	r.HandleFunc("/stream", slow).Name(h.StreamRoute)
+	r.HandleFunc("/media/{key:.+}", slow).Name(h.MediaRoute)
+	r.Use(WriteTimeout(10*time.Millisecond, h.StreamRoute, h.MediaRoute))
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.JSONEq(t, `{"status":503,"data":"TIMEOUT"}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/media/photos/abc.jpg", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
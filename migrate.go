@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"mygram/database"
+	"os"
+)
+
+const migrateUsage = "usage: mygram [-driver name] migrate up|down|status"
+
+// runMigrate implements `mygram migrate up|down|status` and returns the exit code.
+func runMigrate(db database.DatabaseIface, args []string) int {
+	m, ok := db.(database.Migrator)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "this database driver has no schema to migrate")
+		return 1
+	}
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := m.MigrateUp(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied %s\n", migration)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	case "down":
+		migration, err := m.MigrateDown(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if migration == nil {
+			fmt.Println("no migration to roll back")
+		} else {
+			fmt.Printf("rolled back %s\n", migration)
+		}
+	case "status":
+		status, err := m.MigrationStatus(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, migration := range status {
+			state := "pending"
+			if migration.Applied() {
+				state = "applied " + migration.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%s\t%s\n", migration, state)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
+
+// checkSchema refuses to serve against a database that is missing migrations.
+func checkSchema(db database.DatabaseIface) error {
+	m, ok := db.(database.Migrator)
+	if !ok {
+		return nil
+	}
+	pending, err := database.PendingMigrations(context.Background(), m)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is behind by %d migration(s), starting with %s; run `mygram migrate up` first", len(pending), pending[0])
+	}
+	return nil
+}
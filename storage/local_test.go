@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidKey(t *testing.T) {
+	for _, key := range []string{"a", "photos/abc.jpg", "photos/2024/a_b-c.png"} {
+		assert.True(t, ValidKey(key), key)
+	}
+	for _, key := range []string{"", "/abc", "abc/", "photos//abc", "../abc", "photos/./abc", "Photos/abc", "photos/a b", `photos\abc`, strings.Repeat("a", 513)} {
+		assert.False(t, ValidKey(key), key)
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := NewLocalStore(dir)
+
+	require.NoError(t, s.Put(ctx, "photos/abc.png", strings.NewReader("png"), 3, "image/png"))
+	body, info, err := s.Get(ctx, "photos/abc.png")
+	require.NoError(t, err)
+	b, err := io.ReadAll(body)
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	assert.Equal(t, "png", string(b))
+	assert.Equal(t, int64(3), info.Size)
+	assert.Equal(t, "image/png", info.ContentType)
+	assert.Regexp(t, `^"[0-9a-f]+-3"$`, info.ETag)
+
+	// a short upload leaves nothing behind
+	err = s.Put(ctx, "photos/short.png", strings.NewReader("pn"), 3, "image/png")
+	assert.Error(t, err)
+	_, _, err = s.Get(ctx, "photos/short.png")
+	assert.ErrorIs(t, err, ErrNotFound)
+	entries, err := os.ReadDir(filepath.Join(dir, "photos"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	_, _, err = s.Get(ctx, "photos")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, s.Put(ctx, "../escape.png", strings.NewReader("png"), 3, "image/png"), ErrInvalidKey)
+
+	require.NoError(t, s.Delete(ctx, "photos/abc.png"))
+	_, _, err = s.Get(ctx, "photos/abc.png")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, s.Delete(ctx, "photos/abc.png"))
+}
@@ -0,0 +1,60 @@
+// Package storage keeps the files users upload, such as photos, behind the
+// BlobStore interface, on the local filesystem or in an S3-compatible bucket.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when there is no blob with the key.
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned for a key ValidKey refuses.
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore keeps blobs by key. A key is written once and never changed, so
+// what is read back may be cached for good.
+type BlobStore interface {
+	// Put stores the size bytes of body under key.
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get reads the blob under key. The caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error)
+	// Delete removes the blob under key, if there is one.
+	Delete(ctx context.Context, key string) error
+}
+
+// BlobInfo describes a stored blob.
+type BlobInfo struct {
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+	// ETag is quoted, ready for the header.
+	ETag string
+}
+
+// Blobs is where uploads are kept.
+var Blobs BlobStore
+
+// ValidKey tells whether key is safe for every store: slash separated
+// segments of lower case letters, digits, '.', '-' and '_', none of them
+// empty, "." or "..".
+func ValidKey(key string) bool {
+	if key == "" || len(key) > 512 {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+		for _, c := range segment {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
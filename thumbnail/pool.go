@@ -0,0 +1,55 @@
+package thumbnail
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// Queue is where uploads are queued for their variants. While it is nil they
+// stay processing.
+var Queue *Pool
+
+// Pool runs jobs on a fixed number of workers, behind a queue of bounded
+// length, so a burst of uploads can't decode more images at once than the
+// server has room for.
+type Pool struct {
+	jobs chan Job
+	wg   sync.WaitGroup
+}
+
+// NewPool starts workers running process on the jobs submitted, with room
+// for queue of them to wait. Errors are logged: the photo stays processing
+// and is queued again when the server restarts.
+func NewPool(workers int, queue int, process func(ctx context.Context, job Job) error) *Pool {
+	p := &Pool{jobs: make(chan Job, queue)}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				if err := process(context.Background(), job); err != nil {
+					log.Printf("thumbnail: photo %d: %v", job.PhotoID, err)
+				}
+			}
+		}()
+	}
+	return p
+}
+
+// Submit queues job, waiting while the queue is full until ctx is done.
+func (p *Pool) Submit(ctx context.Context, job Job) error {
+	select {
+	case p.jobs <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close waits for the jobs queued to be done. Nothing may be submitted
+// after.
+func (p *Pool) Close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
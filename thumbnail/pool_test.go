@@ -0,0 +1,56 @@
+package thumbnail
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool(t *testing.T) {
+	var mu sync.Mutex
+	var running, most int
+	var done int32
+	p := NewPool(2, 4, func(ctx context.Context, job Job) error {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		atomic.AddInt32(&done, 1)
+		return nil
+	})
+	for i := 0; i < 10; i++ {
+		require.NoError(t, p.Submit(context.Background(), Job{PhotoID: int64(i)}))
+	}
+	p.Close()
+	assert.Equal(t, int32(10), atomic.LoadInt32(&done))
+	assert.Equal(t, 2, most)
+}
+
+func TestPool_SubmitFull(t *testing.T) {
+	release := make(chan struct{})
+	p := NewPool(1, 1, func(ctx context.Context, job Job) error {
+		<-release
+		return nil
+	})
+	defer p.Close()
+	defer close(release)
+	// one job running, one waiting
+	require.NoError(t, p.Submit(context.Background(), Job{PhotoID: 1}))
+	require.Eventually(t, func() bool { return len(p.jobs) == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, p.Submit(context.Background(), Job{PhotoID: 2}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, p.Submit(ctx, Job{PhotoID: 3}), context.DeadlineExceeded)
+}
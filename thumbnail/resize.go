@@ -0,0 +1,78 @@
+package thumbnail
+
+import (
+	"image"
+	"image/draw"
+)
+
+// fit is the size of a w×h image scaled down to fit in max×max, keeping its
+// aspect ratio. An image that fits already keeps its size.
+func fit(w int, h int, max int) (int, int) {
+	if w <= max && h <= max {
+		return w, h
+	}
+	if w >= h {
+		return max, atLeastOne((h*max + w/2) / w)
+	}
+	return atLeastOne((w*max + h/2) / h), max
+}
+
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// flatten draws img over white, as JPEG has no transparency, into an RGBA
+// image whose bounds start at the origin.
+func flatten(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// resize scales the opaque src down to w×h. Each pixel is the average of
+// the ones it covers, which keeps the detail of a large reduction that
+// sampling would alias away.
+func resize(src *image.RGBA, w int, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if w == sw && h == sh {
+		return src
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := span(y, h, sh)
+		for x := 0; x < w; x++ {
+			x0, x1 := span(x, w, sw)
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint64(row[i])
+					g += uint64(row[i+1])
+					b += uint64(row[i+2])
+				}
+				n += uint64(x1 - x0)
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8((r + n/2) / n)
+			dst.Pix[i+1] = uint8((g + n/2) / n)
+			dst.Pix[i+2] = uint8((b + n/2) / n)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+	return dst
+}
+
+// span is the range of the source pixels, out of size, that pixel i of n
+// covers. It is never empty.
+func span(i int, n int, size int) (int, int) {
+	lo, hi := i*size/n, (i+1)*size/n
+	if hi == lo {
+		hi = lo + 1
+	}
+	return lo, hi
+}
@@ -0,0 +1,56 @@
+package thumbnail
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFit(t *testing.T) {
+	for _, c := range []struct{ w, h, max, wantW, wantH int }{
+		{100, 50, 160, 100, 50},
+		{160, 160, 160, 160, 160},
+		{4000, 3000, 1280, 1280, 960},
+		{3000, 4000, 640, 480, 640},
+		{10000, 10, 160, 160, 1},
+	} {
+		w, h := fit(c.w, c.h, c.max)
+		assert.Equal(t, [2]int{c.wantW, c.wantH}, [2]int{w, h}, "%dx%d in %d", c.w, c.h, c.max)
+	}
+}
+
+func TestResize(t *testing.T) {
+	red, blue := color.RGBA{0xff, 0, 0, 0xff}, color.RGBA{0, 0, 0xff, 0xff}
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 2; y++ {
+			if x < 2 {
+				src.Set(x, y, red)
+			} else {
+				src.Set(x, y, blue)
+			}
+		}
+	}
+	dst := resize(src, 2, 1)
+	assert.Equal(t, image.Rect(0, 0, 2, 1), dst.Bounds())
+	assert.Equal(t, red, dst.RGBAAt(0, 0))
+	assert.Equal(t, blue, dst.RGBAAt(1, 0))
+
+	// a pixel covering a red and a blue one is their average
+	dst = resize(src, 1, 1)
+	assert.Equal(t, color.RGBA{0x80, 0, 0x80, 0xff}, dst.RGBAAt(0, 0))
+
+	assert.Same(t, src, resize(src, 4, 2))
+}
+
+func TestFlatten(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(10, 10, 12, 11))
+	src.Set(11, 10, color.NRGBA{0, 0, 0, 0xff})
+	dst := flatten(src)
+	assert.Equal(t, image.Rect(0, 0, 2, 1), dst.Bounds())
+	// transparent is white, as JPEG can't tell
+	assert.Equal(t, color.RGBA{0xff, 0xff, 0xff, 0xff}, dst.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{0, 0, 0, 0xff}, dst.RGBAAt(1, 0))
+}
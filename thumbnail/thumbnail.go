@@ -0,0 +1,166 @@
+// Package thumbnail makes the scaled down variants of uploaded photos in the
+// background, so feeds needn't download the originals.
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"mygram/database"
+	"mygram/entity"
+	"mygram/storage"
+	"path"
+	"strings"
+)
+
+// The sizes of the variants, as the square they are scaled down to fit.
+const (
+	ThumbnailSize = 160
+	MediumSize    = 640
+	LargeSize     = 1280
+)
+
+// MaxPixels bounds the images decoded, so a small file claiming to be a huge
+// image can't exhaust the memory. Decoded and flattened, one takes up to
+// 8 bytes a pixel, about 200 MB, on each worker of a Pool.
+const MaxPixels = 24_000_000
+
+// quality is the JPEG quality of the variants.
+const quality = 85
+
+// ErrUndecodable is returned for an upload that is not an image this package
+// can decode, which is JPEG, PNG and GIF.
+var ErrUndecodable = errors.New("thumbnail: undecodable image")
+
+// Job asks for the variants of the photo PhotoID, uploaded under Key.
+type Job struct {
+	PhotoID int64
+	Key     string
+}
+
+// VariantStore records the variants. database.SqlDatabase implements it.
+type VariantStore interface {
+	SetPhotoVariants(ctx context.Context, id int64, photoURL string, state entity.ProcessingState, variants *entity.PhotoVariants) error
+}
+
+// Generator makes the variants of uploads kept in Blobs and records them in
+// DB.
+type Generator struct {
+	Blobs storage.BlobStore
+	DB    VariantStore
+	// URL tells where the blob under a key is served.
+	URL func(key string) string
+}
+
+type variant struct {
+	name string
+	size int
+	url  *string
+}
+
+func variants(v *entity.PhotoVariants) []variant {
+	return []variant{
+		{"thumbnail", ThumbnailSize, &v.Thumbnail},
+		{"medium", MediumSize, &v.Medium},
+		{"large", LargeSize, &v.Large},
+	}
+}
+
+// VariantKey is the key of the variant name of the upload under key, next
+// to it.
+func VariantKey(key string, name string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + "_" + name + ".jpg"
+}
+
+// VariantKeys are the keys of every variant of the upload under key.
+func VariantKeys(key string) []string {
+	var keys []string
+	for _, v := range variants(&entity.PhotoVariants{}) {
+		keys = append(keys, VariantKey(key, v.name))
+	}
+	return keys
+}
+
+// Process makes the variants of job and records them, or records the photo
+// failed when its upload can't be decoded. Variants made for a photo that
+// was deleted, or given another photo_url, meanwhile are removed again, and
+// so are those made before a failure: the photo is still processing, and
+// the job is run again when the server restarts.
+func (g *Generator) Process(ctx context.Context, job Job) error {
+	img, err := g.decode(ctx, job.Key)
+	if errors.Is(err, ErrUndecodable) {
+		return g.record(ctx, job, entity.ProcessingFailed, nil)
+	}
+	if err != nil {
+		return err
+	}
+	flat := flatten(img)
+	result := &entity.PhotoVariants{}
+	for _, v := range variants(result) {
+		key := VariantKey(job.Key, v.name)
+		w, h := fit(flat.Bounds().Dx(), flat.Bounds().Dy(), v.size)
+		var b bytes.Buffer
+		if err := jpeg.Encode(&b, resize(flat, w, h), &jpeg.Options{Quality: quality}); err != nil {
+			return g.deleteVariants(ctx, job, err)
+		}
+		if err := g.Blobs.Put(ctx, key, &b, int64(b.Len()), "image/jpeg"); err != nil {
+			return g.deleteVariants(ctx, job, err)
+		}
+		*v.url = g.URL(key)
+	}
+	return g.record(ctx, job, entity.ProcessingReady, result)
+}
+
+func (g *Generator) decode(ctx context.Context, key string) (image.Image, error) {
+	body, _, err := g.Blobs.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %v", ErrUndecodable, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUndecodable, err)
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d is too large", ErrUndecodable, config.Width, config.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUndecodable, err)
+	}
+	return img, nil
+}
+
+// record records the variants of job, unless the photo has moved on from
+// the upload of job: it has then no use for them.
+func (g *Generator) record(ctx context.Context, job Job, state entity.ProcessingState, result *entity.PhotoVariants) error {
+	err := g.DB.SetPhotoVariants(ctx, job.PhotoID, g.URL(job.Key), state, result)
+	if !errors.Is(err, database.ErrNotFound) {
+		return err
+	}
+	return g.deleteVariants(ctx, job, nil)
+}
+
+// deleteVariants removes the variants made for job, and returns cause
+// unless that fails too.
+func (g *Generator) deleteVariants(ctx context.Context, job Job, cause error) error {
+	for _, key := range VariantKeys(job.Key) {
+		if err := g.Blobs.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return cause
+}
@@ -0,0 +1,214 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"mygram/database"
+	"mygram/entity"
+	"mygram/storage"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newGenerator(t *testing.T) (*Generator, database.DatabaseIface) {
+	db := database.NewMemoryDatabase()
+	g := &Generator{
+		Blobs: storage.NewLocalStore(t.TempDir()),
+		DB:    db,
+		URL:   func(key string) string { return "/media/" + key },
+	}
+	return g, db
+}
+
+// upload stores a w×h PNG under key and posts it as a photo still processing.
+func upload(t *testing.T, g *Generator, db database.DatabaseIface, key string, w int, h int) int64 {
+	ctx := context.Background()
+	var b bytes.Buffer
+	require.NoError(t, png.Encode(&b, image.NewGray(image.Rect(0, 0, w, h))))
+	require.NoError(t, g.Blobs.Put(ctx, key, &b, int64(b.Len()), "image/png"))
+	return post(t, db, key)
+}
+
+func post(t *testing.T, db database.DatabaseIface, key string) int64 {
+	ctx := context.Background()
+	u, err := db.Register(ctx, entity.UserRegister{Username: "owner" + strings.NewReplacer("/", "", ".", "").Replace(key), Email: key + "@email.com", Password: "hash", Age: 20})
+	require.NoError(t, err)
+	p, err := db.PostPhoto(ctx, int64(u.ID), entity.PhotoPost{Title: "title", PhotoUrl: "/media/" + key, Processing: entity.ProcessingPending})
+	require.NoError(t, err)
+	return p.ID
+}
+
+func TestVariantKeys(t *testing.T) {
+	assert.Equal(t, "photos/abc_medium.jpg", VariantKey("photos/abc.png", "medium"))
+	assert.Equal(t, []string{"photos/abc_thumbnail.jpg", "photos/abc_medium.jpg", "photos/abc_large.jpg"}, VariantKeys("photos/abc.png"))
+}
+
+func TestGenerator_Process(t *testing.T) {
+	ctx := context.Background()
+	g, db := newGenerator(t)
+	id := upload(t, g, db, "photos/wide.png", 2000, 1000)
+
+	require.NoError(t, g.Process(ctx, Job{PhotoID: id, Key: "photos/wide.png"}))
+	p, err := db.GetPhotoByID(ctx, 0, id)
+	require.NoError(t, err)
+	assert.Equal(t, entity.ProcessingReady, p.Processing)
+	assert.Equal(t, &entity.PhotoVariants{
+		Thumbnail: "/media/photos/wide_thumbnail.jpg",
+		Medium:    "/media/photos/wide_medium.jpg",
+		Large:     "/media/photos/wide_large.jpg",
+	}, p.Variants)
+	for key, size := range map[string][2]int{
+		"photos/wide_thumbnail.jpg": {160, 80},
+		"photos/wide_medium.jpg":    {640, 320},
+		"photos/wide_large.jpg":     {1280, 640},
+	} {
+		body, info, err := g.Blobs.Get(ctx, key)
+		require.NoError(t, err, key)
+		config, format, err := image.DecodeConfig(body)
+		require.NoError(t, body.Close())
+		require.NoError(t, err, key)
+		assert.Equal(t, "jpeg", format)
+		assert.Equal(t, "image/jpeg", info.ContentType)
+		assert.Equal(t, size, [2]int{config.Width, config.Height}, key)
+	}
+}
+
+func TestGenerator_ProcessSmall(t *testing.T) {
+	ctx := context.Background()
+	g, db := newGenerator(t)
+	id := upload(t, g, db, "photos/small.png", 300, 200)
+
+	require.NoError(t, g.Process(ctx, Job{PhotoID: id, Key: "photos/small.png"}))
+	// nothing is scaled up
+	for key, size := range map[string][2]int{
+		"photos/small_thumbnail.jpg": {160, 107},
+		"photos/small_medium.jpg":    {300, 200},
+		"photos/small_large.jpg":     {300, 200},
+	} {
+		body, _, err := g.Blobs.Get(ctx, key)
+		require.NoError(t, err, key)
+		config, _, err := image.DecodeConfig(body)
+		require.NoError(t, body.Close())
+		require.NoError(t, err, key)
+		assert.Equal(t, size, [2]int{config.Width, config.Height}, key)
+	}
+}
+
+func TestGenerator_ProcessUndecodable(t *testing.T) {
+	ctx := context.Background()
+	g, db := newGenerator(t)
+	require.NoError(t, g.Blobs.Put(ctx, "photos/bad.png", strings.NewReader("not a png"), 9, "image/png"))
+	id := post(t, db, "photos/bad.png")
+
+	require.NoError(t, g.Process(ctx, Job{PhotoID: id, Key: "photos/bad.png"}))
+	p, err := db.GetPhotoByID(ctx, 0, id)
+	require.NoError(t, err)
+	assert.Equal(t, entity.ProcessingFailed, p.Processing)
+	assert.Nil(t, p.Variants)
+
+	// WebP has no decoder, so one stored before it was refused fails too
+	require.NoError(t, g.Blobs.Put(ctx, "photos/old.webp", strings.NewReader("RIFF\x1a\x00\x00\x00WEBPVP8L\x0d\x00\x00\x00\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00"), 34, "image/webp"))
+	webp := post(t, db, "photos/old.webp")
+	require.NoError(t, g.Process(ctx, Job{PhotoID: webp, Key: "photos/old.webp"}))
+	p, err = db.GetPhotoByID(ctx, 0, webp)
+	require.NoError(t, err)
+	assert.Equal(t, entity.ProcessingFailed, p.Processing)
+
+	missing := post(t, db, "photos/missing.png")
+	require.NoError(t, g.Process(ctx, Job{PhotoID: missing, Key: "photos/missing.png"}))
+	p, err = db.GetPhotoByID(ctx, 0, missing)
+	require.NoError(t, err)
+	assert.Equal(t, entity.ProcessingFailed, p.Processing)
+}
+
+func TestGenerator_DecodeTooLarge(t *testing.T) {
+	ctx := context.Background()
+	g, _ := newGenerator(t)
+	// A tiny PNG whose header claims 6000×4001, just over MaxPixels.
+	var b bytes.Buffer
+	require.NoError(t, png.Encode(&b, image.NewGray(image.Rect(0, 0, 1, 1))))
+	img := b.Bytes()
+	ihdr := img[12:29]
+	binary.BigEndian.PutUint32(ihdr[4:], 6000)
+	binary.BigEndian.PutUint32(ihdr[8:], 4001)
+	binary.BigEndian.PutUint32(img[29:], crc32.ChecksumIEEE(ihdr))
+	require.NoError(t, g.Blobs.Put(ctx, "photos/huge.png", bytes.NewReader(img), int64(len(img)), "image/png"))
+
+	_, err := g.decode(ctx, "photos/huge.png")
+	assert.ErrorIs(t, err, ErrUndecodable)
+	assert.Contains(t, err.Error(), "6000x4001 is too large")
+}
+
+func TestGenerator_ProcessDeleted(t *testing.T) {
+	ctx := context.Background()
+	g, db := newGenerator(t)
+	id := upload(t, g, db, "photos/gone.png", 200, 200)
+	p, err := db.GetPhotoByID(ctx, 0, id)
+	require.NoError(t, err)
+	_, err = db.DeletePhoto(ctx, p.UserID, id)
+	require.NoError(t, err)
+
+	require.NoError(t, g.Process(ctx, Job{PhotoID: id, Key: "photos/gone.png"}))
+	for _, key := range VariantKeys("photos/gone.png") {
+		_, _, err := g.Blobs.Get(ctx, key)
+		assert.ErrorIs(t, err, storage.ErrNotFound, key)
+	}
+}
+
+func TestGenerator_ProcessMovedOn(t *testing.T) {
+	ctx := context.Background()
+	g, db := newGenerator(t)
+	id := upload(t, g, db, "photos/moved.png", 200, 200)
+	p, err := db.GetPhotoByID(ctx, 0, id)
+	require.NoError(t, err)
+	_, err = db.UpdatePhoto(ctx, p.UserID, id, entity.PhotoPost{Title: p.Title, PhotoUrl: "https://photo.domain.com"})
+	require.NoError(t, err)
+
+	require.NoError(t, g.Process(ctx, Job{PhotoID: id, Key: "photos/moved.png"}))
+	for _, key := range VariantKeys("photos/moved.png") {
+		_, _, err := g.Blobs.Get(ctx, key)
+		assert.ErrorIs(t, err, storage.ErrNotFound, key)
+	}
+	p, err = db.GetPhotoByID(ctx, 0, id)
+	require.NoError(t, err)
+	assert.Equal(t, entity.ProcessingNone, p.Processing)
+	assert.Nil(t, p.Variants)
+}
+
+// failingPuts fails to store the blobs under keys ending in suffix.
+type failingPuts struct {
+	storage.BlobStore
+	suffix string
+}
+
+func (s failingPuts) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	if strings.HasSuffix(key, s.suffix) {
+		return errors.New("disk full")
+	}
+	return s.BlobStore.Put(ctx, key, body, size, contentType)
+}
+
+func TestGenerator_ProcessFailsMidway(t *testing.T) {
+	ctx := context.Background()
+	g, db := newGenerator(t)
+	id := upload(t, g, db, "photos/midway.png", 200, 200)
+	g.Blobs = failingPuts{BlobStore: g.Blobs, suffix: "_large.jpg"}
+
+	assert.EqualError(t, g.Process(ctx, Job{PhotoID: id, Key: "photos/midway.png"}), "disk full")
+	for _, key := range VariantKeys("photos/midway.png") {
+		_, _, err := g.Blobs.Get(ctx, key)
+		assert.ErrorIs(t, err, storage.ErrNotFound, key)
+	}
+	p, err := db.GetPhotoByID(ctx, 0, id)
+	require.NoError(t, err)
+	assert.Equal(t, entity.ProcessingPending, p.Processing)
+}
@@ -0,0 +1,201 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"mygram/database"
+	"mygram/entity"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultInterval    = 5 * time.Second
+	DefaultMaxAttempts = 8
+	DefaultBatch       = 50
+	// DefaultTimeout bounds one attempt, and is well within the lease of a
+	// claimed delivery.
+	DefaultTimeout = 10 * time.Second
+	// DefaultRetention is how long delivered events are kept.
+	DefaultRetention = 7 * 24 * time.Hour
+
+	pruneInterval = time.Hour
+
+	backoffBase = 30 * time.Second
+	backoffMax  = time.Hour
+)
+
+// Dispatcher moves the outbox into deliveries and sends those that are due.
+// More than one may run against the same database: each event and each
+// attempt is claimed by exactly one of them.
+type Dispatcher struct {
+	DB          database.WebhookOutbox
+	Client      *http.Client
+	Interval    time.Duration
+	MaxAttempts int
+	Batch       int
+	// Lease is how long a claimed delivery is left to its dispatcher. One
+	// that crashed mid-attempt has it tried again once the lease is up.
+	Lease time.Duration
+	// Retention is how long delivered deliveries, and events with nothing
+	// left to deliver, are kept before they are pruned. Zero keeps them.
+	Retention time.Duration
+	// Now tells the time; tests replace it.
+	Now func() time.Time
+
+	pruned time.Time
+}
+
+func NewDispatcher(db database.WebhookOutbox) *Dispatcher {
+	return &Dispatcher{
+		DB:          db,
+		Client:      &http.Client{Timeout: DefaultTimeout, CheckRedirect: noRedirect},
+		Interval:    DefaultInterval,
+		MaxAttempts: DefaultMaxAttempts,
+		Batch:       DefaultBatch,
+		Lease:       6 * DefaultTimeout,
+		Retention:   DefaultRetention,
+		Now:         time.Now,
+	}
+}
+
+// noRedirect fails an attempt answered with a redirect instead of following
+// it: the events are for the URL the webhook was made with, and a redirect
+// could take them anywhere.
+func noRedirect(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// Backoff is how long to wait after the attempts-th failed attempt: 30s,
+// doubling each time, up to an hour.
+func Backoff(attempts int) time.Duration {
+	d := backoffBase
+	for i := 1; i < attempts && d < backoffMax; i++ {
+		d *= 2
+	}
+	if d > backoffMax {
+		d = backoffMax
+	}
+	return d
+}
+
+// Run dispatches every Interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		if err := d.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("webhook: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce turns the whole outbox into deliveries, then makes one attempt at
+// up to Batch of the deliveries that are due. About once an hour it prunes
+// what is older than Retention first.
+func (d *Dispatcher) RunOnce(ctx context.Context) error {
+	if now := d.Now(); d.Retention > 0 && now.Sub(d.pruned) >= pruneInterval {
+		if err := d.DB.PruneWebhookOutbox(ctx, now.Add(-d.Retention)); err != nil {
+			return err
+		}
+		d.pruned = now
+	}
+	for {
+		n, err := d.DB.DispatchOutbox(ctx, d.Now(), d.Batch)
+		if err != nil {
+			return err
+		}
+		if n < d.Batch {
+			break
+		}
+	}
+	due, err := d.DB.ClaimWebhookDeliveries(ctx, d.Now(), d.Lease, d.Batch)
+	if err != nil {
+		return err
+	}
+	// One slow webhook holds up no other.
+	var wg sync.WaitGroup
+	errs := make([]error, len(due))
+	for i := range due {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = d.DB.UpdateWebhookDelivery(ctx, d.attempt(ctx, due[i]))
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attempt sends delivery once, and is delivery updated with how it went.
+func (d *Dispatcher) attempt(ctx context.Context, delivery entity.WebhookDelivery) entity.WebhookDelivery {
+	status, err := d.send(ctx, delivery)
+	now := d.Now()
+	delivery.Attempts++
+	delivery.LastStatus = status
+	delivery.LastError = ""
+	switch {
+	case err == nil:
+		delivery.Status = entity.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		return delivery
+	case delivery.Attempts >= d.MaxAttempts:
+		delivery.Status = entity.DeliveryDead
+	default:
+		delivery.NextAttemptAt = now.Add(Backoff(delivery.Attempts))
+	}
+	delivery.LastError = err.Error()
+	return delivery
+}
+
+// send posts delivery to its webhook. status is 0 when there was no answer.
+func (d *Dispatcher) send(ctx context.Context, delivery entity.WebhookDelivery) (status int, err error) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := d.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mygram-webhook")
+	req.Header.Set(HeaderEvent, string(delivery.Event.Type))
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, body))
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Read some of the body, so the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, &statusError{resp.Status}
+	}
+	return resp.StatusCode, nil
+}
+
+// statusError is an answer other than 2xx.
+type statusError struct {
+	status string
+}
+
+func (e *statusError) Error() string { return e.status }
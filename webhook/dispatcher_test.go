@@ -0,0 +1,228 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mygram/database"
+	"mygram/entity"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receiver is a webhook endpoint answering status.
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	w.WriteHeader(rc.status)
+}
+
+func (rc *receiver) received() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.requests)
+}
+
+// newTestDispatcher is a dispatcher whose clock stands still until moved.
+func newTestDispatcher(db database.WebhookOutbox, now *time.Time) *Dispatcher {
+	d := NewDispatcher(db)
+	d.Now = func() time.Time { return *now }
+	return d
+}
+
+func setup(t *testing.T, status int) (database.DatabaseIface, *receiver, *entity.Webhook, int64) {
+	ctx := context.Background()
+	db := database.NewMemoryDatabase()
+	rc := &receiver{status: status}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+	u, err := db.Register(ctx, entity.UserRegister{Username: "partner", Email: "partner@email.com", Password: "hash", Age: 20})
+	require.NoError(t, err)
+	w, err := db.PostWebhook(ctx, int64(u.ID), entity.WebhookPost{URL: srv.URL, Events: []entity.WebhookEventType{entity.EventPhotoCreated}}, "s3cret")
+	require.NoError(t, err)
+	return db, rc, w, int64(u.ID)
+}
+
+func TestDispatcher(t *testing.T) {
+	ctx := context.Background()
+	db, rc, w, userid := setup(t, http.StatusNoContent)
+	now := time.Now()
+	d := newTestDispatcher(db, &now)
+
+	p, err := db.PostPhoto(ctx, userid, entity.PhotoPost{Title: "hooked", PhotoUrl: "https://photo.domain.com"})
+	require.NoError(t, err)
+	_, err = db.DeletePhoto(ctx, userid, p.ID)
+	require.NoError(t, err)
+	require.NoError(t, d.RunOnce(ctx))
+
+	// only what the webhook subscribed to is sent, once
+	require.Equal(t, 1, rc.received())
+	require.NoError(t, d.RunOnce(ctx))
+	require.Equal(t, 1, rc.received())
+
+	r, body := rc.requests[0], rc.bodies[0]
+	assert.Equal(t, http.MethodPost, r.Method)
+	assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+	assert.Equal(t, "photo.created", r.Header.Get(HeaderEvent))
+	assert.NotEmpty(t, r.Header.Get(HeaderDelivery))
+	assert.True(t, Verify("s3cret", r.Header.Get(HeaderTimestamp), body, r.Header.Get(HeaderSignature), time.Minute, now))
+	var event entity.WebhookEvent
+	require.NoError(t, json.Unmarshal(body, &event))
+	assert.Equal(t, entity.EventPhotoCreated, event.Type)
+	assert.NotZero(t, event.ID)
+	var photo entity.Photo
+	require.NoError(t, json.Unmarshal(event.Data, &photo))
+	assert.Equal(t, p.ID, photo.ID)
+
+	delivered, err := db.GetWebhookDeliveries(ctx, w.ID, entity.DeliveryDelivered, entity.PageRequest{})
+	require.NoError(t, err)
+	require.Len(t, delivered.Items, 1)
+	assert.Equal(t, 1, delivered.Items[0].Attempts)
+	assert.Equal(t, http.StatusNoContent, delivered.Items[0].LastStatus)
+	assert.NotNil(t, delivered.Items[0].DeliveredAt)
+}
+
+func TestDispatcher_Retries(t *testing.T) {
+	ctx := context.Background()
+	db, rc, w, userid := setup(t, http.StatusInternalServerError)
+	now := time.Now()
+	d := newTestDispatcher(db, &now)
+	d.MaxAttempts = 3
+
+	_, err := db.PostPhoto(ctx, userid, entity.PhotoPost{Title: "hooked", PhotoUrl: "https://photo.domain.com"})
+	require.NoError(t, err)
+	require.NoError(t, d.RunOnce(ctx))
+	require.Equal(t, 1, rc.received())
+
+	// nothing is sent again before the backoff is up
+	now = now.Add(Backoff(1) - time.Second)
+	require.NoError(t, d.RunOnce(ctx))
+	assert.Equal(t, 1, rc.received())
+	now = now.Add(time.Second)
+	require.NoError(t, d.RunOnce(ctx))
+	assert.Equal(t, 2, rc.received())
+	pending, err := db.GetWebhookDeliveries(ctx, w.ID, entity.DeliveryPending, entity.PageRequest{})
+	require.NoError(t, err)
+	require.Len(t, pending.Items, 1)
+	assert.Equal(t, 2, pending.Items[0].Attempts)
+	assert.Equal(t, now.Add(Backoff(2)), pending.Items[0].NextAttemptAt)
+
+	// the last attempt lands it on the dead-letter list
+	now = now.Add(Backoff(2))
+	require.NoError(t, d.RunOnce(ctx))
+	assert.Equal(t, 3, rc.received())
+	now = now.Add(backoffMax)
+	require.NoError(t, d.RunOnce(ctx))
+	assert.Equal(t, 3, rc.received())
+	dead, err := db.GetWebhookDeliveries(ctx, w.ID, entity.DeliveryDead, entity.PageRequest{})
+	require.NoError(t, err)
+	require.Len(t, dead.Items, 1)
+	assert.Equal(t, 3, dead.Items[0].Attempts)
+	assert.Equal(t, http.StatusInternalServerError, dead.Items[0].LastStatus)
+	assert.Equal(t, "500 Internal Server Error", dead.Items[0].LastError)
+
+	// retried by hand, it goes through once the webhook is back
+	rc.mu.Lock()
+	rc.status = http.StatusOK
+	rc.mu.Unlock()
+	_, err = db.RetryWebhookDelivery(ctx, dead.Items[0].ID)
+	require.NoError(t, err)
+	now = time.Now().Add(time.Second)
+	require.NoError(t, d.RunOnce(ctx))
+	assert.Equal(t, 4, rc.received())
+	delivered, err := db.GetWebhookDeliveries(ctx, w.ID, entity.DeliveryDelivered, entity.PageRequest{})
+	require.NoError(t, err)
+	require.Len(t, delivered.Items, 1)
+	assert.Equal(t, 1, delivered.Items[0].Attempts)
+	assert.Equal(t, "", delivered.Items[0].LastError)
+}
+
+func TestDispatcher_Unreachable(t *testing.T) {
+	ctx := context.Background()
+	db, _, w, userid := setup(t, http.StatusOK)
+	now := time.Now()
+	d := newTestDispatcher(db, &now)
+	_, err := db.DeleteWebhook(ctx, w.ID)
+	require.NoError(t, err)
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+	w, err = db.PostWebhook(ctx, userid, entity.WebhookPost{URL: url, Events: []entity.WebhookEventType{entity.EventPhotoCreated}}, "s3cret")
+	require.NoError(t, err)
+
+	_, err = db.PostPhoto(ctx, userid, entity.PhotoPost{Title: "hooked", PhotoUrl: "https://photo.domain.com"})
+	require.NoError(t, err)
+	require.NoError(t, d.RunOnce(ctx))
+	pending, err := db.GetWebhookDeliveries(ctx, w.ID, entity.DeliveryPending, entity.PageRequest{})
+	require.NoError(t, err)
+	require.Len(t, pending.Items, 1)
+	assert.Equal(t, 0, pending.Items[0].LastStatus)
+	assert.NotEmpty(t, pending.Items[0].LastError)
+}
+
+func TestDispatcher_Redirect(t *testing.T) {
+	ctx := context.Background()
+	db, rc, w, userid := setup(t, http.StatusOK)
+	now := time.Now()
+	d := newTestDispatcher(db, &now)
+	_, err := db.DeleteWebhook(ctx, w.ID)
+	require.NoError(t, err)
+	target := httptest.NewServer(rc)
+	t.Cleanup(target.Close)
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	t.Cleanup(redirect.Close)
+	w, err = db.PostWebhook(ctx, userid, entity.WebhookPost{URL: redirect.URL, Events: []entity.WebhookEventType{entity.EventPhotoCreated}}, "s3cret")
+	require.NoError(t, err)
+
+	_, err = db.PostPhoto(ctx, userid, entity.PhotoPost{Title: "hooked", PhotoUrl: "https://photo.domain.com"})
+	require.NoError(t, err)
+	require.NoError(t, d.RunOnce(ctx))
+	assert.Equal(t, 0, rc.received())
+	pending, err := db.GetWebhookDeliveries(ctx, w.ID, entity.DeliveryPending, entity.PageRequest{})
+	require.NoError(t, err)
+	require.Len(t, pending.Items, 1)
+	assert.Equal(t, http.StatusTemporaryRedirect, pending.Items[0].LastStatus)
+}
+
+func TestDispatcher_Prune(t *testing.T) {
+	ctx := context.Background()
+	db, rc, w, userid := setup(t, http.StatusOK)
+	now := time.Now()
+	d := newTestDispatcher(db, &now)
+
+	_, err := db.PostPhoto(ctx, userid, entity.PhotoPost{Title: "hooked", PhotoUrl: "https://photo.domain.com"})
+	require.NoError(t, err)
+	require.NoError(t, d.RunOnce(ctx))
+	require.Equal(t, 1, rc.received())
+	delivered, err := db.GetWebhookDeliveries(ctx, w.ID, entity.DeliveryDelivered, entity.PageRequest{})
+	require.NoError(t, err)
+	require.Len(t, delivered.Items, 1)
+
+	// kept for the retention, then pruned
+	now = now.Add(DefaultRetention - time.Minute)
+	require.NoError(t, d.RunOnce(ctx))
+	delivered, err = db.GetWebhookDeliveries(ctx, w.ID, entity.DeliveryDelivered, entity.PageRequest{})
+	require.NoError(t, err)
+	assert.Len(t, delivered.Items, 1)
+	now = now.Add(pruneInterval)
+	require.NoError(t, d.RunOnce(ctx))
+	delivered, err = db.GetWebhookDeliveries(ctx, w.ID, entity.DeliveryDelivered, entity.PageRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, delivered.Items)
+}
@@ -0,0 +1,53 @@
+// Package webhook sends the events of the outbox to the webhooks subscribed
+// to them.
+//
+// Every request is a POST of the entity.WebhookEvent as JSON, signed with the
+// webhook's secret:
+//
+//	X-Mygram-Event: photo.created
+//	X-Mygram-Delivery: 42
+//	X-Mygram-Timestamp: 1700000000
+//	X-Mygram-Signature: sha256=<hex HMAC-SHA256 of "<timestamp>.<body>">
+//
+// A delivery succeeds on any 2xx answer. Otherwise it is tried again with
+// exponential backoff until MaxAttempts, then it is dead: it stays on the
+// webhook's dead-letter list until it is retried by hand.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderEvent     = "X-Mygram-Event"
+	HeaderDelivery  = "X-Mygram-Delivery"
+	HeaderTimestamp = "X-Mygram-Timestamp"
+	HeaderSignature = "X-Mygram-Signature"
+)
+
+// Sign is the X-Mygram-Signature of body sent at timestamp, in unix seconds.
+// The timestamp is signed too, so a receiver can refuse old requests replayed.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify tells whether signature is the signature of body at timestamp, and
+// timestamp is within tolerance of now. It is what a receiver runs.
+func Verify(secret string, timestamp string, body []byte, signature string, tolerance time.Duration, now time.Time) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature))
+}
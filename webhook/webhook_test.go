@@ -0,0 +1,32 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":1,"type":"photo.created"}`)
+	now := time.Unix(1700000000, 0)
+	sig := Sign("s3cret", now.Unix(), body)
+	assert.Regexp(t, "^sha256=[0-9a-f]{64}$", sig)
+
+	assert.True(t, Verify("s3cret", "1700000000", body, sig, time.Minute, now))
+	assert.True(t, Verify("s3cret", "1700000000", body, sig, time.Minute, now.Add(time.Minute)))
+	assert.False(t, Verify("other", "1700000000", body, sig, time.Minute, now), "wrong secret")
+	assert.False(t, Verify("s3cret", "1700000000", []byte(`{"id":2,"type":"photo.created"}`), sig, time.Minute, now), "tampered body")
+	assert.False(t, Verify("s3cret", "1700000001", body, sig, time.Minute, now), "tampered timestamp")
+	assert.False(t, Verify("s3cret", "1700000000", body, sig, time.Minute, now.Add(2*time.Minute)), "replayed")
+	assert.False(t, Verify("s3cret", "soon", body, sig, time.Minute, now))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, Backoff(1))
+	assert.Equal(t, time.Minute, Backoff(2))
+	assert.Equal(t, 4*time.Minute, Backoff(4))
+	assert.Equal(t, 32*time.Minute, Backoff(7))
+	assert.Equal(t, time.Hour, Backoff(8))
+	assert.Equal(t, time.Hour, Backoff(100))
+}